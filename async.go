@@ -0,0 +1,232 @@
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ResultFuture is the pending result of a query or batch executed
+// asynchronously with Query.ExecAsync, Query.IterAsync or Batch.ExecAsync.
+//
+// When a connection to the first host picked for the execution has a free
+// stream, the request is written on the calling goroutine and the
+// ResultFuture is completed by the reader of the connection once the
+// response arrives, without starting a goroutine. Speculative executions,
+// executions waiting for a request throttler or for a statement to be
+// prepared, and retries continue on a goroutine of their own.
+type ResultFuture struct {
+	done chan struct{}
+
+	mu        sync.Mutex
+	iter      *Iter
+	callbacks []func(*Iter)
+}
+
+func newResultFuture() *ResultFuture {
+	return &ResultFuture{done: make(chan struct{})}
+}
+
+func (f *ResultFuture) complete(iter *Iter) {
+	f.mu.Lock()
+	f.iter = iter
+	callbacks := f.callbacks
+	f.callbacks = nil
+	close(f.done)
+	f.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(iter)
+	}
+}
+
+// Done returns a channel that is closed once the execution completes.
+func (f *ResultFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the execution completes and returns its error, or
+// until ctx is done and returns ctx.Err(). Giving up waiting does not cancel
+// the execution, use the context of the query or batch for that.
+func (f *ResultFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.iter.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Iter returns the iterator of the completed execution, or nil if the
+// execution is still in progress. The iterator returned for ExecAsync is
+// already closed.
+func (f *ResultFuture) Iter() *Iter {
+	select {
+	case <-f.done:
+		return f.iter
+	default:
+		return nil
+	}
+}
+
+// OnComplete registers callback to be called with the iterator once the
+// execution completes. Callbacks are called in the order they were
+// registered on the goroutine which completed the execution, which can be
+// the reader of a connection. They must not block: in particular they must
+// not execute queries synchronously nor iterate past the first page of the
+// iterator, they should hand such work over to another goroutine. If the
+// execution has already completed, callback is called immediately on the
+// calling goroutine.
+func (f *ResultFuture) OnComplete(callback func(iter *Iter)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		callback(f.iter)
+	default:
+		f.callbacks = append(f.callbacks, callback)
+		f.mu.Unlock()
+	}
+}
+
+// ExecAsync executes the query in the background without returning any rows.
+// The returned future completes with the error Exec would return.
+func (q *Query) ExecAsync() *ResultFuture {
+	f := newResultFuture()
+	q.iterAsync(func(iter *Iter) {
+		iter.Close()
+		f.complete(iter)
+	})
+	return f
+}
+
+// IterAsync executes the query in the background. The returned future
+// completes with the iterator Iter would return once the first page is
+// fetched. The iterator has to be closed by the caller.
+func (q *Query) IterAsync() *ResultFuture {
+	f := newResultFuture()
+	q.iterAsync(f.complete)
+	return f
+}
+
+// iterAsync executes the query like Iter but calls done with the iterator
+// instead of returning it.
+func (q *Query) iterAsync(done func(*Iter)) {
+	if isUseStatement(q.stmt) {
+		done(&Iter{err: ErrUseStmt})
+		return
+	}
+	if q.conn != nil {
+		// the query was run on a connection, which is only done internally
+		go func() {
+			done(q.Iter())
+		}()
+		return
+	}
+
+	// Drop metrics from prior query executions
+	q.metrics.reset()
+	q.session.executeQueryAsync(q, func(iter *Iter) {
+		if q.disableAutoPage && iter.err == nil && iter.numRows == 0 && !iter.LastPage() {
+			// Retry on empty page if pagination is manual
+			go func() {
+				q.PageState(iter.PageState())
+				done(q.Iter())
+			}()
+			return
+		}
+		done(iter)
+	})
+}
+
+// ExecAsync executes the batch in the background. The returned future
+// completes with the error Exec would return.
+func (b *Batch) ExecAsync() *ResultFuture {
+	f := newResultFuture()
+	b.session.executeBatchAsync(b, func(iter *Iter) {
+		iter.Close()
+		f.complete(iter)
+	})
+	return f
+}
+
+// ExecuteConcurrently executes queries, which can be either *Query or
+// *Batch, with ctx and at most maxInFlight of them in flight at a time.
+// A maxInFlight of zero or less means no limit.
+//
+// If handle is not nil, it is called on the calling goroutine with the index
+// and the iterator of every successful query, one at a time, as the queries
+// complete, and the iterator is closed once handle returns.
+//
+// ExecuteConcurrently waits for all queries to complete and returns nil if
+// all of them succeeded. Otherwise it returns one error per query, either
+// the error of the query or of its handle, or nil if both succeeded. Once
+// ctx is done queries which have not started yet fail with ctx.Err().
+func (s *Session) ExecuteConcurrently(ctx context.Context, maxInFlight int, queries []ExecutableQuery,
+	handle func(i int, iter *Iter) error) []error {
+	if maxInFlight <= 0 || maxInFlight > len(queries) {
+		maxInFlight = len(queries)
+	}
+
+	type result struct {
+		i    int
+		iter *Iter
+	}
+
+	var failed bool
+	errs := make([]error, len(queries))
+	setErr := func(i int, err error) {
+		if err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+
+	// the results are buffered so that completing a query never blocks
+	results := make(chan result, len(queries))
+	inFlight := 0
+	handleResult := func(r result) {
+		inFlight--
+		if r.iter.err == nil && handle != nil {
+			if err := handle(r.i, r.iter); err != nil {
+				r.iter.Close()
+				setErr(r.i, err)
+				return
+			}
+		}
+		setErr(r.i, r.iter.Close())
+	}
+
+	for i, qry := range queries {
+		for inFlight >= maxInFlight {
+			handleResult(<-results)
+		}
+		if err := ctx.Err(); err != nil {
+			setErr(i, err)
+			continue
+		}
+
+		i := i
+		done := func(iter *Iter) {
+			results <- result{i: i, iter: iter}
+		}
+		switch qry := qry.(type) {
+		case *Query:
+			qry.WithContext(ctx).iterAsync(done)
+		case *Batch:
+			s.executeBatchAsync(qry.WithContext(ctx), done)
+		default:
+			setErr(i, fmt.Errorf("gocql: can not execute %T", qry))
+			continue
+		}
+		inFlight++
+	}
+	for inFlight > 0 {
+		handleResult(<-results)
+	}
+
+	if !failed {
+		return nil
+	}
+	return errs
+}
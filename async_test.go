@@ -0,0 +1,215 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResultFuture(t *testing.T) {
+	t.Parallel()
+
+	f := newResultFuture()
+	if f.Iter() != nil {
+		t.Fatal("expected no iterator before completion")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := f.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	var order []int
+	f.OnComplete(func(*Iter) { order = append(order, 1) })
+	f.OnComplete(func(*Iter) { order = append(order, 2) })
+
+	errTest := errors.New("test")
+	f.complete(&Iter{err: errTest})
+
+	select {
+	case <-f.Done():
+	default:
+		t.Fatal("expected the future to be done")
+	}
+	if err := f.Wait(context.Background()); err != errTest {
+		t.Fatalf("expected %v got %v", errTest, err)
+	}
+	if f.Iter() == nil {
+		t.Fatal("expected the iterator after completion")
+	}
+
+	// callbacks registered after completion are called immediately
+	f.OnComplete(func(*Iter) { order = append(order, 3) })
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("expected callbacks called in order %v got %v", expected, order)
+	}
+}
+
+func TestQueryExecAsync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").ExecAsync().Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("kill").ExecAsync().Wait(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	f := db.Query("void").IterAsync()
+	<-f.Done()
+	if err := f.Iter().Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryExecAsyncCompletedByConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// slow responds after 50ms, long after the callback is registered
+	f := db.Query("slow").ExecAsync()
+	stack := make(chan string, 1)
+	f.OnComplete(func(*Iter) {
+		buf := make([]byte, 64<<10)
+		stack <- string(buf[:runtime.Stack(buf, false)])
+	})
+	if err := f.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-stack; !strings.Contains(s, "(*Conn).serve") {
+		t.Fatalf("expected the future to be completed by the reader of the connection, got:\n%s", s)
+	}
+}
+
+func TestQueryExecAsyncErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Timeout = 50 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("timeout").ExecAsync().Wait(ctx); !errors.Is(err, ErrTimeoutNoResponse) {
+		t.Fatalf("expected %v got %v", ErrTimeoutNoResponse, err)
+	}
+
+	qryCtx, qryCancel := context.WithCancel(ctx)
+	f := db.Query("timeout").WithContext(qryCtx).ExecAsync()
+	qryCancel()
+	if err := f.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v got %v", context.Canceled, err)
+	}
+}
+
+func TestQueryExecAsyncClose(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Timeout = 5 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := db.Query("timeout").ExecAsync()
+	// ensure that the request is written before closing the session
+	time.Sleep(50 * time.Millisecond)
+	db.Close()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := f.Wait(waitCtx); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("expected %v got %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestSessionExecuteConcurrently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var queries []ExecutableQuery
+	for i := 0; i < 6; i++ {
+		queries = append(queries, db.Query("slow"))
+	}
+
+	var (
+		mu      sync.Mutex
+		handled []int
+	)
+	start := time.Now()
+	errs := db.ExecuteConcurrently(ctx, 2, queries, func(i int, iter *Iter) error {
+		mu.Lock()
+		handled = append(handled, i)
+		mu.Unlock()
+		return nil
+	})
+	if errs != nil {
+		t.Fatalf("expected no errors got %v", errs)
+	}
+	if len(handled) != len(queries) {
+		t.Fatalf("expected %d queries to be handled got %d", len(queries), len(handled))
+	}
+	// every slow query takes 50ms and only 2 of them run at a time
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected queries to be limited to 2 in flight, took only %v", elapsed)
+	}
+
+	errHandle := errors.New("handle")
+	queries = []ExecutableQuery{db.Query("void"), db.Query("kill"), db.Query("void")}
+	errs = db.ExecuteConcurrently(ctx, 0, queries, func(i int, iter *Iter) error {
+		if i == 2 {
+			return errHandle
+		}
+		return nil
+	})
+	if len(errs) != len(queries) {
+		t.Fatalf("expected %d errors got %v", len(queries), errs)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[2] != errHandle {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
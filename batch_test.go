@@ -28,6 +28,8 @@
 package gocql
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -86,3 +88,41 @@ func TestBatch_WithTimestamp(t *testing.T) {
 		t.Errorf("got ts %d, expected %d", storedTs, micros)
 	}
 }
+
+func TestBatchWriter(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if err := createTable(session, `CREATE TABLE gocql_test.batch_writer (id int, ck int, val text, PRIMARY KEY (id, ck))`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	w := session.NewBatchWriter(BatchWriterOptions{MaxStatements: 4})
+	for i := 0; i < 20; i++ {
+		w.Add(ctx, "INSERT INTO batch_writer (id, ck, val) VALUES (?, ?, ?)", i%3, i, "value")
+	}
+	// the statement fails to be prepared
+	bad := w.Add(ctx, "INSERT INTO batch_writer_missing (id) VALUES (?)", 1)
+	err := w.Flush(ctx)
+
+	var errs BatchWriteErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected BatchWriteErrors got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Index != bad {
+		t.Fatalf("expected statement %d to fail got %v", bad, errs)
+	}
+
+	var count int
+	if err := session.Query("SELECT COUNT(*) FROM batch_writer").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Fatalf("expected 20 rows got %d", count)
+	}
+
+	if err := w.Flush(ctx); err != nil {
+		t.Fatalf("expected empty flush to succeed got %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchGrouping selects how BatchWriter groups statements into batches.
+type BatchGrouping int
+
+const (
+	// GroupByPartition puts statements of the same partition, determined by
+	// the token of their partition key, into the same batches.
+	GroupByPartition BatchGrouping = iota
+	// GroupByReplicaSet puts statements of the partitions of a table stored
+	// on the same tablet replicas into the same batches. Statements of tables
+	// not using tablets are grouped by partition.
+	GroupByReplicaSet
+)
+
+const (
+	defaultBatchWriterMaxStatements = 100
+	defaultBatchWriterMaxBytes      = 64 * 1024
+)
+
+// BatchWriterOptions configures a BatchWriter.
+type BatchWriterOptions struct {
+	// GroupBy selects how statements are grouped, GroupByPartition by default.
+	GroupBy BatchGrouping
+
+	// MaxStatements is the maximum number of statements in a batch.
+	// Defaults to 100.
+	MaxStatements int
+
+	// MaxBytes is the maximum size of a batch, estimated from the size of the
+	// statements and their values. A single statement larger than MaxBytes is
+	// sent in a batch on its own. Defaults to 64KiB.
+	MaxBytes int
+
+	// Concurrency is the maximum number of batches executed at the same time
+	// during Flush, unlimited if zero.
+	Concurrency int
+
+	// Consistency of the batches, the session default if zero.
+	Consistency Consistency
+
+	// Idempotent marks all statements as idempotent, so that the batches
+	// can be retried.
+	Idempotent bool
+}
+
+// BatchStatementError is the error of a single statement written with a BatchWriter.
+type BatchStatementError struct {
+	// Index of the statement in the order the statements were added since
+	// the last flush.
+	Index int
+	Stmt  string
+	Err   error
+}
+
+func (e *BatchStatementError) Error() string {
+	return fmt.Sprintf("gocql: batch statement %d %q: %v", e.Index, e.Stmt, e.Err)
+}
+
+func (e *BatchStatementError) Unwrap() error {
+	return e.Err
+}
+
+// BatchWriteErrors is returned by BatchWriter.Flush if any of the statements
+// failed. It holds one error for every failed statement, ordered by Index.
+type BatchWriteErrors []*BatchStatementError
+
+func (e BatchWriteErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("gocql: %d batch statements failed, first error: %v", len(e), e[0])
+}
+
+type batchWriterStatement struct {
+	index  int
+	stmt   string
+	values []interface{}
+	size   int
+}
+
+// batchWriterGroup holds the statements of a single partition or replica set
+// of a table.
+type batchWriterGroup struct {
+	keyspace   string
+	table      string
+	routingKey []byte
+	statements []batchWriterStatement
+}
+
+// BatchWriter accumulates statements and writes them in unlogged batches,
+// each containing only statements of a single partition, or of a single
+// tablet replica set with GroupByReplicaSet. Such batches are sent to a
+// replica of their partition and do not cause the coordinator to forward
+// the statements to other nodes, unlike batches mixing partitions.
+//
+// BatchWriter is safe to use from multiple goroutines.
+type BatchWriter struct {
+	session *Session
+	opts    BatchWriterOptions
+
+	mu     sync.Mutex
+	groups map[string]*batchWriterGroup
+	order  []string
+	errs   BatchWriteErrors
+	next   int
+}
+
+// NewBatchWriter returns a BatchWriter writing to the session.
+func (s *Session) NewBatchWriter(opts BatchWriterOptions) *BatchWriter {
+	if opts.MaxStatements <= 0 {
+		opts.MaxStatements = defaultBatchWriterMaxStatements
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultBatchWriterMaxBytes
+	}
+	return &BatchWriter{
+		session: s,
+		opts:    opts,
+		groups:  make(map[string]*batchWriterGroup),
+	}
+}
+
+// Add adds a DML statement to be written on the next Flush and returns its
+// index, which is used to report its error. The partition of the statement
+// is determined from its values, which requires the statement to be
+// prepared, so Add may block on the first use of a statement.
+func (w *BatchWriter) Add(ctx context.Context, stmt string, values ...interface{}) int {
+	key, group, err := w.groupKey(ctx, stmt, values)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	index := w.next
+	w.next++
+	if err != nil {
+		w.errs = append(w.errs, &BatchStatementError{Index: index, Stmt: stmt, Err: err})
+		return index
+	}
+	if key == "" {
+		// the partition is not known, the statement is written on its own
+		key = fmt.Sprintf("\x00%d", index)
+	}
+
+	if existing, ok := w.groups[key]; ok {
+		group = existing
+	} else {
+		if group == nil {
+			group = &batchWriterGroup{}
+		}
+		w.groups[key] = group
+		w.order = append(w.order, key)
+	}
+	group.statements = append(group.statements, batchWriterStatement{
+		index:  index,
+		stmt:   stmt,
+		values: values,
+		size:   len(stmt) + estimateValuesSize(values),
+	})
+	return index
+}
+
+// groupKey returns the key of the group of the statement and a new group to
+// add it to if there is none with this key yet. The key is empty if the
+// partition of the statement is not known.
+func (w *BatchWriter) groupKey(ctx context.Context, stmt string, values []interface{}) (string, *batchWriterGroup, error) {
+	s := w.session
+	info, err := s.routingKeyInfo(ctx, stmt, "")
+	if err != nil {
+		return "", nil, err
+	}
+	if info == nil {
+		return "", nil, nil
+	}
+	routingKey, err := createRoutingKey(info, values)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the batches are routed with the keyspace and the table of their
+	// statements, which must be the same for the whole group
+	group := &batchWriterGroup{keyspace: info.keyspace, table: info.table, routingKey: routingKey}
+	prefix := info.keyspace + "." + info.table + "\x00"
+
+	partitioner := info.partitioner
+	if partitioner == nil {
+		if partitioner, err = newPartitioner(hostsPartitioner(s.hostSource.getHostsList())); err != nil {
+			// the token can't be computed, statements of the same partition
+			// still share the routing key
+			return prefix + "key\x00" + string(routingKey), group, nil
+		}
+	}
+	token := partitioner.Hash(routingKey)
+
+	if w.opts.GroupBy == GroupByReplicaSet && s.tabletsRoutingV1 {
+		if t, ok := token.(int64Token); ok {
+			replicas := s.findTabletReplicasForToken(info.keyspace, info.table, int64(t))
+			if len(replicas) > 0 {
+				ids := make([]string, len(replicas))
+				for i, replica := range replicas {
+					ids[i] = replica.HostID()
+				}
+				sort.Strings(ids)
+				return prefix + "replicas\x00" + strings.Join(ids, ","), group, nil
+			}
+		}
+	}
+
+	return prefix + "token\x00" + token.String(), group, nil
+}
+
+// Flush writes all statements added since the last flush and waits for the
+// batches to complete. It returns BatchWriteErrors if any of the statements
+// failed, including those which failed in Add.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	groups, order, errs := w.groups, w.order, w.errs
+	w.groups = make(map[string]*batchWriterGroup)
+	w.order = nil
+	w.errs = nil
+	w.next = 0
+	w.mu.Unlock()
+
+	var (
+		batches    []ExecutableQuery
+		statements [][]batchWriterStatement
+	)
+	for _, key := range order {
+		group := groups[key]
+		for _, chunk := range w.split(group.statements) {
+			batch := w.session.Batch(UnloggedBatch)
+			batch.routingKey = group.routingKey
+			batch.routingInfo.keyspace = group.keyspace
+			batch.routingInfo.table = group.table
+			if w.opts.Consistency != 0 {
+				batch.SetConsistency(w.opts.Consistency)
+			}
+			for _, st := range chunk {
+				batch.Entries = append(batch.Entries, BatchEntry{
+					Stmt:       st.stmt,
+					Args:       st.values,
+					Idempotent: w.opts.Idempotent,
+				})
+			}
+			batches = append(batches, batch)
+			statements = append(statements, chunk)
+		}
+	}
+
+	for i, err := range w.session.ExecuteConcurrently(ctx, w.opts.Concurrency, batches, nil) {
+		if err == nil {
+			continue
+		}
+		for _, st := range statements[i] {
+			errs = append(errs, &BatchStatementError{Index: st.index, Stmt: st.stmt, Err: err})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+	return errs
+}
+
+// split splits the statements of a group into chunks bounded by the limits.
+func (w *BatchWriter) split(statements []batchWriterStatement) [][]batchWriterStatement {
+	var (
+		chunks [][]batchWriterStatement
+		start  int
+		size   int
+	)
+	for i, st := range statements {
+		if i > start && (i-start >= w.opts.MaxStatements || size+st.size > w.opts.MaxBytes) {
+			chunks = append(chunks, statements[start:i])
+			start, size = i, 0
+		}
+		size += st.size
+	}
+	if start < len(statements) {
+		chunks = append(chunks, statements[start:])
+	}
+	return chunks
+}
+
+// estimateValuesSize estimates the size of the values once marshaled.
+func estimateValuesSize(values []interface{}) int {
+	size := 0
+	for _, v := range values {
+		size += estimateValueSize(reflect.ValueOf(v))
+	}
+	return size
+}
+
+func estimateValueSize(v reflect.Value) int {
+	// every value is prefixed by its length
+	const header = 4
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return header
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return header
+		}
+		return estimateValueSize(v.Elem())
+	case reflect.String:
+		return header + v.Len()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return header + v.Len()
+		}
+		size := header
+		for i := 0; i < v.Len(); i++ {
+			size += estimateValueSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		size := header
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateValueSize(iter.Key()) + estimateValueSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		// user defined types are marshaled from exported fields, other
+		// structs like time.Time are marshaled into fixed size values
+		size, exported := header, false
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				size += estimateValueSize(v.Field(i))
+				exported = true
+			}
+		}
+		if !exported {
+			return header + int(v.Type().Size())
+		}
+		return size
+	default:
+		return header + int(v.Type().Size())
+	}
+}
@@ -0,0 +1,133 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql/internal/lru"
+)
+
+func TestBatchWriterSplit(t *testing.T) {
+	t.Parallel()
+
+	w := &BatchWriter{opts: BatchWriterOptions{MaxStatements: 3, MaxBytes: 100}}
+
+	var statements []batchWriterStatement
+	for i, size := range []int{10, 10, 10, 10, 60, 50, 200, 10} {
+		statements = append(statements, batchWriterStatement{index: i, size: size})
+	}
+
+	var chunks [][]int
+	for _, chunk := range w.split(statements) {
+		var indexes []int
+		for _, st := range chunk {
+			indexes = append(indexes, st.index)
+		}
+		chunks = append(chunks, indexes)
+	}
+
+	// the first chunk is bounded by the count, the rest by the size and a
+	// statement larger than MaxBytes is sent on its own
+	expected := [][]int{{0, 1, 2}, {3, 4}, {5}, {6}, {7}}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Fatalf("expected chunks %v got %v", expected, chunks)
+	}
+}
+
+func TestBatchWriterGroups(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{}
+	s.routingKeyInfoCache.lru = lru.New(10)
+	for stmt, info := range map[string]*routingKeyInfo{
+		"INSERT INTO a.t (id, v) VALUES (?, ?)": {keyspace: "a", table: "t"},
+		"INSERT INTO a.u (id, v) VALUES (?, ?)": {keyspace: "a", table: "u"},
+		"INSERT INTO b.t (id, v) VALUES (?, ?)": {keyspace: "b", table: "t"},
+	} {
+		info.indexes = []int{0}
+		info.types = []TypeInfo{NativeType{proto: protoVersion4, typ: TypeInt}}
+		info.partitioner = murmur3Partitioner{}
+		s.routingKeyInfoCache.lru.Add(routingKeyInfoCacheKey("", stmt), &inflightCachedEntry{value: info})
+	}
+
+	ctx := context.Background()
+	w := s.NewBatchWriter(BatchWriterOptions{})
+	w.Add(ctx, "INSERT INTO a.t (id, v) VALUES (?, ?)", 1, "x")
+	w.Add(ctx, "INSERT INTO b.t (id, v) VALUES (?, ?)", 1, "x")
+	w.Add(ctx, "INSERT INTO a.t (id, v) VALUES (?, ?)", 2, "x")
+	w.Add(ctx, "INSERT INTO a.u (id, v) VALUES (?, ?)", 1, "x")
+	w.Add(ctx, "INSERT INTO a.t (id, v) VALUES (?, ?)", 1, "y")
+
+	// the same partition key in different keyspaces or tables has the same
+	// token, but the statements must not be batched together
+	var groups [][]int
+	for _, key := range w.order {
+		group := w.groups[key]
+		var indexes []int
+		for _, st := range group.statements {
+			indexes = append(indexes, st.index)
+		}
+		groups = append(groups, indexes)
+	}
+	expected := [][]int{{0, 4}, {1}, {2}, {3}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected groups %v got %v", expected, groups)
+	}
+
+	first := w.groups[w.order[0]]
+	if first.keyspace != "a" || first.table != "t" || !reflect.DeepEqual(first.routingKey, []byte{0, 0, 0, 1}) {
+		t.Fatalf("unexpected group %+v", first)
+	}
+	if second := w.groups[w.order[1]]; second.keyspace != "b" || second.table != "t" {
+		t.Fatalf("unexpected group %+v", second)
+	}
+}
+
+func TestEstimateValuesSize(t *testing.T) {
+	t.Parallel()
+
+	type udt struct {
+		Name string
+		Age  int32
+	}
+
+	tests := []struct {
+		value interface{}
+		size  int
+	}{
+		{nil, 4},
+		{"hello", 9},
+		{[]byte{1, 2, 3}, 7},
+		{int64(1), 12},
+		{[]string{"a", "bc"}, 4 + 5 + 6},
+		{map[string]int32{"a": 1}, 4 + 5 + 8},
+		{udt{Name: "x", Age: 1}, 4 + 5 + 8},
+		{&udt{Name: "x", Age: 1}, 4 + 5 + 8},
+		{time.Time{}, 4 + int(reflect.TypeOf(time.Time{}).Size())},
+	}
+	for _, test := range tests {
+		if size := estimateValuesSize([]interface{}{test.value}); size != test.size {
+			t.Errorf("expected size of %#v to be %d got %d", test.value, test.size, size)
+		}
+	}
+}
+
+func TestBatchWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	errs := BatchWriteErrors{
+		{Index: 1, Stmt: "INSERT", Err: ErrTimeoutNoResponse},
+	}
+	if err := error(errs); err.Error() != errs[0].Error() {
+		t.Fatalf("expected the error of the only statement got %v", err)
+	}
+	errs = append(errs, &BatchStatementError{Index: 2, Stmt: "INSERT", Err: ErrNoConnections})
+	if err := error(errs); err.Error() == errs[0].Error() {
+		t.Fatalf("expected the number of failed statements got %v", err)
+	}
+}
@@ -40,6 +40,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"unicode"
@@ -308,6 +309,61 @@ func TestObserve_Pagination(t *testing.T) {
 	}
 }
 
+func TestScanTable(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if err := createTable(session, "CREATE TABLE gocql_test.scan_table (id int, ck int, PRIMARY KEY (id, ck))"); err != nil {
+		t.Fatal("create table:", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := session.Query("INSERT INTO scan_table (id, ck) VALUES (?, ?)", i/2, i).Exec(); err != nil {
+			t.Fatal("insert:", err)
+		}
+	}
+
+	var (
+		mu          sync.Mutex
+		seen        = make(map[int]bool)
+		checkpoints []ScanCheckpoint
+	)
+	err := session.ScanTable(context.Background(), "gocql_test", "scan_table", ScanTableOptions{
+		Columns:        []string{"ck"},
+		PageSize:       7,
+		SplitsPerRange: 2,
+		Handler: func(rng TokenRange, iter *Iter) error {
+			var ck int
+			for iter.Scan(&ck) {
+				mu.Lock()
+				seen[ck] = true
+				mu.Unlock()
+			}
+			return nil
+		},
+		Checkpoint: func(c ScanCheckpoint) {
+			checkpoints = append(checkpoints, c)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 100 {
+		t.Fatalf("expected to scan 100 rows got %d", len(seen))
+	}
+
+	// resuming a finished scan does not read anything
+	err = session.ScanTable(context.Background(), "gocql_test", "scan_table", ScanTableOptions{
+		Resume: []ScanCheckpoint{checkpoints[len(checkpoints)-1]},
+		Handler: func(rng TokenRange, iter *Iter) error {
+			t.Errorf("range %v is done and should not be scanned", rng)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestPaging(t *testing.T) {
 	session := createSession(t)
 	defer session.Close()
@@ -1728,9 +1784,9 @@ func injectInvalidPreparedStatement(t *testing.T, session *Session, table string
 	key := session.stmtsLRU.keyFor(conn.host.HostID(), "", stmt)
 	session.stmtsLRU.add(key, flight)
 
-	flight.preparedStatment = &preparedStatment{
-		id: []byte{'f', 'o', 'o', 'b', 'a', 'r'},
-		request: preparedMetadata{
+	flight.preparedStatment = newPreparedStatement(
+		[]byte{'f', 'o', 'o', 'b', 'a', 'r'},
+		preparedMetadata{
 			resultMetadata: resultMetadata{
 				colCount:       1,
 				actualColCount: 1,
@@ -1746,7 +1802,9 @@ func injectInvalidPreparedStatement(t *testing.T, session *Session, table string
 				},
 			},
 		},
-	}
+		nil,
+		resultMetadata{},
+	)
 
 	return stmt, conn
 }
@@ -1822,7 +1880,7 @@ func TestQueryInfo(t *testing.T) {
 	}
 
 	if session.cfg.ProtoVersion > 1 {
-		if x := len(info.response.columns); x != 2 {
+		if x := len(info.response().metadata.columns); x != 2 {
 			t.Fatalf("Was not expecting meta data for %d result columns, but got %d\n", 2, x)
 		}
 	}
@@ -2373,7 +2431,7 @@ func TestRoutingKey(t *testing.T) {
 		t.Fatalf("failed to create table with error '%v'", err)
 	}
 
-	routingKeyInfo, err := session.routingKeyInfo(context.Background(), "SELECT * FROM test_single_routing_key WHERE second_id=? AND first_id=?")
+	routingKeyInfo, err := session.routingKeyInfo(context.Background(), "SELECT * FROM test_single_routing_key WHERE second_id=? AND first_id=?", "")
 	if err != nil {
 		t.Fatalf("failed to get routing key info due to error: %v", err)
 	}
@@ -2397,7 +2455,7 @@ func TestRoutingKey(t *testing.T) {
 	}
 
 	// verify the cache is working
-	routingKeyInfo, err = session.routingKeyInfo(context.Background(), "SELECT * FROM test_single_routing_key WHERE second_id=? AND first_id=?")
+	routingKeyInfo, err = session.routingKeyInfo(context.Background(), "SELECT * FROM test_single_routing_key WHERE second_id=? AND first_id=?", "")
 	if err != nil {
 		t.Fatalf("failed to get routing key info due to error: %v", err)
 	}
@@ -2431,7 +2489,7 @@ func TestRoutingKey(t *testing.T) {
 		t.Errorf("Expected routing key %v but was %v", expectedRoutingKey, routingKey)
 	}
 
-	routingKeyInfo, err = session.routingKeyInfo(context.Background(), "SELECT * FROM test_composite_routing_key WHERE second_id=? AND first_id=?")
+	routingKeyInfo, err = session.routingKeyInfo(context.Background(), "SELECT * FROM test_composite_routing_key WHERE second_id=? AND first_id=?", "")
 	if err != nil {
 		t.Fatalf("failed to get routing key info due to error: %v", err)
 	}
@@ -0,0 +1,372 @@
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitBreakerWindow                 = 100
+	defaultCircuitBreakerMinRequests            = 20
+	defaultCircuitBreakerErrorRatio             = 0.5
+	defaultCircuitBreakerMaxConsecutiveTimeouts = 5
+	defaultCircuitBreakerOpenDuration           = 5 * time.Second
+	defaultCircuitBreakerProbeTimeout           = time.Second
+	defaultCircuitBreakerRequiredProbes         = 3
+	defaultCircuitBreakerProbeStatement         = "SELECT now() FROM system.local"
+)
+
+// ErrCircuitOpen is returned for attempts to a host whose circuit breaker
+// is open. Such attempts are not sent and are retried on the next host.
+var ErrCircuitOpen = errors.New("gocql: host circuit breaker is open")
+
+// requestConvictionPolicy is implemented by conviction policies which take
+// the results of requests into account, in addition to connection errors.
+type requestConvictionPolicy interface {
+	ConvictionPolicy
+
+	// init is called by the session using the policy once it is created,
+	// and release once it is closed.
+	init(s *Session)
+	release()
+	// allowRequest reports whether requests may be sent to host.
+	allowRequest(host *HostInfo) bool
+	// trackRequest is called with the result of every attempt sent to host.
+	trackRequest(host *HostInfo, err error)
+}
+
+// CircuitBreakerConfig configures a policy created with NewCircuitBreakerConvictionPolicy.
+type CircuitBreakerConfig struct {
+	// Window is the number of the latest requests to a host the error ratio
+	// is computed over.
+	// Default: 100
+	Window int
+
+	// MinRequests is the number of requests in the window required before
+	// the error ratio is taken into account.
+	// Default: 20
+	MinRequests int
+
+	// ErrorRatio is the ratio of failed requests in the window, between 0
+	// and 1, at which the circuit breaker of a host opens.
+	// Default: 0.5
+	ErrorRatio float64
+
+	// MaxConsecutiveTimeouts is the number of timeouts in a row, reported by
+	// the server or by the client, at which the circuit breaker of a host opens.
+	// Default: 5
+	MaxConsecutiveTimeouts int
+
+	// OpenDuration is the time a circuit breaker stays open before it
+	// half-opens and probes the host.
+	// Default: 5 seconds
+	OpenDuration time.Duration
+
+	// ProbeStatement is the statement sent to a host to probe it.
+	// Default: SELECT now() FROM system.local
+	ProbeStatement string
+
+	// ProbeTimeout is the timeout of a single probe.
+	// Default: 1 second
+	ProbeTimeout time.Duration
+
+	// RequiredProbes is the number of probes in a row which have to succeed
+	// for a half-open circuit breaker to close. If any of them fails, the
+	// circuit breaker opens again.
+	// Default: 3
+	RequiredProbes int
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type hostCircuit struct {
+	host  *HostInfo
+	state circuitState
+
+	// outcomes is a ring buffer of the latest results, true for failures
+	outcomes            []bool
+	next                int
+	count               int
+	failures            int
+	consecutiveTimeouts int
+}
+
+func (c *hostCircuit) reset() {
+	for i := range c.outcomes {
+		c.outcomes[i] = false
+	}
+	c.next, c.count, c.failures, c.consecutiveTimeouts = 0, 0, 0, 0
+}
+
+func (c *hostCircuit) record(failed bool) {
+	if c.count == len(c.outcomes) {
+		if c.outcomes[c.next] {
+			c.failures--
+		}
+	} else {
+		c.count++
+	}
+	c.outcomes[c.next] = failed
+	if failed {
+		c.failures++
+	}
+	c.next = (c.next + 1) % len(c.outcomes)
+}
+
+// CircuitBreakerConvictionPolicy is a ConvictionPolicy which, in addition
+// to convicting hosts on connection errors like SimpleConvictionPolicy,
+// keeps a circuit breaker for every host based on the results of requests.
+//
+// The circuit breaker of a host opens when the ratio of failed requests in
+// a sliding window reaches CircuitBreakerConfig.ErrorRatio, or when
+// CircuitBreakerConfig.MaxConsecutiveTimeouts requests in a row time out.
+// Failed requests are timeouts, overloaded, bootstrapping and server errors
+// and connection errors, while errors caused by the request itself, like
+// syntax errors, or by its context running out are not counted.
+//
+// While the circuit breaker is open, the host is reported down to the
+// HostSelectionPolicy and requests are not sent to it. After
+// CircuitBreakerConfig.OpenDuration the circuit breaker half-opens and the
+// host is probed with CircuitBreakerConfig.ProbeStatement. Once enough
+// probes succeed, the circuit breaker closes and the host is reported up to
+// the HostSelectionPolicy again.
+//
+// A CircuitBreakerConvictionPolicy cannot be shared between sessions.
+type CircuitBreakerConvictionPolicy struct {
+	cfg CircuitBreakerConfig
+
+	session *Session
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+// NewCircuitBreakerConvictionPolicy returns a conviction policy keeping a
+// circuit breaker for every host.
+func NewCircuitBreakerConvictionPolicy(cfg CircuitBreakerConfig) *CircuitBreakerConvictionPolicy {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultCircuitBreakerWindow
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultCircuitBreakerMinRequests
+	}
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+	if cfg.ErrorRatio <= 0 || cfg.ErrorRatio > 1 {
+		cfg.ErrorRatio = defaultCircuitBreakerErrorRatio
+	}
+	if cfg.MaxConsecutiveTimeouts <= 0 {
+		cfg.MaxConsecutiveTimeouts = defaultCircuitBreakerMaxConsecutiveTimeouts
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaultCircuitBreakerOpenDuration
+	}
+	if cfg.ProbeStatement == "" {
+		cfg.ProbeStatement = defaultCircuitBreakerProbeStatement
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = defaultCircuitBreakerProbeTimeout
+	}
+	if cfg.RequiredProbes <= 0 {
+		cfg.RequiredProbes = defaultCircuitBreakerRequiredProbes
+	}
+	return &CircuitBreakerConvictionPolicy{
+		cfg:   cfg,
+		hosts: make(map[string]*hostCircuit),
+	}
+}
+
+// AddFailure convicts the host on connection errors, like SimpleConvictionPolicy.
+func (p *CircuitBreakerConvictionPolicy) AddFailure(err error, host *HostInfo) bool {
+	return true
+}
+
+// Reset closes the circuit breaker of the host and clears its state.
+func (p *CircuitBreakerConvictionPolicy) Reset(host *HostInfo) {
+	p.mu.Lock()
+	delete(p.hosts, hostKey(host))
+	p.mu.Unlock()
+}
+
+func (p *CircuitBreakerConvictionPolicy) init(s *Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session != nil {
+		panic("sharing circuit breaker conviction policy between sessions is not supported")
+	}
+	p.session = s
+}
+
+func (p *CircuitBreakerConvictionPolicy) release() {
+	p.mu.Lock()
+	p.session = nil
+	p.hosts = make(map[string]*hostCircuit)
+	p.mu.Unlock()
+}
+
+func (p *CircuitBreakerConvictionPolicy) allowRequest(host *HostInfo) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	circuit, ok := p.hosts[hostKey(host)]
+	return !ok || circuit.state == circuitClosed
+}
+
+func (p *CircuitBreakerConvictionPolicy) trackRequest(host *HostInfo, err error) {
+	failed, timeout := classifyHostFailure(err)
+	if err != nil && !failed {
+		// the error says nothing about the health of the host
+		return
+	}
+
+	key := hostKey(host)
+	p.mu.Lock()
+	s := p.session
+	if s == nil {
+		p.mu.Unlock()
+		return
+	}
+	circuit, ok := p.hosts[key]
+	if !ok {
+		if !failed {
+			p.mu.Unlock()
+			return
+		}
+		circuit = &hostCircuit{host: host, outcomes: make([]bool, p.cfg.Window)}
+		p.hosts[key] = circuit
+	}
+	if circuit.state != circuitClosed {
+		// results of requests sent before the circuit breaker opened
+		p.mu.Unlock()
+		return
+	}
+
+	circuit.record(failed)
+	if timeout {
+		circuit.consecutiveTimeouts++
+	} else {
+		circuit.consecutiveTimeouts = 0
+	}
+
+	open := failed && (circuit.consecutiveTimeouts >= p.cfg.MaxConsecutiveTimeouts ||
+		circuit.count >= p.cfg.MinRequests && float64(circuit.failures) >= p.cfg.ErrorRatio*float64(circuit.count))
+	if !open {
+		if circuit.failures == 0 && circuit.consecutiveTimeouts == 0 {
+			// keep state only for hosts which have failed recently
+			delete(p.hosts, key)
+		}
+		p.mu.Unlock()
+		return
+	}
+	circuit.state = circuitOpen
+	failures, count := circuit.failures, circuit.count
+	p.mu.Unlock()
+
+	s.logger.warn("circuit breaker opened", logHost(host),
+		logField("failures", failures), logField("requests", count), logError(err))
+	s.policy.HostDown(host)
+	go p.probeUntilClosed(s, circuit)
+}
+
+// probeUntilClosed probes the host of the open circuit until it recovers.
+func (p *CircuitBreakerConvictionPolicy) probeUntilClosed(s *Session, circuit *hostCircuit) {
+	timer := time.NewTimer(p.cfg.OpenDuration)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		if _, ok := s.pool.getPool(circuit.host); !ok {
+			// the host is gone, its state will be created anew if it comes back
+			p.Reset(circuit.host)
+			return
+		}
+
+		p.setState(circuit, circuitHalfOpen)
+		if err := p.probe(s, circuit.host); err != nil {
+			p.setState(circuit, circuitOpen)
+			timer.Reset(p.cfg.OpenDuration)
+			continue
+		}
+
+		p.mu.Lock()
+		circuit.reset()
+		circuit.state = circuitClosed
+		p.mu.Unlock()
+
+		s.logger.info("circuit breaker closed", logHost(circuit.host))
+		if circuit.host.IsUp() {
+			s.policy.HostUp(circuit.host)
+		}
+		return
+	}
+}
+
+func (p *CircuitBreakerConvictionPolicy) setState(circuit *hostCircuit, state circuitState) {
+	p.mu.Lock()
+	circuit.state = state
+	p.mu.Unlock()
+}
+
+// probe sends RequiredProbes probes to the host, stopping at the first failure.
+func (p *CircuitBreakerConvictionPolicy) probe(s *Session, host *HostInfo) error {
+	for i := 0; i < p.cfg.RequiredProbes; i++ {
+		pool, ok := s.pool.getPool(host)
+		if !ok {
+			return ErrNoPool
+		}
+		conn := pool.Pick(nil, nil)
+		if conn == nil {
+			return ErrNoConnectionsInPool
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, p.cfg.ProbeTimeout)
+		err := conn.query(ctx, p.cfg.ProbeStatement).Close()
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// classifyHostFailure reports whether err means that the host failed to
+// serve the request, and whether it timed out doing so.
+func classifyHostFailure(err error) (failed, timeout bool) {
+	if err == nil {
+		return false, false
+	}
+	if errors.Is(err, ErrTimeoutNoResponse) {
+		return true, true
+	}
+	var reqErr RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case ErrCodeReadTimeout, ErrCodeWriteTimeout:
+			return true, true
+		case ErrCodeServer, ErrCodeOverloaded, ErrCodeBootstrapping:
+			return true, false
+		default:
+			return false, false
+		}
+	}
+	// the context of the caller or Query.Timeout ran out, or the connection
+	// had no free stream, which says nothing about the host
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNoStreams) {
+		return false, false
+	}
+	// connection errors
+	return true, false
+}
@@ -0,0 +1,124 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyHostFailure(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err     error
+		failed  bool
+		timeout bool
+	}{
+		{nil, false, false},
+		{&QueryError{err: ErrTimeoutNoResponse}, true, true},
+		{&RequestErrReadTimeout{errorFrame: errorFrame{code: ErrCodeReadTimeout}}, true, true},
+		{&RequestErrWriteTimeout{errorFrame: errorFrame{code: ErrCodeWriteTimeout}}, true, true},
+		{&errorFrame{code: ErrCodeOverloaded}, true, false},
+		{&errorFrame{code: ErrCodeSyntax}, false, false},
+		{&RequestErrUnavailable{errorFrame: errorFrame{code: ErrCodeUnavailable}}, false, false},
+		{context.Canceled, false, false},
+		{context.DeadlineExceeded, false, false},
+		{&QueryError{err: context.DeadlineExceeded}, false, false},
+		{ErrNoStreams, false, false},
+		{ErrConnectionClosed, true, false},
+	}
+	for _, test := range tests {
+		failed, timeout := classifyHostFailure(test.err)
+		if failed != test.failed || timeout != test.timeout {
+			t.Errorf("%v: expected failed=%v timeout=%v got failed=%v timeout=%v",
+				test.err, test.failed, test.timeout, failed, timeout)
+		}
+	}
+}
+
+func TestCircuitBreakerConvictionPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	policy := NewCircuitBreakerConvictionPolicy(CircuitBreakerConfig{
+		Window:         4,
+		MinRequests:    4,
+		ErrorRatio:     0.5,
+		OpenDuration:   50 * time.Millisecond,
+		RequiredProbes: 1,
+	})
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.ConvictionPolicy = policy
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{"kill", "void", "void", "kill"} {
+		db.Query(stmt).Exec()
+	}
+	if err := db.Query("void").Exec(); err == nil {
+		t.Fatal("expected the query to fail while the circuit breaker is open")
+	}
+
+	// the probe succeeds and closes the circuit breaker
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := db.Query("void").Exec()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the circuit breaker to close got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCircuitBreakerConsecutiveTimeouts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	policy := NewCircuitBreakerConvictionPolicy(CircuitBreakerConfig{
+		MaxConsecutiveTimeouts: 2,
+		OpenDuration:           time.Hour,
+	})
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.ConvictionPolicy = policy
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := db.Query("timeout").AttemptTimeout(10 * time.Millisecond).Exec(); !errors.Is(err, ErrTimeoutNoResponse) {
+			t.Fatalf("expected %v got %v", ErrTimeoutNoResponse, err)
+		}
+	}
+
+	host := db.hostSource.getHostsList()[0]
+	if policy.allowRequest(host) {
+		t.Fatal("expected the circuit breaker to be open")
+	}
+	if err := db.Query("void").SetHostID(host.HostID()).Exec(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v got %v", ErrCircuitOpen, err)
+	}
+
+	// the state is released with the session
+	db.Close()
+	if !policy.allowRequest(host) {
+		t.Fatal("expected the circuit breaker to be reset")
+	}
+}
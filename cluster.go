@@ -77,6 +77,10 @@ type ClusterConfig struct {
 	// If it is 0 or unset (the default) then the driver will attempt to discover the
 	// highest supported protocol for the cluster. In clusters with nodes of different
 	// versions the protocol selected is not defined (ie, it can be any of the supported in the cluster)
+	//
+	// Protocol version 5 is never discovered and has to be set explicitly. With it, frames are
+	// sent in segments protected by CRC checksums and compression is only used if the Compressor
+	// implements BlockCompressor.
 	ProtoVersion int
 
 	// Timeout limits the time spent on the client side while executing a query.
@@ -146,7 +150,20 @@ type ClusterConfig struct {
 	// Default: no retries.
 	RetryPolicy RetryPolicy
 
+	// RequestThrottler admits every request attempt before it is sent, queueing the
+	// attempts exceeding its limits instead of failing them, see NewConcurrencyThrottler
+	// and NewRateThrottler.
+	// Default: nil, requests are not throttled
+	RequestThrottler RequestThrottler
+
+	// ExecutionProfiles are the named execution profiles queries and batches can
+	// select with Query.Profile and Batch.Profile. They must not be modified once
+	// a session is created.
+	// Default: nil
+	ExecutionProfiles map[string]*ExecutionProfile
+
 	// ConvictionPolicy decides whether to mark host as down based on the error and host info.
+	// CircuitBreakerConvictionPolicy additionally takes the results of requests into account.
 	// Default: SimpleConvictionPolicy
 	ConvictionPolicy ConvictionPolicy
 
@@ -270,6 +287,11 @@ type ClusterConfig struct {
 	// This can be used to track in-flight protocol requests and responses.
 	StreamObserver StreamObserver
 
+	// HostStateListener receives the hosts added to and removed from the
+	// ring, marked up and down, and whose datacenter or rack changed.
+	// Default: nil
+	HostStateListener HostStateListener
+
 	// Default idempotence for queries
 	DefaultIdempotence bool
 
@@ -306,6 +328,13 @@ type ClusterConfig struct {
 	// If not specified, defaults to the gocql.defaultLogger.
 	Logger StdLogger
 
+	// StructuredLogger receives the messages logged by the driver with their
+	// level and fields, such as the host and the shard, instead of Logger.
+	// NewSlogLogger adapts a slog.Handler.
+	// If not specified, the messages are formatted and logged to Logger, debug
+	// messages are dropped unless built with the gocql_debug tag.
+	StructuredLogger StructuredLogger
+
 	// The timeout for the requests to the schema tables. (default: 60s)
 	MetadataSchemaRequestTimeout time.Duration
 
@@ -397,11 +426,8 @@ func NewCluster(hosts ...string) *ClusterConfig {
 	return cfg
 }
 
-func (cfg *ClusterConfig) logger() StdLogger {
-	if cfg.Logger == nil {
-		return &defaultLogger{}
-	}
-	return cfg.Logger
+func (cfg *ClusterConfig) logger() *driverLogger {
+	return newDriverLogger(cfg.Logger, cfg.StructuredLogger)
 }
 
 // CreateSession initializes the cluster based on this config and returns a
@@ -547,6 +573,12 @@ func (cfg *ClusterConfig) Validate() error {
 		return fmt.Errorf("the default SerialConsistency level is not allowed to be anything else but SERIAL or LOCAL_SERIAL. Recived value: %v", cfg.SerialConsistency)
 	}
 
+	for name, profile := range cfg.ExecutionProfiles {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("execution profile %q: %v", name, err)
+		}
+	}
+
 	if cfg.DNSResolver == nil {
 		return fmt.Errorf("DNSResolver is empty")
 	}
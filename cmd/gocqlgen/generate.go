@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gocql/gocql"
+)
+
+// commonInitialisms are the words written in upper case in Go names.
+var commonInitialisms = map[string]bool{
+	"api": true, "cpu": true, "cql": true, "dc": true, "dns": true, "html": true, "http": true,
+	"https": true, "id": true, "ip": true, "json": true, "sql": true, "ttl": true, "tls": true,
+	"uid": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// reservedParams are the names of the parameters and the variables of the
+// generated functions.
+var reservedParams = map[string]bool{
+	"ctx": true, "session": true, "row": true, "rows": true, "iter": true, "err": true,
+}
+
+// generator generates the Go code of the tables and the user defined types
+// of a keyspace.
+type generator struct {
+	km      *gocql.KeyspaceMetadata
+	pkg     string
+	imports map[string]string
+	// types are the Go names of the user defined types.
+	types map[string]string
+	used  map[string]bool
+}
+
+func generate(km *gocql.KeyspaceMetadata, pkg string) ([]byte, error) {
+	g := &generator{
+		km:      km,
+		pkg:     pkg,
+		imports: make(map[string]string),
+		types:   make(map[string]string),
+		used:    make(map[string]bool),
+	}
+
+	typeNames := sortedKeys(km.Types)
+	for _, name := range typeNames {
+		g.types[name] = g.uniqueName(goName(name))
+	}
+
+	var body bytes.Buffer
+	for _, name := range typeNames {
+		if err := g.userType(&body, km.Types[name]); err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+	}
+	for _, name := range sortedKeys(km.Tables) {
+		if err := g.table(&body, km.Tables[name]); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gocqlgen from keyspace %s. DO NOT EDIT.\n\n", km.Name)
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		// the standard library first
+		paths := sortedKeys(g.imports)
+		sort.SliceStable(paths, func(i, j int) bool {
+			return isStandardImport(paths[i]) && !isStandardImport(paths[j])
+		})
+		out.WriteString("import (\n")
+		for i, path := range paths {
+			if i > 0 && isStandardImport(paths[i-1]) != isStandardImport(path) {
+				out.WriteString("\n")
+			}
+			if name := g.imports[path]; name != "" {
+				fmt.Fprintf(&out, "\t%s %q\n", name, path)
+			} else {
+				fmt.Fprintf(&out, "\t%q\n", path)
+			}
+		}
+		out.WriteString(")\n")
+	}
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated code: %w", err)
+	}
+	return src, nil
+}
+
+func isStandardImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+func (g *generator) uniqueName(name string) string {
+	unique := name
+	for i := 2; g.used[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	g.used[unique] = true
+	return unique
+}
+
+func (g *generator) userType(w *bytes.Buffer, tm *gocql.TypeMetadata) error {
+	name := g.types[tm.Name]
+	fields := make([]string, len(tm.FieldNames))
+	used := make(map[string]bool)
+
+	fmt.Fprintf(w, "\n// %s is the user defined type %s.%s.\n", name, g.km.Name, tm.Name)
+	fmt.Fprintf(w, "type %s struct {\n", name)
+	for i, field := range tm.FieldNames {
+		typ, err := g.goType(tm.FieldTypes[i])
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		fields[i] = uniqueField(used, goName(field))
+		fmt.Fprintf(w, "\t%s %s `cql:%q`\n", fields[i], typ, field)
+	}
+	w.WriteString("}\n")
+
+	recv := receiverName(name)
+	fmt.Fprintf(w, "\n// MarshalUDT implements gocql.UDTMarshaler.\n")
+	fmt.Fprintf(w, "func (%s %s) MarshalUDT(name string, info gocql.TypeInfo) ([]byte, error) {\n", recv, name)
+	w.WriteString("\tswitch name {\n")
+	for i, field := range tm.FieldNames {
+		fmt.Fprintf(w, "\tcase %q:\n\t\treturn gocql.Marshal(info, %s.%s)\n", field, recv, fields[i])
+	}
+	w.WriteString("\t}\n\treturn nil, nil\n}\n")
+
+	fmt.Fprintf(w, "\n// UnmarshalUDT implements gocql.UDTUnmarshaler.\n")
+	fmt.Fprintf(w, "func (%s *%s) UnmarshalUDT(name string, info gocql.TypeInfo, data []byte) error {\n", recv, name)
+	w.WriteString("\tswitch name {\n")
+	for i, field := range tm.FieldNames {
+		fmt.Fprintf(w, "\tcase %q:\n\t\treturn gocql.Unmarshal(info, data, &%s.%s)\n", field, recv, fields[i])
+	}
+	w.WriteString("\t}\n\treturn nil\n}\n")
+
+	g.imports["github.com/gocql/gocql"] = ""
+	return nil
+}
+
+// column is a column of a table with the names of its field and parameter.
+type column struct {
+	*gocql.ColumnMetadata
+	field string
+	param string
+	typ   string
+	// elems are the elements of a tuple column, which gocql scans into a
+	// destination each.
+	elems []*column
+}
+
+// parts returns the elements of a tuple column, or the column itself.
+func (c *column) parts() []*column {
+	if c.elems != nil {
+		return c.elems
+	}
+	return []*column{c}
+}
+
+// value returns the expression of the value of the column from the
+// expressions of its parts.
+func (c *column) value(part func(*column) string) string {
+	if c.elems == nil {
+		return part(c)
+	}
+	values := make([]string, len(c.elems))
+	for i, elem := range c.elems {
+		values[i] = part(elem)
+	}
+	return "[]interface{}{" + strings.Join(values, ", ") + "}"
+}
+
+func (g *generator) table(w *bytes.Buffer, tm *gocql.TableMetadata) error {
+	name := g.uniqueName(goName(singular(tm.Name)))
+	table := quoteIdentifier(g.km.Name) + "." + quoteIdentifier(tm.Name)
+
+	var (
+		columns     []*column
+		fields      = make(map[string]bool)
+		params      = make(map[string]bool)
+		counter     bool
+		partitionPK []*column
+		primaryKey  []*column
+	)
+	for _, cm := range tableColumns(tm) {
+		col := &column{ColumnMetadata: cm}
+		if elems, ok := tupleElems(cm.Type); ok {
+			// gocql scans a tuple column into a destination per element
+			for i, elem := range elems {
+				typ, err := g.goType(elem)
+				if err != nil {
+					return fmt.Errorf("column %s: %w", cm.Name, err)
+				}
+				n := strconv.Itoa(i + 1)
+				col.elems = append(col.elems, &column{
+					field: uniqueField(fields, goName(cm.Name)+n),
+					param: uniqueField(params, strings.TrimSuffix(paramName(cm.Name), "_")+n),
+					typ:   typ,
+				})
+			}
+		} else {
+			typ, err := g.goType(cm.Type)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", cm.Name, err)
+			}
+			col.field = uniqueField(fields, goName(cm.Name))
+			col.param = uniqueField(params, paramName(cm.Name))
+			col.typ = typ
+		}
+		columns = append(columns, col)
+		counter = counter || cm.Type == "counter"
+
+		switch cm.Kind {
+		case gocql.ColumnPartitionKey:
+			partitionPK = append(partitionPK, col)
+			primaryKey = append(primaryKey, col)
+		case gocql.ColumnClusteringKey:
+			primaryKey = append(primaryKey, col)
+		}
+	}
+
+	fmt.Fprintf(w, "\n// %s is a row of the table %s.\n", name, table)
+	fmt.Fprintf(w, "type %s struct {\n", name)
+	for _, col := range columns {
+		if col.elems == nil {
+			fmt.Fprintf(w, "\t%s %s `cql:%q`\n", col.field, col.typ, col.Name)
+			continue
+		}
+		fmt.Fprintf(w, "\t// the elements of the tuple %s\n", col.Name)
+		for _, elem := range col.elems {
+			fmt.Fprintf(w, "\t%s %s\n", elem.field, elem.typ)
+		}
+	}
+	w.WriteString("}\n")
+
+	recv := receiverName(name)
+	var pointers []string
+	for _, col := range columns {
+		for _, part := range col.parts() {
+			pointers = append(pointers, "&"+recv+"."+part.field)
+		}
+	}
+	fmt.Fprintf(w, "\n// fields returns pointers to the fields of %s in the order of its columns.\n", recv)
+	fmt.Fprintf(w, "func (%s *%s) fields() []interface{} {\n\treturn []interface{}{%s}\n}\n", recv, name, strings.Join(pointers, ", "))
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = quoteIdentifier(col.Name)
+	}
+	selectStmt := "SELECT " + strings.Join(names, ", ") + " FROM " + table
+
+	fmt.Fprintf(w, "\n// Get%s returns the row of %s with the primary key.\n// It returns gocql.ErrNotFound if there is none.\n", name, table)
+	fmt.Fprintf(w, "func Get%s(ctx context.Context, session *gocql.Session, %s) (*%s, error) {\n", name, paramList(primaryKey), name)
+	fmt.Fprintf(w, "\trow := &%s{}\n", name)
+	fmt.Fprintf(w, "\tif err := session.Query(%q, %s).WithContext(ctx).Scan(row.fields()...); err != nil {\n",
+		selectStmt+" WHERE "+whereClause(primaryKey), argList(primaryKey))
+	w.WriteString("\t\treturn nil, err\n\t}\n\treturn row, nil\n}\n")
+
+	if len(primaryKey) > len(partitionPK) {
+		list := goName(tm.Name)
+		if list == name {
+			list += "Partition"
+		}
+		fmt.Fprintf(w, "\n// List%s returns the rows of the partition of %s with the partition key.\n", list, table)
+		fmt.Fprintf(w, "func List%s(ctx context.Context, session *gocql.Session, %s) ([]%s, error) {\n", list, paramList(partitionPK), name)
+		fmt.Fprintf(w, "\titer := session.Query(%q, %s).WithContext(ctx).Iter()\n",
+			selectStmt+" WHERE "+whereClause(partitionPK), argList(partitionPK))
+		fmt.Fprintf(w, "\tvar rows []%s\n\tfor {\n\t\tvar row %s\n", name, name)
+		w.WriteString("\t\tif !iter.Scan(row.fields()...) {\n\t\t\tbreak\n\t\t}\n\t\trows = append(rows, row)\n\t}\n")
+		w.WriteString("\tif err := iter.Close(); err != nil {\n\t\treturn nil, err\n\t}\n\treturn rows, nil\n}\n")
+	}
+
+	// counter columns can only be updated
+	if !counter {
+		markers := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		insertStmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "), markers)
+		values := make([]string, len(columns))
+		for i, col := range columns {
+			values[i] = col.value(func(part *column) string { return "row." + part.field })
+		}
+		fmt.Fprintf(w, "\n// Insert%s inserts row into %s.\n", name, table)
+		fmt.Fprintf(w, "func Insert%s(ctx context.Context, session *gocql.Session, row *%s) error {\n", name, name)
+		fmt.Fprintf(w, "\treturn session.Query(%q, %s).WithContext(ctx).Exec()\n}\n", insertStmt, strings.Join(values, ", "))
+	}
+
+	fmt.Fprintf(w, "\n// Delete%s deletes the row of %s with the primary key.\n", name, table)
+	fmt.Fprintf(w, "func Delete%s(ctx context.Context, session *gocql.Session, %s) error {\n", name, paramList(primaryKey))
+	fmt.Fprintf(w, "\treturn session.Query(%q, %s).WithContext(ctx).Exec()\n}\n",
+		"DELETE FROM "+table+" WHERE "+whereClause(primaryKey), argList(primaryKey))
+
+	g.imports["context"] = ""
+	g.imports["github.com/gocql/gocql"] = ""
+	return nil
+}
+
+// tupleElems returns the types of the elements of a tuple type.
+func tupleElems(cqlType string) ([]string, bool) {
+	name, params := splitType(cqlType)
+	if name == "frozen" && len(params) == 1 {
+		name, params = splitType(params[0])
+	}
+	return params, name == "tuple"
+}
+
+// tableColumns returns the partition key, the clustering columns and the
+// other columns of tm in the order of their definition.
+func tableColumns(tm *gocql.TableMetadata) []*gocql.ColumnMetadata {
+	columns := append(append([]*gocql.ColumnMetadata(nil), tm.PartitionKey...), tm.ClusteringColumns...)
+	seen := make(map[string]bool)
+	for _, col := range columns {
+		seen[col.Name] = true
+	}
+	for _, name := range append(append([]string(nil), tm.OrderedColumns...), sortedKeys(tm.Columns)...) {
+		if col, ok := tm.Columns[name]; ok && !seen[name] {
+			seen[name] = true
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+func paramList(columns []*column) string {
+	var params []string
+	for _, col := range columns {
+		for _, part := range col.parts() {
+			params = append(params, part.param+" "+part.typ)
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+func argList(columns []*column) string {
+	args := make([]string, len(columns))
+	for i, col := range columns {
+		args[i] = col.value(func(part *column) string { return part.param })
+	}
+	return strings.Join(args, ", ")
+}
+
+func whereClause(columns []*column) string {
+	conditions := make([]string, len(columns))
+	for i, col := range columns {
+		conditions[i] = quoteIdentifier(col.Name) + " = ?"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// goType returns the Go type of a CQL type, following the types gocql
+// unmarshals values into.
+func (g *generator) goType(cqlType string) (string, error) {
+	name, params := splitType(cqlType)
+	param := func(i int) (string, error) {
+		if i >= len(params) {
+			return "", fmt.Errorf("missing parameter of type %s", cqlType)
+		}
+		return g.goType(params[i])
+	}
+
+	switch name {
+	case "ascii", "text", "varchar", "inet":
+		return "string", nil
+	case "bigint", "counter":
+		return "int64", nil
+	case "int":
+		return "int", nil
+	case "smallint":
+		return "int16", nil
+	case "tinyint":
+		return "int8", nil
+	case "float":
+		return "float32", nil
+	case "double":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "blob":
+		return "[]byte", nil
+	case "uuid", "timeuuid":
+		g.imports["github.com/gocql/gocql"] = ""
+		return "gocql.UUID", nil
+	case "timestamp", "date":
+		g.imports["time"] = ""
+		return "time.Time", nil
+	case "time":
+		g.imports["time"] = ""
+		return "time.Duration", nil
+	case "duration":
+		g.imports["github.com/gocql/gocql"] = ""
+		return "gocql.Duration", nil
+	case "varint":
+		g.imports["math/big"] = ""
+		return "*big.Int", nil
+	case "decimal":
+		g.imports["gopkg.in/inf.v0"] = "inf"
+		return "*inf.Dec", nil
+	case "frozen":
+		return param(0)
+	case "list", "set", "vector":
+		elem, err := param(0)
+		return "[]" + elem, err
+	case "map":
+		key, err := param(0)
+		if err != nil {
+			return "", err
+		}
+		if key == "[]byte" {
+			key = "string"
+		} else if strings.HasPrefix(key, "[]") || strings.HasPrefix(key, "map[") {
+			return "", fmt.Errorf("unsupported map key type %s", params[0])
+		}
+		value, err := param(1)
+		return "map[" + key + "]" + value, err
+	case "tuple":
+		// the elements of a tuple nested in another type are unmarshaled
+		// into a slice
+		return "[]interface{}", nil
+	}
+
+	if typ, ok := g.types[name]; ok {
+		return typ, nil
+	}
+	return "", fmt.Errorf("unknown type %s", cqlType)
+}
+
+// splitType splits "map<text, frozen<list<int>>>" into "map" and its
+// parameters "text" and "frozen<list<int>>".
+func splitType(cqlType string) (string, []string) {
+	cqlType = strings.TrimSpace(cqlType)
+	open := strings.IndexByte(cqlType, '<')
+	if open < 0 || !strings.HasSuffix(cqlType, ">") {
+		return cqlType, nil
+	}
+
+	var (
+		params []string
+		depth  int
+		start  = open + 1
+		inner  = cqlType[:len(cqlType)-1]
+	)
+	for i := start; i < len(inner); i++ {
+		switch inner[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(inner[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	params = append(params, strings.TrimSpace(inner[start:]))
+	return cqlType[:open], params
+}
+
+// goName converts a CQL name such as "user_id" to an exported Go name such
+// as "UserID".
+func goName(name string) string {
+	var sb strings.Builder
+	for _, word := range splitWords(name) {
+		if commonInitialisms[strings.ToLower(word)] {
+			sb.WriteString(strings.ToUpper(word))
+		} else {
+			runes := []rune(word)
+			sb.WriteRune(unicode.ToUpper(runes[0]))
+			sb.WriteString(string(runes[1:]))
+		}
+	}
+	s := sb.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// paramName converts a CQL name such as "user_id" to an unexported Go name
+// such as "userID".
+func paramName(name string) string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return "x"
+	}
+	s := strings.ToLower(words[0])
+	if !unicode.IsLetter([]rune(s)[0]) {
+		s = "x" + s
+	}
+	for _, word := range words[1:] {
+		s += goName(word)
+	}
+	if token.IsKeyword(s) || reservedParams[s] {
+		s += "_"
+	}
+	return s
+}
+
+func splitWords(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func uniqueField(used map[string]bool, name string) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+func receiverName(typeName string) string {
+	return strings.ToLower(string([]rune(typeName)[0]))
+}
+
+// singular returns the singular of the English plural name, such as "user"
+// for "users", so that a row of the table users is a User.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") &&
+		!strings.HasSuffix(name, "us") && !strings.HasSuffix(name, "is") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// quoteIdentifier quotes name if it is not a lower case CQL identifier.
+func quoteIdentifier(name string) string {
+	for i, r := range name {
+		if !(r >= 'a' && r <= 'z' || r == '_' || i > 0 && r >= '0' && r <= '9') {
+			return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+		}
+	}
+	if cqlReservedKeywords[name] {
+		return `"` + name + `"`
+	}
+	return name
+}
+
+// cqlReservedKeywords are the keywords which can't be used as unquoted identifiers.
+var cqlReservedKeywords = map[string]bool{
+	"add": true, "allow": true, "alter": true, "and": true, "apply": true, "asc": true, "authorize": true,
+	"batch": true, "begin": true, "by": true, "columnfamily": true, "create": true, "delete": true,
+	"desc": true, "describe": true, "drop": true, "entries": true, "execute": true, "from": true,
+	"full": true, "grant": true, "if": true, "in": true, "index": true, "infinity": true, "insert": true,
+	"into": true, "keyspace": true, "limit": true, "materialized": true, "modify": true, "nan": true,
+	"norecursive": true, "not": true, "null": true, "of": true, "on": true, "or": true, "order": true,
+	"primary": true, "rename": true, "replace": true, "revoke": true, "schema": true, "select": true,
+	"set": true, "table": true, "to": true, "token": true, "truncate": true, "unlogged": true,
+	"update": true, "use": true, "using": true, "view": true, "where": true, "with": true,
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*gocql.TypeMetadata:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]*gocql.TableMetadata:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]*gocql.ColumnMetadata:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
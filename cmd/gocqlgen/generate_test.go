@@ -0,0 +1,146 @@
+//go:build unit
+// +build unit
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestGenerate(t *testing.T) {
+	p := newSchemaParser("app")
+	if err := p.parseScript(testSchema + "CREATE TABLE counters (id text PRIMARY KEY, n counter);"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(p.km, "models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	for _, expected := range []string{
+		"// Code generated by gocqlgen from keyspace app. DO NOT EDIT.",
+		"package models",
+		"type Address struct {",
+		"Zip    int    `cql:\"Zip\"`",
+		"func (a Address) MarshalUDT(name string, info gocql.TypeInfo) ([]byte, error) {",
+		"func (p *Person) UnmarshalUDT(name string, info gocql.TypeInfo, data []byte) error {",
+		"Home   Address  `cql:\"home\"`",
+		"type User struct {",
+		"Tags     map[string][]int `cql:\"tags\"`",
+		`SELECT id, name, addr, tags, \"Type\", nickname FROM app.users WHERE id = ?`,
+		"func GetUser(ctx context.Context, session *gocql.Session, id gocql.UUID) (*User, error) {",
+		"func InsertUser(ctx context.Context, session *gocql.Session, row *User) error {",
+		"func DeleteUser(ctx context.Context, session *gocql.Session, id gocql.UUID) error {",
+		"type UserEvent struct {",
+		"func GetUserEvent(ctx context.Context, session *gocql.Session, userID gocql.UUID, bucket int, at gocql.UUID) (*UserEvent, error) {",
+		"func ListUserEvents(ctx context.Context, session *gocql.Session, userID gocql.UUID, bucket int) ([]UserEvent, error) {",
+		"WHERE user_id = ? AND bucket = ?\"",
+		"func GetCounter(",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("expected the generated code to contain %q", expected)
+		}
+	}
+	// counters can't be inserted
+	if strings.Contains(code, "InsertCounter") {
+		t.Error("expected no insert of a counter table")
+	}
+	if t.Failed() {
+		t.Log(code)
+	}
+}
+
+func TestGenerateUnknownType(t *testing.T) {
+	km := &gocql.KeyspaceMetadata{
+		Name: "app",
+		Tables: map[string]*gocql.TableMetadata{
+			"t": {
+				Name:         "t",
+				PartitionKey: []*gocql.ColumnMetadata{{Name: "id", Type: "missing_udt", Kind: gocql.ColumnPartitionKey}},
+			},
+		},
+	}
+	if _, err := generate(km, "models"); err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("expected unknown type error got %v", err)
+	}
+}
+
+func TestNames(t *testing.T) {
+	for name, expected := range map[string]string{
+		"user_id":   "UserID",
+		"Type":      "Type",
+		"http_url":  "HTTPURL",
+		"2fa":       "X2fa",
+		"createdAt": "CreatedAt",
+	} {
+		if got := goName(name); got != expected {
+			t.Errorf("goName(%q): expected %s got %s", name, expected, got)
+		}
+	}
+	for name, expected := range map[string]string{
+		"user_id": "userID",
+		"type":    "type_",
+		"row":     "row_",
+		"ID":      "id",
+	} {
+		if got := paramName(name); got != expected {
+			t.Errorf("paramName(%q): expected %s got %s", name, expected, got)
+		}
+	}
+	for name, expected := range map[string]string{
+		"users":     "user",
+		"companies": "company",
+		"addresses": "address",
+		"boxes":     "box",
+		"status":    "status",
+		"news_data": "news_data",
+	} {
+		if got := singular(name); got != expected {
+			t.Errorf("singular(%q): expected %s got %s", name, expected, got)
+		}
+	}
+	for name, expected := range map[string]string{
+		"users": "users",
+		"Users": `"Users"`,
+		"table": `"table"`,
+		"a b":   `"a b"`,
+	} {
+		if got := quoteIdentifier(name); got != expected {
+			t.Errorf("quoteIdentifier(%q): expected %s got %s", name, expected, got)
+		}
+	}
+}
+
+func TestGenerateTuple(t *testing.T) {
+	p := newSchemaParser("app")
+	if err := p.parseScript("CREATE TABLE points (id frozen<tuple<int, int>>, pos tuple<double, double>, tags list<frozen<tuple<text, int>>>, PRIMARY KEY (id));"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(p.km, "models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	// gocql scans each element of a tuple column into its own destination
+	for _, expected := range []string{
+		"ID1 int\n\tID2 int\n",
+		"Pos2 float64\n",
+		"Tags [][]interface{} `cql:\"tags\"`",
+		"return []interface{}{&p.ID1, &p.ID2, &p.Pos1, &p.Pos2, &p.Tags}",
+		"func GetPoint(ctx context.Context, session *gocql.Session, id1 int, id2 int) (*Point, error) {",
+		"[]interface{}{id1, id2}).WithContext(ctx).Scan(row.fields()...)",
+		"[]interface{}{row.ID1, row.ID2}, []interface{}{row.Pos1, row.Pos2}, row.Tags)",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("expected the generated code to contain %q", expected)
+		}
+	}
+	if t.Failed() {
+		t.Log(code)
+	}
+}
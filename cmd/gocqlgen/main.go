@@ -0,0 +1,156 @@
+// Command gocqlgen generates Go code for the tables and the user defined
+// types of a keyspace, so that the Go structs follow the schema.
+//
+// The schema is read from a live cluster:
+//
+//	gocqlgen -hosts 127.0.0.1 -keyspace app -pkg models -out models/app.go
+//
+// or from a CQL schema file, or a directory of migration files in the format
+// of the migrate package:
+//
+//	gocqlgen -schema schema.cql -keyspace app -pkg models -out models/app.go
+//
+// Each user defined type is generated as a struct implementing
+// gocql.UDTMarshaler and gocql.UDTUnmarshaler. Each table is generated as a
+// struct with a field per column, named after the singular of the table, with
+// functions getting, inserting and deleting a row by its primary key, and
+// listing the rows of a partition for the tables with clustering columns.
+// The fields have a cql tag with the name of their column.
+//
+// It is meant to be run with go generate:
+//
+//	//go:generate gocqlgen -schema ../schema.cql -keyspace app -pkg models -out app.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/migrate"
+)
+
+func main() {
+	var (
+		hosts    = flag.String("hosts", "", "comma separated hosts of the cluster to read the schema from")
+		username = flag.String("username", "", "username of the cluster")
+		password = flag.String("password", "", "password of the cluster")
+		schema   = flag.String("schema", "", "CQL schema file or directory of migration files to read the schema from")
+		keyspace = flag.String("keyspace", "", "keyspace to generate")
+		tables   = flag.String("tables", "", "comma separated tables to generate, all the tables by default")
+		pkg      = flag.String("pkg", "models", "package of the generated code")
+		out      = flag.String("out", "", "file to write the generated code to, standard output by default")
+	)
+	flag.Parse()
+
+	if err := run(*hosts, *username, *password, *schema, *keyspace, *tables, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "gocqlgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(hosts, username, password, schema, keyspace, tables, pkg, out string) error {
+	if keyspace == "" {
+		return errors.New("no keyspace provided")
+	}
+
+	var (
+		km  *gocql.KeyspaceMetadata
+		err error
+	)
+	switch {
+	case schema != "" && hosts != "":
+		return errors.New("either -hosts or -schema must be provided, not both")
+	case schema != "":
+		km, err = readSchema(schema, keyspace)
+	case hosts != "":
+		km, err = readClusterSchema(strings.Split(hosts, ","), username, password, keyspace)
+	default:
+		return errors.New("either -hosts or -schema must be provided")
+	}
+	if err != nil {
+		return err
+	}
+
+	if tables != "" {
+		if km, err = filterTables(km, strings.Split(tables, ",")); err != nil {
+			return err
+		}
+	}
+
+	src, err := generate(km, pkg)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
+
+// readSchema reads the schema of keyspace from a CQL file or a directory of
+// migration files.
+func readSchema(path, keyspace string) (*gocql.KeyspaceMetadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newSchemaParser(keyspace)
+	if !info.IsDir() {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.parseScript(string(script)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return p.km, nil
+	}
+
+	migrations, err := migrate.FromDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range migrations {
+		for _, stmt := range m.Statements {
+			if err := p.parseStatement(stmt); err != nil {
+				return nil, fmt.Errorf("%s: %w in %q", m.Name, err, stmt)
+			}
+		}
+	}
+	return p.km, nil
+}
+
+func readClusterSchema(hosts []string, username, password, keyspace string) (*gocql.KeyspaceMetadata, error) {
+	cluster := gocql.NewCluster(hosts...)
+	if username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: username, Password: password}
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return session.KeyspaceMetadata(keyspace)
+}
+
+// filterTables returns a copy of km with only the tables named.
+func filterTables(km *gocql.KeyspaceMetadata, names []string) (*gocql.KeyspaceMetadata, error) {
+	filtered := *km
+	filtered.Tables = make(map[string]*gocql.TableMetadata, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		tm, ok := km.Tables[name]
+		if !ok {
+			return nil, fmt.Errorf("keyspace %s has no table %s", km.Name, name)
+		}
+		filtered.Tables[name] = tm
+	}
+	return &filtered, nil
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/internal/cql"
+)
+
+// schemaParser builds the metadata of a keyspace from the CREATE, ALTER and
+// DROP statements of its tables and types, ignoring the other statements and
+// the elements of the other keyspaces.
+type schemaParser struct {
+	km *gocql.KeyspaceMetadata
+	// current is the keyspace of the unqualified names, set by USE.
+	current string
+}
+
+func newSchemaParser(keyspace string) *schemaParser {
+	return &schemaParser{
+		km: &gocql.KeyspaceMetadata{
+			Name:   keyspace,
+			Tables: make(map[string]*gocql.TableMetadata),
+			Types:  make(map[string]*gocql.TypeMetadata),
+		},
+		current: keyspace,
+	}
+}
+
+// parseScript parses the statements of a CQL script.
+func (s *schemaParser) parseScript(script string) error {
+	stmts, err := cql.SplitStatements(script)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if err := s.parseStatement(stmt); err != nil {
+			return fmt.Errorf("%w in %q", err, stmt)
+		}
+	}
+	return nil
+}
+
+func (s *schemaParser) parseStatement(stmt string) error {
+	tokens, err := cql.Lex(stmt)
+	if err != nil {
+		return err
+	}
+	p := &tokenParser{tokens: tokens}
+
+	switch {
+	case p.accept("USE"):
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		s.current = name
+	case p.accept("CREATE"):
+		switch {
+		case p.accept("TABLE"), p.accept("COLUMNFAMILY"):
+			return s.createTable(p)
+		case p.accept("TYPE"):
+			return s.createType(p)
+		}
+	case p.accept("ALTER"):
+		switch {
+		case p.accept("TABLE"), p.accept("COLUMNFAMILY"):
+			return s.alterTable(p)
+		case p.accept("TYPE"):
+			return s.alterType(p)
+		}
+	case p.accept("DROP"):
+		switch {
+		case p.accept("TABLE"), p.accept("COLUMNFAMILY"):
+			p.accept("IF", "EXISTS")
+			if keyspace, name, err := p.qualifiedName(s.current); err != nil {
+				return err
+			} else if keyspace == s.km.Name {
+				delete(s.km.Tables, name)
+			}
+		case p.accept("TYPE"):
+			p.accept("IF", "EXISTS")
+			if keyspace, name, err := p.qualifiedName(s.current); err != nil {
+				return err
+			} else if keyspace == s.km.Name {
+				delete(s.km.Types, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *schemaParser) createTable(p *tokenParser) error {
+	p.accept("IF", "NOT", "EXISTS")
+	keyspace, name, err := p.qualifiedName(s.current)
+	if err != nil {
+		return err
+	}
+	tm := &gocql.TableMetadata{
+		Keyspace: keyspace,
+		Name:     name,
+		Columns:  make(map[string]*gocql.ColumnMetadata),
+	}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+
+	var pk, ck []string
+	for {
+		if p.accept("PRIMARY", "KEY") {
+			if pk, ck, err = p.primaryKey(); err != nil {
+				return err
+			}
+		} else {
+			col, err := p.columnDefinition()
+			if err != nil {
+				return err
+			}
+			if p.accept("PRIMARY", "KEY") {
+				pk = []string{col.Name}
+			}
+			tm.Columns[col.Name] = col
+			tm.OrderedColumns = append(tm.OrderedColumns, col.Name)
+		}
+		if p.accept(")") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+	}
+
+	order := p.clusteringOrder()
+	for _, name := range pk {
+		col, ok := tm.Columns[name]
+		if !ok {
+			return fmt.Errorf("unknown partition key column %s", name)
+		}
+		col.Kind = gocql.ColumnPartitionKey
+		tm.PartitionKey = append(tm.PartitionKey, col)
+	}
+	for _, name := range ck {
+		col, ok := tm.Columns[name]
+		if !ok {
+			return fmt.Errorf("unknown clustering column %s", name)
+		}
+		col.Kind = gocql.ColumnClusteringKey
+		col.ClusteringOrder = "asc"
+		if o, ok := order[name]; ok {
+			col.ClusteringOrder = o
+		}
+		tm.ClusteringColumns = append(tm.ClusteringColumns, col)
+	}
+	if len(tm.PartitionKey) == 0 {
+		return fmt.Errorf("table %s has no primary key", name)
+	}
+	for _, col := range tm.Columns {
+		col.Keyspace, col.Table = keyspace, name
+	}
+
+	if keyspace == s.km.Name {
+		s.km.Tables[name] = tm
+	}
+	return nil
+}
+
+func (s *schemaParser) alterTable(p *tokenParser) error {
+	p.accept("IF", "EXISTS")
+	keyspace, name, err := p.qualifiedName(s.current)
+	if err != nil {
+		return err
+	}
+	tm, ok := s.km.Tables[name]
+	if keyspace != s.km.Name || !ok {
+		return nil
+	}
+
+	switch {
+	case p.accept("ADD"):
+		p.accept("IF", "NOT", "EXISTS")
+		return p.list(func() error {
+			col, err := p.columnDefinition()
+			if err != nil {
+				return err
+			}
+			col.Keyspace, col.Table = keyspace, name
+			if _, ok := tm.Columns[col.Name]; !ok {
+				tm.OrderedColumns = append(tm.OrderedColumns, col.Name)
+			}
+			tm.Columns[col.Name] = col
+			return nil
+		})
+	case p.accept("DROP"):
+		p.accept("IF", "EXISTS")
+		return p.list(func() error {
+			col, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			delete(tm.Columns, col)
+			for i, name := range tm.OrderedColumns {
+				if name == col {
+					tm.OrderedColumns = append(tm.OrderedColumns[:i], tm.OrderedColumns[i+1:]...)
+					break
+				}
+			}
+			return nil
+		})
+	case p.accept("ALTER"):
+		col, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("TYPE"); err != nil {
+			return err
+		}
+		typ, err := p.cqlType()
+		if err != nil {
+			return err
+		}
+		if cm, ok := tm.Columns[col]; ok {
+			cm.Type = typ
+		}
+	}
+	return nil
+}
+
+func (s *schemaParser) createType(p *tokenParser) error {
+	p.accept("IF", "NOT", "EXISTS")
+	keyspace, name, err := p.qualifiedName(s.current)
+	if err != nil {
+		return err
+	}
+	tm := &gocql.TypeMetadata{Keyspace: keyspace, Name: name}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	if err := p.list(func() error {
+		field, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		typ, err := p.cqlType()
+		if err != nil {
+			return err
+		}
+		tm.FieldNames = append(tm.FieldNames, field)
+		tm.FieldTypes = append(tm.FieldTypes, typ)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+
+	if keyspace == s.km.Name {
+		s.km.Types[name] = tm
+	}
+	return nil
+}
+
+func (s *schemaParser) alterType(p *tokenParser) error {
+	p.accept("IF", "EXISTS")
+	keyspace, name, err := p.qualifiedName(s.current)
+	if err != nil {
+		return err
+	}
+	tm, ok := s.km.Types[name]
+	if keyspace != s.km.Name || !ok {
+		return nil
+	}
+
+	switch {
+	case p.accept("ADD"):
+		p.accept("IF", "NOT", "EXISTS")
+		field, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		typ, err := p.cqlType()
+		if err != nil {
+			return err
+		}
+		tm.FieldNames = append(tm.FieldNames, field)
+		tm.FieldTypes = append(tm.FieldTypes, typ)
+	case p.accept("RENAME"):
+		p.accept("IF", "EXISTS")
+		for {
+			from, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			if err := p.expect("TO"); err != nil {
+				return err
+			}
+			to, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			for i, field := range tm.FieldNames {
+				if field == from {
+					tm.FieldNames[i] = to
+				}
+			}
+			if !p.accept("AND") {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type tokenParser struct {
+	tokens []cql.Token
+	pos    int
+}
+
+func (p *tokenParser) peek(offset int) (cql.Token, bool) {
+	if p.pos+offset >= len(p.tokens) {
+		return cql.Token{}, false
+	}
+	return p.tokens[p.pos+offset], true
+}
+
+// accept consumes the keywords or symbols words if the next tokens match them.
+func (p *tokenParser) accept(words ...string) bool {
+	for i, word := range words {
+		t, ok := p.peek(i)
+		if !ok || (t.Kind != cql.Word && t.Kind != cql.Symbol) || !strings.EqualFold(t.Text, word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *tokenParser) expect(word string) error {
+	if !p.accept(word) {
+		if t, ok := p.peek(0); ok {
+			return fmt.Errorf("expected %s got %s", word, t.Text)
+		}
+		return fmt.Errorf("expected %s got end of statement", word)
+	}
+	return nil
+}
+
+// identifier returns the next identifier, lower cased unless quoted.
+func (p *tokenParser) identifier() (string, error) {
+	t, ok := p.peek(0)
+	switch {
+	case !ok:
+		return "", fmt.Errorf("expected an identifier got end of statement")
+	case t.Kind == cql.Word:
+		p.pos++
+		return strings.ToLower(t.Text), nil
+	case t.Kind == cql.Quoted:
+		p.pos++
+		return t.Text, nil
+	default:
+		return "", fmt.Errorf("expected an identifier got %s", t.Text)
+	}
+}
+
+// qualifiedName returns the keyspace and the name of a [keyspace.]name
+// identifier, the keyspace defaulting to current.
+func (p *tokenParser) qualifiedName(current string) (string, string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", "", err
+	}
+	if !p.accept(".") {
+		return current, name, nil
+	}
+	table, err := p.identifier()
+	return name, table, err
+}
+
+// list calls fn for each element of a comma separated list.
+func (p *tokenParser) list(fn func() error) error {
+	for {
+		if err := fn(); err != nil {
+			return err
+		}
+		if !p.accept(",") {
+			return nil
+		}
+	}
+}
+
+// columnDefinition parses "name type [STATIC]".
+func (p *tokenParser) columnDefinition() (*gocql.ColumnMetadata, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	typ, err := p.cqlType()
+	if err != nil {
+		return nil, err
+	}
+	col := &gocql.ColumnMetadata{Name: name, Type: typ, Kind: gocql.ColumnRegular}
+	if p.accept("STATIC") {
+		col.Kind = gocql.ColumnStatic
+	}
+	return col, nil
+}
+
+// cqlType parses a type in the format of the schema tables, such as
+// "map<text, frozen<list<int>>>".
+func (p *tokenParser) cqlType() (string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+	// user defined types may be qualified by their keyspace
+	if p.accept(".") {
+		if name, err = p.identifier(); err != nil {
+			return "", err
+		}
+	}
+	if !p.accept("<") {
+		return name, nil
+	}
+
+	var params []string
+	for {
+		if t, ok := p.peek(0); ok && t.Kind == cql.Number {
+			p.pos++
+			params = append(params, t.Text)
+		} else {
+			param, err := p.cqlType()
+			if err != nil {
+				return "", err
+			}
+			params = append(params, param)
+		}
+		if p.accept(">") {
+			return name + "<" + strings.Join(params, ", ") + ">", nil
+		}
+		if err := p.expect(","); err != nil {
+			return "", err
+		}
+	}
+}
+
+// primaryKey parses "((pk1, pk2), ck1, ck2)" after PRIMARY KEY.
+func (p *tokenParser) primaryKey() ([]string, []string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, nil, err
+	}
+
+	var pk, ck []string
+	if p.accept("(") {
+		if err := p.list(func() error {
+			name, err := p.identifier()
+			pk = append(pk, name)
+			return err
+		}); err != nil {
+			return nil, nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		pk = []string{name}
+	}
+
+	for p.accept(",") {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		ck = append(ck, name)
+	}
+	return pk, ck, p.expect(")")
+}
+
+// clusteringOrder returns the orders of the CLUSTERING ORDER BY option of
+// the table, skipping its other options.
+func (p *tokenParser) clusteringOrder() map[string]string {
+	order := make(map[string]string)
+	for ; p.pos < len(p.tokens); p.pos++ {
+		if !p.accept("CLUSTERING", "ORDER", "BY", "(") {
+			continue
+		}
+		for {
+			name, err := p.identifier()
+			if err != nil {
+				return order
+			}
+			order[name] = "asc"
+			if p.accept("DESC") {
+				order[name] = "desc"
+			} else {
+				p.accept("ASC")
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,104 @@
+//go:build unit
+// +build unit
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+const testSchema = `
+CREATE KEYSPACE IF NOT EXISTS app WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+USE app;
+CREATE TYPE address (street text, city text, "Zip" int);
+CREATE TYPE IF NOT EXISTS app.person (name text, home frozen<address>);
+ALTER TYPE person ADD phones list<text>;
+
+-- users
+CREATE TABLE users (
+  id uuid PRIMARY KEY,
+  name text,
+  age int,
+  addr frozen<app.address>,
+  tags map<text, frozen<list<int>>>,
+  "Type" text
+) WITH comment = 'users; all of them';
+ALTER TABLE users ADD nickname text;
+ALTER TABLE users DROP age;
+
+CREATE TABLE IF NOT EXISTS app.user_events (
+  user_id uuid,
+  bucket int,
+  at timeuuid,
+  kind text static,
+  payload blob,
+  PRIMARY KEY ((user_id, bucket), at)
+) WITH CLUSTERING ORDER BY (at DESC) AND gc_grace_seconds = 10;
+
+CREATE TABLE legacy (id int PRIMARY KEY);
+DROP TABLE legacy;
+CREATE TABLE other.x (id int PRIMARY KEY);
+CREATE INDEX ON users (name);
+`
+
+func TestParseSchema(t *testing.T) {
+	p := newSchemaParser("app")
+	if err := p.parseScript(testSchema); err != nil {
+		t.Fatal(err)
+	}
+	km := p.km
+
+	if len(km.Tables) != 2 || km.Tables["users"] == nil || km.Tables["user_events"] == nil {
+		t.Fatalf("expected tables users and user_events got %v", km.Tables)
+	}
+	users := km.Tables["users"]
+	if !reflect.DeepEqual(users.OrderedColumns, []string{"id", "name", "addr", "tags", "Type", "nickname"}) {
+		t.Errorf("unexpected columns %v", users.OrderedColumns)
+	}
+	if len(users.PartitionKey) != 1 || users.PartitionKey[0].Name != "id" || len(users.ClusteringColumns) != 0 {
+		t.Errorf("unexpected primary key of users %+v %+v", users.PartitionKey, users.ClusteringColumns)
+	}
+	if typ := users.Columns["tags"].Type; typ != "map<text, frozen<list<int>>>" {
+		t.Errorf("unexpected type %s", typ)
+	}
+	if typ := users.Columns["addr"].Type; typ != "frozen<address>" {
+		t.Errorf("unexpected type %s", typ)
+	}
+
+	events := km.Tables["user_events"]
+	if len(events.PartitionKey) != 2 || events.PartitionKey[1].Name != "bucket" {
+		t.Errorf("unexpected partition key %+v", events.PartitionKey)
+	}
+	if len(events.ClusteringColumns) != 1 || events.ClusteringColumns[0].ClusteringOrder != "desc" {
+		t.Errorf("unexpected clustering columns %+v", events.ClusteringColumns)
+	}
+	if kind := events.Columns["kind"].Kind; kind != gocql.ColumnStatic {
+		t.Errorf("expected a static column got %s", kind)
+	}
+
+	person := km.Types["person"]
+	if person == nil || !reflect.DeepEqual(person.FieldNames, []string{"name", "home", "phones"}) ||
+		!reflect.DeepEqual(person.FieldTypes, []string{"text", "frozen<address>", "list<text>"}) {
+		t.Errorf("unexpected type %+v", person)
+	}
+	if address := km.Types["address"]; address == nil || address.FieldNames[2] != "Zip" {
+		t.Errorf("expected the quoted field name to be kept got %+v", address)
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, stmt := range []string{
+		"CREATE TABLE t (id int)",
+		"CREATE TABLE t (id int, PRIMARY KEY (missing))",
+		"CREATE TABLE t (id map<int PRIMARY KEY)",
+		"CREATE TYPE t (a int",
+		"CREATE TABLE t (id text PRIMARY KEY, s text = 'a)",
+	} {
+		if err := newSchemaParser("app").parseStatement(stmt); err == nil {
+			t.Errorf("%q: expected an error", stmt)
+		}
+	}
+}
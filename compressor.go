@@ -51,3 +51,14 @@ func (s SnappyCompressor) Encode(data []byte) ([]byte, error) {
 func (s SnappyCompressor) Decode(data []byte) ([]byte, error) {
 	return s2.Decode(nil, data)
 }
+
+// BlockCompressor is implemented by compressors which can compress protocol v5
+// segments. Unlike Compressor, the compressed blocks carry no length prefix, the
+// uncompressed length is transferred in the segment header instead.
+//
+// If the protocol v5 is negotiated and the configured Compressor does not
+// implement BlockCompressor, the connection is not compressed.
+type BlockCompressor interface {
+	EncodeBlock(data []byte) ([]byte, error)
+	DecodeBlock(data []byte, uncompressedLength int) ([]byte, error)
+}
@@ -156,11 +156,8 @@ type ConnConfig struct {
 	disableCoalesce bool
 }
 
-func (c *ConnConfig) logger() StdLogger {
-	if c.Logger == nil {
-		return &defaultLogger{}
-	}
-	return c.Logger
+func (c *ConnConfig) logger() *driverLogger {
+	return newDriverLogger(c.Logger, nil)
 }
 
 type ConnErrorHandler interface {
@@ -190,7 +187,7 @@ type ConnInterface interface {
 // level API.
 type Conn struct {
 	conn net.Conn
-	r    *bufio.Reader
+	r    io.Reader
 	w    contextWriter
 
 	timeout        time.Duration
@@ -220,6 +217,9 @@ type Conn struct {
 	scyllaSupported scyllaSupported
 	cqlProtoExts    []cqlProtocolExtension
 	isSchemaV2      bool
+	// segmented is set once protocol v5 segment framing is in use, it is only
+	// changed during the connection startup.
+	segmented bool
 
 	session *Session
 
@@ -231,7 +231,7 @@ type Conn struct {
 
 	timeouts int64
 
-	logger           StdLogger
+	logger           *driverLogger
 	tabletsRoutingV1 int32
 }
 
@@ -383,6 +383,9 @@ func (c *Conn) init(ctx context.Context, dialedHost *DialedHost) error {
 	// dont coalesce startup frames
 	if c.session.cfg.WriteCoalesceWaitTime > 0 && !c.cfg.disableCoalesce && !dialedHost.DisableCoalesce {
 		c.w = newWriteCoalescer(c.conn, c.writeTimeout, c.session.cfg.WriteCoalesceWaitTime, ctx.Done())
+		if c.segmented {
+			c.w = newSegmentWriter(c.w, c.blockCompressor())
+		}
 	}
 
 	if c.isScyllaConn() { // ScyllaDB does not support system.peers_v2
@@ -513,6 +516,13 @@ func (s *startupCoordinator) startup(ctx context.Context) error {
 		"DRIVER_VERSION": s.conn.session.cfg.DriverVersion,
 	}
 
+	if s.conn.compressor != nil && s.conn.version >= protoVersion5 {
+		// protocol v5 compresses segments which needs raw blocks.
+		if _, ok := s.conn.compressor.(BlockCompressor); !ok {
+			s.conn.compressor = nil
+		}
+	}
+
 	if s.conn.compressor != nil {
 		comp := s.conn.supported["COMPRESSION"]
 		name := s.conn.compressor.Name()
@@ -544,8 +554,10 @@ func (s *startupCoordinator) startup(ctx context.Context) error {
 	case error:
 		return v
 	case *readyFrame:
+		s.conn.useSegments()
 		return nil
 	case *authenticateFrame:
+		s.conn.useSegments()
 		return s.authenticateHandshake(ctx, v)
 	default:
 		return NewErrProtocol("Unknown type of response to startup frame: %s", v)
@@ -592,6 +604,37 @@ func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFram
 	}
 }
 
+// useSegments switches the connection to protocol v5 segment framing, which
+// starts right after the READY or AUTHENTICATE response. It is a no-op for
+// older protocol versions.
+func (c *Conn) useSegments() {
+	if c.version < protoVersion5 || c.segmented {
+		return
+	}
+	compressor := c.blockCompressor()
+	c.r = newSegmentReader(c.r, compressor)
+	c.w = newSegmentWriter(c.w, compressor)
+	c.segmented = true
+}
+
+func (c *Conn) blockCompressor() BlockCompressor {
+	if c.compressor == nil {
+		return nil
+	}
+	// startup only keeps compressors which implement BlockCompressor for v5.
+	return c.compressor.(BlockCompressor)
+}
+
+// newFramer returns a framer for the connection. Once segments are in use
+// compression is applied to segments and not to individual frames.
+func (c *Conn) newFramer() *framer {
+	compressor := c.compressor
+	if c.segmented {
+		compressor = nil
+	}
+	return newFramerWithExts(compressor, c.version, c.cqlProtoExts, c.logger)
+}
+
 func (c *Conn) closeWithError(err error) {
 	if c == nil {
 		return
@@ -613,14 +656,35 @@ func (c *Conn) closeWithError(err error) {
 		callsToClose = c.calls
 		// It is safe to change c.calls to nil. Nobody should use it after c.closed is set to true.
 		c.calls = nil
+	} else {
+		// the asynchronous calls are not waiting for the connection context
+		// to be done, they have to be completed.
+		for stream, req := range c.calls {
+			if req.async != nil {
+				if callsToClose == nil {
+					callsToClose = make(map[int]*callReq)
+				}
+				callsToClose[stream] = req
+			}
+		}
 	}
 	c.mu.Unlock()
 
 	for _, req := range callsToClose {
 		// we need to send the error to all waiting queries.
-		select {
-		case req.resp <- callResp{err: err}:
-		case <-req.timeout:
+		if req.async != nil {
+			if req.async.claim() {
+				closeErr := err
+				if closeErr == nil {
+					closeErr = ErrConnectionClosed
+				}
+				req.async.done(nil, &QueryError{err: closeErr, potentiallyExecuted: true})
+			}
+		} else {
+			select {
+			case req.resp <- callResp{err: err}:
+			case <-req.timeout:
+			}
 		}
 		if req.streamObserverContext != nil {
 			req.streamObserverEndOnce.Do(func() {
@@ -775,7 +839,7 @@ func (c *Conn) recv(ctx context.Context) error {
 		return fmt.Errorf("gocql: frame header stream is beyond call expected bounds: %d", head.stream)
 	} else if head.stream == -1 {
 		// TODO: handle cassandra event frames, we shouldnt get any currently
-		framer := newFramerWithExts(c.compressor, c.version, c.cqlProtoExts, c.logger)
+		framer := c.newFramer()
 		c.setTabletSupported(framer.tabletsRoutingV1)
 		if err := framer.readFrame(c, &head); err != nil {
 			return err
@@ -785,7 +849,7 @@ func (c *Conn) recv(ctx context.Context) error {
 	} else if head.stream <= 0 {
 		// reserved stream that we dont use, probably due to a protocol error
 		// or a bug in Cassandra, this should be an error, parse it and return.
-		framer := newFramerWithExts(c.compressor, c.version, c.cqlProtoExts, c.logger)
+		framer := c.newFramer()
 		c.setTabletSupported(framer.tabletsRoutingV1)
 		if err := framer.readFrame(c, &head); err != nil {
 			return err
@@ -810,13 +874,13 @@ func (c *Conn) recv(ctx context.Context) error {
 	delete(c.calls, head.stream)
 	c.mu.Unlock()
 	if call == nil || !ok {
-		c.logger.Printf("gocql: received response for stream which has no handler: header=%v\n", head)
+		c.logger.warn("received response for stream which has no handler", logAddr(c.addr), logField("header", head))
 		return c.discardFrame(head)
 	} else if head.stream != call.streamID {
 		panic(fmt.Sprintf("call has incorrect streamID: got %d expected %d", call.streamID, head.stream))
 	}
 
-	framer := newFramerWithExts(c.compressor, c.version, c.cqlProtoExts, c.logger)
+	framer := c.newFramer()
 
 	err = framer.readFrame(c, &head)
 	if err != nil {
@@ -827,6 +891,11 @@ func (c *Conn) recv(ctx context.Context) error {
 		}
 	}
 
+	if call.async != nil {
+		c.respondAsync(call, callResp{framer: framer, err: err})
+		return nil
+	}
+
 	// we either, return a response to the caller, the caller timedout, or the
 	// connection has closed. Either way we should never block indefinatly here
 	select {
@@ -875,6 +944,52 @@ type callReq struct {
 	// streamObserverEndOnce ensures that either StreamAbandoned or StreamFinished is called,
 	// but not both.
 	streamObserverEndOnce sync.Once
+
+	// async is set if the caller does not wait for the response on resp,
+	// it is passed to async.done instead.
+	async *asyncCall
+}
+
+// asyncCall is a call completed with a callback rather than a channel, see
+// Conn.execAsync.
+type asyncCall struct {
+	done func(*framer, error)
+
+	mu        sync.Mutex
+	completed bool
+	// stop stops the timers and the context watches of the call.
+	stop []func() bool
+}
+
+// claim reports whether the caller is the first to complete the call, in
+// which case it has to call done.
+func (a *asyncCall) claim() bool {
+	a.mu.Lock()
+	if a.completed {
+		a.mu.Unlock()
+		return false
+	}
+	a.completed = true
+	stop := a.stop
+	a.stop = nil
+	a.mu.Unlock()
+
+	for _, stop := range stop {
+		stop()
+	}
+	return true
+}
+
+// onComplete registers stop to be called once the call completes.
+func (a *asyncCall) onComplete(stop func() bool) {
+	a.mu.Lock()
+	if a.completed {
+		a.mu.Unlock()
+		stop()
+		return
+	}
+	a.stop = append(a.stop, stop)
+	a.mu.Unlock()
 }
 
 type callResp struct {
@@ -1110,33 +1225,30 @@ func (c *Conn) addCall(call *callReq) error {
 	return nil
 }
 
-func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*framer, error) {
+// send writes req to the connection on a new stream, registering call to
+// receive the response.
+func (c *Conn) send(ctx context.Context, req frameBuilder, tracer Tracer, call *callReq) error {
 	if ctxErr := ctx.Err(); ctxErr != nil {
-		return nil, &QueryError{err: ctxErr, potentiallyExecuted: false}
+		return &QueryError{err: ctxErr, potentiallyExecuted: false}
 	}
 
 	// TODO: move tracer onto conn
 	stream, ok := c.streams.GetStream()
 	if !ok {
-		return nil, &QueryError{err: ErrNoStreams, potentiallyExecuted: false}
+		return &QueryError{err: ErrNoStreams, potentiallyExecuted: false}
 	}
+	call.streamID = stream
 
 	// resp is basically a waiting semaphore protecting the framer
-	framer := newFramerWithExts(c.compressor, c.version, c.cqlProtoExts, c.logger)
+	framer := c.newFramer()
 	c.setTabletSupported(framer.tabletsRoutingV1)
 
-	call := &callReq{
-		timeout:  make(chan struct{}),
-		streamID: stream,
-		resp:     make(chan callResp),
-	}
-
 	if c.streamObserver != nil {
 		call.streamObserverContext = c.streamObserver.StreamContext(ctx)
 	}
 
 	if err := c.addCall(call); err != nil {
-		return nil, &QueryError{err: err, potentiallyExecuted: false}
+		return &QueryError{err: err, potentiallyExecuted: false}
 	}
 
 	// After this point, we need to either read from call.resp or close(call.timeout)
@@ -1168,7 +1280,7 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 		// We need to release the stream after we remove the call from c.calls, otherwise the existingCall != nil
 		// check above could fail.
 		c.releaseStream(call)
-		return nil, &QueryError{err: err, potentiallyExecuted: false}
+		return &QueryError{err: err, potentiallyExecuted: false}
 	}
 
 	n, err := c.w.writeContext(ctx, framer.buf)
@@ -1196,7 +1308,45 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 			// send a frame on, with all the streams used up and not returned.
 			c.closeWithError(err)
 		}
-		return nil, &QueryError{err: err, potentiallyExecuted: true}
+		return &QueryError{err: err, potentiallyExecuted: true}
+	}
+	return nil
+}
+
+// callResponse returns the frame of the response received by call.
+func (c *Conn) callResponse(call *callReq, resp callResp) (*framer, error) {
+	if resp.err != nil {
+		if !c.Closed() {
+			// if the connection is closed then we cant release the stream,
+			// this is because the request is still outstanding and we have
+			// been handed another error from another stream which caused the
+			// connection to close.
+			c.releaseStream(call)
+		}
+		return nil, &QueryError{err: resp.err, potentiallyExecuted: true}
+	}
+	// dont release the stream if detect a timeout as another request can reuse
+	// that stream and get a response for the old request, which we have no
+	// easy way of detecting.
+	//
+	// Ensure that the stream is not released if there are potentially outstanding
+	// requests on the stream to prevent nil pointer dereferences in recv().
+	c.releaseStream(call)
+
+	if v := resp.framer.header.version.version(); v != c.version {
+		return nil, &QueryError{err: NewErrProtocol("unexpected protocol version in response: got %d expected %d", v, c.version), potentiallyExecuted: true}
+	}
+
+	return resp.framer, nil
+}
+
+func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*framer, error) {
+	call := &callReq{
+		timeout: make(chan struct{}),
+		resp:    make(chan callResp),
+	}
+	if err := c.send(ctx, req, tracer, call); err != nil {
+		return nil, err
 	}
 
 	var timeoutCh <-chan time.Time
@@ -1225,29 +1375,7 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 	select {
 	case resp := <-call.resp:
 		close(call.timeout)
-		if resp.err != nil {
-			if !c.Closed() {
-				// if the connection is closed then we cant release the stream,
-				// this is because the request is still outstanding and we have
-				// been handed another error from another stream which caused the
-				// connection to close.
-				c.releaseStream(call)
-			}
-			return nil, &QueryError{err: resp.err, potentiallyExecuted: true}
-		}
-		// dont release the stream if detect a timeout as another request can reuse
-		// that stream and get a response for the old request, which we have no
-		// easy way of detecting.
-		//
-		// Ensure that the stream is not released if there are potentially outstanding
-		// requests on the stream to prevent nil pointer dereferences in recv().
-		defer c.releaseStream(call)
-
-		if v := resp.framer.header.version.version(); v != c.version {
-			return nil, &QueryError{err: NewErrProtocol("unexpected protocol version in response: got %d expected %d", v, c.version), potentiallyExecuted: true}
-		}
-
-		return resp.framer, nil
+		return c.callResponse(call, resp)
 	case <-timeoutCh:
 		close(call.timeout)
 		c.handleTimeout()
@@ -1261,6 +1389,47 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 	}
 }
 
+// execAsync writes req like exec but does not wait for the response: done is
+// called with it by the reader of the connection, or with the error which
+// ended the wait. done is called exactly once, possibly before execAsync
+// returns, and must not block.
+func (c *Conn) execAsync(ctx context.Context, req frameBuilder, tracer Tracer, done func(*framer, error)) {
+	call := &callReq{
+		timeout: make(chan struct{}),
+		async:   &asyncCall{done: done},
+	}
+	if err := c.send(ctx, req, tracer, call); err != nil {
+		if call.async.claim() {
+			done(nil, err)
+		}
+		return
+	}
+
+	if c.timeout > 0 {
+		call.async.onComplete(time.AfterFunc(c.timeout, func() {
+			if call.async.claim() {
+				c.handleTimeout()
+				done(nil, &QueryError{err: ErrTimeoutNoResponse, potentiallyExecuted: true})
+			}
+		}).Stop)
+	}
+	call.async.onComplete(afterFunc(ctx, func() {
+		if call.async.claim() {
+			done(nil, &QueryError{err: ctx.Err(), potentiallyExecuted: true})
+		}
+	}))
+}
+
+// respondAsync passes the response read by recv to an asynchronous call.
+func (c *Conn) respondAsync(call *callReq, resp callResp) {
+	if !call.async.claim() {
+		// the call already timed out, nobody waits for the response anymore
+		c.releaseStream(call)
+		return
+	}
+	call.async.done(c.callResponse(call, resp))
+}
+
 // ObservedStream observes a single request/response stream.
 type ObservedStream struct {
 	// Host of the connection used to send the stream.
@@ -1308,9 +1477,44 @@ type StreamObserverContext interface {
 }
 
 type preparedStatment struct {
-	id       []byte
-	request  preparedMetadata
-	response resultMetadata
+	id      []byte
+	request preparedMetadata
+
+	// result holds the *preparedResult, it is replaced as a whole when the
+	// server reports that the result metadata has changed (protocol v5+),
+	// for example after an ALTER TABLE.
+	result atomic.Value
+}
+
+type preparedResult struct {
+	// metadataID is sent with EXECUTE so that the server can detect stale
+	// metadata, it is only set for protocol v5+.
+	metadataID []byte
+	metadata   resultMetadata
+}
+
+func newPreparedStatement(id []byte, request preparedMetadata, resultMetadataID []byte, response resultMetadata) *preparedStatment {
+	p := &preparedStatment{
+		id:      id,
+		request: request,
+	}
+	p.setResult(resultMetadataID, response)
+	return p
+}
+
+// response returns the current result metadata of the prepared statement.
+func (p *preparedStatment) response() *preparedResult {
+	return p.result.Load().(*preparedResult)
+}
+
+func (p *preparedStatment) setResult(metadataID []byte, metadata resultMetadata) {
+	// paging state belongs to a particular result, never cache it
+	metadata.pagingState = nil
+	metadata.newMetadataID = nil
+	p.result.Store(&preparedResult{
+		metadataID: metadataID,
+		metadata:   metadata,
+	})
 }
 
 type inflightPrepare struct {
@@ -1321,7 +1525,13 @@ type inflightPrepare struct {
 }
 
 func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer) (*preparedStatment, error) {
-	stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
+	return c.prepareStatementInKeyspace(ctx, stmt, c.currentKeyspace, tracer)
+}
+
+// prepareStatementInKeyspace prepares stmt in the given keyspace, which must be
+// the current keyspace of the connection unless protocol v5+ is used.
+func (c *Conn) prepareStatementInKeyspace(ctx context.Context, stmt, keyspace string, tracer Tracer) (*preparedStatment, error) {
+	stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), keyspace, stmt)
 	flight, ok := c.session.stmtsLRU.execIfMissing(stmtCacheKey, func(lru *lru.Cache) *inflightPrepare {
 		flight := &inflightPrepare{
 			done: make(chan struct{}),
@@ -1338,7 +1548,7 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 				statement: stmt,
 			}
 			if c.version > protoVersion4 {
-				prep.keyspace = c.currentKeyspace
+				prep.keyspace = keyspace
 			}
 
 			// we won the race to do the load, if our context is canceled we shouldnt
@@ -1366,15 +1576,16 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 
 			switch x := frame.(type) {
 			case *resultPreparedFrame:
-				flight.preparedStatment = &preparedStatment{
+				flight.preparedStatment = newPreparedStatement(
 					// defensively copy as we will recycle the underlying buffer after we
 					// return.
-					id: copyBytes(x.preparedID),
+					copyBytes(x.preparedID),
 					// the type info's should _not_ have a reference to the framers read buffer,
 					// therefore we can just copy them directly.
-					request:  x.reqMeta,
-					response: x.respMeta,
-				}
+					x.reqMeta,
+					copyBytes(x.resultMetadataID),
+					x.respMeta,
+				)
 			case error:
 				flight.err = x
 			default:
@@ -1395,6 +1606,19 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 	}
 }
 
+// statementKeyspace returns the keyspace a statement with the given per-query
+// keyspace is executed in. Keyspaces other than the current keyspace of the
+// connection can only be used with protocol v5+.
+func (c *Conn) statementKeyspace(keyspace string) (string, error) {
+	if keyspace == "" || keyspace == c.currentKeyspace {
+		return c.currentKeyspace, nil
+	}
+	if c.version < protoVersion5 {
+		return "", ErrPerQueryKeyspace
+	}
+	return keyspace, nil
+}
+
 func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error {
 	if named, ok := value.(*namedValue); ok {
 		dst.name = named.name
@@ -1415,16 +1639,73 @@ func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error
 	return nil
 }
 
-func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
-	defer func() {
-		if iter == nil || c.session == nil {
-			return
-		}
-		warnings := iter.Warnings()
-		if len(warnings) > 0 && c.session.warningHandler != nil {
-			c.session.warningHandler.HandleWarnings(qry, iter.host, warnings)
-		}
-	}()
+// responseAction is what has to be done with a response before its iterator
+// is returned.
+type responseAction int
+
+const (
+	// responseDone means that the iterator can be returned.
+	responseDone responseAction = iota
+	// responseAwaitSchema means that the schema changed and the schema
+	// agreement has to be awaited.
+	responseAwaitSchema
+	// responseReprepare means that the statement was not prepared on the
+	// host anymore and the request has to be executed again.
+	responseReprepare
+)
+
+// errNotPrepared is returned by preparedStatementInKeyspace if the statement
+// is not prepared yet.
+var errNotPrepared = errors.New("gocql: statement not prepared")
+
+// preparedStatementInKeyspace returns the statement prepared in keyspace
+// without preparing it or waiting for it to be prepared, it returns
+// errNotPrepared instead.
+func (c *Conn) preparedStatementInKeyspace(stmt, keyspace string) (*preparedStatment, error) {
+	flight, ok := c.session.stmtsLRU.get(c.session.stmtsLRU.keyFor(c.host.HostID(), keyspace, stmt))
+	if !ok {
+		return nil, errNotPrepared
+	}
+	select {
+	case <-flight.done:
+		return flight.preparedStatment, flight.err
+	default:
+		return nil, errNotPrepared
+	}
+}
+
+// handleWarnings passes the warnings of the response to qry to the warning
+// handler of the session.
+func (c *Conn) handleWarnings(qry ExecutableQuery, iter *Iter) {
+	if c.session == nil || c.session.warningHandler == nil {
+		return
+	}
+	if warnings := iter.Warnings(); len(warnings) > 0 {
+		c.session.warningHandler.HandleWarnings(qry, iter.host, warnings)
+	}
+}
+
+// queryRequest is the request executing a query.
+type queryRequest struct {
+	frame    frameBuilder
+	keyspace string
+	// info and result are set if the statement is prepared.
+	info     *preparedStatment
+	result   *preparedResult
+	skipMeta bool
+}
+
+// newQueryRequest returns the request executing qry. If its statement has to
+// be prepared, it is prepared with prepare.
+func (c *Conn) newQueryRequest(qry *Query, prepare func(stmt, keyspace string) (*preparedStatment, error)) (*queryRequest, error) {
+	keyspace, err := c.statementKeyspace(qry.keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if qry.nowInSeconds && c.version < protoVersion5 {
+		return nil, ErrNowInSeconds
+	}
+
 	params := queryParams{
 		consistency: qry.cons,
 	}
@@ -1441,38 +1722,38 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 		params.pageSize = qry.pageSize
 	}
 	if c.version > protoVersion4 {
-		params.keyspace = c.currentKeyspace
+		params.keyspace = keyspace
+		params.nowInSeconds = qry.nowInSeconds
+		params.nowInSecondsValue = int32(qry.nowInSecondsValue)
 	}
 
-	var (
-		frame frameBuilder
-		info  *preparedStatment
-	)
-
+	req := &queryRequest{keyspace: keyspace}
 	if !qry.skipPrepare && qry.shouldPrepare() {
 		// Prepare all DML queries. Other queries can not be prepared.
-		var err error
-		info, err = c.prepareStatement(ctx, qry.stmt, qry.trace)
+		info, err := prepare(qry.stmt, keyspace)
 		if err != nil {
-			return &Iter{err: err}
+			return nil, err
 		}
+		// use the same result metadata for the whole execution even if it is
+		// concurrently replaced, it has to match the metadata id we send.
+		result := info.response()
 
 		values := qry.values
 		if qry.binding != nil {
 			values, err = qry.binding(&QueryInfo{
 				Id:          info.id,
 				Args:        info.request.columns,
-				Rval:        info.response.columns,
+				Rval:        result.metadata.columns,
 				PKeyColumns: info.request.pkeyColumns,
 			})
 
 			if err != nil {
-				return &Iter{err: err}
+				return nil, err
 			}
 		}
 
 		if len(values) != info.request.actualColCount {
-			return &Iter{err: fmt.Errorf("gocql: expected %d values send got %d", info.request.actualColCount, len(values))}
+			return nil, fmt.Errorf("gocql: expected %d values send got %d", info.request.actualColCount, len(values))
 		}
 
 		params.values = make([]queryValues, len(values))
@@ -1481,17 +1762,21 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 			value := values[i]
 			typ := info.request.columns[i].TypeInfo
 			if err := marshalQueryValue(typ, value, v); err != nil {
-				return &Iter{err: err}
+				return nil, err
 			}
 		}
 
 		// if the metadata was not present in the response then we should not skip it
-		params.skipMeta = !(c.session.cfg.DisableSkipMetadata || qry.disableSkipMetadata) && len(info.response.columns) != 0
+		params.skipMeta = !(c.session.cfg.DisableSkipMetadata || qry.disableSkipMetadata) && len(result.metadata.columns) != 0
 
-		frame = &writeExecuteFrame{
-			preparedID:    info.id,
-			params:        params,
-			customPayload: qry.customPayload,
+		req.info = info
+		req.result = result
+		req.skipMeta = params.skipMeta
+		req.frame = &writeExecuteFrame{
+			preparedID:       info.id,
+			resultMetadataID: result.metadataID,
+			params:           params,
+			customPayload:    qry.customPayload,
 		}
 
 		// Set "lwt", keyspace", "table" property in the query if it is present in preparedMetadata
@@ -1501,21 +1786,21 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 		qry.routingInfo.table = info.request.table
 		qry.routingInfo.mu.Unlock()
 	} else {
-		frame = &writeQueryFrame{
+		req.frame = &writeQueryFrame{
 			statement:     qry.stmt,
 			params:        params,
 			customPayload: qry.customPayload,
 		}
 	}
+	return req, nil
+}
 
-	framer, err := c.exec(ctx, frame, qry.trace)
-	if err != nil {
-		return &Iter{err: err}
-	}
-
+// queryResponse returns the iterator of the response to the request req of
+// qry and what has to be done with it before it is returned.
+func (c *Conn) queryResponse(qry *Query, req *queryRequest, framer *framer) (*Iter, responseAction) {
 	resp, err := framer.parseFrame()
 	if err != nil {
-		return &Iter{err: err}
+		return &Iter{err: err}, responseDone
 	}
 
 	if len(framer.customPayload) > 0 {
@@ -1538,13 +1823,13 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 				},
 			}, tabletInfo, []interface{}{&tabletBuilder.FirstToken, &tabletBuilder.LastToken, &tabletBuilder.Replicas})
 			if err != nil {
-				return &Iter{err: err}
+				return &Iter{err: err}, responseDone
 			}
 			tabletBuilder.KeyspaceName = qry.routingInfo.keyspace
 			tabletBuilder.TableName = qry.routingInfo.table
 			tablet, err := tabletBuilder.Build()
 			if err != nil {
-				return &Iter{err: err}
+				return &Iter{err: err}, responseDone
 			}
 			c.session.metadataDescriber.AddTablet(tablet)
 		}
@@ -1556,7 +1841,7 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 
 	switch x := resp.(type) {
 	case *resultVoidFrame:
-		return &Iter{framer: framer}
+		return &Iter{framer: framer}, responseDone
 	case *resultRowsFrame:
 		iter := &Iter{
 			meta:    x.meta,
@@ -1564,12 +1849,18 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 			numRows: x.numRows,
 		}
 
-		if params.skipMeta {
-			if info != nil {
-				iter.meta = info.response
+		if x.meta.metadataChanged() {
+			// the server sent the new metadata along with its id, the rows
+			// must be decoded with it and so must be the following executions.
+			if req.info != nil {
+				req.info.setResult(x.meta.newMetadataID, x.meta)
+			}
+		} else if req.skipMeta {
+			if req.info != nil {
+				iter.meta = req.result.metadata
 				iter.meta.pagingState = copyBytes(x.meta.pagingState)
 			} else {
-				return &Iter{framer: framer, err: errors.New("gocql: did not receive metadata but prepared info is nil")}
+				return &Iter{framer: framer, err: errors.New("gocql: did not receive metadata but prepared info is nil")}, responseDone
 			}
 		}
 
@@ -1589,31 +1880,96 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) (iter *Iter) {
 			}
 		}
 
-		return iter
+		return iter, responseDone
 	case *resultKeyspaceFrame:
-		return &Iter{framer: framer}
+		return &Iter{framer: framer}, responseDone
 	case *schemaChangeKeyspace, *schemaChangeTable, *schemaChangeFunction, *schemaChangeAggregate, *schemaChangeType:
-		iter := &Iter{framer: framer}
-		if err := c.awaitSchemaAgreement(ctx); err != nil {
-			// TODO: should have this behind a flag
-			c.logger.Println(err)
-		}
-		// dont return an error from this, might be a good idea to give a warning
-		// though. The impact of this returning an error would be that the cluster
-		// is not consistent with regards to its schema.
-		return iter
+		return &Iter{framer: framer}, responseAwaitSchema
 	case *RequestErrUnprepared:
-		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, qry.stmt)
+		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), req.keyspace, qry.stmt)
 		c.session.stmtsLRU.evictPreparedID(stmtCacheKey, x.StatementId)
-		return c.executeQuery(ctx, qry)
+		return nil, responseReprepare
 	case error:
-		return &Iter{err: x, framer: framer}
+		return &Iter{err: x, framer: framer}, responseDone
 	default:
 		return &Iter{
 			err:    NewErrProtocol("Unknown type in response to execute query (%T): %s", x, x),
 			framer: framer,
+		}, responseDone
+	}
+}
+
+func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
+	req, err := c.newQueryRequest(qry, func(stmt, keyspace string) (*preparedStatment, error) {
+		return c.prepareStatementInKeyspace(ctx, stmt, keyspace, qry.trace)
+	})
+	if err != nil {
+		return &Iter{err: err}
+	}
+
+	framer, err := c.exec(ctx, req.frame, qry.trace)
+	if err != nil {
+		return &Iter{err: err}
+	}
+
+	iter, action := c.queryResponse(qry, req, framer)
+	return c.completeQuery(ctx, qry, iter, action)
+}
+
+// completeQuery does what the response to qry requires before its iterator
+// is returned.
+func (c *Conn) completeQuery(ctx context.Context, qry *Query, iter *Iter, action responseAction) *Iter {
+	switch action {
+	case responseReprepare:
+		return c.executeQuery(ctx, qry)
+	case responseAwaitSchema:
+		if err := c.awaitSchemaAgreement(ctx); err != nil {
+			// TODO: should have this behind a flag
+			c.logger.warn("schema agreement not reached", logAddr(c.addr), logError(err))
 		}
+		// dont return an error from this, might be a good idea to give a warning
+		// though. The impact of this returning an error would be that the cluster
+		// is not consistent with regards to its schema.
+	}
+	c.handleWarnings(qry, iter)
+	return iter
+}
+
+// executeQueryAsync executes qry like executeQuery but calls done with the
+// iterator instead of returning it. The request is written on the calling
+// goroutine and done is called by the reader of the connection, unless the
+// response requires more requests, which are made on a new goroutine.
+//
+// It returns false without executing qry if its statement has not been
+// prepared on the connection yet, as it would block.
+func (c *Conn) executeQueryAsync(ctx context.Context, qry *Query, done func(*Iter)) bool {
+	req, err := c.newQueryRequest(qry, c.preparedStatementInKeyspace)
+	if err == errNotPrepared {
+		return false
+	} else if err != nil {
+		done(&Iter{err: err})
+		return true
 	}
+
+	c.execAsync(ctx, req.frame, qry.trace, func(framer *framer, err error) {
+		if err != nil {
+			done(&Iter{err: err})
+			return
+		}
+
+		iter, action := c.queryResponse(qry, req, framer)
+		if action != responseDone {
+			// the reader of the connection can't wait for the responses
+			// to the requests required to complete the query
+			go func() {
+				done(c.completeQuery(ctx, qry, iter, action))
+			}()
+			return
+		}
+		c.handleWarnings(qry, iter)
+		done(iter)
+	})
+	return true
 }
 
 func (c *Conn) Pick(qry *Query) *Conn {
@@ -1664,19 +2020,27 @@ func (c *Conn) UseKeyspace(keyspace string) error {
 	return nil
 }
 
-func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
-	defer func() {
-		if iter == nil || c.session == nil {
-			return
-		}
-		warnings := iter.Warnings()
-		if len(warnings) > 0 && c.session.warningHandler != nil {
-			c.session.warningHandler.HandleWarnings(batch, iter.host, warnings)
-		}
-	}()
+// batchRequest is the request executing a batch.
+type batchRequest struct {
+	frame    *writeBatchFrame
+	keyspace string
+	// stmts are the statements of the prepared ids.
+	stmts map[string]string
+}
 
+// newBatchRequest returns the request executing batch. The statements which
+// have to be prepared are prepared with prepare.
+func (c *Conn) newBatchRequest(batch *Batch, prepare func(stmt, keyspace string) (*preparedStatment, error)) (*batchRequest, error) {
 	if c.version == protoVersion1 {
-		return &Iter{err: ErrUnsupported}
+		return nil, ErrUnsupported
+	}
+
+	keyspace, err := c.statementKeyspace(batch.keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if batch.nowInSeconds && c.version < protoVersion5 {
+		return nil, ErrNowInSeconds
 	}
 
 	n := len(batch.Entries)
@@ -1689,6 +2053,11 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 		defaultTimestampValue: batch.defaultTimestampValue,
 		customPayload:         batch.CustomPayload,
 	}
+	if c.version > protoVersion4 {
+		req.keyspace = keyspace
+		req.nowInSeconds = batch.nowInSeconds
+		req.nowInSecondsValue = int32(batch.nowInSecondsValue)
+	}
 
 	stmts := make(map[string]string, len(batch.Entries))
 
@@ -1699,9 +2068,9 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 		b := &req.statements[i]
 
 		if len(entry.Args) > 0 || entry.binding != nil {
-			info, err := c.prepareStatement(batch.Context(), entry.Stmt, batch.trace)
+			info, err := prepare(entry.Stmt, keyspace)
 			if err != nil {
-				return &Iter{err: err}
+				return nil, err
 			}
 
 			var values []interface{}
@@ -1711,16 +2080,16 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 				values, err = entry.binding(&QueryInfo{
 					Id:          info.id,
 					Args:        info.request.columns,
-					Rval:        info.response.columns,
+					Rval:        info.response().metadata.columns,
 					PKeyColumns: info.request.pkeyColumns,
 				})
 				if err != nil {
-					return &Iter{err: err}
+					return nil, err
 				}
 			}
 
 			if len(values) != info.request.actualColCount {
-				return &Iter{err: fmt.Errorf("gocql: batch statement %d expected %d values send got %d", i, info.request.actualColCount, len(values))}
+				return nil, fmt.Errorf("gocql: batch statement %d expected %d values send got %d", i, info.request.actualColCount, len(values))
 			}
 
 			b.preparedID = info.id
@@ -1733,7 +2102,7 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 				value := values[j]
 				typ := info.request.columns[j].TypeInfo
 				if err := marshalQueryValue(typ, value, v); err != nil {
-					return &Iter{err: err}
+					return nil, err
 				}
 			}
 
@@ -1751,15 +2120,15 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 	batch.routingInfo.lwt = hasLwtEntries
 	batch.routingInfo.mu.Unlock()
 
-	// TODO: should batch support tracing?
-	framer, err := c.exec(batch.Context(), req, batch.trace)
-	if err != nil {
-		return &Iter{err: err}
-	}
+	return &batchRequest{frame: req, keyspace: keyspace, stmts: stmts}, nil
+}
 
+// batchResponse returns the iterator of the response to the request req of
+// batch and what has to be done with it before it is returned.
+func (c *Conn) batchResponse(batch *Batch, req *batchRequest, framer *framer) (*Iter, responseAction) {
 	resp, err := framer.parseFrame()
 	if err != nil {
-		return &Iter{err: err, framer: framer}
+		return &Iter{err: err, framer: framer}, responseDone
 	}
 
 	if len(framer.traceID) > 0 && batch.trace != nil {
@@ -1768,14 +2137,14 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 
 	switch x := resp.(type) {
 	case *resultVoidFrame:
-		return &Iter{}
+		return &Iter{}, responseDone
 	case *RequestErrUnprepared:
-		stmt, found := stmts[string(x.StatementId)]
+		stmt, found := req.stmts[string(x.StatementId)]
 		if found {
-			key := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
+			key := c.session.stmtsLRU.keyFor(c.host.HostID(), req.keyspace, stmt)
 			c.session.stmtsLRU.evictPreparedID(key, x.StatementId)
 		}
-		return c.executeBatch(ctx, batch)
+		return nil, responseReprepare
 	case *resultRowsFrame:
 		iter := &Iter{
 			meta:    x.meta,
@@ -1783,12 +2152,70 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) (iter *Iter) {
 			numRows: x.numRows,
 		}
 
-		return iter
+		return iter, responseDone
 	case error:
-		return &Iter{err: x, framer: framer}
+		return &Iter{err: x, framer: framer}, responseDone
 	default:
-		return &Iter{err: NewErrProtocol("Unknown type in response to batch statement: %s", x), framer: framer}
+		return &Iter{err: NewErrProtocol("Unknown type in response to batch statement: %s", x), framer: framer}, responseDone
+	}
+}
+
+func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
+	req, err := c.newBatchRequest(batch, func(stmt, keyspace string) (*preparedStatment, error) {
+		return c.prepareStatementInKeyspace(ctx, stmt, keyspace, batch.trace)
+	})
+	if err != nil {
+		return &Iter{err: err}
 	}
+
+	// TODO: should batch support tracing?
+	framer, err := c.exec(ctx, req.frame, batch.trace)
+	if err != nil {
+		return &Iter{err: err}
+	}
+
+	iter, action := c.batchResponse(batch, req, framer)
+	return c.completeBatch(ctx, batch, iter, action)
+}
+
+// completeBatch does what the response to batch requires before its iterator
+// is returned.
+func (c *Conn) completeBatch(ctx context.Context, batch *Batch, iter *Iter, action responseAction) *Iter {
+	if action == responseReprepare {
+		return c.executeBatch(ctx, batch)
+	}
+	c.handleWarnings(batch, iter)
+	return iter
+}
+
+// executeBatchAsync executes batch like executeBatch but calls done with the
+// iterator instead of returning it, see executeQueryAsync.
+func (c *Conn) executeBatchAsync(ctx context.Context, batch *Batch, done func(*Iter)) bool {
+	req, err := c.newBatchRequest(batch, c.preparedStatementInKeyspace)
+	if err == errNotPrepared {
+		return false
+	} else if err != nil {
+		done(&Iter{err: err})
+		return true
+	}
+
+	c.execAsync(ctx, req.frame, batch.trace, func(framer *framer, err error) {
+		if err != nil {
+			done(&Iter{err: err})
+			return
+		}
+
+		iter, action := c.batchResponse(batch, req, framer)
+		if action != responseDone {
+			go func() {
+				done(c.completeBatch(ctx, batch, iter, action))
+			}()
+			return
+		}
+		c.handleWarnings(batch, iter)
+		done(iter)
+	})
+	return true
 }
 
 func (c *Conn) query(ctx context.Context, statement string, values ...interface{}) (iter *Iter) {
@@ -1814,12 +2241,12 @@ const qrySystemPeersV2 = "SELECT * FROM system.peers_v2"
 
 const qrySystemLocal = "SELECT * FROM system.local WHERE key='local'"
 
-func getSchemaAgreement(queryLocalSchemasRows []string, querySystemPeersRows []schemaAgreementHost, connectAddress net.IP, port int, translateAddressPort func(addr net.IP, port int) (net.IP, int), logger StdLogger) (err error) {
+func getSchemaAgreement(queryLocalSchemasRows []string, querySystemPeersRows []schemaAgreementHost, connectAddress net.IP, port int, translateAddressPort func(addr net.IP, port int) (net.IP, int), logger *driverLogger) (err error) {
 	versions := make(map[string]struct{})
 
 	for _, row := range querySystemPeersRows {
 		if !row.IsValid() {
-			logger.Printf("invalid peer or peer with empty schema_version: peer=%q", row)
+			logger.warn("invalid peer or peer with empty schema_version", logField("peer", row))
 			continue
 		}
 		versions[row.SchemaVersion.String()] = struct{}{}
@@ -1933,6 +2360,8 @@ var (
 	ErrHostDown            = errors.New("gocql: host is nil or down")
 	ErrNoPool              = errors.New("gocql: host does not have a pool")
 	ErrNoConnectionsInPool = errors.New("gocql: host pool does not have connections")
+	ErrPerQueryKeyspace    = errors.New("gocql: per-query keyspace requires protocol version 5 or higher")
+	ErrNowInSeconds        = errors.New("gocql: now_in_seconds requires protocol version 5 or higher")
 )
 
 type ErrSchemaMismatch struct {
@@ -733,7 +733,7 @@ func TestStream0(t *testing.T) {
 	conn := &Conn{
 		r:       bufio.NewReader(&buf),
 		streams: streams.New(protoVersion4),
-		logger:  &defaultLogger{},
+		logger:  newDriverLogger(&defaultLogger{}, nil),
 	}
 
 	err := conn.recv(context.Background())
@@ -768,6 +768,82 @@ func TestContext_Timeout(t *testing.T) {
 	}
 }
 
+func TestQueryRequestTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Timeout = 5 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	start := time.Now()
+	qry := db.Query("timeout").Idempotent(true).
+		RetryPolicy(&SimpleRetryPolicy{NumRetries: 3}).
+		Timeout(100 * time.Millisecond)
+	err = qry.Exec()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to get %v got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > cluster.Timeout {
+		t.Fatalf("query was not bounded by its timeout, took %v", elapsed)
+	}
+	if attempts := qry.Attempts(); attempts != 1 {
+		t.Fatalf("expected the query to be attempted once, got %d attempts", attempts)
+	}
+}
+
+func TestQueryAttemptTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var addresses []string
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+		srv := NewTestServerWithAddress(ip+":0", t, defaultProto, ctx)
+		defer srv.Stop()
+		addresses = append(addresses, srv.Address)
+	}
+
+	cluster := testCluster(defaultProto, addresses...)
+	cluster.Timeout = 5 * time.Second
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// every attempt times out, so the query is retried on each of the hosts
+	qry := db.Query("timeout").Idempotent(true).
+		RetryPolicy(&SimpleRetryPolicy{NumRetries: 5}).
+		AttemptTimeout(50 * time.Millisecond)
+	err = qry.Exec()
+	if !errors.Is(err, ErrTimeoutNoResponse) {
+		t.Fatalf("expected to get %v got %v", ErrTimeoutNoResponse, err)
+	}
+	if attempts := qry.Attempts(); attempts != len(addresses) {
+		t.Fatalf("expected %d attempts got %d", len(addresses), attempts)
+	}
+
+	// the overall timeout takes precedence over the attempt timeout
+	qry = db.Query("timeout").Idempotent(true).
+		RetryPolicy(&SimpleRetryPolicy{NumRetries: 5}).
+		AttemptTimeout(50 * time.Millisecond).
+		Timeout(80 * time.Millisecond)
+	err = qry.Exec()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to get %v got %v", context.DeadlineExceeded, err)
+	}
+	if attempts := qry.Attempts(); attempts != 2 {
+		t.Fatalf("expected the query to be retried until its timeout, got %d attempts", attempts)
+	}
+}
+
 type TestReconnectionPolicy struct {
 	NumRetries       int
 	GetIntervalCalls []int
@@ -1587,7 +1663,7 @@ func TestGetSchemaAgreement(t *testing.T) {
 		return addr, port
 	}
 
-	var logger StdLogger
+	var logger *driverLogger
 
 	t.Run("SchemaNotConsistent", func(t *testing.T) {
 		err := getSchemaAgreement(
@@ -1629,3 +1705,31 @@ func TestGetSchemaAgreement(t *testing.T) {
 		assert.NoError(t, err, "expected no error when all nodes have the same schema")
 	})
 }
+
+func TestConnStatementKeyspace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version  uint8
+		keyspace string
+		expected string
+		err      error
+	}{
+		{protoVersion4, "", "session_ks", nil},
+		{protoVersion4, "session_ks", "session_ks", nil},
+		{protoVersion4, "other_ks", "", ErrPerQueryKeyspace},
+		{protoVersion5, "", "session_ks", nil},
+		{protoVersion5, "other_ks", "other_ks", nil},
+	}
+
+	for _, test := range tests {
+		c := &Conn{version: test.version, currentKeyspace: "session_ks"}
+		keyspace, err := c.statementKeyspace(test.keyspace)
+		if err != test.err {
+			t.Errorf("v%d %q: expected error %v got %v", test.version, test.keyspace, test.err, err)
+		}
+		if keyspace != test.expected {
+			t.Errorf("v%d %q: expected keyspace %q got %q", test.version, test.keyspace, test.expected, keyspace)
+		}
+	}
+}
@@ -263,7 +263,7 @@ type hostConnPool struct {
 	filling    bool
 	debouncer  *debounce.SimpleDebouncer
 
-	logger StdLogger
+	logger *driverLogger
 }
 
 func (h *hostConnPool) String() string {
@@ -424,21 +424,17 @@ func (pool *hostConnPool) logConnectErr(err error) {
 	if opErr, ok := err.(*net.OpError); ok && (opErr.Op == "dial" || opErr.Op == "read") {
 		// connection refused
 		// these are typical during a node outage so avoid log spam.
-		if gocqlDebug {
-			pool.logger.Printf("unable to dial %q: %v\n", pool.host, err)
-		}
+		pool.logger.debug("unable to dial", logHost(pool.host), logHostID(pool.host), logError(err))
 	} else if err != nil {
 		// unexpected error
-		pool.logger.Printf("error: failed to connect to %q due to error: %v", pool.host, err)
+		pool.logger.error("failed to connect", logHost(pool.host), logHostID(pool.host), logError(err))
 	}
 }
 
 // transition back to a not-filling state.
 func (pool *hostConnPool) fillingStopped(err error) {
 	if err != nil {
-		if gocqlDebug {
-			pool.logger.Printf("gocql: filling stopped %q: %v\n", pool.host.ConnectAddress(), err)
-		}
+		pool.logger.debug("filling stopped", logHost(pool.host), logHostID(pool.host), logError(err))
 		// wait for some time to avoid back-to-back filling
 		// this provides some time between failed attempts
 		// to fill the pool for the host to recover
@@ -454,9 +450,7 @@ func (pool *hostConnPool) fillingStopped(err error) {
 
 	// if we errored and the size is now zero, make sure the host is marked as down
 	// see https://github.com/apache/cassandra-gocql-driver/issues/1614
-	if gocqlDebug {
-		pool.logger.Printf("gocql: conns of pool after stopped %q: %v\n", host.ConnectAddress(), count)
-	}
+	pool.logger.debug("conns of pool after stopped", logHost(host), logHostID(host), logField("conns", count))
 	if err != nil && count == 0 {
 		if pool.session.cfg.ConvictionPolicy.AddFailure(err, host) {
 			pool.session.handleNodeDown(host.ConnectAddress(), port)
@@ -516,10 +510,8 @@ func (pool *hostConnPool) connect() (err error) {
 				break
 			}
 		}
-		if gocqlDebug {
-			pool.logger.Printf("gocql: connection failed %q: %v, reconnecting with %T\n",
-				pool.host.ConnectAddress(), err, reconnectionPolicy)
-		}
+		pool.logger.debug("connection failed, reconnecting", logHost(pool.host), logHostID(pool.host),
+			logShard(shardID), logError(err), logField("attempt", i+1))
 		time.Sleep(reconnectionPolicy.GetInterval(i))
 	}
 
@@ -581,9 +573,7 @@ func (pool *hostConnPool) HandleError(conn *Conn, err error, closed bool) {
 		return
 	}
 
-	if gocqlDebug {
-		pool.logger.Printf("gocql: pool connection error %q: %v\n", conn.addr, err)
-	}
+	pool.logger.debug("pool connection error", logAddr(conn.addr), logHostID(pool.host), logShard(conn.scyllaSupported.shard), logError(err))
 
 	pool.connPicker.Remove(conn)
 	go pool.fill_debounce()
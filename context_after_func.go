@@ -0,0 +1,10 @@
+//go:build go1.21
+
+package gocql
+
+import "context"
+
+// afterFunc calls f once ctx is done, unless stopped before.
+func afterFunc(ctx context.Context, f func()) (stop func() bool) {
+	return context.AfterFunc(ctx, f)
+}
@@ -0,0 +1,33 @@
+//go:build !go1.21
+
+package gocql
+
+import (
+	"context"
+	"sync"
+)
+
+// afterFunc calls f once ctx is done, unless stopped before.
+func afterFunc(ctx context.Context, f func()) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return true }
+	}
+
+	var once sync.Once
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			once.Do(f)
+		case <-stopped:
+		}
+	}()
+	return func() bool {
+		stop := false
+		once.Do(func() {
+			close(stopped)
+			stop = true
+		})
+		return stop
+	}
+}
@@ -274,14 +274,14 @@ func (c *controlConn) connect(hosts []*HostInfo) error {
 	for _, host := range hosts {
 		conn, err = c.session.dial(c.session.ctx, host, &cfg, c)
 		if err != nil {
-			c.session.logger.Printf("gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			c.session.logger.warn("unable to dial control conn", logHost(host), logError(err))
 			continue
 		}
 		err = c.setupConn(conn)
 		if err == nil {
 			break
 		}
-		c.session.logger.Printf("gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+		c.session.logger.warn("unable to setup control conn", logHost(host), logError(err))
 		conn.Close()
 		conn = nil
 	}
@@ -388,18 +388,19 @@ func (c *controlConn) reconnect() {
 
 	err := c.attemptReconnect()
 	if err != nil {
-		c.session.logger.Printf("gocql: unable to reconnect control connection: %v\n", err)
+		c.session.logger.error("unable to reconnect control connection", logError(err))
 		return
 	}
+	c.session.metrics.trackControlReconnect()
 
 	err = c.session.refreshRingNow()
 	if err != nil {
-		c.session.logger.Printf("gocql: unable to refresh ring: %v\n", err)
+		c.session.logger.warn("unable to refresh ring", logError(err))
 	}
 
 	err = c.session.metadataDescriber.refreshAllSchema()
 	if err != nil {
-		c.session.logger.Printf("gocql: unable to refresh the schema: %v\n", err)
+		c.session.logger.warn("unable to refresh the schema", logError(err))
 	}
 }
 
@@ -425,8 +426,7 @@ func (c *controlConn) attemptReconnect() error {
 		return nil
 	}
 
-	c.session.logger.Printf("gocql: unable to connect to any ring node: %v\n", err)
-	c.session.logger.Printf("gocql: control falling back to initial contact points.\n")
+	c.session.logger.warn("unable to connect to any ring node, control falling back to initial contact points", logError(err))
 	// Fallback to initial contact points, as it may be the case that all known initialHosts
 	// changed their IPs while keeping the same hostname(s).
 	initialHosts, resolvErr := addrsToHosts(c.session.cfg.DNSResolver, c.session.cfg.translateAddressPort, c.session.cfg.Hosts, c.session.cfg.Port, c.session.logger)
@@ -444,12 +444,12 @@ func (c *controlConn) attemptReconnectToAnyOfHosts(hosts []*HostInfo) error {
 			if c.session.cfg.ConvictionPolicy.AddFailure(err, host) {
 				c.session.handleNodeDown(host.ConnectAddress(), host.Port())
 			}
-			c.session.logger.Printf("gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			c.session.logger.debug("unable to dial control conn", logHost(host), logHostID(host), logError(err))
 			continue
 		}
 		err = c.setupConn(conn)
 		if err != nil {
-			c.session.logger.Printf("gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			c.session.logger.debug("unable to setup control conn", logHost(host), logHostID(host), logError(err))
 			conn.Close()
 			continue
 		}
@@ -501,8 +501,8 @@ func (c *controlConn) query(statement string, values ...interface{}) (iter *Iter
 		q.conn = ch.conn.(*Conn)
 		iter = ch.conn.executeQuery(context.TODO(), q)
 
-		if gocqlDebug && iter.err != nil {
-			c.session.logger.Printf("control: error executing %q: %v\n", statement, iter.err)
+		if iter.err != nil {
+			c.session.logger.debug("control conn error executing statement", logHost(ch.host), logField("statement", statement), logError(iter.err))
 		}
 
 		q.AddAttempts(1, c.getConn().host)
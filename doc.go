@@ -194,6 +194,13 @@
 //
 // See Example for complete example.
 //
+// Settings shared by a group of queries, like consistency, page size, timeouts, retry and host selection policies,
+// can be registered as an ExecutionProfile in ClusterConfig.ExecutionProfiles and selected with Query.Profile or
+// Batch.Profile:
+//
+//	iter := session.Query(`SELECT id, text FROM tweet WHERE timeline = ?`,
+//		"me").Profile("analytics").WithContext(ctx).Iter()
+//
 // # Prepared statements
 //
 // The driver automatically prepares DML queries (SELECT/INSERT/UPDATE/DELETE/BATCH statements) and maintains a cache
@@ -307,6 +314,40 @@
 //
 // See Example_dynamicColumns.
 //
+// # Scanning into structs
+//
+// Rows can be scanned into structs with Iter.StructScan and Query.ScanStruct, and struct fields can be bound
+// as query arguments with Query.BindStruct. Columns and bind variables are matched to fields by the name
+// given in the `cql` tag of the field or, if the field has no tag, by the field name converted to snake_case:
+//
+//	type Tweet struct {
+//		Timeline string
+//		ID       gocql.UUID `cql:"id"`
+//		Text     string
+//		Internal int `cql:"-"`
+//	}
+//
+//	var tweet Tweet
+//	err := session.Query(`SELECT timeline, id, text FROM tweet WHERE timeline = ? LIMIT 1`,
+//		"me").WithContext(ctx).ScanStruct(&tweet)
+//
+//	err = session.Query(`INSERT INTO tweet (timeline, id, text) VALUES (?, ?, ?)`).
+//		BindStruct(tweet).WithContext(ctx).Exec()
+//
+// With Go 1.23 or newer, Rows returns a typed iterator for range-over-func loops and QueryAll collects all rows
+// of a query, decoding them into structs, structs matched by position, or single column values:
+//
+//	for tweet, err := range gocql.Rows[Tweet](session.Query(`SELECT timeline, id, text FROM tweet`).Iter()) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(tweet.ID, tweet.Text)
+//	}
+//
+// Unexported fields and fields tagged with `cql:"-"` are ignored. Fields of embedded structs without a tag
+// are matched as if they were fields of the outer struct. A field that is itself a struct is unmarshaled as
+// a whole, so user defined types and tuples map to nested structs as described in Marshal and Unmarshal.
+//
 // # Batches
 //
 // The CQL protocol supports sending batches of DML statements (INSERT/UPDATE/DELETE) and so does gocql.
@@ -358,7 +399,8 @@
 // cause the driver to retry on a different node if the query is taking longer than a specified delay even before the
 // driver receives an error or timeout from the server. When a query is speculatively executed, the original execution
 // is still executing. The two parallel executions of the query race to return a result, the first received result will
-// be returned.
+// be returned. PercentileSpeculativeExecution adapts the delay to the observed latency of each statement and limits the
+// rate of speculative executions. ObservedQuery reports whether an attempt was speculative and whether it won the race.
 //
 // # User-defined types
 //
@@ -383,6 +425,10 @@
 //   - ConnectObserver for monitoring new connections from the driver to the database.
 //   - FrameHeaderObserver for monitoring individual protocol frames.
 //
+// Session.Metrics returns a snapshot of the metrics the session gathers itself: request counts and latency histograms
+// per host and per statement type, retries, speculative executions, timeouts, connection pool and stream usage.
+// The metrics package publishes them with expvar or serves them in the Prometheus text format.
+//
 // CQL protocol also supports tracing of queries. When enabled, the database will write information about
 // internal events that happened during execution of the query. You can use Query.Trace to request tracing and receive
 // the session ID that the database used to store the trace information in system_traces.sessions and
@@ -392,4 +438,8 @@
 // There is also a new implementation of Tracer - TracerEnhanced, that is intended to be more reliable and convinient to use.
 // It has a funcionality to check if trace is ready to be extracted and only actually gets it if requested which makes
 // the impact on a performance smaller.
+//
+// NewSlowQueryObserver returns an observer logging the slow attempts of queries and batches, with rate limiting per
+// statement, redaction of bound values and sampling of the other attempts. It can trace the next executions of a slow
+// statement with a Tracer, so that tracing is limited to the statements worth investigating.
 package gocql // import "github.com/gocql/gocql"
@@ -25,7 +25,9 @@
 package gocql
 
 import (
+	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -39,7 +41,7 @@ type eventDebouncer struct {
 	callback func([]frame)
 	quit     chan struct{}
 
-	logger StdLogger
+	logger *driverLogger
 }
 
 func newEventDebouncer(name string, eventHandler func([]frame), logger StdLogger) *eventDebouncer {
@@ -48,7 +50,7 @@ func newEventDebouncer(name string, eventHandler func([]frame), logger StdLogger
 		quit:     make(chan struct{}),
 		timer:    time.NewTimer(eventDebounceTime),
 		callback: eventHandler,
-		logger:   logger,
+		logger:   newDriverLogger(logger, nil),
 	}
 	e.timer.Stop()
 	go e.flusher()
@@ -100,7 +102,7 @@ func (e *eventDebouncer) debounce(frame frame) {
 	if len(e.events) < eventBufferSize {
 		e.events = append(e.events, frame)
 	} else {
-		e.logger.Printf("%s: buffer full, dropping event frame: %s", e.name, frame)
+		e.logger.warn("buffer full, dropping event frame", logField("debouncer", e.name), logField("frame", frame))
 	}
 
 	e.mu.Unlock()
@@ -109,13 +111,11 @@ func (e *eventDebouncer) debounce(frame frame) {
 func (s *Session) handleEvent(framer *framer) {
 	frame, err := framer.parseFrame()
 	if err != nil {
-		s.logger.Printf("gocql: unable to parse event frame: %v\n", err)
+		s.logger.warn("unable to parse event frame", logError(err))
 		return
 	}
 
-	if gocqlDebug {
-		s.logger.Printf("gocql: handling frame: %v\n", frame)
-	}
+	s.logger.debug("handling event frame", logField("frame", frame))
 
 	switch f := frame.(type) {
 	case *schemaChangeKeyspace, *schemaChangeFunction,
@@ -125,11 +125,29 @@ func (s *Session) handleEvent(framer *framer) {
 	case *topologyChangeEventFrame, *statusChangeEventFrame:
 		s.nodeEvents.debounce(frame)
 	default:
-		s.logger.Printf("gocql: invalid event frame (%T): %v\n", f, f)
+		s.logger.warn("invalid event frame", logField("type", fmt.Sprintf("%T", f)), logField("frame", f))
 	}
 }
 
 func (s *Session) handleSchemaEvent(frames []frame) {
+	var (
+		events []SchemaChangeEvent
+		old    map[string]*KeyspaceMetadata
+	)
+	if !s.schemaSubscribers.empty() {
+		old = make(map[string]*KeyspaceMetadata)
+		for _, frame := range frames {
+			event, ok := newSchemaChangeEvent(frame)
+			if !ok {
+				continue
+			}
+			events = append(events, event)
+			if _, ok := old[event.Keyspace]; !ok {
+				old[event.Keyspace], _ = s.metadataDescriber.metadata.keyspaceMetadata.getKeyspace(event.Keyspace)
+			}
+		}
+	}
+
 	// TODO: debounce events
 	for _, frame := range frames {
 		switch f := frame.(type) {
@@ -147,6 +165,10 @@ func (s *Session) handleSchemaEvent(frames []frame) {
 			s.metadataDescriber.clearSchema(f.keyspace)
 		}
 	}
+
+	if len(events) > 0 {
+		s.publishSchemaChanges(events, old)
+	}
 }
 
 func (s *Session) handleKeyspaceChange(keyspace, change string) {
@@ -203,9 +225,7 @@ func (s *Session) handleNodeEvent(frames []frame) {
 	}
 
 	for _, f := range sEvents {
-		if gocqlDebug {
-			s.logger.Printf("gocql: dispatching status change event: %+v\n", f)
-		}
+		s.logger.debug("dispatching status change event", logField("change", f.change), logAddr(net.JoinHostPort(f.host.String(), strconv.Itoa(f.port))))
 
 		// ignore events we received if they were disabled
 		// see https://github.com/apache/cassandra-gocql-driver/issues/1591
@@ -223,9 +243,7 @@ func (s *Session) handleNodeEvent(frames []frame) {
 }
 
 func (s *Session) handleNodeUp(eventIp net.IP, eventPort int) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeUp: %s:%d\n", eventIp.String(), eventPort)
-	}
+	s.logger.debug("node up", logAddr(net.JoinHostPort(eventIp.String(), strconv.Itoa(eventPort))))
 
 	host, ok := s.hostSource.getHostByIP(eventIp.String())
 	if !ok {
@@ -250,30 +268,32 @@ func (s *Session) startPoolFill(host *HostInfo) {
 }
 
 func (s *Session) handleNodeConnected(host *HostInfo) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeConnected: %s:%d\n", host.ConnectAddress(), host.Port())
-	}
+	s.logger.debug("node connected", logHost(host), logHostID(host))
 
-	host.setState(NodeUp)
+	wasDown := host.swapState(NodeUp) == NodeDown
 
 	if !s.cfg.filterHost(host) {
 		s.policy.HostUp(host)
+		if wasDown {
+			s.hostStateDispatcher.dispatch(HostStateUp, host)
+		}
 	}
 }
 
 func (s *Session) handleNodeDown(ip net.IP, port int) {
-	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeDown: %s:%d\n", ip.String(), port)
-	}
+	s.logger.debug("node down", logAddr(net.JoinHostPort(ip.String(), strconv.Itoa(port))))
 
 	host, ok := s.hostSource.getHostByIP(ip.String())
 	if ok {
-		host.setState(NodeDown)
+		wasUp := host.swapState(NodeDown) == NodeUp
 		if s.cfg.filterHost(host) {
 			return
 		}
 
 		s.policy.HostDown(host)
+		if wasUp {
+			s.hostStateDispatcher.dispatch(HostStateDown, host)
+		}
 		hostID := host.HostID()
 		s.pool.removeHost(hostID)
 	}
@@ -0,0 +1,322 @@
+package gocql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExecutionProfileNotFound is matched by errors.Is for errors of queries
+// and batches which select a profile not registered in ClusterConfig.ExecutionProfiles.
+var ErrExecutionProfileNotFound = errors.New("gocql: execution profile not found")
+
+// ExecutionProfile is a named set of execution settings registered in
+// ClusterConfig.ExecutionProfiles and selected with Query.Profile or
+// Batch.Profile, so that they don't have to be set on every query:
+//
+//	localOne := gocql.LocalOne
+//	cluster.ExecutionProfiles = map[string]*gocql.ExecutionProfile{
+//		"analytics": {
+//			Consistency:         &localOne,
+//			PageSize:            10000,
+//			Timeout:             time.Minute,
+//			HostSelectionPolicy: gocql.DCAwareRoundRobinPolicy("analytics"),
+//		},
+//	}
+//
+//	iter := session.Query(stmt).Profile("analytics").Iter()
+//
+// The settings of a query are, in order of precedence, the settings made on
+// the query, before or after selecting the profile, the settings of the
+// profile and the session defaults. Settings left nil or at their zero value
+// are not set by the profile.
+type ExecutionProfile struct {
+	// Consistency of queries.
+	Consistency *Consistency
+
+	// SerialConsistency of conditional queries, either SERIAL or LOCAL_SERIAL.
+	SerialConsistency Consistency
+
+	// PageSize of queries, ignored by batches.
+	PageSize int
+
+	// Timeout bounds the whole execution of queries, see Query.Timeout.
+	Timeout time.Duration
+
+	// AttemptTimeout bounds every single attempt of queries, see Query.AttemptTimeout.
+	AttemptTimeout time.Duration
+
+	RetryPolicy RetryPolicy
+
+	SpeculativeExecutionPolicy SpeculativeExecutionPolicy
+
+	// Idempotent marks queries as idempotent or not, instead of
+	// ClusterConfig.DefaultIdempotence.
+	Idempotent *bool
+
+	// HostSelectionPolicy picks the hosts of queries instead of the policy of
+	// the session, for example to send analytics queries to a dedicated
+	// datacenter. It receives the same host events as the policy of the
+	// session and, like it, can not be used by multiple sessions.
+	HostSelectionPolicy HostSelectionPolicy
+}
+
+func (p *ExecutionProfile) validate() error {
+	if p == nil {
+		return errors.New("execution profile is nil")
+	}
+	if p.SerialConsistency > 0 && !p.SerialConsistency.IsSerial() {
+		return fmt.Errorf("SerialConsistency is not allowed to be anything else but SERIAL or LOCAL_SERIAL. Recived value: %v", p.SerialConsistency)
+	}
+	return nil
+}
+
+// executionSettings are the settings of queries and batches which profiles
+// set, a set of them records the settings made on a query or a batch.
+type executionSettings uint8
+
+const (
+	settingConsistency executionSettings = 1 << iota
+	settingSerialConsistency
+	settingPageSize
+	settingTimeout
+	settingAttemptTimeout
+	settingRetryPolicy
+	settingSpeculativeExecutionPolicy
+	settingIdempotent
+)
+
+// noExecutionProfile sets none of the settings of queries and batches.
+var noExecutionProfile = &ExecutionProfile{}
+
+// applyToQuery sets the settings of q which were not made on it to the
+// settings of the profile, or to the session defaults if the profile doesn't
+// set them. p may be nil. It is called with the session read locked.
+func (p *ExecutionProfile) applyToQuery(q *Query) {
+	if p == nil {
+		p = noExecutionProfile
+	}
+	s := q.session
+
+	if q.explicit&settingConsistency == 0 {
+		q.cons = s.cons
+		if p.Consistency != nil {
+			q.cons = *p.Consistency
+		}
+	}
+	if q.explicit&settingSerialConsistency == 0 {
+		q.serialCons = s.cfg.SerialConsistency
+		if p.SerialConsistency > 0 {
+			q.serialCons = p.SerialConsistency
+		}
+	}
+	if q.explicit&settingPageSize == 0 {
+		q.pageSize = s.pageSize
+		if p.PageSize > 0 {
+			q.pageSize = p.PageSize
+		}
+	}
+	if q.explicit&settingTimeout == 0 {
+		q.timeout = p.Timeout
+	}
+	if q.explicit&settingAttemptTimeout == 0 {
+		q.attemptTimeout = p.AttemptTimeout
+	}
+	if q.explicit&settingRetryPolicy == 0 {
+		q.rt = s.cfg.RetryPolicy
+		if p.RetryPolicy != nil {
+			q.rt = p.RetryPolicy
+		}
+	}
+	if q.explicit&settingSpeculativeExecutionPolicy == 0 {
+		q.spec = p.SpeculativeExecutionPolicy
+		if q.spec == nil {
+			q.spec = &NonSpeculativeExecution{}
+		}
+	}
+	if q.explicit&settingIdempotent == 0 {
+		q.idempotent = s.cfg.DefaultIdempotence
+		if p.Idempotent != nil {
+			q.idempotent = *p.Idempotent
+		}
+	}
+}
+
+// applyToBatch sets the settings of b as applyToQuery does for queries.
+func (p *ExecutionProfile) applyToBatch(b *Batch) {
+	if p == nil {
+		p = noExecutionProfile
+	}
+	s := b.session
+
+	if b.Cons != b.appliedCons {
+		// the consistency was assigned to Cons
+		b.explicit |= settingConsistency
+	}
+	if b.explicit&settingConsistency == 0 {
+		b.Cons = s.cons
+		if p.Consistency != nil {
+			b.Cons = *p.Consistency
+		}
+	}
+	b.appliedCons = b.Cons
+	if b.explicit&settingSerialConsistency == 0 {
+		b.serialCons = s.cfg.SerialConsistency
+		if p.SerialConsistency > 0 {
+			b.serialCons = p.SerialConsistency
+		}
+	}
+	if b.explicit&settingTimeout == 0 {
+		b.timeout = p.Timeout
+	}
+	if b.explicit&settingAttemptTimeout == 0 {
+		b.attemptTimeout = p.AttemptTimeout
+	}
+	if b.explicit&settingRetryPolicy == 0 {
+		b.rt = s.cfg.RetryPolicy
+		if p.RetryPolicy != nil {
+			b.rt = p.RetryPolicy
+		}
+	}
+	if b.explicit&settingSpeculativeExecutionPolicy == 0 {
+		b.spec = p.SpeculativeExecutionPolicy
+		if b.spec == nil {
+			b.spec = &NonSpeculativeExecution{}
+		}
+	}
+	b.idempotent = p.Idempotent != nil && *p.Idempotent
+}
+
+// executionProfile returns the profile registered under name.
+func (s *Session) executionProfile(name string) (*ExecutionProfile, error) {
+	profile, ok := s.cfg.ExecutionProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrExecutionProfileNotFound, name)
+	}
+	return profile, nil
+}
+
+// profilesHostPolicy is the HostSelectionPolicy of sessions with execution
+// profiles carrying their own HostSelectionPolicy. It picks hosts with the
+// policy of the profile of the query and forwards host events to all of them.
+type profilesHostPolicy struct {
+	HostSelectionPolicy // the policy of the session
+
+	// profiles holds the distinct policies of the profiles
+	profiles []HostSelectionPolicy
+}
+
+// newProfilesHostPolicy wraps policy if any of the profiles carries its own
+// HostSelectionPolicy, otherwise it returns policy.
+func newProfilesHostPolicy(policy HostSelectionPolicy, profiles map[string]*ExecutionProfile) HostSelectionPolicy {
+	p := &profilesHostPolicy{HostSelectionPolicy: policy}
+	for _, profile := range profiles {
+		if profile.HostSelectionPolicy == nil || profile.HostSelectionPolicy == policy || p.hasProfilePolicy(profile.HostSelectionPolicy) {
+			continue
+		}
+		p.profiles = append(p.profiles, profile.HostSelectionPolicy)
+	}
+	if len(p.profiles) == 0 {
+		return policy
+	}
+	return p
+}
+
+func (p *profilesHostPolicy) hasProfilePolicy(policy HostSelectionPolicy) bool {
+	for _, profilePolicy := range p.profiles {
+		if profilePolicy == policy {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *profilesHostPolicy) each(f func(HostSelectionPolicy)) {
+	f(p.HostSelectionPolicy)
+	for _, policy := range p.profiles {
+		f(policy)
+	}
+}
+
+func (p *profilesHostPolicy) Init(s *Session) {
+	p.each(func(policy HostSelectionPolicy) { policy.Init(s) })
+}
+
+func (p *profilesHostPolicy) Reset() {
+	p.each(func(policy HostSelectionPolicy) { policy.Reset() })
+}
+
+func (p *profilesHostPolicy) IsOperational(s *Session) error {
+	if err := p.HostSelectionPolicy.IsOperational(s); err != nil {
+		return err
+	}
+	for _, policy := range p.profiles {
+		if err := policy.IsOperational(s); err != nil {
+			return fmt.Errorf("execution profile host selection policy: %v", err)
+		}
+	}
+	return nil
+}
+
+func (p *profilesHostPolicy) KeyspaceChanged(update KeyspaceUpdateEvent) {
+	p.each(func(policy HostSelectionPolicy) { policy.KeyspaceChanged(update) })
+}
+
+func (p *profilesHostPolicy) SetPartitioner(partitioner string) {
+	p.each(func(policy HostSelectionPolicy) { policy.SetPartitioner(partitioner) })
+}
+
+func (p *profilesHostPolicy) AddHost(host *HostInfo) {
+	p.each(func(policy HostSelectionPolicy) { policy.AddHost(host) })
+}
+
+func (p *profilesHostPolicy) AddHosts(hosts []*HostInfo) {
+	p.each(func(policy HostSelectionPolicy) {
+		if v, ok := policy.(bulkAddHosts); ok {
+			v.AddHosts(hosts)
+			return
+		}
+		for _, host := range hosts {
+			policy.AddHost(host)
+		}
+	})
+}
+
+func (p *profilesHostPolicy) RemoveHost(host *HostInfo) {
+	p.each(func(policy HostSelectionPolicy) { policy.RemoveHost(host) })
+}
+
+func (p *profilesHostPolicy) HostUp(host *HostInfo) {
+	p.each(func(policy HostSelectionPolicy) { policy.HostUp(host) })
+}
+
+func (p *profilesHostPolicy) HostDown(host *HostInfo) {
+	p.each(func(policy HostSelectionPolicy) { policy.HostDown(host) })
+}
+
+func (p *profilesHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	if qry != nil {
+		if profile := qry.executionProfile(); profile != nil && profile.HostSelectionPolicy != nil {
+			return profile.HostSelectionPolicy.Pick(qry)
+		}
+	}
+	return p.HostSelectionPolicy.Pick(qry)
+}
+
+func (p *profilesHostPolicy) trackLatency(host *HostInfo, latency time.Duration, err error) {
+	p.each(func(policy HostSelectionPolicy) {
+		if tracker, ok := policy.(hostLatencyTracker); ok {
+			tracker.trackLatency(host, latency, err)
+		}
+	})
+}
+
+func (p *profilesHostPolicy) Ready() bool {
+	ready := true
+	p.each(func(policy HostSelectionPolicy) {
+		if rdy, ok := policy.(ReadyPolicy); ok && !rdy.Ready() {
+			ready = false
+		}
+	})
+	return ready
+}
@@ -0,0 +1,198 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingHostPolicy struct {
+	HostSelectionPolicy
+	picks int32
+}
+
+func (c *countingHostPolicy) Pick(qry ExecutableQuery) NextHost {
+	atomic.AddInt32(&c.picks, 1)
+	return c.HostSelectionPolicy.Pick(qry)
+}
+
+type profileBatchObserver struct{}
+
+func (*profileBatchObserver) ObserveBatch(context.Context, ObservedBatch) {}
+
+func TestExecutionProfileDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	rt := &SimpleRetryPolicy{NumRetries: 2}
+	sp := &SimpleSpeculativeExecution{NumAttempts: 1, TimeoutDelay: time.Second}
+	localOne, anyCons, idempotent, notIdempotent := LocalOne, Any, true, false
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.DefaultIdempotence = true
+	cluster.ExecutionProfiles = map[string]*ExecutionProfile{
+		"analytics": {
+			Consistency:                &localOne,
+			SerialConsistency:          LocalSerial,
+			PageSize:                   10,
+			Timeout:                    time.Minute,
+			AttemptTimeout:             time.Second,
+			RetryPolicy:                rt,
+			SpeculativeExecutionPolicy: sp,
+			Idempotent:                 &idempotent,
+		},
+		// the zero values of the settings can be selected
+		"writes": {
+			Consistency: &anyCons,
+			Idempotent:  &notIdempotent,
+		},
+		"empty": {},
+	}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	qry := db.Query("void").Profile("analytics")
+	if qry.cons != LocalOne || qry.serialCons != LocalSerial || qry.pageSize != 10 ||
+		qry.timeout != time.Minute || qry.attemptTimeout != time.Second ||
+		qry.rt != rt || qry.spec != sp || !qry.idempotent {
+		t.Fatalf("expected the settings of the profile got %v", qry)
+	}
+	// settings made after selecting the profile take precedence
+	if qry.Consistency(All); qry.cons != All {
+		t.Fatalf("expected %v got %v", All, qry.cons)
+	}
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	qry = db.Query("void").Profile("empty")
+	if qry.cons != cluster.Consistency || qry.pageSize != cluster.PageSize || qry.idempotent != cluster.DefaultIdempotence {
+		t.Fatalf("expected the session defaults got %v", qry)
+	}
+
+	batch := db.Batch(LoggedBatch).Profile("analytics")
+	if batch.Cons != LocalOne || batch.serialCons != LocalSerial || batch.timeout != time.Minute ||
+		batch.rt != rt || batch.spec != sp || !batch.IsIdempotent() {
+		t.Fatalf("expected the settings of the profile got %+v", batch)
+	}
+
+	qry = db.Query("void").Profile("writes")
+	if qry.cons != Any || qry.idempotent {
+		t.Fatalf("expected the zero values set by the profile got %v", qry)
+	}
+
+	// settings made on the query take precedence, whether they are made
+	// before or after selecting the profile
+	observer := &profileBatchObserver{}
+	batch = db.Batch(LoggedBatch).SetKeyspace("ks").Timeout(time.Hour).Observer(observer).Profile("empty")
+	if batch.keyspace != "ks" || batch.timeout != time.Hour || batch.observer != observer {
+		t.Fatalf("expected the settings of the batch got %+v", batch)
+	}
+	batch = batch.Profile("analytics")
+	if batch.keyspace != "ks" || batch.timeout != time.Hour || batch.observer != observer ||
+		batch.Cons != LocalOne || batch.attemptTimeout != time.Second {
+		t.Fatalf("expected the settings of the batch and the profile got %+v", batch)
+	}
+	batch = db.Batch(LoggedBatch)
+	batch.Cons = One
+	if batch = batch.Profile("analytics"); batch.Cons != One {
+		t.Fatalf("expected the consistency of the batch got %+v", batch)
+	}
+	qry = db.Query("void").Consistency(One).PageSize(3).Timeout(time.Hour).Profile("analytics")
+	if qry.cons != One || qry.pageSize != 3 || qry.timeout != time.Hour || qry.attemptTimeout != time.Second {
+		t.Fatalf("expected the settings of the query and the profile got %v", qry)
+	}
+
+	// selecting another profile drops the settings of the previous one
+	qry = db.Query("void").Profile("analytics").Profile("empty")
+	if qry.cons != cluster.Consistency || qry.pageSize != cluster.PageSize || qry.timeout != 0 || qry.rt != cluster.RetryPolicy {
+		t.Fatalf("expected the session defaults got %v", qry)
+	}
+}
+
+func TestExecutionProfileNotFound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Profile("missing").Exec(); !errors.Is(err, ErrExecutionProfileNotFound) {
+		t.Fatalf("expected %v got %v", ErrExecutionProfileNotFound, err)
+	}
+	if err := db.Batch(LoggedBatch).Profile("missing").Query("void").Exec(); !errors.Is(err, ErrExecutionProfileNotFound) {
+		t.Fatalf("expected %v got %v", ErrExecutionProfileNotFound, err)
+	}
+}
+
+func TestExecutionProfileHostSelectionPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	sessionPolicy := &countingHostPolicy{HostSelectionPolicy: RoundRobinHostPolicy()}
+	profilePolicy := &countingHostPolicy{HostSelectionPolicy: RoundRobinHostPolicy()}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.PoolConfig.HostSelectionPolicy = sessionPolicy
+	cluster.ExecutionProfiles = map[string]*ExecutionProfile{
+		"analytics": {HostSelectionPolicy: profilePolicy},
+		// the policy is shared by profiles, it must be initialized once
+		"reporting": {HostSelectionPolicy: profilePolicy},
+		"default":   {},
+	}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Profile("analytics").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if host := db.policy.Pick(db.Batch(LoggedBatch).Profile("reporting"))(); host == nil {
+		t.Fatal("expected the profile policy to pick a host")
+	}
+	if sessionPicks, profilePicks := atomic.LoadInt32(&sessionPolicy.picks), atomic.LoadInt32(&profilePolicy.picks); sessionPicks != 0 || profilePicks != 2 {
+		t.Fatalf("expected the profile policy to pick hosts got %d session picks and %d profile picks", sessionPicks, profilePicks)
+	}
+
+	if err := db.Query("void").Profile("default").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if picks := atomic.LoadInt32(&sessionPolicy.picks); picks != 2 {
+		t.Fatalf("expected the session policy to pick hosts of queries without a profile policy got %d picks", picks)
+	}
+}
+
+func TestExecutionProfileValidate(t *testing.T) {
+	t.Parallel()
+
+	cluster := NewCluster("127.0.0.1")
+	cluster.ExecutionProfiles = map[string]*ExecutionProfile{
+		"invalid": {SerialConsistency: Quorum},
+	}
+	if err := cluster.Validate(); err == nil {
+		t.Fatal("expected an invalid serial consistency to fail validation")
+	}
+}
@@ -168,6 +168,7 @@ const (
 	flagGlobalTableSpec int = 0x01
 	flagHasMorePages    int = 0x02
 	flagNoMetaData      int = 0x04
+	flagMetaDataChanged int = 0x08
 
 	// query flags
 	flagValues                byte = 0x01
@@ -178,6 +179,8 @@ const (
 	flagDefaultTimestamp      byte = 0x20
 	flagWithNameValues        byte = 0x40
 	flagWithKeyspace          byte = 0x80
+	// v5+ query and batch flags no longer fit in a byte
+	flagWithNowInSeconds uint32 = 0x100
 
 	// prepare flags
 	flagWithPreparedKeyspace uint32 = 0x01
@@ -1044,6 +1047,9 @@ type resultMetadata struct {
 	// only if flagPageState
 	pagingState []byte
 
+	// v5+, only if flagMetaDataChanged
+	newMetadataID []byte
+
 	columns  []ColumnInfo
 	colCount int
 
@@ -1057,6 +1063,10 @@ func (r *resultMetadata) morePages() bool {
 	return r.flags&flagHasMorePages == flagHasMorePages
 }
 
+func (r *resultMetadata) metadataChanged() bool {
+	return r.flags&flagMetaDataChanged == flagMetaDataChanged
+}
+
 func (r resultMetadata) String() string {
 	return fmt.Sprintf("[metadata flags=0x%x paging_state=% X columns=%v]", r.flags, r.pagingState, r.columns)
 }
@@ -1094,6 +1104,10 @@ func (f *framer) parseResultMetadata() resultMetadata {
 		meta.pagingState = f.readBytesCopy()
 	}
 
+	if f.proto > protoVersion4 && meta.flags&flagMetaDataChanged == flagMetaDataChanged {
+		meta.newMetadataID = copyBytes(f.readShortBytes())
+	}
+
 	if meta.flags&flagNoMetaData == flagNoMetaData {
 		return meta
 	}
@@ -1199,17 +1213,24 @@ type resultPreparedFrame struct {
 	frameHeader
 
 	preparedID []byte
-	reqMeta    preparedMetadata
-	respMeta   resultMetadata
+	// v5+
+	resultMetadataID []byte
+	reqMeta          preparedMetadata
+	respMeta         resultMetadata
 }
 
 func (f *framer) parseResultPrepared() frame {
 	frame := &resultPreparedFrame{
 		frameHeader: *f.header,
 		preparedID:  f.readShortBytes(),
-		reqMeta:     f.parsePreparedMetadata(),
 	}
 
+	if f.proto > protoVersion4 {
+		frame.resultMetadataID = f.readShortBytes()
+	}
+
+	frame.reqMeta = f.parsePreparedMetadata()
+
 	if f.proto < protoVersion2 {
 		return frame
 	}
@@ -1491,12 +1512,14 @@ type queryParams struct {
 	defaultTimestamp      bool
 	defaultTimestampValue int64
 	// v5+
-	keyspace string
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int32
 }
 
 func (q queryParams) String() string {
-	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v values=%v keyspace=%s]",
-		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.values, q.keyspace)
+	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v values=%v keyspace=%s now_in_seconds=%v]",
+		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.values, q.keyspace, q.nowInSeconds)
 }
 
 func (f *framer) writeQueryParams(opts *queryParams) {
@@ -1506,21 +1529,21 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 		return
 	}
 
-	var flags byte
+	var flags uint32
 	if len(opts.values) > 0 {
-		flags |= flagValues
+		flags |= uint32(flagValues)
 	}
 	if opts.skipMeta {
-		flags |= flagSkipMetaData
+		flags |= uint32(flagSkipMetaData)
 	}
 	if opts.pageSize > 0 {
-		flags |= flagPageSize
+		flags |= uint32(flagPageSize)
 	}
 	if len(opts.pagingState) > 0 {
-		flags |= flagWithPagingState
+		flags |= uint32(flagWithPagingState)
 	}
 	if opts.serialConsistency > 0 {
-		flags |= flagWithSerialConsistency
+		flags |= uint32(flagWithSerialConsistency)
 	}
 
 	names := false
@@ -1528,27 +1551,35 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 	// protoV3 specific things
 	if f.proto > protoVersion2 {
 		if opts.defaultTimestamp {
-			flags |= flagDefaultTimestamp
+			flags |= uint32(flagDefaultTimestamp)
 		}
 
 		if len(opts.values) > 0 && opts.values[0].name != "" {
-			flags |= flagWithNameValues
+			flags |= uint32(flagWithNameValues)
 			names = true
 		}
 	}
 
 	if opts.keyspace != "" {
 		if f.proto > protoVersion4 {
-			flags |= flagWithKeyspace
+			flags |= uint32(flagWithKeyspace)
 		} else {
 			panic(fmt.Errorf("the keyspace can only be set with protocol 5 or higher"))
 		}
 	}
 
+	if opts.nowInSeconds {
+		if f.proto > protoVersion4 {
+			flags |= flagWithNowInSeconds
+		} else {
+			panic(fmt.Errorf("now_in_seconds can only be set with protocol 5 or higher"))
+		}
+	}
+
 	if f.proto > protoVersion4 {
-		f.writeUint(uint32(flags))
+		f.writeUint(flags)
 	} else {
-		f.writeByte(flags)
+		f.writeByte(byte(flags))
 	}
 
 	if n := len(opts.values); n > 0 {
@@ -1592,6 +1623,10 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 	if opts.keyspace != "" {
 		f.writeString(opts.keyspace)
 	}
+
+	if opts.nowInSeconds {
+		f.writeInt(opts.nowInSecondsValue)
+	}
 }
 
 type writeQueryFrame struct {
@@ -1634,27 +1669,32 @@ func (f frameWriterFunc) buildFrame(framer *framer, streamID int) error {
 
 type writeExecuteFrame struct {
 	preparedID []byte
-	params     queryParams
+	// v5+
+	resultMetadataID []byte
+	params           queryParams
 
 	// v4+
 	customPayload map[string][]byte
 }
 
 func (e *writeExecuteFrame) String() string {
-	return fmt.Sprintf("[execute id=% X params=%v]", e.preparedID, &e.params)
+	return fmt.Sprintf("[execute id=% X result_metadata_id=% X params=%v]", e.preparedID, e.resultMetadataID, &e.params)
 }
 
 func (e *writeExecuteFrame) buildFrame(fr *framer, streamID int) error {
-	return fr.writeExecuteFrame(streamID, e.preparedID, &e.params, &e.customPayload)
+	return fr.writeExecuteFrame(streamID, e.preparedID, e.resultMetadataID, &e.params, &e.customPayload)
 }
 
-func (f *framer) writeExecuteFrame(streamID int, preparedID []byte, params *queryParams, customPayload *map[string][]byte) error {
+func (f *framer) writeExecuteFrame(streamID int, preparedID, resultMetadataID []byte, params *queryParams, customPayload *map[string][]byte) error {
 	if len(*customPayload) > 0 {
 		f.payload()
 	}
 	f.writeHeader(f.flags, opExecute, streamID)
 	f.writeCustomPayload(customPayload)
 	f.writeShortBytes(preparedID)
+	if f.proto > protoVersion4 {
+		f.writeShortBytes(resultMetadataID)
+	}
 	if f.proto > protoVersion1 {
 		f.writeQueryParams(params)
 	} else {
@@ -1693,6 +1733,11 @@ type writeBatchFrame struct {
 
 	//v4+
 	customPayload map[string][]byte
+
+	// v5+
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int32
 }
 
 func (w *writeBatchFrame) buildFrame(framer *framer, streamID int) error {
@@ -1710,7 +1755,7 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame, customPayload
 	n := len(w.statements)
 	f.writeShort(uint16(n))
 
-	var flags byte
+	var flags uint32
 
 	for i := 0; i < n; i++ {
 		b := &w.statements[i]
@@ -1731,7 +1776,7 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame, customPayload
 				if f.proto <= protoVersion5 {
 					return fmt.Errorf("gocql: named query values are not supported in batches, please see https://issues.apache.org/jira/browse/CASSANDRA-10246")
 				}
-				flags |= flagWithNameValues
+				flags |= uint32(flagWithNameValues)
 				f.writeString(col.name)
 			}
 			if col.isUnset {
@@ -1746,16 +1791,27 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame, customPayload
 
 	if f.proto > protoVersion2 {
 		if w.serialConsistency > 0 {
-			flags |= flagWithSerialConsistency
+			flags |= uint32(flagWithSerialConsistency)
 		}
 		if w.defaultTimestamp {
-			flags |= flagDefaultTimestamp
+			flags |= uint32(flagDefaultTimestamp)
+		}
+		if w.keyspace != "" || w.nowInSeconds {
+			if f.proto <= protoVersion4 {
+				return fmt.Errorf("gocql: keyspace and now_in_seconds can only be set for batches with protocol 5 or higher")
+			}
+			if w.keyspace != "" {
+				flags |= uint32(flagWithKeyspace)
+			}
+			if w.nowInSeconds {
+				flags |= flagWithNowInSeconds
+			}
 		}
 
 		if f.proto > protoVersion4 {
-			f.writeUint(uint32(flags))
+			f.writeUint(flags)
 		} else {
-			f.writeByte(flags)
+			f.writeByte(byte(flags))
 		}
 
 		if w.serialConsistency > 0 {
@@ -1771,6 +1827,14 @@ func (f *framer) writeBatchFrame(streamID int, w *writeBatchFrame, customPayload
 			}
 			f.writeLong(ts)
 		}
+
+		if w.keyspace != "" {
+			f.writeString(w.keyspace)
+		}
+
+		if w.nowInSeconds {
+			f.writeInt(w.nowInSecondsValue)
+		}
 	}
 
 	return f.finish()
@@ -134,3 +134,159 @@ func TestFrameReadTooLong(t *testing.T) {
 		t.Fatalf("expected to get header %v got %v", opReady, head.op)
 	}
 }
+
+func TestFrameResultMetadataIDv5(t *testing.T) {
+	t.Parallel()
+
+	f := newFramer(nil, protoVersion5)
+	f.writeShortBytes([]byte{1, 2, 3}) // prepared id
+	f.writeShortBytes([]byte{4, 5})    // result metadata id
+	// prepared metadata: global table spec, one bind variable, no pk
+	f.writeInt(int32(flagGlobalTableSpec))
+	f.writeInt(1)
+	f.writeInt(0)
+	f.writeString("ks")
+	f.writeString("tbl")
+	f.writeString("id")
+	f.writeShort(uint16(TypeInt))
+	// result metadata
+	f.writeInt(int32(flagGlobalTableSpec))
+	f.writeInt(1)
+	f.writeString("ks")
+	f.writeString("tbl")
+	f.writeString("val")
+	f.writeShort(uint16(TypeVarchar))
+	f.header = &frameHeader{version: protoVersion5 | protoDirectionMask, op: opResult}
+
+	prepared, ok := f.parseResultPrepared().(*resultPreparedFrame)
+	if !ok {
+		t.Fatal("expected a prepared result")
+	}
+	if !bytes.Equal(prepared.preparedID, []byte{1, 2, 3}) {
+		t.Errorf("unexpected prepared id % X", prepared.preparedID)
+	}
+	if !bytes.Equal(prepared.resultMetadataID, []byte{4, 5}) {
+		t.Errorf("unexpected result metadata id % X", prepared.resultMetadataID)
+	}
+	if len(prepared.respMeta.columns) != 1 || prepared.respMeta.columns[0].Name != "val" {
+		t.Errorf("unexpected result columns %v", prepared.respMeta.columns)
+	}
+
+	f = newFramer(nil, protoVersion5)
+	f.writeInt(int32(flagGlobalTableSpec | flagMetaDataChanged))
+	f.writeInt(1)
+	f.writeShortBytes([]byte{6, 7})
+	f.writeString("ks")
+	f.writeString("tbl")
+	f.writeString("other")
+	f.writeShort(uint16(TypeBigInt))
+
+	meta := f.parseResultMetadata()
+	if !meta.metadataChanged() {
+		t.Error("expected metadata to be marked as changed")
+	}
+	if !bytes.Equal(meta.newMetadataID, []byte{6, 7}) {
+		t.Errorf("unexpected new metadata id % X", meta.newMetadataID)
+	}
+	if len(meta.columns) != 1 || meta.columns[0].Name != "other" {
+		t.Errorf("unexpected columns %v", meta.columns)
+	}
+}
+
+func TestFrameWriteExecuteResultMetadataID(t *testing.T) {
+	t.Parallel()
+
+	for _, proto := range []byte{protoVersion4, protoVersion5} {
+		f := newFramer(nil, proto)
+		frame := &writeExecuteFrame{
+			preparedID:       []byte{1, 2},
+			resultMetadataID: []byte{3, 4},
+			params:           queryParams{consistency: One},
+		}
+		if err := frame.buildFrame(f, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		f.buf = f.buf[f.headSize:]
+		if id := f.readShortBytes(); !bytes.Equal(id, []byte{1, 2}) {
+			t.Fatalf("proto %d: unexpected prepared id % X", proto, id)
+		}
+		if proto > protoVersion4 {
+			if id := f.readShortBytes(); !bytes.Equal(id, []byte{3, 4}) {
+				t.Fatalf("proto %d: unexpected result metadata id % X", proto, id)
+			}
+		}
+		if cons := f.readConsistency(); cons != One {
+			t.Fatalf("proto %d: expected consistency %v got %v", proto, One, cons)
+		}
+	}
+}
+
+func TestFrameWriteQueryParamsKeyspaceAndNowInSeconds(t *testing.T) {
+	t.Parallel()
+
+	f := newFramer(nil, protoVersion5)
+	f.writeQueryParams(&queryParams{
+		consistency:       One,
+		keyspace:          "other_ks",
+		nowInSeconds:      true,
+		nowInSecondsValue: 1700000000,
+	})
+
+	if cons := f.readConsistency(); cons != One {
+		t.Fatalf("expected consistency %v got %v", One, cons)
+	}
+	flags := uint32(f.readInt())
+	if expected := uint32(flagWithKeyspace) | flagWithNowInSeconds; flags != expected {
+		t.Fatalf("expected flags 0x%x got 0x%x", expected, flags)
+	}
+	if ks := f.readString(); ks != "other_ks" {
+		t.Fatalf("expected keyspace %q got %q", "other_ks", ks)
+	}
+	if now := f.readInt(); now != 1700000000 {
+		t.Fatalf("expected now_in_seconds %d got %d", 1700000000, now)
+	}
+	if len(f.buf) != 0 {
+		t.Fatalf("unexpected %d trailing bytes", len(f.buf))
+	}
+}
+
+func TestFrameWriteBatchKeyspaceAndNowInSeconds(t *testing.T) {
+	t.Parallel()
+
+	batch := &writeBatchFrame{
+		typ:               LoggedBatch,
+		statements:        []batchStatment{{statement: "INSERT INTO t (k) VALUES (1)"}},
+		consistency:       Quorum,
+		keyspace:          "other_ks",
+		nowInSeconds:      true,
+		nowInSecondsValue: 42,
+	}
+
+	f := newFramer(nil, protoVersion5)
+	if err := batch.buildFrame(f, 1); err != nil {
+		t.Fatal(err)
+	}
+	f.buf = f.buf[f.headSize:]
+	f.readByte()  // type
+	f.readShort() // statement count
+	f.readByte()  // kind
+	f.readLongString()
+	f.readShort() // values count
+	if cons := f.readConsistency(); cons != Quorum {
+		t.Fatalf("expected consistency %v got %v", Quorum, cons)
+	}
+	if flags := uint32(f.readInt()); flags != uint32(flagWithKeyspace)|flagWithNowInSeconds {
+		t.Fatalf("unexpected flags 0x%x", flags)
+	}
+	if ks := f.readString(); ks != "other_ks" {
+		t.Fatalf("expected keyspace %q got %q", "other_ks", ks)
+	}
+	if now := f.readInt(); now != 42 {
+		t.Fatalf("expected now_in_seconds %d got %d", 42, now)
+	}
+
+	if err := batch.buildFrame(newFramer(nil, protoVersion4), 1); err == nil {
+		t.Fatal("expected keyspace to be rejected with protocol v4")
+	}
+}
@@ -381,6 +381,15 @@ func (h *HostInfo) setState(state nodeState) *HostInfo {
 	return h
 }
 
+// swapState sets the state of the host and returns its previous state.
+func (h *HostInfo) swapState(state nodeState) nodeState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.state
+	h.state = state
+	return old
+}
+
 func (h *HostInfo) Tokens() []string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -471,6 +480,14 @@ func (h *HostInfo) ConnectAddressAndPort() string {
 	return net.JoinHostPort(addr.String(), strconv.Itoa(h.port))
 }
 
+// hostKey identifies the host by its host ID, or by its address if the ID is not known.
+func hostKey(h *HostInfo) string {
+	if hostID := h.HostID(); hostID != "" {
+		return hostID
+	}
+	return h.ConnectAddressAndPort()
+}
+
 func (h *HostInfo) String() string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -663,6 +680,14 @@ func hostInfoFromIter(iter *Iter, connectAddress net.IP, defaultPort int, transl
 	return host, nil
 }
 
+// hostMoved reports whether the datacenter or the rack of a known host
+// differs in its refreshed info.
+func hostMoved(known, refreshed *HostInfo) bool {
+	knownDC, knownRack := known.DataCenter(), known.Rack()
+	dc, rack := refreshed.DataCenter(), refreshed.Rack()
+	return (knownDC != "" && dc != "" && dc != knownDC) || (knownRack != "" && rack != "" && rack != knownRack)
+}
+
 // debounceRingRefresh submits a ring refresh request to the ring refresh debouncer.
 func (s *Session) debounceRingRefresh() {
 	s.ringRefresher.Debounce()
@@ -691,6 +716,7 @@ func (s *Session) refreshRing() error {
 		}
 
 		if host, ok := s.hostSource.addHostIfMissing(h); !ok {
+			s.hostStateDispatcher.dispatch(HostStateAdded, h)
 			s.startPoolFill(h)
 		} else {
 			// host (by hostID) already exists; determine if IP has changed
@@ -699,17 +725,34 @@ func (s *Session) refreshRing() error {
 			if !ok {
 				return fmt.Errorf("get existing host=%s from prevHosts: %w", h, ErrCannotFindHost)
 			}
-			if h.connectAddress.Equal(existing.connectAddress) && h.nodeToNodeAddress().Equal(existing.nodeToNodeAddress()) {
-				// no host IP change
+			ipChanged := !h.connectAddress.Equal(existing.connectAddress) || !h.nodeToNodeAddress().Equal(existing.nodeToNodeAddress())
+			moved := hostMoved(existing, h)
+			if !ipChanged && !moved {
+				// no host IP or location change
 				host.update(h)
 			} else {
-				// host IP has changed
+				// host IP or location has changed, the host is replaced as
+				// policies place the hosts by location once they are added
 				// remove old HostInfo (w/old IP)
 				s.removeHost(existing)
 				if _, alreadyExists := s.hostSource.addHostIfMissing(h); alreadyExists {
 					return fmt.Errorf("add new host=%s after removal: %w", h, ErrHostAlreadyExists)
 				}
-				// add new HostInfo (same hostID, new IP)
+				if s.cfg.filterHost(existing) {
+					// the listener doesn't know the host filtered out until now
+					s.hostStateDispatcher.dispatch(HostStateAdded, h)
+				} else if moved {
+					s.hostStateDispatcher.dispatchEvent(HostStateEvent{
+						Type:          HostStateLocationChanged,
+						Host:          h,
+						OldDataCenter: existing.DataCenter(),
+						OldRack:       existing.Rack(),
+					})
+				} else {
+					s.hostStateDispatcher.dispatch(HostStateRemoved, existing)
+					s.hostStateDispatcher.dispatch(HostStateAdded, h)
+				}
+				// add new HostInfo (same hostID, new IP or location)
 				s.startPoolFill(h)
 			}
 		}
@@ -719,6 +762,9 @@ func (s *Session) refreshRing() error {
 	for _, host := range prevHosts {
 		s.metadataDescriber.RemoveTabletsWithHost(host)
 		s.removeHost(host)
+		if !s.cfg.filterHost(host) {
+			s.hostStateDispatcher.dispatch(HostStateRemoved, host)
+		}
 	}
 	s.policy.SetPartitioner(partitioner)
 
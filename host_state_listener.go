@@ -0,0 +1,150 @@
+package gocql
+
+import (
+	"sync"
+)
+
+// HostStateEventType is the kind of change of a HostStateEvent.
+type HostStateEventType int
+
+const (
+	// HostStateAdded is delivered when a host joins the ring known by the
+	// session, hosts are up once added.
+	HostStateAdded HostStateEventType = iota
+	// HostStateRemoved is delivered when a host leaves the ring known by the session.
+	HostStateRemoved
+	// HostStateUp is delivered when the session connects to a host which was down.
+	HostStateUp
+	// HostStateDown is delivered when a host is marked down.
+	HostStateDown
+	// HostStateLocationChanged is delivered when the datacenter or the rack of
+	// a host changes.
+	HostStateLocationChanged
+)
+
+func (t HostStateEventType) String() string {
+	switch t {
+	case HostStateAdded:
+		return "ADDED"
+	case HostStateRemoved:
+		return "REMOVED"
+	case HostStateUp:
+		return "UP"
+	case HostStateDown:
+		return "DOWN"
+	case HostStateLocationChanged:
+		return "LOCATION_CHANGED"
+	default:
+		return "unknown"
+	}
+}
+
+// HostStateEvent is a change of a host delivered to a HostStateListener.
+type HostStateEvent struct {
+	Type HostStateEventType
+	Host *HostInfo
+
+	// OldDataCenter and OldRack are the location of the host before a
+	// HostStateLocationChanged event.
+	OldDataCenter string
+	OldRack       string
+}
+
+// HostStateListener receives the changes of the hosts of a session, with the
+// hosts filtered out by ClusterConfig.HostFilter left out. The events are
+// delivered in order on a goroutine of the session, so a slow listener delays
+// the next events but not the session.
+type HostStateListener interface {
+	HostStateChanged(HostStateEvent)
+}
+
+// HostStateListenerFunc adapts a function to HostStateListener.
+type HostStateListenerFunc func(HostStateEvent)
+
+func (f HostStateListenerFunc) HostStateChanged(event HostStateEvent) {
+	f(event)
+}
+
+// hostStateDispatcher queues host state events and delivers them to the
+// listener on its own goroutine. A nil dispatcher drops all events.
+type hostStateDispatcher struct {
+	listener HostStateListener
+
+	mu      sync.Mutex
+	queue   []HostStateEvent
+	stopped bool
+	wake    chan struct{}
+	quit    chan struct{}
+}
+
+func newHostStateDispatcher(listener HostStateListener) *hostStateDispatcher {
+	if listener == nil {
+		return nil
+	}
+	d := &hostStateDispatcher{
+		listener: listener,
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *hostStateDispatcher) dispatch(typ HostStateEventType, host *HostInfo) {
+	d.dispatchEvent(HostStateEvent{Type: typ, Host: host})
+}
+
+func (d *hostStateDispatcher) dispatchEvent(event HostStateEvent) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.queue = append(d.queue, event)
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *hostStateDispatcher) run() {
+	for {
+		select {
+		case <-d.wake:
+		case <-d.quit:
+			return
+		}
+
+		d.mu.Lock()
+		events := d.queue
+		d.queue = nil
+		d.mu.Unlock()
+
+		for _, event := range events {
+			select {
+			case <-d.quit:
+				return
+			default:
+			}
+			d.listener.HostStateChanged(event)
+		}
+	}
+}
+
+func (d *hostStateDispatcher) stop() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.stopped {
+		d.stopped = true
+		d.queue = nil
+		close(d.quit)
+	}
+}
@@ -0,0 +1,210 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingHostStateListener struct {
+	mu     sync.Mutex
+	events []HostStateEvent
+	notify chan struct{}
+}
+
+func newRecordingHostStateListener() *recordingHostStateListener {
+	return &recordingHostStateListener{notify: make(chan struct{}, 100)}
+}
+
+func (l *recordingHostStateListener) HostStateChanged(event HostStateEvent) {
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+	l.notify <- struct{}{}
+}
+
+func (l *recordingHostStateListener) wait(t *testing.T, n int) []HostStateEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		l.mu.Lock()
+		if len(l.events) >= n {
+			events := append([]HostStateEvent(nil), l.events...)
+			l.mu.Unlock()
+			return events
+		}
+		l.mu.Unlock()
+		select {
+		case <-l.notify:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %d events", n)
+		}
+	}
+}
+
+func TestHostStateDispatcherOrder(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	listener := newRecordingHostStateListener()
+	d := newHostStateDispatcher(HostStateListenerFunc(func(event HostStateEvent) {
+		<-release
+		listener.HostStateChanged(event)
+	}))
+	defer d.stop()
+
+	// dispatching doesn't wait for the listener
+	hosts := make([]*HostInfo, 100)
+	for i := range hosts {
+		hosts[i] = &HostInfo{}
+		d.dispatch(HostStateEventType(i%5), hosts[i])
+	}
+	close(release)
+
+	events := listener.wait(t, len(hosts))
+	for i, event := range events {
+		if event.Host != hosts[i] || event.Type != HostStateEventType(i%5) {
+			t.Fatalf("event %d delivered out of order: %+v", i, event)
+		}
+	}
+}
+
+func TestHostStateDispatcherStop(t *testing.T) {
+	t.Parallel()
+
+	var nilDispatcher *hostStateDispatcher
+	nilDispatcher.dispatch(HostStateUp, &HostInfo{})
+	nilDispatcher.stop()
+
+	if d := newHostStateDispatcher(nil); d != nil {
+		t.Fatal("expected no dispatcher without a listener")
+	}
+
+	listener := newRecordingHostStateListener()
+	d := newHostStateDispatcher(listener)
+	d.stop()
+	d.stop()
+	d.dispatch(HostStateUp, &HostInfo{})
+	time.Sleep(10 * time.Millisecond)
+	if len(listener.events) != 0 {
+		t.Errorf("expected no events after stop got %+v", listener.events)
+	}
+}
+
+func TestHostStateListenerSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	listener := newRecordingHostStateListener()
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.HostStateListener = listener
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	events := listener.wait(t, 1)
+	host := events[0].Host
+	if events[0].Type != HostStateAdded || host == nil {
+		t.Fatalf("expected the initial host to be added, got %+v", events[0])
+	}
+
+	// node events are matched by the node to node address of the hosts
+	ip, port := host.nodeToNodeAddress(), host.Port()
+	db.handleNodeDown(ip, port)
+	// a host already down is not reported again
+	db.handleNodeDown(ip, port)
+	db.handleNodeConnected(host)
+	db.handleNodeConnected(host)
+
+	events = listener.wait(t, 3)
+	if events[1].Type != HostStateDown || events[1].Host != host {
+		t.Errorf("expected host down got %+v", events[1])
+	}
+	if events[2].Type != HostStateUp || events[2].Host != host {
+		t.Errorf("expected host up got %+v", events[2])
+	}
+	time.Sleep(10 * time.Millisecond)
+	if events = listener.wait(t, 3); len(events) != 3 {
+		t.Errorf("expected 3 events got %+v", events)
+	}
+}
+
+func TestHostStateListenerHostFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	listener := newRecordingHostStateListener()
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.HostStateListener = listener
+	cluster.HostFilter = HostFilterFunc(func(host *HostInfo) bool {
+		return host.ConnectAddress().Equal(srv.host().ConnectAddress())
+	})
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	events := listener.wait(t, 1)
+	host := events[0].Host
+	if events[0].Type != HostStateAdded || host == nil {
+		t.Fatalf("expected the initial host to be added, got %+v", events[0])
+	}
+
+	// a host filtered out is known to the session, as after Session.init
+	filtered := &HostInfo{hostId: MustRandomUUID().String(), connectAddress: net.IPv4(10, 0, 0, 1), port: 9042}
+	db.hostSource.addOrUpdate(filtered)
+
+	// the ring has neither of the hosts anymore
+	control := db.hostSource.control
+	db.hostSource.setControlConn(&mockControlConn{})
+	defer db.hostSource.setControlConn(control)
+	if err := db.refreshRing(); err != nil {
+		t.Fatal(err)
+	}
+
+	events = listener.wait(t, 2)
+	if events[1].Type != HostStateRemoved || events[1].Host != host {
+		t.Errorf("expected the initial host to be removed got %+v", events[1])
+	}
+	time.Sleep(10 * time.Millisecond)
+	if events = listener.wait(t, 2); len(events) != 2 {
+		t.Errorf("expected no events of the hosts filtered out got %+v", events[2:])
+	}
+}
+
+func TestHostMoved(t *testing.T) {
+	t.Parallel()
+
+	host := func(dc, rack string) *HostInfo {
+		return &HostInfo{dataCenter: dc, rack: rack}
+	}
+	tests := []struct {
+		known, refreshed *HostInfo
+		moved            bool
+	}{
+		{host("dc1", "r1"), host("dc1", "r1"), false},
+		{host("dc1", "r1"), host("dc2", "r1"), true},
+		{host("dc1", "r1"), host("dc1", "r2"), true},
+		{host("", ""), host("dc1", "r1"), false},
+		{host("dc1", "r1"), host("", ""), false},
+	}
+	for i, test := range tests {
+		if moved := hostMoved(test.known, test.refreshed); moved != test.moved {
+			t.Errorf("%d: expected %v got %v", i, test.moved, moved)
+		}
+	}
+}
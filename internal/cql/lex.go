@@ -0,0 +1,175 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cql splits CQL statements into tokens, for the tools reading CQL
+// scripts.
+package cql
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	// Word is a keyword or an unquoted identifier.
+	Word Kind = iota
+	// Number is a numeric constant.
+	Number
+	// Quoted is a quoted identifier, its text is unescaped.
+	Quoted
+	// String is a string constant or a $$ function body, its text is
+	// unescaped.
+	String
+	// Symbol is any other character.
+	Symbol
+)
+
+// Token is a token of a statement, between the offsets Start and End.
+type Token struct {
+	Kind       Kind
+	Text       string
+	Start, End int
+}
+
+// Is reports whether t is the symbol.
+func (t Token) Is(symbol string) bool {
+	return t.Kind == Symbol && t.Text == symbol
+}
+
+// Lex splits stmt into tokens, skipping the comments.
+func Lex(stmt string) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(stmt); {
+		rest := stmt[i:]
+		c := rest[0]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(rest, "--"), strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case strings.HasPrefix(rest, "$$"):
+			end := strings.Index(rest[2:], "$$")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated $$ string")
+			}
+			tokens = append(tokens, Token{Kind: String, Text: rest[2 : end+2], Start: i, End: i + end + 4})
+			i += end + 4
+		case c == '\'' || c == '"':
+			// quotes are escaped by doubling them
+			end := 1
+			for {
+				n := strings.IndexByte(rest[end:], c)
+				if n < 0 {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				end += n + 1
+				if end < len(rest) && rest[end] == c {
+					end++
+					continue
+				}
+				break
+			}
+			kind := String
+			if c == '"' {
+				kind = Quoted
+			}
+			text := strings.ReplaceAll(rest[1:end-1], string([]byte{c, c}), string(c))
+			tokens = append(tokens, Token{Kind: kind, Text: text, Start: i, End: i + end})
+			i += end
+		case isDigit(c) || c == '-' && len(rest) > 1 && isDigit(rest[1]):
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Number, Text: rest[:end], Start: i, End: i + end})
+			i += end
+		case isWordByte(c):
+			end := 1
+			for end < len(rest) && isWordByte(rest[end]) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Word, Text: rest[:end], Start: i, End: i + end})
+			i += end
+		default:
+			// unquoted identifiers are ASCII, any other character is a symbol
+			_, size := utf8.DecodeRuneInString(rest)
+			tokens = append(tokens, Token{Kind: Symbol, Text: rest[:size], Start: i, End: i + size})
+			i += size
+		}
+	}
+	return tokens, nil
+}
+
+// SplitStatements splits a CQL script into its statements, dropping the
+// comments and the semicolons ending the statements. Semicolons in strings,
+// quoted identifiers and $$ function bodies don't end a statement.
+func SplitStatements(script string) ([]string, error) {
+	tokens, err := Lex(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stmts []string
+		sb    strings.Builder
+	)
+	for i, tok := range tokens {
+		if tok.Is(";") {
+			if sb.Len() > 0 {
+				stmts = append(stmts, sb.String())
+				sb.Reset()
+			}
+			continue
+		}
+		if sb.Len() > 0 {
+			// keep the spacing between the tokens, unless it has comments
+			if gap := script[tokens[i-1].End:tok.Start]; strings.TrimSpace(gap) == "" {
+				sb.WriteString(gap)
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(script[tok.Start:tok.End])
+	}
+	if sb.Len() > 0 {
+		stmts = append(stmts, sb.String())
+	}
+	return stmts, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
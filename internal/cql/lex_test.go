@@ -0,0 +1,79 @@
+//go:build unit
+// +build unit
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	stmt := `SELECT "Col""a", -1.5, 'it''s' /* c */ FROM ks.tbl_1 -- c
+WHERE x = $$a;b$$ AND y = 'é' AND zé = 1`
+
+	tokens, err := Lex(stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type token struct {
+		kind Kind
+		text string
+	}
+	var got []token
+	for _, tok := range tokens {
+		got = append(got, token{tok.Kind, tok.Text})
+	}
+	expected := []token{
+		{Word, "SELECT"}, {Quoted, `Col"a`}, {Symbol, ","}, {Number, "-1.5"}, {Symbol, ","},
+		{String, "it's"}, {Word, "FROM"}, {Word, "ks"}, {Symbol, "."}, {Word, "tbl_1"},
+		{Word, "WHERE"}, {Word, "x"}, {Symbol, "="}, {String, "a;b"},
+		{Word, "AND"}, {Word, "y"}, {Symbol, "="}, {String, "é"},
+		{Word, "AND"}, {Word, "z"}, {Symbol, "é"}, {Symbol, "="}, {Number, "1"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+	for _, tok := range tokens {
+		if tok.Kind == Word && stmt[tok.Start:tok.End] != tok.Text {
+			t.Errorf("token %q has the offsets of %q", tok.Text, stmt[tok.Start:tok.End])
+		}
+	}
+
+	for _, stmt := range []string{"SELECT 'a", `SELECT "a`, "/* a", "AS $$a"} {
+		if _, err := Lex(stmt); err == nil {
+			t.Errorf("%q: expected an error", stmt)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "CREATE TABLE t (\n\tid int PRIMARY KEY /* key */, v text\n);; -- done\nSELECT * FROM t"
+
+	stmts, err := SplitStatements(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CREATE TABLE t (\n\tid int PRIMARY KEY , v text\n)", "SELECT * FROM t"}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("expected %q got %q", expected, stmts)
+	}
+}
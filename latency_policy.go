@@ -0,0 +1,291 @@
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatencyExclusionThreshold = 2.0
+	defaultLatencyWeight             = 0.1
+	defaultLatencyRetryPeriod        = 10 * time.Second
+	defaultLatencyUpdateRate         = 100 * time.Millisecond
+	defaultLatencyMinMeasurements    = 50
+)
+
+// LatencyAwareOptions configures a policy created with LatencyAwarePolicy.
+type LatencyAwareOptions struct {
+	// ExclusionThreshold is how many times a host's average latency may be
+	// higher than the average latency of the fastest host before the host is
+	// penalized.
+	// Default: 2
+	ExclusionThreshold float64
+
+	// Weight is the weight of a new measurement in a host's exponentially
+	// weighted average latency, between 0 and 1. Higher weights make the
+	// average react faster to latency changes.
+	// Default: 0.1
+	Weight float64
+
+	// RetryPeriod is the time after which the average latency of a host
+	// which has not been measured again is no longer trusted, so that a
+	// penalized host is tried again and its latency measured anew.
+	// Default: 10 seconds
+	RetryPeriod time.Duration
+
+	// UpdateRate is how often the average latency of the fastest host is recomputed.
+	// Default: 100 milliseconds
+	UpdateRate time.Duration
+
+	// MinMeasurements is the number of measurements of a host required
+	// before its average latency is taken into account.
+	// Default: 50
+	MinMeasurements int
+
+	// Exclude makes penalized hosts to be left out of query plans, unless
+	// no other host is available. Otherwise they are moved to the end of
+	// query plans. Replicas selected by TokenAwareHostPolicy are only ever
+	// reordered, never left out.
+	Exclude bool
+}
+
+// hostLatencyTracker is implemented by host selection policies which take
+// the latency of hosts into account.
+type hostLatencyTracker interface {
+	// trackLatency is called with the latency and the result of every
+	// attempt sent to host.
+	trackLatency(host *HostInfo, latency time.Duration, err error)
+}
+
+// hostPenalizer is implemented by host selection policies which penalize
+// some hosts, so that TokenAwareHostPolicy can reorder replicas accordingly.
+type hostPenalizer interface {
+	// penalizedLast returns hosts with the penalized hosts moved to the end,
+	// keeping the order otherwise. hosts is not modified.
+	penalizedLast(hosts []*HostInfo) []*HostInfo
+}
+
+type hostLatency struct {
+	average      float64 // nanoseconds
+	measurements int
+	updated      time.Time
+}
+
+// LatencyAwarePolicy wraps child and penalizes hosts which are slower than
+// the fastest host by more than LatencyAwareOptions.ExclusionThreshold,
+// according to an exponentially weighted average latency of the requests
+// sent to them.
+//
+// To reorder replicas by latency, use it as the fallback of TokenAwareHostPolicy:
+//
+//	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(
+//		gocql.LatencyAwarePolicy(gocql.RoundRobinHostPolicy(), gocql.LatencyAwareOptions{}),
+//	)
+//
+// Penalized replicas are then tried after the other replicas, but before
+// any other host. Wrapping TokenAwareHostPolicy instead moves penalized
+// replicas behind every other host of the query plan.
+func LatencyAwarePolicy(child HostSelectionPolicy, opts LatencyAwareOptions) HostSelectionPolicy {
+	if opts.ExclusionThreshold <= 1 {
+		opts.ExclusionThreshold = defaultLatencyExclusionThreshold
+	}
+	if opts.Weight <= 0 || opts.Weight > 1 {
+		opts.Weight = defaultLatencyWeight
+	}
+	if opts.RetryPeriod <= 0 {
+		opts.RetryPeriod = defaultLatencyRetryPeriod
+	}
+	if opts.UpdateRate <= 0 {
+		opts.UpdateRate = defaultLatencyUpdateRate
+	}
+	if opts.MinMeasurements <= 0 {
+		opts.MinMeasurements = defaultLatencyMinMeasurements
+	}
+	return &latencyAwarePolicy{
+		HostSelectionPolicy: child,
+		opts:                opts,
+		hosts:               make(map[string]*hostLatency),
+	}
+}
+
+type latencyAwarePolicy struct {
+	HostSelectionPolicy
+	opts LatencyAwareOptions
+
+	mu    sync.Mutex
+	hosts map[string]*hostLatency
+	// fastest is the lowest trusted average latency, 0 if there is none
+	fastest   float64
+	refreshed time.Time
+}
+
+func (l *latencyAwarePolicy) Pick(qry ExecutableQuery) NextHost {
+	next := l.HostSelectionPolicy.Pick(qry)
+	if qry != nil && qry.IsLWT() {
+		// the order of replicas matters for LWT
+		return next
+	}
+
+	var (
+		deferred []SelectedHost
+		picked   bool
+		done     bool
+	)
+	return func() SelectedHost {
+		for !done {
+			host := next()
+			if host == nil {
+				done = true
+				break
+			}
+			if !l.isPenalized(host.Info()) {
+				picked = true
+				return host
+			}
+			deferred = append(deferred, host)
+		}
+		if l.opts.Exclude && picked {
+			return nil
+		}
+		if len(deferred) == 0 {
+			return nil
+		}
+		host := deferred[0]
+		deferred = deferred[1:]
+		return host
+	}
+}
+
+func (l *latencyAwarePolicy) penalizedLast(hosts []*HostInfo) []*HostInfo {
+	var reordered, penalized []*HostInfo
+	for _, host := range hosts {
+		if l.isPenalized(host) {
+			penalized = append(penalized, host)
+		} else {
+			reordered = append(reordered, host)
+		}
+	}
+	if len(penalized) == 0 || len(reordered) == 0 {
+		return hosts
+	}
+	return append(reordered, penalized...)
+}
+
+func (l *latencyAwarePolicy) isPenalized(host *HostInfo) bool {
+	if host == nil {
+		return false
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.refreshed) >= l.opts.UpdateRate {
+		l.refreshFastest(now)
+	}
+	latency, ok := l.hosts[hostKey(host)]
+	if !ok || l.fastest == 0 || !l.trusted(latency, now) {
+		return false
+	}
+	return latency.average > l.fastest*l.opts.ExclusionThreshold
+}
+
+// refreshFastest recomputes the lowest trusted average latency.
+func (l *latencyAwarePolicy) refreshFastest(now time.Time) {
+	l.fastest = 0
+	for _, latency := range l.hosts {
+		if l.trusted(latency, now) && (l.fastest == 0 || latency.average < l.fastest) {
+			l.fastest = latency.average
+		}
+	}
+	l.refreshed = now
+}
+
+func (l *latencyAwarePolicy) trusted(latency *hostLatency, now time.Time) bool {
+	return latency.measurements >= l.opts.MinMeasurements && now.Sub(latency.updated) < l.opts.RetryPeriod
+}
+
+func (l *latencyAwarePolicy) trackLatency(host *HostInfo, d time.Duration, err error) {
+	if tracker, ok := l.HostSelectionPolicy.(hostLatencyTracker); ok {
+		tracker.trackLatency(host, d, err)
+	}
+	if !measuresLatency(err) {
+		return
+	}
+	now := time.Now()
+	key := hostKey(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	latency, ok := l.hosts[key]
+	if !ok {
+		latency = &hostLatency{}
+		l.hosts[key] = latency
+	}
+	if latency.measurements == 0 || now.Sub(latency.updated) >= l.opts.RetryPeriod {
+		// the previous average is too old to be trusted, start over
+		latency.average = float64(d)
+		latency.measurements = 0
+	} else {
+		latency.average += l.opts.Weight * (float64(d) - latency.average)
+	}
+	latency.measurements++
+	latency.updated = now
+}
+
+// measuresLatency reports whether an attempt which ended with err measured
+// the latency of the host, that is whether the host replied or timed out.
+func measuresLatency(err error) bool {
+	if err == nil {
+		return true
+	}
+	var reqErr RequestError
+	return errors.As(err, &reqErr) ||
+		errors.Is(err, ErrTimeoutNoResponse) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func (l *latencyAwarePolicy) RemoveHost(host *HostInfo) {
+	l.HostSelectionPolicy.RemoveHost(host)
+
+	l.mu.Lock()
+	delete(l.hosts, hostKey(host))
+	l.mu.Unlock()
+}
+
+func (l *latencyAwarePolicy) Reset() {
+	l.HostSelectionPolicy.Reset()
+
+	l.mu.Lock()
+	l.hosts = make(map[string]*hostLatency)
+	l.fastest = 0
+	l.refreshed = time.Time{}
+	l.mu.Unlock()
+}
+
+func (l *latencyAwarePolicy) HostTier(host *HostInfo) uint {
+	if tierer, ok := l.HostSelectionPolicy.(HostTierer); ok {
+		return tierer.HostTier(host)
+	}
+	if l.IsLocal(host) {
+		return 0
+	}
+	return 1
+}
+
+func (l *latencyAwarePolicy) MaxHostTier() uint {
+	if tierer, ok := l.HostSelectionPolicy.(HostTierer); ok {
+		return tierer.MaxHostTier()
+	}
+	return 1
+}
+
+func (l *latencyAwarePolicy) Ready() bool {
+	if rdy, ok := l.HostSelectionPolicy.(ReadyPolicy); ok {
+		return rdy.Ready()
+	}
+	return true
+}
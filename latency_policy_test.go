@@ -0,0 +1,189 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func trackLatencies(policy HostSelectionPolicy, host *HostInfo, latency time.Duration, n int) {
+	tracker := policy.(hostLatencyTracker)
+	for i := 0; i < n; i++ {
+		tracker.trackLatency(host, latency, nil)
+	}
+}
+
+func TestLatencyAwarePolicy(t *testing.T) {
+	t.Parallel()
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	policy := LatencyAwarePolicy(RoundRobinHostPolicy(), LatencyAwareOptions{
+		MinMeasurements: 5,
+		UpdateRate:      time.Nanosecond,
+	})
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+
+	trackLatencies(policy, hosts[0], time.Millisecond, 5)
+	trackLatencies(policy, hosts[1], 10*time.Millisecond, 5)
+	// not enough measurements yet
+	trackLatencies(policy, hosts[2], 10*time.Millisecond, 4)
+
+	for i := 0; i < len(hosts); i++ {
+		iter := policy.Pick(nil)
+		expectHosts(t, "fast hosts", iter, "0", "2")
+		expectHosts(t, "penalized hosts", iter, "1")
+		expectNoMoreHosts(t, iter)
+	}
+
+	trackLatencies(policy, hosts[2], 10*time.Millisecond, 1)
+	iter := policy.Pick(nil)
+	expectHosts(t, "fast hosts", iter, "0")
+	expectHosts(t, "penalized hosts", iter, "1", "2")
+	expectNoMoreHosts(t, iter)
+
+	// errors which do not measure the latency of the host are ignored
+	policy.(hostLatencyTracker).trackLatency(hosts[0], time.Second, context.Canceled)
+	policy.(hostLatencyTracker).trackLatency(hosts[0], time.Second, ErrNoStreams)
+	iter = policy.Pick(nil)
+	expectHosts(t, "fast hosts", iter, "0")
+	expectHosts(t, "penalized hosts", iter, "1", "2")
+	expectNoMoreHosts(t, iter)
+
+	// penalized hosts are trusted again after their latency has been measured anew
+	trackLatencies(policy, hosts[1], time.Millisecond, 50)
+	iter = policy.Pick(nil)
+	expectHosts(t, "fast hosts", iter, "0", "1")
+	expectHosts(t, "penalized hosts", iter, "2")
+	expectNoMoreHosts(t, iter)
+}
+
+func TestLatencyAwarePolicyExclude(t *testing.T) {
+	t.Parallel()
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+	}
+	policy := LatencyAwarePolicy(RoundRobinHostPolicy(), LatencyAwareOptions{
+		MinMeasurements: 1,
+		UpdateRate:      time.Nanosecond,
+		Exclude:         true,
+	})
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+	trackLatencies(policy, hosts[0], time.Millisecond, 1)
+	trackLatencies(policy, hosts[1], 10*time.Millisecond, 1)
+
+	iter := policy.Pick(nil)
+	expectHosts(t, "fast hosts", iter, "0")
+	expectNoMoreHosts(t, iter)
+
+	// penalized hosts are used if no other host is available
+	policy.HostDown(hosts[0])
+	policy.RemoveHost(hosts[0])
+	iter = policy.Pick(nil)
+	expectHosts(t, "penalized hosts", iter, "1")
+	expectNoMoreHosts(t, iter)
+}
+
+func TestLatencyAwarePolicyRetryPeriod(t *testing.T) {
+	t.Parallel()
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1)},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2)},
+	}
+	policy := LatencyAwarePolicy(RoundRobinHostPolicy(), LatencyAwareOptions{
+		MinMeasurements: 1,
+		UpdateRate:      time.Nanosecond,
+		RetryPeriod:     20 * time.Millisecond,
+	})
+	internal := policy.(*latencyAwarePolicy)
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+	trackLatencies(policy, hosts[0], time.Millisecond, 1)
+	trackLatencies(policy, hosts[1], 10*time.Millisecond, 1)
+	if !internal.isPenalized(hosts[1]) {
+		t.Fatal("expected the slow host to be penalized")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if internal.isPenalized(hosts[1]) {
+		t.Fatal("expected the slow host to be retried after RetryPeriod")
+	}
+
+	// a new measurement replaces the stale average
+	trackLatencies(policy, hosts[1], time.Millisecond, 1)
+	trackLatencies(policy, hosts[0], time.Millisecond, 1)
+	if internal.isPenalized(hosts[1]) {
+		t.Fatal("expected the host not to be penalized once it is fast again")
+	}
+}
+
+func TestHostPolicy_TokenAware_LatencyAware(t *testing.T) {
+	t.Parallel()
+
+	const keyspace = "myKeyspace"
+	fallback := LatencyAwarePolicy(RoundRobinHostPolicy(), LatencyAwareOptions{
+		MinMeasurements: 1,
+		UpdateRate:      time.Nanosecond,
+	})
+	policy := TokenAwareHostPolicy(fallback)
+	policyInternal := policy.(*tokenAwareHostPolicy)
+	policyInternal.getKeyspaceName = func() string { return keyspace }
+	policyInternal.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		if keyspaceName != keyspace {
+			return nil, fmt.Errorf("unknown keyspace: %s", keyspaceName)
+		}
+		return &KeyspaceMetadata{
+			Name:          keyspace,
+			StrategyClass: "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{
+				"class":              "SimpleStrategy",
+				"replication_factor": 2,
+			},
+		}, nil
+	}
+
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"25"}},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"50"}},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4), tokens: []string{"75"}},
+	}
+	for _, host := range &hosts {
+		policy.AddHost(host)
+	}
+	policy.SetPartitioner("OrderedPartitioner")
+	policy.KeyspaceChanged(KeyspaceUpdateEvent{Keyspace: keyspace})
+
+	// latencies are tracked through the token aware policy
+	for _, host := range &hosts {
+		trackLatencies(policy, host, time.Millisecond, 1)
+	}
+	trackLatencies(policy, hosts[1], time.Second, 1)
+
+	query := &Query{routingInfo: &queryRoutingInfo{}}
+	query.getKeyspace = func() string { return keyspace }
+	query.RoutingKey([]byte("20"))
+
+	// the slow replica is tried after the other replica, but before the rest of the hosts
+	iter := policy.Pick(query)
+	expectHosts(t, "fast replica", iter, "2")
+	expectHosts(t, "penalized replica", iter, "1")
+	expectHosts(t, "rest", iter, "0", "3")
+	expectNoMoreHosts(t, iter)
+}
@@ -73,3 +73,29 @@ func (s LZ4Compressor) Decode(data []byte) ([]byte, error) {
 	n, err := lz4.UncompressBlock(data[4:], buf)
 	return buf[:n], err
 }
+
+// EncodeBlock implements the gocql.BlockCompressor interface, it compresses
+// data into a raw LZ4 block as used by protocol v5 segments.
+func (s LZ4Compressor) EncodeBlock(data []byte) ([]byte, error) {
+	buf := make([]byte, lz4.CompressBlockBound(len(data)))
+	var compressor lz4.Compressor
+	n, err := compressor.CompressBlock(data, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// DecodeBlock implements the gocql.BlockCompressor interface, it decompresses
+// a raw LZ4 block whose uncompressed length is known upfront.
+func (s LZ4Compressor) DecodeBlock(data []byte, uncompressedLength int) ([]byte, error) {
+	buf := make([]byte, uncompressedLength)
+	n, err := lz4.UncompressBlock(data, buf)
+	if err != nil {
+		return nil, err
+	}
+	if n != uncompressedLength {
+		return nil, fmt.Errorf("lz4 block uncompressed to %d bytes, expected %d", n, uncompressedLength)
+	}
+	return buf, nil
+}
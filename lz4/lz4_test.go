@@ -57,3 +57,19 @@ func TestLZ4Compressor(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, original, decoded)
 }
+
+func TestLZ4CompressorBlock(t *testing.T) {
+	t.Parallel()
+
+	var c LZ4Compressor
+
+	original := []byte("My Test String My Test String My Test String")
+	encoded, err := c.EncodeBlock(original)
+	require.NoError(t, err)
+	decoded, err := c.DecodeBlock(encoded, len(original))
+	require.NoError(t, err)
+	require.Equal(t, original, decoded)
+
+	_, err = c.DecodeBlock(encoded, len(original)+1)
+	require.Error(t, err)
+}
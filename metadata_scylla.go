@@ -570,6 +570,8 @@ func (s *metadataDescriber) refreshAllSchema() error {
 func (s *metadataDescriber) refreshSchema(keyspaceName string) error {
 	var err error
 
+	s.session.metrics.trackSchemaRefresh()
+
 	// query the system keyspace for schema data
 	// TODO retrieve concurrently
 	keyspace, err := getKeyspaceMetadata(s.session, keyspaceName)
@@ -0,0 +1,388 @@
+package gocql
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBucketBounds are the upper bounds of the buckets of the latency
+// histograms in SessionMetrics.
+var latencyBucketBounds = [...]time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBucketBounds returns the upper bounds of the buckets of the latency
+// histograms in SessionMetrics.
+func LatencyBucketBounds() []time.Duration {
+	bounds := latencyBucketBounds
+	return bounds[:]
+}
+
+// Statement types of SessionMetrics.StatementTypes.
+const (
+	StatementTypeSelect = "select"
+	StatementTypeInsert = "insert"
+	StatementTypeUpdate = "update"
+	StatementTypeDelete = "delete"
+	StatementTypeBatch  = "batch"
+	StatementTypeOther  = "other"
+)
+
+var statementTypes = [...]string{
+	StatementTypeSelect,
+	StatementTypeInsert,
+	StatementTypeUpdate,
+	StatementTypeDelete,
+	StatementTypeBatch,
+	StatementTypeOther,
+}
+
+// indexes of the statement types which are not told by the first keyword
+const (
+	batchStatementType = 4
+	otherStatementType = 5
+)
+
+// LatencyHistogram is a histogram of request latencies.
+type LatencyHistogram struct {
+	// Counts holds the number of latencies in every bucket of
+	// LatencyBucketBounds, the last count is of latencies above the last bound.
+	Counts []uint64
+	// Count is the number of latencies.
+	Count uint64
+	// Sum is the sum of the latencies.
+	Sum time.Duration
+}
+
+// RequestMetrics holds the counters of request attempts, including retries
+// and speculative executions.
+type RequestMetrics struct {
+	// Requests is the number of attempts.
+	Requests uint64
+	// Errors is the number of failed attempts.
+	Errors uint64
+	// Timeouts is the number of attempts to which the host didn't respond
+	// in time, or which timed out on the server. Attempts cut short by
+	// their context are not counted.
+	Timeouts uint64
+	// Latency is the histogram of the latencies of the attempts.
+	Latency LatencyHistogram
+}
+
+// SessionHostMetrics holds the metrics of a single host.
+type SessionHostMetrics struct {
+	RequestMetrics
+
+	// Connections is the number of open connections to the host.
+	Connections int
+	// InFlight is the number of requests in flight to the host.
+	InFlight int
+	// StreamsInUse and StreamsAvailable are the number of used and free
+	// streams of the connections to the host.
+	StreamsInUse     int
+	StreamsAvailable int
+}
+
+// SessionMetrics is a snapshot of the metrics of a session returned by
+// Session.Metrics.
+type SessionMetrics struct {
+	// Requests holds the counters of all attempts.
+	Requests RequestMetrics
+	// Hosts holds the metrics of the hosts keyed by their address and port.
+	Hosts map[string]SessionHostMetrics
+	// StatementTypes holds the counters of attempts keyed by the statement
+	// type, one of the StatementType constants.
+	StatementTypes map[string]RequestMetrics
+
+	// Retries is the number of retries decided by retry policies.
+	Retries uint64
+	// SpeculativeExecutions is the number of speculative executions started.
+	SpeculativeExecutions uint64
+
+	// Connections is the number of open connections of the pool.
+	Connections int
+	// InFlight is the number of requests in flight.
+	InFlight int
+	// StreamsInUse and StreamsAvailable are the number of used and free
+	// streams of all connections of the pool.
+	StreamsInUse     int
+	StreamsAvailable int
+
+	// ControlConnectionReconnects is the number of times the control
+	// connection reconnected.
+	ControlConnectionReconnects uint64
+	// SchemaRefreshes is the number of keyspace schema refreshes.
+	SchemaRefreshes uint64
+}
+
+// StreamUtilization returns the ratio of used streams of all connections.
+func (m SessionMetrics) StreamUtilization() float64 {
+	if total := m.StreamsInUse + m.StreamsAvailable; total > 0 {
+		return float64(m.StreamsInUse) / float64(total)
+	}
+	return 0
+}
+
+// requestCounters counts request attempts, it is updated atomically.
+type requestCounters struct {
+	requests uint64
+	errors   uint64
+	timeouts uint64
+	sum      int64
+	buckets  []uint64
+}
+
+func newRequestCounters() *requestCounters {
+	return &requestCounters{buckets: make([]uint64, len(latencyBucketBounds)+1)}
+}
+
+func (c *requestCounters) track(latency time.Duration, err error) {
+	atomic.AddUint64(&c.requests, 1)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		if _, timeout := classifyHostFailure(err); timeout {
+			atomic.AddUint64(&c.timeouts, 1)
+		}
+	}
+
+	bucket := len(latencyBucketBounds)
+	for i, bound := range latencyBucketBounds {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddUint64(&c.buckets[bucket], 1)
+	atomic.AddInt64(&c.sum, int64(latency))
+}
+
+func (c *requestCounters) snapshot() RequestMetrics {
+	m := RequestMetrics{
+		Requests: atomic.LoadUint64(&c.requests),
+		Errors:   atomic.LoadUint64(&c.errors),
+		Timeouts: atomic.LoadUint64(&c.timeouts),
+		Latency: LatencyHistogram{
+			Counts: make([]uint64, len(c.buckets)),
+			Sum:    time.Duration(atomic.LoadInt64(&c.sum)),
+		},
+	}
+	for i := range c.buckets {
+		m.Latency.Counts[i] = atomic.LoadUint64(&c.buckets[i])
+		m.Latency.Count += m.Latency.Counts[i]
+	}
+	return m
+}
+
+type hostRequestCounters struct {
+	host *HostInfo
+	*requestCounters
+}
+
+// sessionMetrics collects the metrics of a session. Its methods can be
+// called on a nil *sessionMetrics, which collects nothing.
+type sessionMetrics struct {
+	requests       *requestCounters
+	statementTypes [len(statementTypes)]*requestCounters
+
+	mu    sync.RWMutex
+	hosts map[string]hostRequestCounters
+
+	retries               uint64
+	speculativeExecutions uint64
+	controlReconnects     uint64
+	schemaRefreshes       uint64
+}
+
+func newSessionMetrics() *sessionMetrics {
+	m := &sessionMetrics{
+		requests: newRequestCounters(),
+		hosts:    make(map[string]hostRequestCounters),
+	}
+	for i := range m.statementTypes {
+		m.statementTypes[i] = newRequestCounters()
+	}
+	return m
+}
+
+// statementTypeIndex returns the index in statementTypes of the type of qry.
+func statementTypeIndex(qry ExecutableQuery) int {
+	q, ok := qry.(*Query)
+	if !ok {
+		return batchStatementType
+	}
+	keyword := strings.TrimLeft(q.stmt, " \t\r\n")
+	if i := strings.IndexAny(keyword, " \t\r\n"); i >= 0 {
+		keyword = keyword[:i]
+	}
+	for i, typ := range statementTypes[:batchStatementType] {
+		if strings.EqualFold(keyword, typ) {
+			return i
+		}
+	}
+	return otherStatementType
+}
+
+func (m *sessionMetrics) hostCounters(host *HostInfo) *requestCounters {
+	key := hostKey(host)
+	m.mu.RLock()
+	counters, ok := m.hosts[key]
+	m.mu.RUnlock()
+	if ok {
+		return counters.requestCounters
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if counters, ok = m.hosts[key]; !ok {
+		counters = hostRequestCounters{host: host, requestCounters: newRequestCounters()}
+		m.hosts[key] = counters
+	}
+	return counters.requestCounters
+}
+
+func (m *sessionMetrics) trackAttempt(qry ExecutableQuery, host *HostInfo, latency time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.requests.track(latency, err)
+	m.statementTypes[statementTypeIndex(qry)].track(latency, err)
+	m.hostCounters(host).track(latency, err)
+}
+
+func (m *sessionMetrics) removeHost(host *HostInfo) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.hosts, hostKey(host))
+	m.mu.Unlock()
+}
+
+func (m *sessionMetrics) trackRetry() {
+	if m != nil {
+		atomic.AddUint64(&m.retries, 1)
+	}
+}
+
+func (m *sessionMetrics) trackSpeculativeExecution() {
+	if m != nil {
+		atomic.AddUint64(&m.speculativeExecutions, 1)
+	}
+}
+
+func (m *sessionMetrics) trackControlReconnect() {
+	if m != nil {
+		atomic.AddUint64(&m.controlReconnects, 1)
+	}
+}
+
+func (m *sessionMetrics) trackSchemaRefresh() {
+	if m != nil {
+		atomic.AddUint64(&m.schemaRefreshes, 1)
+	}
+}
+
+// streamCounter is implemented by connection pickers which can count the
+// streams of their connections.
+type streamCounter interface {
+	streams() (inUse, available int)
+}
+
+func (p *defaultConnPicker) streams() (inUse, available int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, conn := range p.conns {
+		inUse += conn.streams.InUse()
+		available += conn.streams.Available()
+	}
+	return inUse, available
+}
+
+func (p *scyllaConnPicker) streams() (inUse, available int) {
+	for _, conn := range p.conns {
+		if conn != nil {
+			inUse += conn.streams.InUse()
+			available += conn.streams.Available()
+		}
+	}
+	return inUse, available
+}
+
+func (pool *hostConnPool) streams() (inUse, available int) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if counter, ok := pool.connPicker.(streamCounter); ok {
+		return counter.streams()
+	}
+	return 0, 0
+}
+
+// Metrics returns a snapshot of the metrics of the session. See the metrics
+// package for publishing them with expvar or to Prometheus.
+func (s *Session) Metrics() SessionMetrics {
+	m := s.metrics
+	snapshot := SessionMetrics{
+		Requests:                    m.requests.snapshot(),
+		Hosts:                       make(map[string]SessionHostMetrics),
+		StatementTypes:              make(map[string]RequestMetrics, len(statementTypes)),
+		Retries:                     atomic.LoadUint64(&m.retries),
+		SpeculativeExecutions:       atomic.LoadUint64(&m.speculativeExecutions),
+		ControlConnectionReconnects: atomic.LoadUint64(&m.controlReconnects),
+		SchemaRefreshes:             atomic.LoadUint64(&m.schemaRefreshes),
+	}
+	for i, typ := range statementTypes {
+		snapshot.StatementTypes[typ] = m.statementTypes[i].snapshot()
+	}
+
+	m.mu.RLock()
+	for _, counters := range m.hosts {
+		snapshot.Hosts[counters.host.ConnectAddressAndPort()] = SessionHostMetrics{
+			RequestMetrics: counters.snapshot(),
+		}
+	}
+	m.mu.RUnlock()
+
+	if s.pool == nil {
+		return snapshot
+	}
+	s.pool.mu.RLock()
+	pools := make([]*hostConnPool, 0, len(s.pool.hostConnPools))
+	for _, pool := range s.pool.hostConnPools {
+		pools = append(pools, pool)
+	}
+	s.pool.mu.RUnlock()
+
+	for _, pool := range pools {
+		addr := pool.host.ConnectAddressAndPort()
+		host, ok := snapshot.Hosts[addr]
+		if !ok {
+			host.Latency.Counts = make([]uint64, len(latencyBucketBounds)+1)
+		}
+		host.Connections = pool.Size()
+		host.InFlight = pool.InFlight()
+		host.StreamsInUse, host.StreamsAvailable = pool.streams()
+		snapshot.Hosts[addr] = host
+
+		snapshot.Connections += host.Connections
+		snapshot.InFlight += host.InFlight
+		snapshot.StreamsInUse += host.StreamsInUse
+		snapshot.StreamsAvailable += host.StreamsAvailable
+	}
+	return snapshot
+}
@@ -0,0 +1,27 @@
+// Package metrics publishes the metrics of gocql sessions, returned by
+// Session.Metrics, with expvar and in the Prometheus text format without
+// depending on a metrics library:
+//
+//	metrics.PublishExpvar("gocql", session)
+//	http.Handle("/metrics", metrics.PrometheusHandler(session))
+package metrics
+
+import (
+	"expvar"
+
+	"github.com/gocql/gocql"
+)
+
+// Source is the source of the published metrics, usually a *gocql.Session.
+type Source interface {
+	Metrics() gocql.SessionMetrics
+}
+
+// PublishExpvar publishes the metrics of source as the expvar variable name,
+// which is served in JSON by the expvar handler at /debug/vars. Like
+// expvar.Publish, it panics if name is already published.
+func PublishExpvar(name string, source Source) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return source.Metrics()
+	}))
+}
@@ -0,0 +1,98 @@
+//go:build unit
+// +build unit
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+type staticSource gocql.SessionMetrics
+
+func (s staticSource) Metrics() gocql.SessionMetrics {
+	return gocql.SessionMetrics(s)
+}
+
+func testMetrics() gocql.SessionMetrics {
+	counts := make([]uint64, len(gocql.LatencyBucketBounds())+1)
+	counts[1] = 2
+	counts[len(counts)-1] = 1
+	requests := gocql.RequestMetrics{
+		Requests: 3,
+		Errors:   1,
+		Timeouts: 1,
+		Latency:  gocql.LatencyHistogram{Counts: counts, Count: 3, Sum: 12 * time.Second},
+	}
+	return gocql.SessionMetrics{
+		Requests: requests,
+		Hosts: map[string]gocql.SessionHostMetrics{
+			`10.0.0.1:9042`: {RequestMetrics: requests, Connections: 2, InFlight: 1, StreamsInUse: 1, StreamsAvailable: 63},
+		},
+		StatementTypes: map[string]gocql.RequestMetrics{
+			gocql.StatementTypeSelect: requests,
+		},
+		Retries:                     4,
+		SpeculativeExecutions:       5,
+		Connections:                 2,
+		ControlConnectionReconnects: 6,
+		SchemaRefreshes:             7,
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	PrometheusHandler(staticSource(testMetrics())).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != PrometheusContentType {
+		t.Fatalf("expected content type %q got %q", PrometheusContentType, ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE gocql_requests_total counter",
+		`gocql_requests_total{host="10.0.0.1:9042"} 3`,
+		`gocql_request_timeouts_total{host="10.0.0.1:9042"} 1`,
+		"# TYPE gocql_request_duration_seconds histogram",
+		`gocql_request_duration_seconds_bucket{host="10.0.0.1:9042",le="0.0005"} 0`,
+		`gocql_request_duration_seconds_bucket{host="10.0.0.1:9042",le="0.001"} 2`,
+		`gocql_request_duration_seconds_bucket{host="10.0.0.1:9042",le="10"} 2`,
+		`gocql_request_duration_seconds_bucket{host="10.0.0.1:9042",le="+Inf"} 3`,
+		`gocql_request_duration_seconds_sum{host="10.0.0.1:9042"} 12`,
+		`gocql_request_duration_seconds_count{host="10.0.0.1:9042"} 3`,
+		`gocql_statement_request_errors_total{type="select"} 1`,
+		"gocql_retries_total 4",
+		"gocql_speculative_executions_total 5",
+		`gocql_connections{host="10.0.0.1:9042"} 2`,
+		`gocql_streams_available{host="10.0.0.1:9042"} 63`,
+		"gocql_control_connection_reconnects_total 6",
+		"gocql_schema_refreshes_total 7",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if l := label("host", "a\"b\\c\nd"); l != `host="a\"b\\c\nd"` {
+		t.Fatalf("unexpected label %s", l)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar("gocql_test", staticSource(testMetrics()))
+
+	var m gocql.SessionMetrics
+	if err := json.Unmarshal([]byte(expvar.Get("gocql_test").String()), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Retries != 4 || m.Hosts["10.0.0.1:9042"].Connections != 2 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// PrometheusContentType is the content type of the Prometheus text format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler returns a handler serving the metrics of source in the
+// Prometheus text format.
+func PrometheusHandler(source Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		WritePrometheus(w, source.Metrics())
+	})
+}
+
+// WritePrometheus writes m to w in the Prometheus text format. Request
+// metrics are labeled with the host or the statement type, pool metrics
+// with the host.
+func WritePrometheus(w io.Writer, m gocql.SessionMetrics) error {
+	p := &promWriter{w: bufio.NewWriter(w)}
+
+	hosts := make([]string, 0, len(m.Hosts))
+	for host := range m.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	types := make([]string, 0, len(m.StatementTypes))
+	for typ := range m.StatementTypes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	p.requests("gocql_", "host", hosts, func(host string) gocql.RequestMetrics {
+		return m.Hosts[host].RequestMetrics
+	})
+	p.requests("gocql_statement_", "type", types, func(typ string) gocql.RequestMetrics {
+		return m.StatementTypes[typ]
+	})
+
+	p.counter("gocql_retries_total", "Number of retries decided by retry policies.", float64(m.Retries))
+	p.counter("gocql_speculative_executions_total", "Number of speculative executions started.", float64(m.SpeculativeExecutions))
+
+	p.hostGauge(m, hosts, "gocql_connections", "Number of open connections.", func(h gocql.SessionHostMetrics) int {
+		return h.Connections
+	})
+	p.hostGauge(m, hosts, "gocql_in_flight_requests", "Number of requests in flight.", func(h gocql.SessionHostMetrics) int {
+		return h.InFlight
+	})
+	p.hostGauge(m, hosts, "gocql_streams_in_use", "Number of used streams of the connections.", func(h gocql.SessionHostMetrics) int {
+		return h.StreamsInUse
+	})
+	p.hostGauge(m, hosts, "gocql_streams_available", "Number of free streams of the connections.", func(h gocql.SessionHostMetrics) int {
+		return h.StreamsAvailable
+	})
+
+	p.counter("gocql_control_connection_reconnects_total", "Number of control connection reconnects.", float64(m.ControlConnectionReconnects))
+	p.counter("gocql_schema_refreshes_total", "Number of keyspace schema refreshes.", float64(m.SchemaRefreshes))
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) write(s ...string) {
+	for _, s := range s {
+		if p.err != nil {
+			return
+		}
+		_, p.err = p.w.WriteString(s)
+	}
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	p.write("# HELP ", name, " ", help, "\n# TYPE ", name, " ", typ, "\n")
+}
+
+func (p *promWriter) sample(name, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	p.write(name, labels, " ", formatFloat(value), "\n")
+}
+
+func (p *promWriter) counter(name, help string, value float64) {
+	p.header(name, "counter", help)
+	p.sample(name, "", value)
+}
+
+func (p *promWriter) hostGauge(m gocql.SessionMetrics, hosts []string, name, help string, value func(gocql.SessionHostMetrics) int) {
+	p.header(name, "gauge", help)
+	for _, host := range hosts {
+		p.sample(name, label("host", host), float64(value(m.Hosts[host])))
+	}
+}
+
+// requests writes the request counters and latency histograms of keys.
+func (p *promWriter) requests(prefix, labelName string, keys []string, metrics func(string) gocql.RequestMetrics) {
+	counters := []struct {
+		name  string
+		help  string
+		value func(gocql.RequestMetrics) uint64
+	}{
+		{"requests_total", "Number of request attempts.", func(m gocql.RequestMetrics) uint64 { return m.Requests }},
+		{"request_errors_total", "Number of failed request attempts.", func(m gocql.RequestMetrics) uint64 { return m.Errors }},
+		{"request_timeouts_total", "Number of timed out request attempts.", func(m gocql.RequestMetrics) uint64 { return m.Timeouts }},
+	}
+	for _, counter := range counters {
+		name := prefix + counter.name
+		p.header(name, "counter", counter.help)
+		for _, key := range keys {
+			p.sample(name, label(labelName, key), float64(counter.value(metrics(key))))
+		}
+	}
+
+	name := prefix + "request_duration_seconds"
+	p.header(name, "histogram", "Latency of request attempts.")
+	bounds := gocql.LatencyBucketBounds()
+	for _, key := range keys {
+		keyLabel := label(labelName, key)
+		latency := metrics(key).Latency
+		var cumulative uint64
+		for i, count := range latency.Counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(bounds) {
+				le = formatFloat(bounds[i].Seconds())
+			}
+			p.sample(name+"_bucket", keyLabel+","+label("le", le), float64(cumulative))
+		}
+		p.sample(name+"_sum", keyLabel, latency.Sum.Seconds())
+		p.sample(name+"_count", keyLabel, float64(latency.Count))
+	}
+}
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,94 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatementTypeIndex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		qry ExecutableQuery
+		typ string
+	}{
+		{&Query{stmt: "SELECT * FROM t"}, StatementTypeSelect},
+		{&Query{stmt: "  insert INTO t (a) VALUES (?)"}, StatementTypeInsert},
+		{&Query{stmt: "UPDATE t SET a = ?"}, StatementTypeUpdate},
+		{&Query{stmt: "DELETE FROM t"}, StatementTypeDelete},
+		{&Query{stmt: "CREATE TABLE t (a int PRIMARY KEY)"}, StatementTypeOther},
+		{&Query{stmt: "selection"}, StatementTypeOther},
+		{&Batch{}, StatementTypeBatch},
+	}
+	for _, test := range tests {
+		if typ := statementTypes[statementTypeIndex(test.qry)]; typ != test.typ {
+			t.Errorf("%v: expected %s got %s", test.qry, test.typ, typ)
+		}
+	}
+}
+
+func TestSessionMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("kill").Idempotent(true).RetryPolicy(&testRetryPolicy{NumRetries: 1}).Exec(); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+
+	m := db.Metrics()
+	if m.Requests.Requests != 3 || m.Requests.Errors != 2 || m.Requests.Latency.Count != 3 {
+		t.Fatalf("unexpected request metrics %+v", m.Requests)
+	}
+	if m.Retries != 1 {
+		t.Fatalf("expected 1 retry got %d", m.Retries)
+	}
+	if selects := m.StatementTypes[StatementTypeSelect]; selects.Requests != 0 {
+		t.Fatalf("unexpected select metrics %+v", selects)
+	}
+	if other := m.StatementTypes[StatementTypeOther]; other.Requests != 3 || other.Errors != 2 {
+		t.Fatalf("unexpected other metrics %+v", other)
+	}
+
+	host, ok := m.Hosts[srv.Address]
+	if !ok {
+		t.Fatalf("expected metrics of host %s got %+v", srv.Address, m.Hosts)
+	}
+	if host.Requests != 3 || host.Connections != m.Connections || host.Connections == 0 {
+		t.Fatalf("unexpected host metrics %+v", host)
+	}
+	if host.StreamsAvailable == 0 || m.StreamUtilization() != 0 {
+		t.Fatalf("expected free streams got %d in use and %d available", host.StreamsInUse, host.StreamsAvailable)
+	}
+}
+
+func TestLatencyBucketBounds(t *testing.T) {
+	t.Parallel()
+
+	c := newRequestCounters()
+	// the bounds returned can't change the buckets of the counters
+	bounds := LatencyBucketBounds()
+	bounds[0] = time.Hour
+	c.track(time.Minute, nil)
+	if m := c.snapshot(); m.Latency.Counts[len(m.Latency.Counts)-1] != 1 || len(m.Latency.Counts) != len(LatencyBucketBounds())+1 {
+		t.Fatalf("expected the latency above the last bound got %v", m.Latency.Counts)
+	}
+	if LatencyBucketBounds()[0] != 500*time.Microsecond {
+		t.Fatal("expected the bounds to be unchanged")
+	}
+}
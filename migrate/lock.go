@@ -0,0 +1,140 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	// ErrLockTimeout is returned when the lock held by another deployer is
+	// not released within Config.LockTimeout.
+	ErrLockTimeout = errors.New("migrate: timed out waiting for the lock")
+	// ErrLockLost is returned when the lock expired while migrating, which
+	// lets another deployer migrate concurrently.
+	ErrLockLost = errors.New("migrate: lock lost")
+)
+
+// lockID is the key of the row holding the lock.
+const lockID = "lock"
+
+// lockRetryInterval is the interval between the attempts to acquire a lock
+// held by another deployer.
+var lockRetryInterval = time.Second
+
+// migrationLock is a lock held with lightweight transactions, refreshed until
+// it is released. Its context is canceled if the lock is lost.
+type migrationLock struct {
+	m      *Migrator
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	lost bool
+}
+
+func (m *Migrator) acquireLock(ctx context.Context) (*migrationLock, error) {
+	deadline := time.Now().Add(m.cfg.LockTimeout)
+	for {
+		acquired, owner, err := m.tryLock(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: acquiring the lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w held by %s", ErrLockTimeout, owner)
+		}
+
+		m.log(gocql.LogLevelInfo, "waiting for the lock", gocql.LogField{Key: "owner", Value: owner})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	l := &migrationLock{m: m, done: make(chan struct{})}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	go l.refresh()
+	return l, nil
+}
+
+func (m *Migrator) lockTTL() int {
+	if ttl := int(m.cfg.LockTTL / time.Second); ttl > 0 {
+		return ttl
+	}
+	return 1
+}
+
+// tryLock returns the owner of the lock if it is not acquired.
+func (m *Migrator) tryLock(ctx context.Context) (bool, string, error) {
+	existing := make(map[string]interface{})
+	applied, err := m.session.Query("INSERT INTO "+m.lockTable()+" (id, owner, acquired_at) VALUES (?, ?, ?) IF NOT EXISTS USING TTL ?",
+		lockID, m.cfg.Owner, time.Now(), m.lockTTL()).WithContext(ctx).MapScanCAS(existing)
+	if err != nil {
+		return false, "", err
+	}
+	owner, _ := existing["owner"].(string)
+	return applied, owner, nil
+}
+
+func (l *migrationLock) refresh() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(time.Duration(l.m.lockTTL()) * time.Second / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		applied, err := l.m.session.Query("UPDATE "+l.m.lockTable()+" USING TTL ? SET owner = ? WHERE id = ? IF owner = ?",
+			l.m.lockTTL(), l.m.cfg.Owner, lockID, l.m.cfg.Owner).WithContext(l.ctx).MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			// the lock is still held until it expires, the next refresh may succeed
+			l.m.log(gocql.LogLevelWarn, "unable to refresh the lock", gocql.LogField{Key: gocql.LogFieldError, Value: err})
+			continue
+		}
+		if !applied {
+			l.m.log(gocql.LogLevelError, "lock lost", gocql.LogField{Key: "owner", Value: l.m.cfg.Owner})
+			l.mu.Lock()
+			l.lost = true
+			l.mu.Unlock()
+			l.cancel()
+			return
+		}
+	}
+}
+
+// wrap returns ErrLockLost wrapping err if the lock was lost.
+func (l *migrationLock) wrap(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost {
+		return fmt.Errorf("%w: %v", ErrLockLost, err)
+	}
+	return err
+}
+
+func (l *migrationLock) release() {
+	l.cancel()
+	<-l.done
+
+	// the context of the migration may be canceled
+	ctx, cancel := context.WithTimeout(context.Background(), l.m.cfg.LockTTL)
+	defer cancel()
+	_, err := l.m.session.Query("DELETE FROM "+l.m.lockTable()+" WHERE id = ? IF owner = ?",
+		lockID, l.m.cfg.Owner).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+	if err != nil {
+		l.m.log(gocql.LogLevelWarn, "unable to release the lock, it expires after its TTL", gocql.LogField{Key: gocql.LogFieldError, Value: err})
+	}
+}
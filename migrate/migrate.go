@@ -0,0 +1,359 @@
+// Package migrate applies versioned CQL migrations to a keyspace.
+//
+// The migrations are ".cql" files named "<version>_<description>.cql", read
+// from a directory or an fs.FS such as an embed.FS:
+//
+//	//go:embed migrations/*.cql
+//	var files embed.FS
+//
+//	sub, _ := fs.Sub(files, "migrations")
+//	migrations, err := migrate.FromFS(sub)
+//	...
+//	m, err := migrate.New(session, migrate.Config{Keyspace: "app"})
+//	...
+//	applied, err := m.Migrate(ctx, migrations)
+//
+// The applied versions are recorded with the checksums of their files in a
+// tracking table of the keyspace, the migrations already applied are skipped
+// and their files must not change. A migration which fails is resumed from
+// the statement which failed by the next run. The cluster must agree on the
+// schema after each schema change before the next statement is executed, and
+// a lock held with a lightweight transaction makes concurrent deployers apply
+// the migrations one at a time.
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Config configures a Migrator.
+type Config struct {
+	// Keyspace is the keyspace migrated, which holds the tracking table. It
+	// must exist before migrating.
+	Keyspace string
+	// Table is the name of the tracking table, the lock is held in the table
+	// named after it suffixed with "_lock".
+	// Default: schema_migrations
+	Table string
+
+	// LockTTL is the time to live of the lock, refreshed while migrating so
+	// that the lock of a deployer which crashed expires.
+	// Default: 1m
+	LockTTL time.Duration
+	// LockTimeout is the maximum time waiting for the lock held by another
+	// deployer.
+	// Default: 10m
+	LockTimeout time.Duration
+	// Owner identifies the deployer holding the lock.
+	// Default: the host name with a random suffix
+	Owner string
+
+	// ScratchRun applies the pending migrations to a scratch copy of the
+	// keyspace instead of the keyspace, and writes them to Output with the
+	// differences of the schema they make. It is not a dry run, it changes the
+	// cluster: it creates the scratch keyspace with the replication of the
+	// keyspace, copies the schema of the keyspace into it, executes all the
+	// statements of the migrations, data changes included, waiting for schema
+	// agreement as migrations do, and drops the scratch keyspace once done,
+	// which may fail and leave it behind.
+	// The statements must qualify the objects they target with the keyspace,
+	// as the statements which don't would change another keyspace; such
+	// statements fail the scratch run before the cluster is changed.
+	ScratchRun bool
+	// ScratchKeyspace prefixes the scratch keyspaces of the scratch runs. Each
+	// scratch run uses its own scratch keyspace, suffixed with random
+	// characters, so concurrent scratch runs don't interfere.
+	// Default: Keyspace suffixed with "_scratch"
+	ScratchKeyspace string
+	// Output receives the reports of the scratch runs.
+	// Default: os.Stdout
+	Output io.Writer
+
+	// Logger logs the progress of the migrations.
+	// Default: no logging
+	Logger gocql.StructuredLogger
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Table == "" {
+		cfg.Table = "schema_migrations"
+	}
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = time.Minute
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = 10 * time.Minute
+	}
+	if cfg.Owner == "" {
+		cfg.Owner = defaultOwner()
+	}
+	if cfg.ScratchKeyspace == "" {
+		cfg.ScratchKeyspace = cfg.Keyspace + "_scratch"
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+}
+
+// maxKeyspaceNameLength is the maximum length of keyspace names.
+const maxKeyspaceNameLength = 48
+
+// scratchKeyspace returns a new name of the scratch keyspace of a scratch run.
+func (m *Migrator) scratchKeyspace() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("migrate: %w", err)
+	}
+	prefix := m.cfg.ScratchKeyspace
+	if n := maxKeyspaceNameLength - 1 - 2*len(suffix); len(prefix) > n {
+		prefix = prefix[:n]
+	}
+	return prefix + "_" + hex.EncodeToString(suffix), nil
+}
+
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return host
+	}
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// ChecksumMismatchError is returned when the file of a migration which was
+// applied changed. A migration which failed must be deleted from the tracking
+// table, once its changes are reverted, to be applied again.
+type ChecksumMismatchError struct {
+	Version int64
+	Name    string
+	// Applied is the checksum of the migration when it was applied.
+	Applied string
+	// Checksum is the checksum of the migration file.
+	Checksum string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("migrate: %s: checksum %s doesn't match the checksum %s of version %d when it was applied",
+		e.Name, e.Checksum, e.Applied, e.Version)
+}
+
+// AppliedMigration is a migration recorded in the tracking table.
+type AppliedMigration struct {
+	Version  int64
+	Name     string
+	Checksum string
+	// Done is the number of statements applied, which is lower than the
+	// number of statements of the migration if it failed.
+	Done      int
+	StartedAt time.Time
+	// AppliedAt is zero if the migration failed.
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations to a keyspace.
+type Migrator struct {
+	session *gocql.Session
+	cfg     Config
+}
+
+// New returns a Migrator applying migrations with session.
+func New(session *gocql.Session, cfg Config) (*Migrator, error) {
+	if cfg.Keyspace == "" {
+		return nil, errors.New("migrate: no keyspace provided")
+	}
+	cfg.setDefaults()
+	return &Migrator{session: session, cfg: cfg}, nil
+}
+
+func (m *Migrator) table() string {
+	return m.cfg.Keyspace + "." + m.cfg.Table
+}
+
+func (m *Migrator) lockTable() string {
+	return m.cfg.Keyspace + "." + m.cfg.Table + "_lock"
+}
+
+func (m *Migrator) log(level gocql.LogLevel, msg string, fields ...gocql.LogField) {
+	if m.cfg.Logger != nil && m.cfg.Logger.Enabled(level) {
+		m.cfg.Logger.Log(level, msg, fields...)
+	}
+}
+
+// Migrate applies the migrations which were not applied in the order of
+// their versions, and returns them. It returns a *ChecksumMismatchError
+// before applying any migration if an applied migration changed.
+func (m *Migrator) Migrate(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	migrations = append([]Migration(nil), migrations...)
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	if m.cfg.ScratchRun {
+		return m.scratchRun(ctx, migrations)
+	}
+
+	if err := m.createTables(ctx); err != nil {
+		return nil, err
+	}
+
+	lock, err := m.acquireLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+	ctx = lock.ctx
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, lock.wrap(err)
+	}
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0, len(pending))
+	for _, p := range pending {
+		if err := m.apply(ctx, p); err != nil {
+			return done, lock.wrap(err)
+		}
+		done = append(done, p.Migration)
+	}
+	return done, nil
+}
+
+// Applied returns the migrations recorded in the tracking table, sorted by
+// version.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	iter := m.session.Query("SELECT version, name, checksum, done, started_at, applied_at FROM " + m.table()).
+		WithContext(ctx).Iter()
+
+	var (
+		applied []AppliedMigration
+		a       AppliedMigration
+	)
+	for iter.Scan(&a.Version, &a.Name, &a.Checksum, &a.Done, &a.StartedAt, &a.AppliedAt) {
+		applied = append(applied, a)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("migrate: reading %s: %w", m.table(), err)
+	}
+
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version < applied[j].Version
+	})
+	return applied, nil
+}
+
+func (m *Migrator) createTables(ctx context.Context) error {
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS " + m.table() + " (" +
+			"version bigint PRIMARY KEY, name text, checksum text, done int, started_at timestamp, applied_at timestamp)",
+		"CREATE TABLE IF NOT EXISTS " + m.lockTable() + " (id text PRIMARY KEY, owner text, acquired_at timestamp)",
+	}
+	for _, stmt := range stmts {
+		if err := m.exec(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: creating the tracking tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// exec executes stmt and waits for the cluster to agree on the schema if
+// stmt changes it.
+func (m *Migrator) exec(ctx context.Context, stmt string) error {
+	if err := m.session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+		return err
+	}
+	if isDDL(stmt) {
+		if err := m.session.AwaitSchemaAgreement(ctx); err != nil {
+			return fmt.Errorf("awaiting schema agreement: %w", err)
+		}
+	}
+	return nil
+}
+
+type pendingMigration struct {
+	Migration
+	// done is the number of statements applied by a previous run which failed.
+	done int
+}
+
+func pendingMigrations(migrations []Migration, applied []AppliedMigration) ([]pendingMigration, error) {
+	byVersion := make(map[int64]AppliedMigration, len(applied))
+	for _, a := range applied {
+		byVersion[a.Version] = a
+	}
+
+	var pending []pendingMigration
+	for _, mig := range migrations {
+		a, ok := byVersion[mig.Version]
+		if !ok {
+			pending = append(pending, pendingMigration{Migration: mig})
+			continue
+		}
+		if a.Checksum != mig.Checksum {
+			return nil, &ChecksumMismatchError{
+				Version:  mig.Version,
+				Name:     mig.Name,
+				Applied:  a.Checksum,
+				Checksum: mig.Checksum,
+			}
+		}
+		if a.AppliedAt.IsZero() {
+			pending = append(pending, pendingMigration{Migration: mig, done: a.Done})
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, p pendingMigration) error {
+	version := gocql.LogField{Key: "version", Value: p.Version}
+	if p.done > 0 {
+		m.log(gocql.LogLevelInfo, "resuming migration", version, gocql.LogField{Key: "name", Value: p.Name},
+			gocql.LogField{Key: "statement", Value: p.done + 1})
+	} else {
+		m.log(gocql.LogLevelInfo, "applying migration", version, gocql.LogField{Key: "name", Value: p.Name})
+	}
+
+	startedAt := time.Now()
+	if err := m.record(ctx, p.Migration, p.done, startedAt, time.Time{}); err != nil {
+		return err
+	}
+	for i := p.done; i < len(p.Statements); i++ {
+		m.log(gocql.LogLevelDebug, "executing statement", version, gocql.LogField{Key: "statement", Value: p.Statements[i]})
+		if err := m.exec(ctx, p.Statements[i]); err != nil {
+			return fmt.Errorf("migrate: %s: statement %d: %w", p.Name, i+1, err)
+		}
+		if err := m.record(ctx, p.Migration, i+1, startedAt, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return m.record(ctx, p.Migration, len(p.Statements), startedAt, time.Now())
+}
+
+func (m *Migrator) record(ctx context.Context, mig Migration, done int, startedAt, appliedAt time.Time) error {
+	var applied interface{}
+	if !appliedAt.IsZero() {
+		applied = appliedAt
+	}
+	err := m.session.Query("INSERT INTO "+m.table()+" (version, name, checksum, done, started_at, applied_at) VALUES (?, ?, ?, ?, ?, ?)",
+		mig.Version, mig.Name, mig.Checksum, done, startedAt, applied).WithContext(ctx).Exec()
+	if err != nil {
+		return fmt.Errorf("migrate: recording %s: %w", mig.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build unit
+// +build unit
+
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "0001_a.cql", Statements: []string{"a"}, Checksum: "1"},
+		{Version: 2, Name: "0002_b.cql", Statements: []string{"b1", "b2", "b3"}, Checksum: "2"},
+		{Version: 3, Name: "0003_c.cql", Statements: []string{"c"}, Checksum: "3"},
+	}
+	applied := []AppliedMigration{
+		{Version: 1, Checksum: "1", Done: 1, AppliedAt: time.Now()},
+		// failed on its second statement
+		{Version: 2, Checksum: "2", Done: 1},
+	}
+
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending migrations got %+v", pending)
+	}
+	if pending[0].Version != 2 || pending[0].done != 1 {
+		t.Errorf("expected migration 2 to be resumed got %+v", pending[0])
+	}
+	if pending[1].Version != 3 || pending[1].done != 0 {
+		t.Errorf("expected migration 3 to be applied got %+v", pending[1])
+	}
+
+	applied[0].Checksum = "changed"
+	_, err = pendingMigrations(migrations, applied)
+	var mismatch *ChecksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected checksum mismatch got %v", err)
+	}
+	if mismatch.Version != 1 || mismatch.Applied != "changed" || mismatch.Checksum != "1" {
+		t.Errorf("unexpected error %+v", mismatch)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	if _, err := New(nil, Config{}); err == nil {
+		t.Error("expected an error without keyspace")
+	}
+
+	m, err := New(nil, Config{Keyspace: "ks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.table() != "ks.schema_migrations" || m.lockTable() != "ks.schema_migrations_lock" {
+		t.Errorf("unexpected tables %s %s", m.table(), m.lockTable())
+	}
+	if m.cfg.ScratchKeyspace != "ks_scratch" || m.cfg.Owner == "" || m.lockTTL() != 60 {
+		t.Errorf("unexpected defaults %+v", m.cfg)
+	}
+}
+
+func TestScratchKeyspace(t *testing.T) {
+	m, err := New(nil, Config{Keyspace: "ks", ScratchKeyspace: strings.Repeat("k", 60)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.scratchKeyspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.scratchKeyspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || len(a) != maxKeyspaceNameLength || !strings.HasPrefix(a, strings.Repeat("k", 39)+"_") {
+		t.Errorf("unexpected scratch keyspaces %s %s", a, b)
+	}
+}
@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocql/gocql/internal/cql"
+)
+
+// Migration is a CQL migration file named "<version>_<description>.cql",
+// such as "0001_create_users.cql". The versions order the migrations.
+type Migration struct {
+	Version int64
+	Name    string
+	// Statements are the CQL statements of the file, without comments and
+	// trailing semicolons.
+	Statements []string
+	// Checksum is the hex encoded SHA-256 of the file.
+	Checksum string
+}
+
+// ParseMigration parses the migration file name with the given content.
+func ParseMigration(name string, content []byte) (Migration, error) {
+	base := path.Base(name)
+	prefix := strings.TrimSuffix(base, path.Ext(base))
+	if i := strings.IndexByte(prefix, '_'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return Migration{}, fmt.Errorf("migrate: %s: name must start with a version: %w", name, err)
+	}
+
+	stmts, err := SplitStatements(string(content))
+	if err != nil {
+		return Migration{}, fmt.Errorf("migrate: %s: %w", name, err)
+	}
+
+	sum := sha256.Sum256(content)
+	return Migration{
+		Version:    version,
+		Name:       base,
+		Statements: stmts,
+		Checksum:   hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// FromFS reads the migrations from the ".cql" files at the root of fsys,
+// such as the files of an embed.FS, sorted by version.
+func FromFS(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.cql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := ParseMigration(name, content)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// FromDir reads the migrations from the ".cql" files of dir, sorted by version.
+func FromDir(dir string) ([]Migration, error) {
+	return FromFS(os.DirFS(dir))
+}
+
+func sortMigrations(migrations []Migration) error {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return fmt.Errorf("migrate: %s and %s have the same version %d",
+				migrations[i-1].Name, migrations[i].Name, migrations[i].Version)
+		}
+	}
+	return nil
+}
+
+// SplitStatements splits a CQL script into its statements, dropping the
+// comments and the semicolons ending the statements. Semicolons in strings,
+// quoted identifiers and $$ function bodies don't end a statement.
+func SplitStatements(script string) ([]string, error) {
+	return cql.SplitStatements(script)
+}
+
+// isDDL reports whether stmt changes the schema.
+func isDDL(stmt string) bool {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP":
+		return true
+	}
+	return false
+}
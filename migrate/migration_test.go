@@ -0,0 +1,86 @@
+//go:build unit
+// +build unit
+
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- users
+CREATE TABLE ks.users (id uuid PRIMARY KEY, name text); // trailing comment
+/* a block
+   comment; with a semicolon */
+INSERT INTO ks.users (id, name) VALUES (uuid(), 'it''s; fine');
+CREATE FUNCTION ks.f (v int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$return v; $$;
+ALTER TABLE "ks"."Quoted;" ADD c int`
+
+	stmts, err := SplitStatements(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"CREATE TABLE ks.users (id uuid PRIMARY KEY, name text)",
+		"INSERT INTO ks.users (id, name) VALUES (uuid(), 'it''s; fine')",
+		"CREATE FUNCTION ks.f (v int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$return v; $$",
+		`ALTER TABLE "ks"."Quoted;" ADD c int`,
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("expected %q got %q", expected, stmts)
+	}
+
+	for _, script := range []string{"SELECT 'a", "/* a", "AS $$a"} {
+		if _, err := SplitStatements(script); err == nil {
+			t.Errorf("%q: expected an error", script)
+		}
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_add_email.cql":    {Data: []byte("ALTER TABLE ks.users ADD email text;")},
+		"0002_create_users.cql": {Data: []byte("CREATE TABLE ks.users (id uuid PRIMARY KEY);")},
+		"README.md":             {Data: []byte("not a migration")},
+	}
+	migrations, err := FromFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations got %+v", migrations)
+	}
+	if migrations[0].Version != 2 || migrations[0].Name != "0002_create_users.cql" || migrations[1].Version != 10 {
+		t.Errorf("expected the migrations sorted by version got %+v", migrations)
+	}
+	if len(migrations[1].Statements) != 1 || migrations[1].Checksum == "" || migrations[0].Checksum == migrations[1].Checksum {
+		t.Errorf("unexpected migration %+v", migrations[1])
+	}
+
+	fsys["0010_duplicate.cql"] = &fstest.MapFile{Data: []byte("SELECT now() FROM system.local;")}
+	if _, err := FromFS(fsys); err == nil || !strings.Contains(err.Error(), "same version") {
+		t.Errorf("expected duplicate versions error got %v", err)
+	}
+
+	if _, err := FromFS(fstest.MapFS{"init.cql": {}}); err == nil {
+		t.Error("expected an error for a name without a version")
+	}
+}
+
+func TestIsDDL(t *testing.T) {
+	for stmt, ddl := range map[string]bool{
+		"CREATE TABLE ks.t (id int PRIMARY KEY)": true,
+		"  alter table ks.t ADD c int":           true,
+		"DROP INDEX ks.i":                        true,
+		"INSERT INTO ks.t (id) VALUES (1)":       false,
+		"":                                       false,
+	} {
+		if got := isDDL(stmt); got != ddl {
+			t.Errorf("%q: expected %v got %v", stmt, ddl, got)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/gocql/gocql/internal/cql"
+)
+
+// keyspaceRewriter rewrites the statements of a keyspace to another one.
+type keyspaceRewriter struct {
+	from, to string
+}
+
+func newKeyspaceRewriter(from, to string) *keyspaceRewriter {
+	return &keyspaceRewriter{from: from, to: to}
+}
+
+// rewrite returns stmt with the keyspace replaced. It reports false if stmt
+// targets no object, or an object which is not qualified with the keyspace,
+// as executing it would change another keyspace.
+func (r *keyspaceRewriter) rewrite(stmt string) (string, bool) {
+	tokens, err := cql.Lex(stmt)
+	if err != nil {
+		return stmt, false
+	}
+
+	// the names to replace
+	var names []cql.Token
+	for i, tok := range tokens {
+		if r.isKeyspace(tok) && i+1 < len(tokens) && tokens[i+1].Is(".") {
+			names = append(names, tok)
+		}
+	}
+
+	targets, keyspaceTarget := statementTargets(tokens)
+	if len(targets) == 0 && keyspaceTarget < 0 {
+		return stmt, false
+	}
+	for _, i := range targets {
+		if i >= len(tokens) || !r.isKeyspace(tokens[i]) || i+1 >= len(tokens) || !tokens[i+1].Is(".") {
+			return stmt, false
+		}
+	}
+	if keyspaceTarget >= 0 {
+		if keyspaceTarget >= len(tokens) || !r.isKeyspace(tokens[keyspaceTarget]) {
+			return stmt, false
+		}
+		names = append(names, tokens[keyspaceTarget])
+		sort.Slice(names, func(i, j int) bool { return names[i].Start < names[j].Start })
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, name := range names {
+		sb.WriteString(stmt[last:name.Start])
+		if name.Kind == cql.Quoted {
+			sb.WriteString(`"` + strings.ReplaceAll(r.to, `"`, `""`) + `"`)
+		} else {
+			sb.WriteString(r.to)
+		}
+		last = name.End
+	}
+	sb.WriteString(stmt[last:])
+	return sb.String(), true
+}
+
+// isKeyspace reports whether tok names the keyspace, unquoted names being
+// case insensitive.
+func (r *keyspaceRewriter) isKeyspace(tok cql.Token) bool {
+	switch tok.Kind {
+	case cql.Quoted:
+		return tok.Text == r.from
+	case cql.Word:
+		return strings.ToLower(tok.Text) == r.from
+	}
+	return false
+}
+
+// statementTargets returns the indexes of the tokens naming the objects
+// targeted by a statement, whose keyspace precedes them: the tables read or
+// written, including in batches and views, and the objects created, altered
+// or dropped. keyspaceTarget is the index of the name of the keyspace
+// created, altered or dropped, or -1.
+func statementTargets(tokens []cql.Token) (targets []int, keyspaceTarget int) {
+	keyspaceTarget = -1
+	is := func(i int, keywords ...string) bool {
+		if i >= len(tokens) || tokens[i].Kind != cql.Word {
+			return false
+		}
+		for _, keyword := range keywords {
+			if strings.EqualFold(tokens[i].Text, keyword) {
+				return true
+			}
+		}
+		return false
+	}
+	skipIfExists := func(i int) int {
+		if is(i, "IF") {
+			i++
+			if is(i, "NOT") {
+				i++
+			}
+			if is(i, "EXISTS") {
+				i++
+			}
+		}
+		return i
+	}
+	indexOf := func(from int, keyword string) int {
+		for i := from; i < len(tokens); i++ {
+			if is(i, keyword) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	switch {
+	case is(0, "CREATE", "ALTER", "DROP"):
+		i := 1
+		if is(i, "OR") && is(i+1, "REPLACE") {
+			i += 2
+		}
+		if is(i, "CUSTOM", "MATERIALIZED") {
+			i++
+		}
+		switch {
+		case is(i, "KEYSPACE", "SCHEMA"):
+			keyspaceTarget = skipIfExists(i + 1)
+		case is(i, "INDEX", "TRIGGER"):
+			// indexes and triggers are created on a table, indexes are
+			// dropped with their keyspace
+			if on := indexOf(i+1, "ON"); on >= 0 {
+				targets = append(targets, on+1)
+			} else {
+				targets = append(targets, skipIfExists(i+1))
+			}
+		case is(i, "TABLE", "COLUMNFAMILY", "TYPE", "VIEW", "FUNCTION", "AGGREGATE"):
+			targets = append(targets, skipIfExists(i+1))
+		}
+	case is(0, "TRUNCATE"):
+		i := 1
+		if is(i, "TABLE", "COLUMNFAMILY") {
+			i++
+		}
+		targets = append(targets, i)
+	}
+
+	// statements reading or writing tables, possibly in batches or views
+	for i := range tokens {
+		switch {
+		case is(i, "INSERT") && is(i+1, "INTO"):
+			targets = append(targets, i+2)
+		case is(i, "UPDATE"), is(i, "FROM"):
+			targets = append(targets, i+1)
+		}
+	}
+	return targets, keyspaceTarget
+}
+
+// renameKeyspace returns a copy of km named name.
+func renameKeyspace(km *gocql.KeyspaceMetadata, name string) *gocql.KeyspaceMetadata {
+	if km == nil {
+		return nil
+	}
+	renamed := *km
+	renamed.Name = name
+	renamed.CreateStmts = ""
+	return &renamed
+}
+
+// scratchRun applies the pending migrations to a scratch copy of the keyspace
+// and writes them with the schema differences they make to the output.
+func (m *Migrator) scratchRun(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	live, err := m.session.KeyspaceMetadata(m.cfg.Keyspace)
+	if err != nil && !errors.Is(err, gocql.ErrKeyspaceDoesNotExist) {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	var applied []AppliedMigration
+	if live != nil && live.Tables[m.cfg.Table] != nil {
+		if applied, err = m.Applied(ctx); err != nil {
+			return nil, err
+		}
+	}
+	pending, err := pendingMigrations(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := m.scratchKeyspace()
+	if err != nil {
+		return nil, err
+	}
+
+	// check all the statements before changing the cluster
+	rewriter := newKeyspaceRewriter(m.cfg.Keyspace, scratch)
+	rewritten := make([][]string, len(pending))
+	for i, p := range pending {
+		for j := p.done; j < len(p.Statements); j++ {
+			stmt, ok := rewriter.rewrite(p.Statements[j])
+			if !ok {
+				return nil, fmt.Errorf("migrate: %s: statement %d doesn't qualify its targets with keyspace %s, which scratch runs require",
+					p.Name, j+1, m.cfg.Keyspace)
+			}
+			rewritten[i] = append(rewritten[i], stmt)
+		}
+	}
+
+	out := m.cfg.Output
+	fmt.Fprintf(out, "-- scratch run of %d pending migrations of keyspace %s in keyspace %s\n",
+		len(pending), m.cfg.Keyspace, scratch)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	drop := "DROP KEYSPACE IF EXISTS " + scratch
+	defer func() {
+		if err := m.exec(context.Background(), drop); err != nil {
+			m.log(gocql.LogLevelWarn, "unable to drop the keyspace of the scratch run",
+				gocql.LogField{Key: "keyspace", Value: scratch}, gocql.LogField{Key: gocql.LogFieldError, Value: err})
+		}
+	}()
+
+	if live != nil {
+		copied := gocql.DiffKeyspaces(nil, renameKeyspace(live, scratch))
+		if copied.Err != nil {
+			return nil, fmt.Errorf("migrate: copying keyspace %s: %w", m.cfg.Keyspace, copied.Err)
+		}
+		for _, stmt := range copied.Statements {
+			if err := m.exec(ctx, stmt); err != nil {
+				return nil, fmt.Errorf("migrate: copying keyspace %s: %w", m.cfg.Keyspace, err)
+			}
+		}
+	}
+
+	done := make([]Migration, 0, len(pending))
+	for i, p := range pending {
+		fmt.Fprintf(out, "-- %s\n", p.Name)
+		for j, stmt := range rewritten[i] {
+			fmt.Fprintf(out, "%s;\n", p.Statements[p.done+j])
+			if err := m.exec(ctx, stmt); err != nil {
+				return done, fmt.Errorf("migrate: %s: statement %d: %w", p.Name, p.done+j+1, err)
+			}
+		}
+		done = append(done, p.Migration)
+	}
+
+	migrated, err := m.session.KeyspaceMetadata(scratch)
+	if err != nil {
+		return done, fmt.Errorf("migrate: %w", err)
+	}
+	diff := gocql.DiffKeyspaces(live, renameKeyspace(migrated, m.cfg.Keyspace))
+	fmt.Fprintf(out, "-- schema differences of keyspace %s\n", m.cfg.Keyspace)
+	if !diff.Empty() {
+		fmt.Fprintln(out, diff)
+	}
+	return done, nil
+}
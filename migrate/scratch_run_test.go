@@ -0,0 +1,55 @@
+//go:build unit
+// +build unit
+
+package migrate
+
+import (
+	"testing"
+)
+
+func TestKeyspaceRewriter(t *testing.T) {
+	r := newKeyspaceRewriter("ks", "ks_scratch")
+	tests := []struct {
+		stmt, expected string
+		ok             bool
+	}{
+		{"CREATE TABLE ks.users (id int PRIMARY KEY)", "CREATE TABLE ks_scratch.users (id int PRIMARY KEY)", true},
+		{`ALTER TABLE "ks"."Users" ADD c int`, `ALTER TABLE "ks_scratch"."Users" ADD c int`, true},
+		{"INSERT INTO ks . t (a) SELECT", "INSERT INTO ks_scratch . t (a) SELECT", true},
+		{"CREATE INDEX i ON ks.t (ks)", "CREATE INDEX i ON ks_scratch.t (ks)", true},
+		{"ALTER KEYSPACE ks WITH durable_writes = false", "ALTER KEYSPACE ks_scratch WITH durable_writes = false", true},
+		{"CREATE KEYSPACE IF NOT EXISTS ks WITH replication = {}", "CREATE KEYSPACE IF NOT EXISTS ks_scratch WITH replication = {}", true},
+		// other keyspaces and unqualified tables are left unchanged
+		{"CREATE TABLE books.t (id int PRIMARY KEY)", "CREATE TABLE books.t (id int PRIMARY KEY)", false},
+		{"CREATE TABLE t (ks int PRIMARY KEY)", "CREATE TABLE t (ks int PRIMARY KEY)", false},
+		{"DROP KEYSPACE ks2", "DROP KEYSPACE ks2", false},
+		{"ALTER TABLE t ADD c int", "ALTER TABLE t ADD c int", false},
+		{"GRANT SELECT ON ks.t TO r", "GRANT SELECT ON ks.t TO r", false},
+		// string literals, $$ strings and comments aren't names
+		{"INSERT INTO t (x) VALUES ('ks.x')", "INSERT INTO t (x) VALUES ('ks.x')", false},
+		{"INSERT INTO ks.t (x) VALUES ('ks.x''s')", "INSERT INTO ks_scratch.t (x) VALUES ('ks.x''s')", true},
+		{"UPDATE /* ks.t */ t SET x = 1", "UPDATE /* ks.t */ t SET x = 1", false},
+		{"UPDATE ks.t -- ks.t\nSET x = 1", "UPDATE ks_scratch.t -- ks.t\nSET x = 1", true},
+		{"CREATE FUNCTION ks.f (a int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$ return 'ks.a' $$",
+			"CREATE FUNCTION ks_scratch.f (a int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$ return 'ks.a' $$", true},
+		{"INSERT INTO t (x) VALUES ('unterminated", "INSERT INTO t (x) VALUES ('unterminated", false},
+		// every target must be qualified
+		{"BEGIN BATCH INSERT INTO ks.a (x) VALUES (1); UPDATE b SET x = 1 WHERE y = 1; APPLY BATCH",
+			"BEGIN BATCH INSERT INTO ks.a (x) VALUES (1); UPDATE b SET x = 1 WHERE y = 1; APPLY BATCH", false},
+		{"BEGIN BATCH INSERT INTO ks.a (x) VALUES (1); DELETE FROM KS.b WHERE y = 1; APPLY BATCH",
+			"BEGIN BATCH INSERT INTO ks_scratch.a (x) VALUES (1); DELETE FROM ks_scratch.b WHERE y = 1; APPLY BATCH", true},
+		{"CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM other.t WHERE k IS NOT NULL PRIMARY KEY (k)",
+			"CREATE MATERIALIZED VIEW ks.v AS SELECT * FROM other.t WHERE k IS NOT NULL PRIMARY KEY (k)", false},
+		{"CREATE MATERIALIZED VIEW IF NOT EXISTS ks.v AS SELECT * FROM ks.t WHERE k IS NOT NULL PRIMARY KEY (k)",
+			"CREATE MATERIALIZED VIEW IF NOT EXISTS ks_scratch.v AS SELECT * FROM ks_scratch.t WHERE k IS NOT NULL PRIMARY KEY (k)", true},
+		{"DROP INDEX IF EXISTS ks.i", "DROP INDEX IF EXISTS ks_scratch.i", true},
+		{"TRUNCATE TABLE ks.t", "TRUNCATE TABLE ks_scratch.t", true},
+		{`CREATE TABLE "KS".t (id int PRIMARY KEY)`, `CREATE TABLE "KS".t (id int PRIMARY KEY)`, false},
+	}
+	for _, test := range tests {
+		got, ok := r.rewrite(test.stmt)
+		if got != test.expected || ok != test.ok {
+			t.Errorf("%q: expected %q %v got %q %v", test.stmt, test.expected, test.ok, got, ok)
+		}
+	}
+}
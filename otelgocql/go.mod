@@ -0,0 +1,24 @@
+module github.com/gocql/gocql/otelgocql
+
+go 1.20
+
+require (
+	github.com/gocql/gocql v1.7.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	gopkg.in/inf.v0 v0.9.1 // indirect
+)
+
+// the module is developed with the driver in the parent directory, whose
+// observer APIs it uses; the requirement above is to be raised to the first
+// driver release providing them
+replace github.com/gocql/gocql => ../
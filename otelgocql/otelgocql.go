@@ -0,0 +1,297 @@
+// Package otelgocql traces gocql queries, batches, connections and streams
+// with OpenTelemetry. Observer implements the gocql observer interfaces and
+// records a span for every attempt:
+//
+//	observer := otelgocql.NewObserver()
+//	cluster.QueryObserver = observer
+//	cluster.BatchObserver = observer
+//	cluster.ConnectObserver = observer
+//	cluster.StreamObserver = observer
+//
+// The spans of queries and batches are children of the span in the context of
+// the query, set with Query.WithContext. Observers are notified once an attempt
+// is over, so the spans are recorded with the start and end time of the attempt.
+//
+// The observers don't send the trace context to the server, as they are
+// notified once the request is sent. It is propagated only to the queries and
+// batches passed to InjectQuery and InjectBatch:
+//
+//	err := observer.InjectQuery(ctx, session.Query(stmt, values...).WithContext(ctx)).Exec()
+package otelgocql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gocql/gocql"
+)
+
+// InstrumentationName is the name of the tracer used by Observer.
+const InstrumentationName = "github.com/gocql/gocql/otelgocql"
+
+// Attribute keys of the spans, the db.* and server.* keys follow the
+// OpenTelemetry semantic conventions.
+const (
+	DBSystemKey        = attribute.Key("db.system")
+	DBStatementKey     = attribute.Key("db.statement")
+	DBOperationKey     = attribute.Key("db.operation")
+	DBKeyspaceKey      = attribute.Key("db.name")
+	DBConsistencyKey   = attribute.Key("db.cassandra.consistency_level")
+	DBCoordinatorIDKey = attribute.Key("db.cassandra.coordinator.id")
+	DBCoordinatorDCKey = attribute.Key("db.cassandra.coordinator.dc")
+	DBAttemptKey       = attribute.Key("db.cassandra.attempt")
+	DBSpeculativeKey   = attribute.Key("db.cassandra.speculative")
+	DBRowsKey          = attribute.Key("db.cassandra.rows")
+	DBBatchSizeKey     = attribute.Key("db.cassandra.batch.size")
+	ServerAddressKey   = attribute.Key("server.address")
+	ServerPortKey      = attribute.Key("server.port")
+)
+
+const dbSystemCassandraName = "cassandra"
+
+// Option configures an Observer.
+type Option func(*Observer)
+
+// WithTracerProvider sets the tracer provider of the spans.
+// Default: the global tracer provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *Observer) {
+		o.provider = provider
+	}
+}
+
+// WithPropagator sets the propagator injecting trace context into custom payloads.
+// Default: the global text map propagator.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(o *Observer) {
+		o.propagator = propagator
+	}
+}
+
+// WithoutStatements leaves the statements out of the span attributes.
+func WithoutStatements() Option {
+	return func(o *Observer) {
+		o.omitStatements = true
+	}
+}
+
+// Observer records spans of queries, batches, connections and streams. It
+// implements gocql.QueryObserver, gocql.BatchObserver, gocql.ConnectObserver
+// and gocql.StreamObserver.
+type Observer struct {
+	provider       trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	omitStatements bool
+
+	tracer trace.Tracer
+}
+
+// NewObserver returns an Observer configured with opts.
+func NewObserver(opts ...Option) *Observer {
+	o := &Observer{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.provider == nil {
+		o.provider = otel.GetTracerProvider()
+	}
+	if o.propagator == nil {
+		o.propagator = otel.GetTextMapPropagator()
+	}
+	o.tracer = o.provider.Tracer(InstrumentationName)
+	return o
+}
+
+// ObserveQuery records a span of a query attempt.
+func (o *Observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	operation := operationName(q.Statement)
+	attrs := []attribute.KeyValue{
+		DBSystemKey.String(dbSystemCassandraName),
+		DBOperationKey.String(operation),
+		DBKeyspaceKey.String(q.Keyspace),
+		DBConsistencyKey.String(q.Consistency.String()),
+		DBAttemptKey.Int(q.Attempt),
+		DBSpeculativeKey.Bool(q.Speculative),
+		DBRowsKey.Int(q.Rows),
+	}
+	if !o.omitStatements {
+		attrs = append(attrs, DBStatementKey.String(q.Statement))
+	}
+	attrs = append(attrs, hostAttributes(q.Host)...)
+
+	_, span := o.tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(q.Start),
+		trace.WithAttributes(attrs...))
+	endSpan(span, q.Err, q.End)
+}
+
+// ObserveBatch records a span of a batch attempt.
+func (o *Observer) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	attrs := []attribute.KeyValue{
+		DBSystemKey.String(dbSystemCassandraName),
+		DBOperationKey.String("BATCH"),
+		DBKeyspaceKey.String(b.Keyspace),
+		DBConsistencyKey.String(b.Consistency.String()),
+		DBAttemptKey.Int(b.Attempt),
+		DBSpeculativeKey.Bool(b.Speculative),
+		DBBatchSizeKey.Int(len(b.Statements)),
+	}
+	if !o.omitStatements {
+		attrs = append(attrs, DBStatementKey.String(strings.Join(b.Statements, "; ")))
+	}
+	attrs = append(attrs, hostAttributes(b.Host)...)
+
+	_, span := o.tracer.Start(ctx, "BATCH",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(b.Start),
+		trace.WithAttributes(attrs...))
+	endSpan(span, b.Err, b.End)
+}
+
+// ObserveConnect records a span of a connection attempt. The span is the
+// root of its trace, as connections are not made on behalf of a query.
+func (o *Observer) ObserveConnect(c gocql.ObservedConnect) {
+	attrs := append([]attribute.KeyValue{DBSystemKey.String(dbSystemCassandraName)}, hostAttributes(c.Host)...)
+	_, span := o.tracer.Start(context.Background(), "CONNECT",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(c.Start),
+		trace.WithAttributes(attrs...))
+	endSpan(span, c.Err, c.End)
+}
+
+// StreamContext returns an observer recording a span of the stream if ctx
+// holds a span, so that streams of internal requests are not traced.
+func (o *Observer) StreamContext(ctx context.Context) gocql.StreamObserverContext {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	return &streamObserver{observer: o, ctx: ctx}
+}
+
+type streamObserver struct {
+	observer *Observer
+	ctx      context.Context
+	span     trace.Span
+}
+
+func (s *streamObserver) StreamStarted(stream gocql.ObservedStream) {
+	attrs := append([]attribute.KeyValue{DBSystemKey.String(dbSystemCassandraName)}, hostAttributes(stream.Host)...)
+	_, s.span = s.observer.tracer.Start(s.ctx, "STREAM",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+func (s *streamObserver) StreamAbandoned(gocql.ObservedStream) {
+	if s.span != nil {
+		s.span.SetStatus(codes.Error, "stream abandoned")
+		s.span.End()
+	}
+}
+
+func (s *streamObserver) StreamFinished(gocql.ObservedStream) {
+	if s.span != nil {
+		s.span.End()
+	}
+}
+
+// Inject adds the trace context of ctx to payload, allocating it if it is
+// nil, and returns it. The trace context is sent to the server in the custom
+// payload of the request, which allows correlating server side traces.
+func (o *Observer) Inject(ctx context.Context, payload map[string][]byte) map[string][]byte {
+	if payload == nil {
+		payload = make(map[string][]byte)
+	}
+	o.propagator.Inject(ctx, PayloadCarrier(payload))
+	return payload
+}
+
+// InjectQuery adds the trace context of ctx to the custom payload of q. The
+// custom payload previously set on q is copied, not modified.
+func (o *Observer) InjectQuery(ctx context.Context, q *gocql.Query) *gocql.Query {
+	return q.CustomPayload(o.Inject(ctx, copyPayload(q.GetCustomPayload())))
+}
+
+// InjectBatch adds the trace context of ctx to the custom payload of b. The
+// custom payload previously set on b is copied, not modified.
+func (o *Observer) InjectBatch(ctx context.Context, b *gocql.Batch) *gocql.Batch {
+	b.CustomPayload = o.Inject(ctx, copyPayload(b.CustomPayload))
+	return b
+}
+
+func copyPayload(payload map[string][]byte) map[string][]byte {
+	copied := make(map[string][]byte, len(payload)+2)
+	for key, value := range payload {
+		copied[key] = value
+	}
+	return copied
+}
+
+// PayloadCarrier adapts a CQL custom payload to propagation.TextMapCarrier.
+type PayloadCarrier map[string][]byte
+
+var _ propagation.TextMapCarrier = PayloadCarrier(nil)
+
+func (c PayloadCarrier) Get(key string) string {
+	return string(c[key])
+}
+
+func (c PayloadCarrier) Set(key, value string) {
+	c[key] = []byte(value)
+}
+
+func (c PayloadCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func hostAttributes(host *gocql.HostInfo) []attribute.KeyValue {
+	if host == nil {
+		return nil
+	}
+	attrs := make([]attribute.KeyValue, 0, 4)
+	if addr, err := host.ConnectAddressWithError(); err == nil {
+		attrs = append(attrs, ServerAddressKey.String(addr.String()))
+	}
+	if port := host.Port(); port != 0 {
+		attrs = append(attrs, ServerPortKey.Int(port))
+	}
+	if id := host.HostID(); id != "" {
+		attrs = append(attrs, DBCoordinatorIDKey.String(id))
+	}
+	if dc := host.DataCenter(); dc != "" {
+		attrs = append(attrs, DBCoordinatorDCKey.String(dc))
+	}
+	return attrs
+}
+
+func endSpan(span trace.Span, err error, end time.Time) {
+	if err != nil {
+		span.RecordError(err, trace.WithTimestamp(end))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// operationName returns the uppercased first keyword of stmt.
+func operationName(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+	if i := strings.IndexAny(stmt, " \t\r\n"); i >= 0 {
+		stmt = stmt[:i]
+	}
+	if stmt == "" {
+		return "QUERY"
+	}
+	return strings.ToUpper(stmt)
+}
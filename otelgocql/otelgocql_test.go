@@ -0,0 +1,183 @@
+//go:build unit
+// +build unit
+
+package otelgocql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gocql/gocql"
+)
+
+func newTestObserver(opts ...Option) (*Observer, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	opts = append([]Option{WithTracerProvider(provider), WithPropagator(propagation.TraceContext{})}, opts...)
+	return NewObserver(opts...), exporter, provider
+}
+
+func testHost() *gocql.HostInfo {
+	host := &gocql.HostInfo{}
+	host.SetConnectAddress(net.ParseIP("10.0.0.1"))
+	host.SetHostID("host-1")
+	return host
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestObserveQuery(t *testing.T) {
+	observer, exporter, provider := newTestObserver()
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	start := time.Now()
+	observer.ObserveQuery(ctx, gocql.ObservedQuery{
+		Keyspace:    "ks",
+		Statement:   "select * from t where id = ?",
+		Consistency: gocql.LocalQuorum,
+		Start:       start,
+		End:         start.Add(time.Millisecond),
+		Rows:        3,
+		Host:        testHost(),
+		Attempt:     1,
+		Err:         errors.New("failed"),
+	})
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "SELECT" || span.SpanKind != trace.SpanKindClient {
+		t.Fatalf("unexpected span %s of kind %v", span.Name, span.SpanKind)
+	}
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the span to be a child of the span of the context")
+	}
+	if !span.StartTime.Equal(start) || span.EndTime.Sub(span.StartTime) != time.Millisecond {
+		t.Fatalf("expected the span to last the attempt got %v - %v", span.StartTime, span.EndTime)
+	}
+	if span.Status.Code != codes.Error {
+		t.Fatalf("expected an error status got %v", span.Status)
+	}
+
+	attrs := attributes(span)
+	expected := map[attribute.Key]attribute.Value{
+		DBSystemKey:        attribute.StringValue("cassandra"),
+		DBStatementKey:     attribute.StringValue("select * from t where id = ?"),
+		DBOperationKey:     attribute.StringValue("SELECT"),
+		DBKeyspaceKey:      attribute.StringValue("ks"),
+		DBConsistencyKey:   attribute.StringValue("LOCAL_QUORUM"),
+		DBAttemptKey:       attribute.IntValue(1),
+		DBRowsKey:          attribute.IntValue(3),
+		DBCoordinatorIDKey: attribute.StringValue("host-1"),
+		ServerAddressKey:   attribute.StringValue("10.0.0.1"),
+	}
+	for key, value := range expected {
+		if attrs[key] != value {
+			t.Errorf("expected %s=%v got %v", key, value.Emit(), attrs[key].Emit())
+		}
+	}
+}
+
+func TestObserveBatchWithoutStatements(t *testing.T) {
+	observer, exporter, _ := newTestObserver(WithoutStatements())
+
+	observer.ObserveBatch(context.Background(), gocql.ObservedBatch{
+		Keyspace:    "ks",
+		Statements:  []string{"INSERT INTO t (id) VALUES (1)", "INSERT INTO t (id) VALUES (2)"},
+		Consistency: gocql.One,
+		Start:       time.Now(),
+		End:         time.Now(),
+	})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "BATCH" {
+		t.Fatalf("expected a batch span got %v", spans)
+	}
+	attrs := attributes(spans[0])
+	if _, ok := attrs[DBStatementKey]; ok {
+		t.Fatal("expected the statements to be left out")
+	}
+	if attrs[DBBatchSizeKey] != attribute.IntValue(2) {
+		t.Fatalf("expected a batch of 2 statements got %v", attrs[DBBatchSizeKey].Emit())
+	}
+}
+
+func TestObserveConnect(t *testing.T) {
+	observer, exporter, _ := newTestObserver()
+
+	observer.ObserveConnect(gocql.ObservedConnect{Host: testHost(), Start: time.Now(), End: time.Now()})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "CONNECT" || spans[0].Parent.IsValid() {
+		t.Fatalf("expected a root connect span got %v", spans)
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+	observer, exporter, provider := newTestObserver()
+
+	if stream := observer.StreamContext(context.Background()); stream != nil {
+		t.Fatal("expected streams without a span not to be traced")
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+	stream := observer.StreamContext(ctx)
+	stream.StreamStarted(gocql.ObservedStream{Host: testHost()})
+	stream.StreamFinished(gocql.ObservedStream{Host: testHost()})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "STREAM" || spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected a stream span got %v", spans)
+	}
+}
+
+func TestInject(t *testing.T) {
+	observer, _, provider := newTestObserver()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+
+	payload := observer.Inject(ctx, map[string][]byte{"key": []byte("value")})
+	if string(payload["key"]) != "value" {
+		t.Fatal("expected the payload to be kept")
+	}
+
+	extracted := propagation.TraceContext{}.Extract(context.Background(), PayloadCarrier(payload))
+	if sc := trace.SpanContextFromContext(extracted); sc.TraceID() != span.SpanContext().TraceID() {
+		t.Fatalf("expected trace %s in the payload got %s", span.SpanContext().TraceID(), sc.TraceID())
+	}
+
+	batch := observer.InjectBatch(ctx, &gocql.Batch{})
+	if _, ok := batch.CustomPayload["traceparent"]; !ok {
+		t.Fatalf("expected the trace context in the batch payload got %v", batch.CustomPayload)
+	}
+
+	// the custom payload of queries is merged, without modifying it
+	custom := map[string][]byte{"key": []byte("value")}
+	query := observer.InjectQuery(ctx, (&gocql.Query{}).CustomPayload(custom))
+	if payload := query.GetCustomPayload(); string(payload["key"]) != "value" || payload["traceparent"] == nil {
+		t.Fatalf("expected the custom payload with the trace context got %v", payload)
+	}
+	if len(custom) != 1 {
+		t.Fatalf("expected the custom payload not to be modified got %v", custom)
+	}
+}
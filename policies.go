@@ -367,6 +367,12 @@ type HostSelectionPolicy interface {
 	IsOperational(*Session) error
 }
 
+// bulkAddHosts is implemented by policies which can add multiple hosts at once
+// more efficiently than one by one.
+type bulkAddHosts interface {
+	AddHosts([]*HostInfo)
+}
+
 // SelectedHost is an interface returned when picking a host from a host
 // selection policy.
 type SelectedHost interface {
@@ -664,6 +670,12 @@ func (t *tokenAwareHostPolicy) RemoveHost(host *HostInfo) {
 	t.fallback.RemoveHost(host)
 }
 
+func (t *tokenAwareHostPolicy) trackLatency(host *HostInfo, latency time.Duration, err error) {
+	if tracker, ok := t.fallback.(hostLatencyTracker); ok {
+		tracker.trackLatency(host, latency, err)
+	}
+}
+
 func (t *tokenAwareHostPolicy) HostUp(host *HostInfo) {
 	t.fallback.HostUp(host)
 }
@@ -785,6 +797,10 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 		replicas = append(healthyReplicas, unhealthyReplicas...)
 	}
 
+	if penalizer, ok := t.fallback.(hostPenalizer); ok && !qry.IsLWT() && len(replicas) > 1 {
+		replicas = penalizer.penalizedLast(replicas)
+	}
+
 	var (
 		fallbackIter NextHost
 		i, j, k      int
@@ -1113,6 +1129,12 @@ func (s *singleHostReadyPolicy) HostUp(host *HostInfo) {
 	s.readyMux.Unlock()
 }
 
+func (s *singleHostReadyPolicy) trackLatency(host *HostInfo, latency time.Duration, err error) {
+	if tracker, ok := s.HostSelectionPolicy.(hostLatencyTracker); ok {
+		tracker.trackLatency(host, latency, err)
+	}
+}
+
 func (s *singleHostReadyPolicy) Ready() bool {
 	s.readyMux.Lock()
 	ready := s.ready
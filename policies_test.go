@@ -1131,7 +1131,7 @@ func TestTokenAwarePolicyReset(t *testing.T) {
 		t.Fatal("nonLocalReplicasFallback is false")
 	}
 
-	policy.Init(&Session{logger: &defaultLogger{}})
+	policy.Init(&Session{logger: newDriverLogger(&defaultLogger{}, nil)})
 	if policyInternal.getKeyspaceMetadata == nil {
 		t.Fatal("keyspace metatadata fn is nil")
 	}
@@ -1180,7 +1180,7 @@ func TestTokenAwarePolicyResetInSessionClose(t *testing.T) {
 
 	// emulate session initialization
 	session := &Session{
-		logger: &defaultLogger{},
+		logger: newDriverLogger(&defaultLogger{}, nil),
 		policy: policy,
 	}
 	policy.Init(session)
@@ -54,6 +54,16 @@ func (p *preparedLRU) add(key string, val *inflightPrepare) {
 	p.lru.Add(key, val)
 }
 
+func (p *preparedLRU) get(key string) (*inflightPrepare, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	val, ok := p.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return val.(*inflightPrepare), true
+}
+
 func (p *preparedLRU) remove(key string) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -29,6 +29,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,9 +37,13 @@ type ExecutableQuery interface {
 	borrowForExecution()    // Used to ensure that the query stays alive for lifetime of a particular execution goroutine.
 	releaseAfterExecution() // Used when a goroutine finishes its execution attempts, either with ok result or an error.
 	execute(ctx context.Context, conn *Conn) *Iter
-	attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo)
+	// executeAsync executes the query on conn without waiting for the
+	// response, or returns false if it can't, see Conn.executeQueryAsync.
+	executeAsync(ctx context.Context, conn *Conn, done func(*Iter)) bool
+	attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo, speculative, won bool)
 	retryPolicy() RetryPolicy
 	speculativeExecutionPolicy() SpeculativeExecutionPolicy
+	executionProfile() *ExecutionProfile
 	GetRoutingKey() ([]byte, error)
 	Keyspace() string
 	Table() string
@@ -46,6 +51,7 @@ type ExecutableQuery interface {
 	IsLWT() bool
 	GetCustomPartitioner() Partitioner
 	GetHostID() string
+	timeouts() (total, attempt time.Duration)
 
 	withContext(context.Context) ExecutableQuery
 
@@ -55,30 +61,66 @@ type ExecutableQuery interface {
 }
 
 type queryExecutor struct {
-	pool   *policyConnPool
-	policy HostSelectionPolicy
+	pool      *policyConnPool
+	policy    HostSelectionPolicy
+	throttler RequestThrottler
+	// conviction is set if the conviction policy tracks the results of requests
+	conviction requestConvictionPolicy
+	metrics    *sessionMetrics
 }
 
-func (q *queryExecutor) attemptQuery(ctx context.Context, qry ExecutableQuery, conn *Conn) *Iter {
-	start := time.Now()
-	iter := qry.execute(ctx, conn)
-	end := time.Now()
-
-	qry.attempt(q.pool.keyspace, end, start, iter, conn.host)
+// trackAttempt records the attempt of qry on conn which ended with iter.
+func (q *queryExecutor) trackAttempt(ctx context.Context, qry ExecutableQuery, conn *Conn, start, end time.Time, iter *Iter) {
+	exec := executionFromContext(ctx)
+	qry.attempt(q.pool.keyspace, end, start, iter, conn.host, exec.speculative, exec.claimWin(iter.err))
+	q.metrics.trackAttempt(qry, conn.host, end.Sub(start), iter.err)
+	if q.conviction != nil {
+		q.conviction.trackRequest(conn.host, iter.err)
+	}
+	if tracker, ok := q.policy.(hostLatencyTracker); ok {
+		tracker.trackLatency(conn.host, end.Sub(start), iter.err)
+	}
+	if sp, ok := qry.speculativeExecutionPolicy().(adaptiveSpeculativeExecutionPolicy); ok {
+		sp.trackLatency(qry, end.Sub(start), iter.err)
+	}
+}
 
-	return iter
+// throttle waits for the request throttler to admit an attempt of qry to host.
+func (q *queryExecutor) throttle(ctx context.Context, qry ExecutableQuery, host *HostInfo) (func(error), error) {
+	// the routing key is only used to slow down rate limited partitions
+	routingKey, _ := qry.GetRoutingKey()
+	return q.throttler.Acquire(ctx, ThrottledRequest{
+		Host:       host,
+		Keyspace:   qry.Keyspace(),
+		Table:      qry.Table(),
+		RoutingKey: routingKey,
+	})
 }
 
 func (q *queryExecutor) speculate(ctx context.Context, qry ExecutableQuery, sp SpeculativeExecutionPolicy,
 	hostIter NextHost, results chan *Iter) *Iter {
-	ticker := time.NewTicker(sp.Delay())
+	delay := sp.Delay()
+	adaptive, isAdaptive := sp.(adaptiveSpeculativeExecutionPolicy)
+	if isAdaptive {
+		if delay = adaptive.delayFor(qry); delay <= 0 {
+			return nil
+		}
+	}
+	ticker := time.NewTicker(delay)
 	defer ticker.Stop()
 
+	exec := executionFromContext(ctx)
+	specCtx := withExecution(ctx, execution{speculative: true, won: exec.won, speculated: exec.speculated})
 	for i := 0; i < sp.Attempts(); i++ {
 		select {
 		case <-ticker.C:
+			if isAdaptive && !adaptive.allowSpeculation() {
+				continue
+			}
+			q.metrics.trackSpeculativeExecution()
+			atomic.StoreInt32(exec.speculated, 1)
 			qry.borrowForExecution() // ensure liveness in case of executing Query to prevent races with Query.Release().
-			go q.run(ctx, qry, hostIter, results)
+			go q.run(specCtx, qry, hostIter, results)
 		case <-ctx.Done():
 			return &Iter{err: ctx.Err()}
 		case iter := <-results:
@@ -90,6 +132,13 @@ func (q *queryExecutor) speculate(ctx context.Context, qry ExecutableQuery, sp S
 }
 
 func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
+	ctx := qry.Context()
+	if timeout, _ := qry.timeouts(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	var hostIter NextHost
 
 	// check if the hostID is specified for the query,
@@ -113,7 +162,7 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 	// it is, we force the policy to NonSpeculative
 	sp := qry.speculativeExecutionPolicy()
 	if qry.GetHostID() != "" || !qry.IsIdempotent() || sp.Attempts() == 0 {
-		return q.do(qry.Context(), qry, hostIter), nil
+		return q.do(ctx, qry, hostIter), nil
 	}
 
 	// When speculative execution is enabled, we could be accessing the host iterator from multiple goroutines below.
@@ -126,8 +175,9 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 		return origHostIter()
 	}
 
-	ctx, cancel := context.WithCancel(qry.Context())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	ctx = withExecution(ctx, execution{won: new(int32), speculated: new(int32)})
 
 	results := make(chan *Iter, 1)
 
@@ -150,124 +200,325 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 	}
 }
 
+// executeQueryAsync executes qry like executeQuery but calls done with the
+// iterator instead of returning it.
+//
+// Unless qry is executed speculatively, on a given host or with a request
+// throttler, which all wait, its first attempt is written on the calling
+// goroutine and done is called by the reader of the connection once the
+// response arrives. The execution continues on a new goroutine if the
+// statement has to be prepared first or the attempt fails.
+func (q *queryExecutor) executeQueryAsync(qry ExecutableQuery, done func(*Iter)) {
+	sp := qry.speculativeExecutionPolicy()
+	if qry.GetHostID() != "" || (qry.IsIdempotent() && sp.Attempts() > 0) || q.throttler != nil {
+		go func() {
+			iter, err := q.executeQuery(qry)
+			if err != nil {
+				iter = &Iter{err: err}
+			}
+			done(iter)
+		}()
+		return
+	}
+
+	ctx, cancel := qry.Context(), context.CancelFunc(func() {})
+	if timeout, _ := qry.timeouts(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	a := q.newAttempts(ctx, qry, q.policy.Pick(qry))
+	a.startAsync(a.hostIter(), func(iter *Iter) {
+		cancel()
+		done(iter)
+	})
+}
+
 func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter NextHost) *Iter {
+	a := q.newAttempts(ctx, qry, hostIter)
+	return a.run(hostIter())
+}
+
+// attempts are the attempts of an execution of a query on the hosts picked
+// for it, as long as its retry policy allows.
+type attempts struct {
+	q        *queryExecutor
+	ctx      context.Context
+	qry      ExecutableQuery
+	hostIter NextHost
+
+	shouldRetry    func(qry RetryableQuery) bool
+	getRetryType   func(error) RetryType
+	budget         retryBudget
+	attemptTimeout time.Duration
+
+	potentiallyExecuted bool
+	lastErr             error
+}
+
+func (q *queryExecutor) newAttempts(ctx context.Context, qry ExecutableQuery, hostIter NextHost) *attempts {
 	rt := qry.retryPolicy()
 	if rt == nil {
 		rt = &SimpleRetryPolicy{3}
 	}
 
-	lwtRT, isRTSupportsLWT := rt.(LWTRetryPolicy)
+	a := &attempts{
+		q:        q,
+		ctx:      ctx,
+		qry:      qry,
+		hostIter: hostIter,
+	}
+	if lwtRT, ok := rt.(LWTRetryPolicy); ok && qry.IsLWT() {
+		a.shouldRetry = lwtRT.AttemptLWT
+		a.getRetryType = lwtRT.GetRetryTypeLWT
+	} else {
+		a.shouldRetry = rt.Attempt
+		a.getRetryType = rt.GetRetryType
+	}
+	a.budget, _ = rt.(retryBudget)
+	_, a.attemptTimeout = qry.timeouts()
+	return a
+}
 
-	var getShouldRetry func(qry RetryableQuery) bool
-	var getRetryType func(error) RetryType
+// run makes the attempts starting with the one on selectedHost until one of
+// them is final and returns its iterator.
+func (a *attempts) run(selectedHost SelectedHost) *Iter {
+	for selectedHost != nil {
+		iter, retryType := a.execute(selectedHost)
+		var final *Iter
+		if final, selectedHost = a.next(iter, retryType, selectedHost); final != nil {
+			return final
+		}
+	}
+	return a.exhausted()
+}
 
-	if isRTSupportsLWT && qry.IsLWT() {
-		getShouldRetry = lwtRT.AttemptLWT
-		getRetryType = lwtRT.GetRetryTypeLWT
-	} else {
-		getShouldRetry = rt.Attempt
-		getRetryType = rt.GetRetryType
+// startAsync starts the attempt on selectedHost without waiting for its
+// response, see queryExecutor.executeQueryAsync.
+func (a *attempts) startAsync(selectedHost SelectedHost, done func(*Iter)) {
+	if selectedHost == nil {
+		done(a.exhausted())
+		return
 	}
 
-	var potentiallyExecuted bool
+	conn, release, iter, retryType := a.connect(selectedHost)
+	if conn == nil {
+		a.continueAsync(iter, retryType, selectedHost, done)
+		return
+	}
 
-	execute := func(qry ExecutableQuery, selectedHost SelectedHost) (iter *Iter, retry RetryType) {
-		host := selectedHost.Info()
-		if host == nil || !host.IsUp() {
-			return &Iter{
-				err: &QueryError{
-					err:                 ErrHostDown,
-					potentiallyExecuted: potentiallyExecuted,
-				},
-			}, RetryNextHost
-		}
-		pool, ok := q.pool.getPool(host)
-		if !ok {
-			return &Iter{
-				err: &QueryError{
-					err:                 ErrNoPool,
-					potentiallyExecuted: potentiallyExecuted,
-				},
-			}, RetryNextHost
+	attemptCtx, attemptCancel := a.attemptContext()
+	start := time.Now()
+	attempted := func(iter *Iter) {
+		a.attempted(attemptCtx, conn, start, iter)
+		release(iter.err)
+		iter, retryType := a.result(selectedHost, attemptCancel, iter)
+		a.continueAsync(iter, retryType, selectedHost, done)
+	}
+	if !a.qry.executeAsync(attemptCtx, conn, attempted) {
+		// the statements have to be prepared first
+		go func() {
+			attempted(a.qry.execute(attemptCtx, conn))
+		}()
+	}
+}
+
+// continueAsync continues the execution after the attempt on selectedHost
+// which ended with iter. Failed attempts are handled on a new goroutine as
+// the retry policy may wait before the next attempt.
+func (a *attempts) continueAsync(iter *Iter, retryType RetryType, selectedHost SelectedHost, done func(*Iter)) {
+	if iter.err == nil {
+		final, _ := a.next(iter, retryType, selectedHost)
+		done(final)
+		return
+	}
+
+	go func() {
+		final, next := a.next(iter, retryType, selectedHost)
+		if final == nil {
+			final = a.run(next)
 		}
-		conn := pool.Pick(selectedHost.Token(), qry)
-		if conn == nil {
-			return &Iter{
+		done(final)
+	}()
+}
+
+// connect returns the connection to selectedHost to make the next attempt
+// on, admitted by the request throttler which has to be released with the
+// result of the attempt. If there is none, it returns the iterator of the
+// failed attempt instead.
+func (a *attempts) connect(selectedHost SelectedHost) (*Conn, func(error), *Iter, RetryType) {
+	host := selectedHost.Info()
+	if host == nil || !host.IsUp() {
+		return nil, nil, &Iter{
+			err: &QueryError{
+				err:                 ErrHostDown,
+				potentiallyExecuted: a.potentiallyExecuted,
+			},
+		}, RetryNextHost
+	}
+	if a.q.conviction != nil && !a.q.conviction.allowRequest(host) {
+		return nil, nil, &Iter{
+			err: &QueryError{
+				err:                 ErrCircuitOpen,
+				potentiallyExecuted: a.potentiallyExecuted,
+			},
+		}, RetryNextHost
+	}
+	pool, ok := a.q.pool.getPool(host)
+	if !ok {
+		return nil, nil, &Iter{
+			err: &QueryError{
+				err:                 ErrNoPool,
+				potentiallyExecuted: a.potentiallyExecuted,
+			},
+		}, RetryNextHost
+	}
+	release := func(error) {}
+	if a.q.throttler != nil {
+		var err error
+		if release, err = a.q.throttle(a.ctx, a.qry, host); err != nil {
+			retry := RetryNextHost
+			if a.ctx.Err() != nil {
+				retry = Rethrow
+			}
+			return nil, nil, &Iter{
 				err: &QueryError{
-					err:                 ErrNoConnectionsInPool,
-					potentiallyExecuted: potentiallyExecuted,
+					err:                 err,
+					potentiallyExecuted: a.potentiallyExecuted,
 				},
-			}, RetryNextHost
-		}
-		iter = q.attemptQuery(ctx, qry, conn)
-		iter.host = selectedHost.Info()
-		// Update host
-		if iter.err == nil {
-			return iter, RetryType(255)
+			}, retry
 		}
+	}
+	conn := pool.Pick(selectedHost.Token(), a.qry)
+	if conn == nil {
+		release(ErrNoConnectionsInPool)
+		return nil, nil, &Iter{
+			err: &QueryError{
+				err:                 ErrNoConnectionsInPool,
+				potentiallyExecuted: a.potentiallyExecuted,
+			},
+		}, RetryNextHost
+	}
+	return conn, release, nil, 0
+}
 
-		switch {
-		case errors.Is(iter.err, context.Canceled),
-			errors.Is(iter.err, context.DeadlineExceeded):
-			selectedHost.Mark(nil)
-			potentiallyExecuted = true
-			retry = Rethrow
-		default:
-			selectedHost.Mark(iter.err)
-			retry = RetryType(255) // Don't enforce retry and get it from retry policy
-		}
+func (a *attempts) attemptContext() (context.Context, context.CancelFunc) {
+	if a.attemptTimeout > 0 {
+		return context.WithTimeout(a.ctx, a.attemptTimeout)
+	}
+	return a.ctx, func() {}
+}
 
-		var qErr *QueryError
-		if errors.As(iter.err, &qErr) {
-			potentiallyExecuted = potentiallyExecuted || qErr.PotentiallyExecuted()
-			qErr.potentiallyExecuted = potentiallyExecuted
-			qErr.isIdempotent = qry.IsIdempotent()
-			iter.err = qErr
-		} else {
-			iter.err = &QueryError{
-				err:                 iter.err,
-				potentiallyExecuted: potentiallyExecuted,
-				isIdempotent:        qry.IsIdempotent(),
-			}
+// execute makes an attempt on selectedHost.
+func (a *attempts) execute(selectedHost SelectedHost) (*Iter, RetryType) {
+	conn, release, iter, retryType := a.connect(selectedHost)
+	if conn == nil {
+		return iter, retryType
+	}
+	attemptCtx, attemptCancel := a.attemptContext()
+	start := time.Now()
+	iter = a.qry.execute(attemptCtx, conn)
+	a.attempted(attemptCtx, conn, start, iter)
+	release(iter.err)
+	return a.result(selectedHost, attemptCancel, iter)
+}
+
+// attempted records the attempt on conn with attemptCtx which started at
+// start and ended with iter. An attempt cut short by its own timeout while
+// the query still has time left fails with ErrTimeoutNoResponse, as the host
+// didn't respond in time.
+func (a *attempts) attempted(attemptCtx context.Context, conn *Conn, start time.Time, iter *Iter) {
+	if errors.Is(iter.err, context.DeadlineExceeded) &&
+		attemptCtx.Err() == context.DeadlineExceeded && a.ctx.Err() == nil {
+		iter.err = &QueryError{err: ErrTimeoutNoResponse, potentiallyExecuted: true}
+	}
+	a.q.trackAttempt(attemptCtx, a.qry, conn, start, time.Now(), iter)
+}
+
+// result returns the result of the attempt on selectedHost which ended with
+// iter, and how to retry it if it failed.
+func (a *attempts) result(selectedHost SelectedHost, attemptCancel context.CancelFunc, iter *Iter) (*Iter, RetryType) {
+	attemptCancel()
+	iter.host = selectedHost.Info()
+	// Update host
+	if iter.err == nil {
+		return iter, RetryType(255)
+	}
+
+	var retry RetryType
+	switch {
+	case errors.Is(iter.err, context.Canceled),
+		errors.Is(iter.err, context.DeadlineExceeded):
+		selectedHost.Mark(nil)
+		a.potentiallyExecuted = true
+		retry = Rethrow
+	default:
+		selectedHost.Mark(iter.err)
+		retry = RetryType(255) // Don't enforce retry and get it from retry policy
+	}
+
+	var qErr *QueryError
+	if errors.As(iter.err, &qErr) {
+		a.potentiallyExecuted = a.potentiallyExecuted || qErr.PotentiallyExecuted()
+		qErr.potentiallyExecuted = a.potentiallyExecuted
+		qErr.isIdempotent = a.qry.IsIdempotent()
+		iter.err = qErr
+	} else {
+		iter.err = &QueryError{
+			err:                 iter.err,
+			potentiallyExecuted: a.potentiallyExecuted,
+			isIdempotent:        a.qry.IsIdempotent(),
 		}
-		return iter, retry
 	}
+	return iter, retry
+}
 
-	var lastErr error
-	selectedHost := hostIter()
-	for selectedHost != nil {
-		iter, retryType := execute(qry, selectedHost)
-		if iter.err == nil {
-			return iter
+// next returns the iterator of the execution if the attempt on selectedHost
+// which ended with iter is final, and otherwise the host of the next attempt,
+// nil if there is none left.
+func (a *attempts) next(iter *Iter, retryType RetryType, selectedHost SelectedHost) (*Iter, SelectedHost) {
+	if iter.err == nil {
+		if a.budget != nil {
+			a.budget.trackSuccess()
 		}
-		lastErr = iter.err
+		return iter, nil
+	}
+	a.lastErr = iter.err
 
-		// Exit if retry policy decides to not retry anymore
-		if retryType == RetryType(255) {
-			if !getShouldRetry(qry) {
-				return iter
+	// Exit if retry policy decides to not retry anymore
+	if retryType == RetryType(255) {
+		if !a.shouldRetry(a.qry) {
+			return iter, nil
+		}
+		retryType = a.getRetryType(iter.err)
+		if retryType == Retry || retryType == RetryNextHost {
+			if a.budget != nil && !a.budget.allowRetry() {
+				iter.err = &RetryBudgetExceededError{Err: iter.err}
+				return iter, nil
 			}
-			retryType = getRetryType(iter.err)
+			a.q.metrics.trackRetry()
 		}
+	}
 
-		// If query is unsuccessful, check the error with RetryPolicy to retry
-		switch retryType {
-		case Retry:
-			// retry on the same host
-			continue
-		case Rethrow, Ignore:
-			return iter
-		case RetryNextHost:
-			// retry on the next host
-			selectedHost = hostIter()
-			continue
-		default:
-			// Undefined? Return nil and error, this will panic in the requester
-			return &Iter{err: ErrUnknownRetryType}
-		}
+	// If query is unsuccessful, check the error with RetryPolicy to retry
+	switch retryType {
+	case Retry:
+		// retry on the same host
+		return nil, selectedHost
+	case Rethrow, Ignore:
+		return iter, nil
+	case RetryNextHost:
+		// retry on the next host
+		return nil, a.hostIter()
+	default:
+		// Undefined? Return nil and error, this will panic in the requester
+		return &Iter{err: ErrUnknownRetryType}, nil
 	}
-	if lastErr != nil {
-		return &Iter{err: lastErr}
+}
+
+// exhausted returns the iterator of an execution without hosts left to
+// attempt it on.
+func (a *attempts) exhausted() *Iter {
+	if a.lastErr != nil {
+		return &Iter{err: a.lastErr}
 	}
 	return &Iter{err: ErrNoConnections}
 }
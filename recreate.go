@@ -401,11 +401,7 @@ func (h toCQLHelpers) tablePropertiesToCQL(cks []*ColumnMetadata, opts TableMeta
 
 	var properties []string
 
-	compactStorage := len(flags) > 0 && (contains(flags, TableFlagDense) ||
-		contains(flags, TableFlagSuper) ||
-		!contains(flags, TableFlagCompound))
-
-	if compactStorage {
+	if h.compactStorage(flags) {
 		properties = append(properties, "COMPACT STORAGE")
 	}
 
@@ -433,6 +429,12 @@ func (h toCQLHelpers) tablePropertiesToCQL(cks []*ColumnMetadata, opts TableMeta
 	return sb.String(), nil
 }
 
+func (h toCQLHelpers) compactStorage(flags []string) bool {
+	return len(flags) > 0 && (contains(flags, TableFlagDense) ||
+		contains(flags, TableFlagSuper) ||
+		!contains(flags, TableFlagCompound))
+}
+
 func (h toCQLHelpers) tableColumnToCQL(tm *TableMetadata) string {
 	var sb strings.Builder
 
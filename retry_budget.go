@@ -0,0 +1,179 @@
+package gocql
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudgetRatio         = 0.1
+	defaultRetryBudgetMinPerSecond  = 10
+	defaultRetryBudgetMaxRetryBurst = 100
+)
+
+// ErrRetryBudgetExceeded is matched by errors.Is for errors of queries
+// which were refused a retry by a RetryBudget.
+var ErrRetryBudgetExceeded = errors.New("gocql: retry budget exceeded")
+
+// RetryBudgetExceededError is returned for a query which could be retried
+// according to its retry policy, but was refused the retry by a RetryBudget.
+// Err is the error of the last attempt of the query.
+type RetryBudgetExceededError struct {
+	Err error
+}
+
+func (e *RetryBudgetExceededError) Error() string {
+	return ErrRetryBudgetExceeded.Error() + ": " + e.Err.Error()
+}
+
+func (e *RetryBudgetExceededError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryBudgetExceededError) Is(target error) bool {
+	return target == ErrRetryBudgetExceeded
+}
+
+// retryBudget is implemented by retry policies which limit the total number
+// of retries.
+type retryBudget interface {
+	// trackSuccess is called for every successful query.
+	trackSuccess()
+	// allowRetry is called before every retry the retry policy decided on
+	// and reports whether it may be made.
+	allowRetry() bool
+}
+
+// RetryBudgetConfig configures a RetryBudget.
+type RetryBudgetConfig struct {
+	// RetryRatio is the number of retries allowed per successful query,
+	// for example 0.1 allows retrying one in ten queries.
+	// Default: 0.1
+	RetryRatio float64
+
+	// MinRetriesPerSecond is the number of retries allowed per second
+	// regardless of the number of successful queries, so that queries can
+	// be retried when few or none of them succeed.
+	// Default: 10
+	MinRetriesPerSecond float64
+
+	// MaxRetryBurst is the maximum number of retries which can be saved up
+	// while queries succeed and made at once afterwards.
+	// Default: 100
+	MaxRetryBurst float64
+}
+
+// RetryBudgetStats holds the counters of a RetryBudget.
+type RetryBudgetStats struct {
+	// Successes is the number of successful queries.
+	Successes uint64
+	// Retries is the number of retries allowed by the budget.
+	Retries uint64
+	// Refused is the number of retries refused by the budget.
+	Refused uint64
+	// Balance is the number of retries currently available.
+	Balance float64
+}
+
+// RetryBudget wraps a RetryPolicy and limits the total number of retries made
+// by all queries using it, so that retries do not multiply the load of
+// struggling nodes during partial outages. It is a token bucket which is
+// filled by successful queries and at a minimum rate, and every retry takes
+// a token from it. Queries refused a retry fail with RetryBudgetExceededError.
+//
+// The budget is shared by all queries using the policy, so it is meant to be
+// set as the default retry policy of the session:
+//
+//	cluster.RetryPolicy = gocql.NewRetryBudget(&gocql.SimpleRetryPolicy{NumRetries: 3}, gocql.RetryBudgetConfig{})
+//
+// If the wrapped policy implements LWTRetryPolicy, it is used for LWT queries.
+type RetryBudget struct {
+	policy RetryPolicy
+	cfg    RetryBudgetConfig
+
+	mu       sync.Mutex
+	balance  float64
+	refilled time.Time
+	stats    RetryBudgetStats
+}
+
+// NewRetryBudget returns a RetryBudget limiting the retries of policy.
+func NewRetryBudget(policy RetryPolicy, cfg RetryBudgetConfig) *RetryBudget {
+	if cfg.RetryRatio <= 0 {
+		cfg.RetryRatio = defaultRetryBudgetRatio
+	}
+	if cfg.MinRetriesPerSecond <= 0 {
+		cfg.MinRetriesPerSecond = defaultRetryBudgetMinPerSecond
+	}
+	if cfg.MaxRetryBurst < 1 {
+		cfg.MaxRetryBurst = defaultRetryBudgetMaxRetryBurst
+	}
+	return &RetryBudget{
+		policy:   policy,
+		cfg:      cfg,
+		balance:  cfg.MaxRetryBurst,
+		refilled: time.Now(),
+	}
+}
+
+func (b *RetryBudget) Attempt(q RetryableQuery) bool {
+	return b.policy.Attempt(q)
+}
+
+func (b *RetryBudget) GetRetryType(err error) RetryType {
+	return b.policy.GetRetryType(err)
+}
+
+func (b *RetryBudget) AttemptLWT(q RetryableQuery) bool {
+	if lwt, ok := b.policy.(LWTRetryPolicy); ok {
+		return lwt.AttemptLWT(q)
+	}
+	return b.policy.Attempt(q)
+}
+
+func (b *RetryBudget) GetRetryTypeLWT(err error) RetryType {
+	if lwt, ok := b.policy.(LWTRetryPolicy); ok {
+		return lwt.GetRetryTypeLWT(err)
+	}
+	return b.policy.GetRetryType(err)
+}
+
+// Stats returns the current counters of the budget.
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	stats := b.stats
+	stats.Balance = b.balance
+	return stats
+}
+
+func (b *RetryBudget) trackSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Successes++
+	b.balance = math.Min(b.balance+b.cfg.RetryRatio, b.cfg.MaxRetryBurst)
+}
+
+func (b *RetryBudget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.balance < 1 {
+		b.stats.Refused++
+		return false
+	}
+	b.balance--
+	b.stats.Retries++
+	return true
+}
+
+func (b *RetryBudget) refill(now time.Time) {
+	b.balance = math.Min(b.balance+now.Sub(b.refilled).Seconds()*b.cfg.MinRetriesPerSecond, b.cfg.MaxRetryBurst)
+	b.refilled = now
+}
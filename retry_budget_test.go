@@ -0,0 +1,110 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+
+	budget := NewRetryBudget(&SimpleRetryPolicy{NumRetries: 3}, RetryBudgetConfig{
+		RetryRatio:          0.5,
+		MinRetriesPerSecond: 0.001,
+		MaxRetryBurst:       2,
+	})
+
+	for i := 0; i < 2; i++ {
+		if !budget.allowRetry() {
+			t.Fatalf("expected retry %d to be allowed", i)
+		}
+	}
+	if budget.allowRetry() {
+		t.Fatal("expected the retry to be refused")
+	}
+
+	// two successful queries pay for a retry
+	budget.trackSuccess()
+	if budget.allowRetry() {
+		t.Fatal("expected the retry to be refused")
+	}
+	budget.trackSuccess()
+	if !budget.allowRetry() {
+		t.Fatal("expected the retry to be allowed")
+	}
+
+	// the balance is capped
+	for i := 0; i < 10; i++ {
+		budget.trackSuccess()
+	}
+	stats := budget.Stats()
+	if stats.Successes != 12 || stats.Retries != 3 || stats.Refused != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Balance < 2 || stats.Balance > 2.001 {
+		t.Fatalf("expected the balance to be capped at 2 got %v", stats.Balance)
+	}
+}
+
+func TestRetryBudgetLWT(t *testing.T) {
+	t.Parallel()
+
+	lwt := NewRetryBudget(&SimpleRetryPolicy{}, RetryBudgetConfig{})
+	if rt := lwt.GetRetryTypeLWT(errors.New("test")); rt != Retry {
+		t.Fatalf("expected the LWT retry type of the wrapped policy got %v", rt)
+	}
+
+	plain := NewRetryBudget(&testRetryPolicy{}, RetryBudgetConfig{})
+	if rt := plain.GetRetryTypeLWT(errors.New("test")); rt != Retry {
+		t.Fatalf("expected the retry type of the wrapped policy got %v", rt)
+	}
+}
+
+func TestQueryRetryBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	budget := NewRetryBudget(&testRetryPolicy{NumRetries: 3}, RetryBudgetConfig{
+		MinRetriesPerSecond: 0.001,
+		MaxRetryBurst:       1,
+	})
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.RetryPolicy = budget
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Query("kill").Idempotent(true).Exec()
+	if !errors.Is(err, ErrRetryBudgetExceeded) {
+		t.Fatalf("expected %v got %v", ErrRetryBudgetExceeded, err)
+	}
+	var budgetErr *RetryBudgetExceededError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("expected %T got %T", budgetErr, err)
+	}
+	var qErr *QueryError
+	if !errors.As(err, &qErr) {
+		t.Fatalf("expected the error of the last attempt to be wrapped got %v", err)
+	}
+	// the budget allowed a single retry
+	if requests := atomic.LoadInt64(&srv.nKillReq); requests != 2 {
+		t.Fatalf("expected 2 attempts got %d", requests)
+	}
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := budget.Stats(); stats.Successes != 1 || stats.Retries != 1 || stats.Refused != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
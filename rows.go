@@ -0,0 +1,83 @@
+//go:build go1.23
+
+package gocql
+
+import (
+	"context"
+	"iter"
+	"reflect"
+)
+
+// Rows returns an iterator over the rows of it decoded into values of type T,
+// for use with range-over-func:
+//
+//	for user, err := range gocql.Rows[User](session.Query(`SELECT id, name FROM users`).Iter()) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(user.ID, user.Name)
+//	}
+//
+// T may be a struct, whose fields are matched to the columns by name like
+// in Iter.StructScan or, if the names do not match, by position. A single
+// column is decoded into T itself, so T may also be any type supported by
+// Unmarshal. Pages are fetched as needed and the decoding plan compiled for
+// the first row is reused for the rest of the result.
+//
+// If the query or decoding of a row fails, the error is yielded with the
+// zero value of T and the iteration stops. The iterator is closed once the
+// iteration ends, including when the loop is exited early, so it must not
+// be used afterwards.
+func Rows[T any](it *Iter) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if it == nil {
+			return
+		}
+		scanner := it.Scanner().(*iterScanner)
+
+		var (
+			decoder *rowDecoder
+			zero    T
+		)
+		for scanner.Next() {
+			columns := scanner.iter.meta.columns
+			if decoder == nil {
+				var err error
+				decoder, err = newRowDecoder(reflect.TypeOf((*T)(nil)).Elem(), columns)
+				if err != nil {
+					scanner.Err()
+					yield(zero, err)
+					return
+				}
+			}
+
+			var row T
+			if err := decoder.decode(columns, scanner.cols, reflect.ValueOf(&row)); err != nil {
+				scanner.Err()
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				scanner.Err()
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// QueryAll executes the statement with the given values and returns all the
+// rows of the result decoded into values of type T, as described in Rows.
+func QueryAll[T any](ctx context.Context, s *Session, stmt string, values ...interface{}) ([]T, error) {
+	var rows []T
+	for row, err := range Rows[T](s.Query(stmt, values...).WithContext(ctx).Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,172 @@
+//go:build unit && go1.23
+// +build unit,go1.23
+
+package gocql
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql/internal/tests/mock"
+)
+
+// testRowsIter returns an iterator over the rows split into pages of pageSize rows.
+func testRowsIter(meta resultMetadata, pageSize int, rows ...[]interface{}) *Iter {
+	var pages []*Iter
+	for start := 0; start < len(rows); start += pageSize {
+		end := start + pageSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var data [][]byte
+		for _, row := range rows[start:end] {
+			data = append(data, marshalMetadataMust(meta, row)...)
+		}
+		pages = append(pages, &Iter{
+			meta:    meta,
+			framer:  &mock.MockFramer{Data: data},
+			numRows: end - start,
+		})
+	}
+	if len(pages) == 0 {
+		return &Iter{meta: meta}
+	}
+
+	for i := len(pages) - 2; i >= 0; i-- {
+		next := &nextIter{next: pages[i+1], pos: pages[i].numRows}
+		next.once.Do(func() {})
+		pages[i].next = next
+	}
+	return pages[0]
+}
+
+func TestRowsStruct(t *testing.T) {
+	t.Parallel()
+
+	iter := testRowsIter(structScanMetadata, 1,
+		[]interface{}{1, "alice", "alice@example.com", structScanAddress{Street: "Main St"}, structScanPoint{X: 1}},
+		[]interface{}{2, "bob", "bob@example.com", structScanAddress{Street: "Side St"}, structScanPoint{X: 2}},
+	)
+
+	var names []string
+	for row, err := range Rows[structScanRow](iter) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, row.UserName+" "+row.Address.Street)
+	}
+	if expected := []string{"alice Main St", "bob Side St"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v got %v", expected, names)
+	}
+}
+
+func TestRowsTupleLikeStruct(t *testing.T) {
+	t.Parallel()
+
+	type row struct {
+		A int
+		B string
+		C string
+		D structScanAddress
+		E structScanPoint
+	}
+
+	iter := testRowsIter(structScanMetadata, 2,
+		[]interface{}{1, "alice", "alice@example.com", structScanAddress{}, structScanPoint{}},
+		[]interface{}{2, "bob", "bob@example.com", structScanAddress{}, structScanPoint{}},
+		[]interface{}{3, "carol", "carol@example.com", structScanAddress{Zip: 3}, structScanPoint{Y: "c"}},
+	)
+
+	var rows []row
+	for r, err := range Rows[row](iter) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows got %d", len(rows))
+	}
+	if expected := (row{A: 3, B: "carol", C: "carol@example.com", D: structScanAddress{Zip: 3}, E: structScanPoint{Y: "c"}}); rows[2] != expected {
+		t.Fatalf("expected %+v got %+v", expected, rows[2])
+	}
+}
+
+func TestRowsScalar(t *testing.T) {
+	t.Parallel()
+
+	meta := resultMetadata{
+		colCount:       1,
+		actualColCount: 1,
+		columns:        []ColumnInfo{{Name: "ts", TypeInfo: NativeType{proto: 4, typ: TypeTimestamp}}},
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	var values []time.Time
+	for v, err := range Rows[time.Time](testRowsIter(meta, 1, []interface{}{now}, []interface{}{now.Add(time.Second)})) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	if expected := []time.Time{now, now.Add(time.Second)}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v got %v", expected, values)
+	}
+
+	// a single UDT column is decoded into the struct itself
+	meta = resultMetadata{
+		colCount:       1,
+		actualColCount: 1,
+		columns:        []ColumnInfo{structScanMetadata.columns[3]},
+	}
+	for v, err := range Rows[structScanAddress](testRowsIter(meta, 1, []interface{}{structScanAddress{Street: "Main St", Zip: 1}})) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (structScanAddress{Street: "Main St", Zip: 1}); v != expected {
+			t.Fatalf("expected %+v got %+v", expected, v)
+		}
+	}
+}
+
+func TestRowsErrors(t *testing.T) {
+	t.Parallel()
+
+	iter := testRowsIter(structScanMetadata, 1,
+		[]interface{}{1, "alice", "alice@example.com", structScanAddress{}, structScanPoint{}},
+	)
+	var errs []error
+	for _, err := range Rows[int](iter) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil || !strings.Contains(errs[0].Error(), "can not decode 5 columns") {
+		t.Fatalf("expected a single decode error got %v", errs)
+	}
+
+	iter = &Iter{err: context.DeadlineExceeded}
+	errs = nil
+	for _, err := range Rows[structScanRow](iter) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] != context.DeadlineExceeded {
+		t.Fatalf("expected the query error got %v", errs)
+	}
+}
+
+func TestRowsBreak(t *testing.T) {
+	t.Parallel()
+
+	iter := testRowsIter(structScanMetadata, 2,
+		[]interface{}{1, "alice", "alice@example.com", structScanAddress{}, structScanPoint{}},
+		[]interface{}{2, "bob", "bob@example.com", structScanAddress{}, structScanPoint{}},
+	)
+	for range Rows[structScanRow](iter) {
+		break
+	}
+	if iter.closed == 0 {
+		t.Fatal("expected the iterator to be closed after break")
+	}
+}
@@ -0,0 +1,436 @@
+package gocql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql/tablets"
+)
+
+// TokenRange is a range of Murmur3 tokens. Start is exclusive and End is
+// inclusive, matching the ranges owned by nodes and tablets.
+type TokenRange struct {
+	Start int64
+	End   int64
+}
+
+func (r TokenRange) String() string {
+	return fmt.Sprintf("(%d, %d]", r.Start, r.End)
+}
+
+// ScanCheckpoint records the progress of scanning a single token range.
+type ScanCheckpoint struct {
+	Range TokenRange
+	// PageState is the paging state to continue scanning the range from,
+	// nil if the range was not started yet or is done.
+	PageState []byte
+	Done      bool
+}
+
+// ScanTableOptions configures Session.ScanTable.
+type ScanTableOptions struct {
+	// Handler is called with an iterator over every page of rows of a token
+	// range. It is called concurrently for different ranges, but in order for
+	// the pages of the same range. The iterator must not be used after Handler
+	// returns. If Handler returns an error, the scan is stopped. Required.
+	Handler func(rng TokenRange, iter *Iter) error
+
+	// Columns to select, all of them if empty.
+	Columns []string
+
+	// Concurrency is the maximum number of ranges scanned at the same time.
+	// Defaults to the number of hosts in the cluster.
+	Concurrency int
+
+	// SplitsPerRange splits the token range of every vnode or tablet into
+	// the given number of subranges. Useful to increase the parallelism of
+	// clusters with few tokens. Defaults to 1.
+	SplitsPerRange int
+
+	// PageSize of the queries, the session default if zero.
+	PageSize int
+
+	// Consistency of the queries, the session default if zero.
+	Consistency Consistency
+
+	// MaxRetries is the number of times fetching a page of a range is retried,
+	// each time on the next replica of the range. Defaults to 3.
+	MaxRetries int
+
+	// RetryDelay is the delay before the first retry, it is doubled with every
+	// next retry of the same page. Defaults to 100ms.
+	RetryDelay time.Duration
+
+	// Checkpoint, if not nil, is called with the checkpoint of every range
+	// before the scan starts and then after every page, so that an interrupted
+	// scan can be resumed. Calls are serialized.
+	Checkpoint func(ScanCheckpoint)
+
+	// Resume, if not nil, replaces the ranges of the ring with the ranges of
+	// the given checkpoints, as reported to Checkpoint by a previous scan.
+	// Done ranges are skipped and the others continue from their page state.
+	Resume []ScanCheckpoint
+}
+
+// scanRange is a token range being scanned.
+type scanRange struct {
+	ScanCheckpoint
+	replicas []string
+}
+
+// ScanTable reads all rows of the table by splitting the token ring into
+// ranges and querying them in parallel with
+//
+//	SELECT ... WHERE token(pk) > ? AND token(pk) <= ?
+//
+// Ranges follow the tablets of the table if the keyspace uses tablets and
+// the driver knows all of them, or the tokens of the nodes otherwise. The
+// query of every range is sent to one of its replicas. Only the Murmur3
+// partitioner is supported.
+//
+// ScanTable returns once all ranges were scanned, or the scan was stopped
+// because of an error, ctx being done, or a range failing more than
+// MaxRetries times in a row.
+func (s *Session) ScanTable(ctx context.Context, keyspace, table string, opts ScanTableOptions) error {
+	if opts.Handler == nil {
+		return errors.New("gocql: ScanTable requires a Handler")
+	}
+
+	ks, err := s.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return err
+	}
+	tableMeta, ok := ks.Tables[table]
+	if !ok {
+		return fmt.Errorf("gocql: table %s.%s not found", keyspace, table)
+	}
+
+	hosts := s.hostSource.getHostsList()
+	ring, err := s.scanTokenRing(hosts)
+	if err != nil {
+		return err
+	}
+	replicasFor := s.scanReplicas(ks, table, ring)
+
+	var ranges []*scanRange
+	if opts.Resume != nil {
+		for _, checkpoint := range opts.Resume {
+			ranges = append(ranges, &scanRange{ScanCheckpoint: checkpoint})
+		}
+	} else {
+		for _, rng := range s.tableTokenRanges(keyspace, table, ring, opts.SplitsPerRange) {
+			ranges = append(ranges, &scanRange{ScanCheckpoint: ScanCheckpoint{Range: rng}})
+		}
+	}
+
+	var checkpointMu sync.Mutex
+	checkpoint := func(c ScanCheckpoint) {
+		if opts.Checkpoint == nil {
+			return
+		}
+		checkpointMu.Lock()
+		opts.Checkpoint(c)
+		checkpointMu.Unlock()
+	}
+
+	pending := make(chan *scanRange, len(ranges))
+	for _, rng := range ranges {
+		if rng.Done {
+			continue
+		}
+		rng.replicas = replicasFor(rng.Range.End)
+		checkpoint(rng.ScanCheckpoint)
+		pending <- rng
+	}
+	close(pending)
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(hosts)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stmt := scanTableStatement(keyspace, tableMeta, opts.Columns)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rng := range pending {
+				if err := s.scanTokenRange(ctx, stmt, rng, &opts, checkpoint); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// scanTokenRange scans all pages of the range starting from its page state.
+func (s *Session) scanTokenRange(ctx context.Context, stmt string, rng *scanRange, opts *ScanTableOptions,
+	checkpoint func(ScanCheckpoint)) error {
+	maxRetries := opts.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	retryDelay := opts.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = 100 * time.Millisecond
+	}
+
+	attempt := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		qry := s.Query(stmt, rng.Range.Start, rng.Range.End).
+			WithContext(ctx).
+			Idempotent(true).
+			PageState(rng.PageState)
+		if opts.PageSize > 0 {
+			qry.PageSize(opts.PageSize)
+		}
+		if opts.Consistency != 0 {
+			qry.Consistency(opts.Consistency)
+		}
+		if len(rng.replicas) > 0 {
+			// retry on the next replica of the range
+			qry.SetHostID(rng.replicas[attempt%len(rng.replicas)])
+		}
+
+		iter := qry.Iter()
+		if err := iter.err; err != nil {
+			iter.Close()
+			if attempt >= maxRetries || errors.Is(err, context.Canceled) {
+				return fmt.Errorf("gocql: scanning token range %v: %w", rng.Range, err)
+			}
+			select {
+			case <-time.After(retryDelay << uint(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			attempt++
+			continue
+		}
+		attempt = 0
+
+		pageState := append([]byte(nil), iter.PageState()...)
+		if err := opts.Handler(rng.Range, iter); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := iter.Close(); err != nil {
+			return fmt.Errorf("gocql: scanning token range %v: %w", rng.Range, err)
+		}
+
+		rng.PageState = pageState
+		rng.Done = len(rng.PageState) == 0
+		checkpoint(rng.ScanCheckpoint)
+		if rng.Done {
+			return nil
+		}
+	}
+}
+
+func scanTableStatement(keyspace string, table *TableMetadata, columns []string) string {
+	selection := "*"
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = quoteIdentifier(column)
+		}
+		selection = strings.Join(quoted, ", ")
+	}
+
+	pk := make([]string, len(table.PartitionKey))
+	for i, column := range table.PartitionKey {
+		pk[i] = quoteIdentifier(column.Name)
+	}
+	token := "token(" + strings.Join(pk, ", ") + ")"
+
+	return fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s > ? AND %s <= ?",
+		selection, quoteIdentifier(keyspace), quoteIdentifier(table.Name), token, token)
+}
+
+// quoteIdentifier quotes a CQL identifier so that it is used as is, keeping
+// its case and allowing any characters.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// scanTokenRing returns the token ring of the hosts, it is nil if the hosts
+// have no tokens.
+func (s *Session) scanTokenRing(hosts []*HostInfo) (*tokenRing, error) {
+	partitioner := hostsPartitioner(hosts)
+	if partitioner == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		return nil, fmt.Errorf("gocql: scanning tables is not supported with partitioner %s", partitioner)
+	}
+	return newTokenRing(partitioner, hosts)
+}
+
+// hostsPartitioner returns the name of the partitioner used by the hosts, or
+// an empty string if it is not known yet.
+func hostsPartitioner(hosts []*HostInfo) string {
+	for _, host := range hosts {
+		if partitioner := host.Partitioner(); partitioner != "" {
+			return partitioner
+		}
+	}
+	return ""
+}
+
+// tableTokenRanges splits the token ring into ranges owned by the tablets of
+// the table, or if they are not known, by the tokens of the hosts.
+func (s *Session) tableTokenRanges(keyspace, table string, ring *tokenRing, splits int) []TokenRange {
+	var ranges []TokenRange
+	if s.tabletsRoutingV1 {
+		ranges = tabletTokenRanges(s.metadataDescriber.getTablets(), keyspace, table)
+	}
+	if ranges == nil {
+		ranges = ringTokenRanges(ring)
+	}
+
+	if splits <= 1 {
+		return ranges
+	}
+	split := make([]TokenRange, 0, len(ranges)*splits)
+	for _, rng := range ranges {
+		split = append(split, splitTokenRange(rng, splits)...)
+	}
+	return split
+}
+
+// tabletTokenRanges returns the ranges of the tablets of the table, or nil if
+// the known tablets do not cover the whole ring.
+func tabletTokenRanges(tabletsList tablets.TabletInfoList, keyspace, table string) []TokenRange {
+	l, r := tabletsList.FindTablets(keyspace, table)
+	if l == -1 {
+		return nil
+	}
+
+	ranges := make([]TokenRange, 0, r-l+1)
+	prev := int64(math.MinInt64)
+	for _, tablet := range tabletsList[l : r+1] {
+		if tablet.FirstToken() != prev {
+			return nil
+		}
+		ranges = append(ranges, TokenRange{Start: tablet.FirstToken(), End: tablet.LastToken()})
+		prev = tablet.LastToken()
+	}
+	if prev != math.MaxInt64 {
+		return nil
+	}
+	return ranges
+}
+
+// ringTokenRanges returns the ranges between the tokens of the ring. The range
+// wrapping around the ring is split in two at the end of the ring.
+func ringTokenRanges(ring *tokenRing) []TokenRange {
+	if ring == nil || len(ring.tokens) == 0 {
+		return []TokenRange{{Start: math.MinInt64, End: math.MaxInt64}}
+	}
+
+	ranges := make([]TokenRange, 0, len(ring.tokens)+1)
+	prev := int64(math.MinInt64)
+	for _, ht := range ring.tokens {
+		token := int64(ht.token.(int64Token))
+		if token != prev {
+			ranges = append(ranges, TokenRange{Start: prev, End: token})
+		}
+		prev = token
+	}
+	if prev != math.MaxInt64 {
+		ranges = append(ranges, TokenRange{Start: prev, End: math.MaxInt64})
+	}
+	return ranges
+}
+
+// splitTokenRange splits rng into n ranges of about the same size.
+func splitTokenRange(rng TokenRange, n int) []TokenRange {
+	width := uint64(rng.End - rng.Start)
+	if uint64(n) > width {
+		n = int(width)
+	}
+	if n <= 1 {
+		return []TokenRange{rng}
+	}
+
+	step := width / uint64(n)
+	ranges := make([]TokenRange, n)
+	start := rng.Start
+	for i := 0; i < n; i++ {
+		end := start + int64(step)
+		if i == n-1 {
+			end = rng.End
+		}
+		ranges[i] = TokenRange{Start: start, End: end}
+		start = end
+	}
+	return ranges
+}
+
+// scanReplicas returns a function finding the host IDs of the replicas of the
+// token, preferring the tablet replicas if known.
+func (s *Session) scanReplicas(ks *KeyspaceMetadata, table string, ring *tokenRing) func(token int64) []string {
+	var replicas tokenRingReplicas
+	if ring != nil {
+		if strategy := getStrategy(ks, s.logger); strategy != nil {
+			replicas = strategy.replicaMap(ring)
+		}
+	}
+
+	return func(token int64) []string {
+		if s.tabletsRoutingV1 {
+			if tabletReplicas := s.findTabletReplicasForToken(ks.Name, table, token); len(tabletReplicas) > 0 {
+				ids := make([]string, len(tabletReplicas))
+				for i, replica := range tabletReplicas {
+					ids[i] = replica.HostID()
+				}
+				return ids
+			}
+		}
+
+		var hosts []*HostInfo
+		if ht := replicas.replicasFor(int64Token(token)); ht != nil {
+			hosts = ht.hosts
+		} else if host, _ := ring.GetHostForToken(int64Token(token)); host != nil {
+			hosts = []*HostInfo{host}
+		}
+
+		ids := make([]string, 0, len(hosts))
+		for _, host := range hosts {
+			if host.IsUp() {
+				ids = append(ids, host.HostID())
+			}
+		}
+		return ids
+	}
+}
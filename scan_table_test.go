@@ -0,0 +1,120 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/gocql/gocql/tablets"
+)
+
+func TestRingTokenRanges(t *testing.T) {
+	t.Parallel()
+
+	if ranges := ringTokenRanges(nil); !reflect.DeepEqual(ranges, []TokenRange{{math.MinInt64, math.MaxInt64}}) {
+		t.Fatalf("expected the whole ring got %v", ranges)
+	}
+
+	hosts := []*HostInfo{
+		{hostId: "a", tokens: []string{"-100", "50"}},
+		{hostId: "b", tokens: []string{"0", "9223372036854775807"}},
+	}
+	ring, err := newTokenRing("Murmur3Partitioner", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TokenRange{
+		{math.MinInt64, -100},
+		{-100, 0},
+		{0, 50},
+		{50, math.MaxInt64},
+	}
+	if ranges := ringTokenRanges(ring); !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected %v got %v", expected, ranges)
+	}
+}
+
+func TestSplitTokenRange(t *testing.T) {
+	t.Parallel()
+
+	ranges := splitTokenRange(TokenRange{math.MinInt64, math.MaxInt64}, 4)
+	if len(ranges) != 4 {
+		t.Fatalf("expected 4 ranges got %v", ranges)
+	}
+	prev := int64(math.MinInt64)
+	for _, rng := range ranges {
+		if rng.Start != prev || rng.End <= rng.Start {
+			t.Fatalf("ranges are not contiguous: %v", ranges)
+		}
+		prev = rng.End
+	}
+	if prev != math.MaxInt64 {
+		t.Fatalf("ranges do not cover the whole ring: %v", ranges)
+	}
+
+	// a range can't be split into more ranges than it has tokens
+	if ranges := splitTokenRange(TokenRange{0, 2}, 4); !reflect.DeepEqual(ranges, []TokenRange{{0, 1}, {1, 2}}) {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+}
+
+func TestTabletTokenRanges(t *testing.T) {
+	t.Parallel()
+
+	build := func(table string, first, last int64) *tablets.TabletInfo {
+		tablet, err := tablets.TabletInfoBuilder{
+			KeyspaceName: "ks",
+			TableName:    table,
+			FirstToken:   first,
+			LastToken:    last,
+		}.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tablet
+	}
+
+	list := tablets.TabletInfoList{
+		build("a", math.MinInt64, 0),
+		build("a", 0, math.MaxInt64),
+		build("b", math.MinInt64, 0),
+	}
+
+	expected := []TokenRange{{math.MinInt64, 0}, {0, math.MaxInt64}}
+	if ranges := tabletTokenRanges(list, "ks", "a"); !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected %v got %v", expected, ranges)
+	}
+	// tablets of b do not cover the whole ring
+	if ranges := tabletTokenRanges(list, "ks", "b"); ranges != nil {
+		t.Fatalf("expected no ranges got %v", ranges)
+	}
+	if ranges := tabletTokenRanges(list, "ks", "c"); ranges != nil {
+		t.Fatalf("expected no ranges got %v", ranges)
+	}
+}
+
+func TestScanTableStatement(t *testing.T) {
+	t.Parallel()
+
+	table := &TableMetadata{
+		Name: "Events",
+		PartitionKey: []*ColumnMetadata{
+			{Name: "day"},
+			{Name: "bucket"},
+		},
+	}
+
+	expected := `SELECT * FROM "ks"."Events" WHERE token("day", "bucket") > ? AND token("day", "bucket") <= ?`
+	if stmt := scanTableStatement("ks", table, nil); stmt != expected {
+		t.Fatalf("expected %s got %s", expected, stmt)
+	}
+
+	expected = `SELECT "id", "my""col" FROM "ks"."Events" WHERE token("day", "bucket") > ? AND token("day", "bucket") <= ?`
+	if stmt := scanTableStatement("ks", table, []string{"id", `my"col`}); stmt != expected {
+		t.Fatalf("expected %s got %s", expected, stmt)
+	}
+}
@@ -0,0 +1,916 @@
+package gocql
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SchemaObject is the kind of schema element of a SchemaDifference.
+type SchemaObject int
+
+const (
+	SchemaObjectKeyspace SchemaObject = iota
+	SchemaObjectTable
+	SchemaObjectColumn
+	SchemaObjectType
+	SchemaObjectField
+	SchemaObjectView
+	SchemaObjectIndex
+	SchemaObjectFunction
+	SchemaObjectAggregate
+	SchemaObjectOption
+)
+
+func (o SchemaObject) String() string {
+	switch o {
+	case SchemaObjectKeyspace:
+		return "keyspace"
+	case SchemaObjectTable:
+		return "table"
+	case SchemaObjectColumn:
+		return "column"
+	case SchemaObjectType:
+		return "type"
+	case SchemaObjectField:
+		return "field"
+	case SchemaObjectView:
+		return "view"
+	case SchemaObjectIndex:
+		return "index"
+	case SchemaObjectFunction:
+		return "function"
+	case SchemaObjectAggregate:
+		return "aggregate"
+	case SchemaObjectOption:
+		return "option"
+	default:
+		return "unknown"
+	}
+}
+
+// SchemaDifference is an element which differs between two snapshots of a
+// keyspace. Change is SchemaCreated for the elements only in the new
+// snapshot, SchemaDropped for the elements only in the old one and
+// SchemaUpdated for the elements in both which differ.
+type SchemaDifference struct {
+	Object   SchemaObject
+	Change   SchemaChangeType
+	Keyspace string
+	// Parent is the table, view or type holding the column, field, option or
+	// index. It is empty for the elements of the keyspace.
+	Parent string
+	// Name is the name of the element, empty for the keyspace itself.
+	Name string
+	// Old and New describe the element before and after the change, such as
+	// the type of a column or the value of an option.
+	Old string
+	New string
+}
+
+func (d SchemaDifference) String() string {
+	name := d.Keyspace
+	if d.Parent != "" {
+		name += "." + d.Parent
+	}
+	if d.Name != "" {
+		name += "." + d.Name
+	}
+
+	switch d.Change {
+	case SchemaCreated:
+		if d.New == "" {
+			return fmt.Sprintf("+ %s %s", d.Object, name)
+		}
+		return fmt.Sprintf("+ %s %s %s", d.Object, name, d.New)
+	case SchemaDropped:
+		if d.Old == "" {
+			return fmt.Sprintf("- %s %s", d.Object, name)
+		}
+		return fmt.Sprintf("- %s %s %s", d.Object, name, d.Old)
+	default:
+		return fmt.Sprintf("~ %s %s: %s -> %s", d.Object, name, d.Old, d.New)
+	}
+}
+
+// SchemaDiff is the difference between two snapshots of a keyspace computed
+// by DiffKeyspaces.
+type SchemaDiff struct {
+	Keyspace    string
+	Differences []SchemaDifference
+	// Statements are the CQL statements migrating the old snapshot of the
+	// keyspace to the new one, in the order they must be executed.
+	Statements []string
+	// Err is the first error rendering the statements, they are incomplete
+	// when it is set.
+	Err error
+}
+
+// Empty reports whether the snapshots are the same.
+func (d SchemaDiff) Empty() bool {
+	return len(d.Differences) == 0
+}
+
+// String returns the differences, one per line.
+func (d SchemaDiff) String() string {
+	lines := make([]string, len(d.Differences))
+	for i, difference := range d.Differences {
+		lines[i] = difference.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CQL returns the statements as a CQL script.
+func (d SchemaDiff) CQL() string {
+	var sb strings.Builder
+	for _, stmt := range d.Statements {
+		sb.WriteString(stmt)
+		sb.WriteString(";\n")
+	}
+	return sb.String()
+}
+
+// DiffKeyspaces compares two snapshots of the metadata of a keyspace, such as
+// the schema of a live cluster and the expected one, and returns the
+// differences with the CQL statements migrating old to new. A nil old
+// snapshot creates the keyspace and a nil new snapshot drops it.
+//
+// Elements are altered in place when CQL allows it. The primary key of a
+// table, the type of a column, the definition of a view or an index, and the
+// signature of a function or an aggregate are changed by dropping and
+// recreating the element, and the views and indexes depending on it, losing
+// their data, so the statements should be reviewed before being executed.
+// A type which can't be altered is recreated with the types referring to it,
+// but Err is set and the type left unchanged if tables, functions or
+// aggregates refer to it.
+func DiffKeyspaces(old, new *KeyspaceMetadata) SchemaDiff {
+	if new == nil {
+		if old == nil {
+			return SchemaDiff{}
+		}
+		return SchemaDiff{
+			Keyspace:    old.Name,
+			Differences: []SchemaDifference{{Object: SchemaObjectKeyspace, Change: SchemaDropped, Keyspace: old.Name}},
+			Statements:  []string{"DROP KEYSPACE " + old.Name},
+		}
+	}
+
+	d := &schemaDiffer{
+		old:                old,
+		new:                new,
+		recreatedTables:    make(map[string]bool),
+		recreatedFunctions: make(map[string]bool),
+		droppedColumns:     make(map[string]map[string]bool),
+	}
+	d.diff.Keyspace = new.Name
+
+	if old == nil {
+		d.old = &KeyspaceMetadata{Name: new.Name}
+		d.difference(SchemaObjectKeyspace, SchemaCreated, "", "", "", "")
+		d.render(diffPhaseKeyspace, new.keyspaceToCQL)
+	} else {
+		d.diffKeyspace()
+	}
+
+	// views and indexes depend on the tables recreated, aggregates on the
+	// functions recreated
+	d.diffTypes()
+	d.diffTables()
+	d.diffViews()
+	d.diffIndexes()
+	d.diffFunctions()
+	d.diffAggregates()
+
+	for _, stmts := range d.statements {
+		d.diff.Statements = append(d.diff.Statements, stmts...)
+	}
+	return d.diff
+}
+
+// The statements of a diff are ordered by phase, so that the elements are
+// dropped before the elements they depend on and created after them.
+const (
+	diffPhaseKeyspace = iota
+	diffPhaseDropViews
+	diffPhaseDropIndexes
+	diffPhaseDropAggregates
+	diffPhaseDropFunctions
+	diffPhaseDropTables
+	diffPhaseDropTypes
+	diffPhaseTypes
+	diffPhaseTables
+	diffPhaseFunctions
+	diffPhaseAggregates
+	diffPhaseIndexes
+	diffPhaseViews
+	diffPhaseCount
+)
+
+// schemaDiffOptionResets are the values of the table options which are left
+// out of the CQL of a table when they are not set.
+var schemaDiffOptionResets = map[string]string{
+	"cdc":       "{'enabled': 'false'}",
+	"in_memory": "false",
+}
+
+type schemaDiffer struct {
+	old, new   *KeyspaceMetadata
+	diff       SchemaDiff
+	statements [diffPhaseCount][]string
+
+	recreatedTables    map[string]bool
+	recreatedFunctions map[string]bool
+	// droppedColumns are the columns dropped by table.
+	droppedColumns map[string]map[string]bool
+}
+
+func (d *schemaDiffer) difference(object SchemaObject, change SchemaChangeType, parent, name, from, to string) {
+	d.diff.Differences = append(d.diff.Differences, SchemaDifference{
+		Object:   object,
+		Change:   change,
+		Keyspace: d.new.Name,
+		Parent:   parent,
+		Name:     name,
+		Old:      from,
+		New:      to,
+	})
+}
+
+func (d *schemaDiffer) statement(phase int, format string, args ...interface{}) {
+	d.statements[phase] = append(d.statements[phase], fmt.Sprintf(format, args...))
+}
+
+func (d *schemaDiffer) fail(err error) {
+	if d.diff.Err == nil {
+		d.diff.Err = err
+	}
+}
+
+// renderCQL returns the statement written by fn without its trailing semicolon.
+func (d *schemaDiffer) renderCQL(fn func(io.Writer) error) string {
+	var sb strings.Builder
+	if err := fn(&sb); err != nil {
+		d.fail(err)
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSpace(sb.String()), ";")
+}
+
+func (d *schemaDiffer) render(phase int, fn func(io.Writer) error) {
+	if stmt := d.renderCQL(fn); stmt != "" {
+		d.statements[phase] = append(d.statements[phase], stmt)
+	}
+}
+
+func (d *schemaDiffer) diffKeyspace() {
+	var alter []string
+	if from, to := replicationToCQL(d.old), replicationToCQL(d.new); from != to {
+		d.difference(SchemaObjectOption, SchemaUpdated, "", "replication", from, to)
+		alter = append(alter, "replication = "+to)
+	}
+	if d.old.DurableWrites != d.new.DurableWrites {
+		from, to := strconv.FormatBool(d.old.DurableWrites), strconv.FormatBool(d.new.DurableWrites)
+		d.difference(SchemaObjectOption, SchemaUpdated, "", "durable_writes", from, to)
+		alter = append(alter, "durable_writes = "+to)
+	}
+	if len(alter) > 0 {
+		d.statement(diffPhaseKeyspace, "ALTER KEYSPACE %s WITH %s", d.new.Name, strings.Join(alter, " AND "))
+	}
+}
+
+func (d *schemaDiffer) diffTypes() {
+	var dropped, created []string
+	alter := make(map[string][]string)
+	recreated := make(map[string]bool)
+	for _, name := range schemaNames(d.old.Types, d.new.Types) {
+		from, to := d.old.Types[name], d.new.Types[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectType, SchemaDropped, "", name, typeFieldsString(from), "")
+			dropped = append(dropped, name)
+		case from == nil:
+			d.difference(SchemaObjectType, SchemaCreated, "", name, "", typeFieldsString(to))
+			created = append(created, name)
+		default:
+			stmts, ok := d.alterType(from, to)
+			if !ok {
+				d.difference(SchemaObjectType, SchemaUpdated, "", name, typeFieldsString(from), typeFieldsString(to))
+				recreated[name] = true
+			}
+			alter[name] = stmts
+		}
+	}
+
+	// the types referring to a type recreated are recreated too, the other
+	// elements referring to it would have to be recreated with their data
+	for changed := true; changed; {
+		changed = false
+		for _, name := range schemaNames(d.old.Types, nil) {
+			if recreated[name] || d.new.Types[name] == nil {
+				continue
+			}
+			for dep := range recreated {
+				if typeRefersTo(d.old.Types[name], dep) {
+					recreated[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	// the types used by the other elements are left unchanged, with the types
+	// they refer to
+	users := make(map[string][]string)
+	for name := range recreated {
+		if elements := d.typeUsers(name); len(elements) > 0 {
+			users[name] = elements
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name := range recreated {
+			if users[name] != nil {
+				continue
+			}
+			for _, dep := range schemaNames(users, nil) {
+				if typeRefersTo(d.old.Types[dep], name) {
+					users[name] = users[dep]
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	for _, name := range schemaNames(recreated, nil) {
+		if elements := users[name]; elements != nil {
+			d.fail(fmt.Errorf("type %s.%s can't be altered and is used by %s, which must be recreated first",
+				d.old.Name, name, strings.Join(elements, ", ")))
+			continue
+		}
+		dropped = append(dropped, name)
+		created = append(created, name)
+		delete(alter, name)
+	}
+	sort.Strings(dropped)
+	sort.Strings(created)
+
+	// types are dropped before the types they refer to
+	dropped = typesInDependencyOrder(d.old.Types, dropped)
+	for i := len(dropped) - 1; i >= 0; i-- {
+		d.statement(diffPhaseDropTypes, "DROP TYPE %s.%s", d.old.Name, dropped[i])
+	}
+	for _, name := range typesInDependencyOrder(d.new.Types, created) {
+		tm := *d.new.Types[name]
+		tm.Keyspace = d.new.Name
+		d.render(diffPhaseTypes, func(w io.Writer) error { return d.new.userTypeToCQL(w, &tm) })
+	}
+	for _, name := range schemaNames(alter, nil) {
+		d.statements[diffPhaseTypes] = append(d.statements[diffPhaseTypes], alter[name]...)
+	}
+}
+
+// typeUsers returns the tables, functions and aggregates kept by the diff
+// which refer to the type name.
+func (d *schemaDiffer) typeUsers(name string) []string {
+	var users []string
+	for _, table := range schemaNames(d.old.Tables, nil) {
+		if d.new.Tables[table] == nil {
+			continue
+		}
+		for _, col := range d.old.Tables[table].Columns {
+			if containsIdentifier(col.Type, name) {
+				users = append(users, "table "+table)
+				break
+			}
+		}
+	}
+	for _, function := range schemaNames(d.old.Functions, nil) {
+		fm := d.old.Functions[function]
+		if d.new.Functions[function] == nil {
+			continue
+		}
+		for _, typ := range append(append([]string(nil), fm.ArgumentTypes...), fm.ReturnType) {
+			if containsIdentifier(typ, name) {
+				users = append(users, "function "+function)
+				break
+			}
+		}
+	}
+	for _, aggregate := range schemaNames(d.old.Aggregates, nil) {
+		am := d.old.Aggregates[aggregate]
+		if d.new.Aggregates[aggregate] == nil {
+			continue
+		}
+		for _, typ := range append(append([]string(nil), am.ArgumentTypes...), am.StateType, am.ReturnType) {
+			if containsIdentifier(typ, name) {
+				users = append(users, "aggregate "+aggregate)
+				break
+			}
+		}
+	}
+	return users
+}
+
+// alterType returns the statements altering from into to, it reports false
+// if the fields of from were removed, reordered or changed type, which
+// requires the type to be recreated.
+func (d *schemaDiffer) alterType(from, to *TypeMetadata) ([]string, bool) {
+	if len(to.FieldTypes) < len(from.FieldTypes) {
+		return nil, false
+	}
+	for i, typ := range from.FieldTypes {
+		if typ != to.FieldTypes[i] {
+			return nil, false
+		}
+	}
+
+	var stmts, renames []string
+	for i, name := range from.FieldNames {
+		if to.FieldNames[i] != name {
+			d.difference(SchemaObjectField, SchemaUpdated, to.Name, name, name, to.FieldNames[i])
+			renames = append(renames, fmt.Sprintf("%s TO %s", name, to.FieldNames[i]))
+		}
+	}
+	if len(renames) > 0 {
+		stmts = append(stmts, fmt.Sprintf("ALTER TYPE %s.%s RENAME %s", d.new.Name, to.Name, strings.Join(renames, " AND ")))
+	}
+	for i := len(from.FieldNames); i < len(to.FieldNames); i++ {
+		d.difference(SchemaObjectField, SchemaCreated, to.Name, to.FieldNames[i], "", to.FieldTypes[i])
+		stmts = append(stmts, fmt.Sprintf("ALTER TYPE %s.%s ADD %s %s", d.new.Name, to.Name, to.FieldNames[i], to.FieldTypes[i]))
+	}
+	return stmts, true
+}
+
+func (d *schemaDiffer) diffTables() {
+	for _, name := range schemaNames(d.old.Tables, d.new.Tables) {
+		from, to := d.old.Tables[name], d.new.Tables[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectTable, SchemaDropped, "", name, "", "")
+			d.statement(diffPhaseDropTables, "DROP TABLE %s.%s", d.old.Name, name)
+		case from == nil:
+			d.difference(SchemaObjectTable, SchemaCreated, "", name, "", "")
+			d.createTable(to)
+		default:
+			d.diffTable(from, to)
+		}
+	}
+}
+
+func (d *schemaDiffer) createTable(tm *TableMetadata) {
+	d.render(diffPhaseTables, func(w io.Writer) error { return d.new.tableToCQL(w, d.new.Name, tm) })
+}
+
+func (d *schemaDiffer) diffTable(from, to *TableMetadata) {
+	if fromKey, toKey := tableKeyString(from), tableKeyString(to); fromKey != toKey {
+		d.difference(SchemaObjectTable, SchemaUpdated, "", to.Name, fromKey, toKey)
+		d.statement(diffPhaseDropTables, "DROP TABLE %s.%s", d.old.Name, from.Name)
+		d.createTable(to)
+		d.recreatedTables[to.Name] = true
+		return
+	}
+
+	keys := make(map[string]bool)
+	for _, col := range append(append([]*ColumnMetadata(nil), to.PartitionKey...), to.ClusteringColumns...) {
+		keys[col.Name] = true
+	}
+
+	table := d.new.Name + "." + to.Name
+	for _, name := range schemaNames(from.Columns, to.Columns) {
+		if keys[name] {
+			continue
+		}
+		fromCol, toCol := from.Columns[name], to.Columns[name]
+		switch {
+		case toCol == nil:
+			d.difference(SchemaObjectColumn, SchemaDropped, to.Name, name, columnString(fromCol), "")
+			d.dropColumn(to.Name, name)
+		case fromCol == nil:
+			d.difference(SchemaObjectColumn, SchemaCreated, to.Name, name, "", columnString(toCol))
+			d.statement(diffPhaseTables, "ALTER TABLE %s ADD %s %s", table, name, columnString(toCol))
+		case columnString(fromCol) != columnString(toCol):
+			// the type of a column can't be altered since Cassandra 3.0.11,
+			// the column is recreated losing its data
+			d.difference(SchemaObjectColumn, SchemaUpdated, to.Name, name, columnString(fromCol), columnString(toCol))
+			d.dropColumn(to.Name, name)
+			d.statement(diffPhaseTables, "ALTER TABLE %s ADD %s %s", table, name, columnString(toCol))
+		}
+	}
+
+	if options := d.diffOptions(to.Name, from.Options, from.Extensions, to.Options, to.Extensions); len(options) > 0 {
+		d.statement(diffPhaseTables, "ALTER TABLE %s WITH %s", table, strings.Join(options, " AND "))
+	}
+}
+
+// dropColumn drops the column of the table, whose views and indexes on the
+// column are recreated as columns can't be dropped while they depend on them.
+func (d *schemaDiffer) dropColumn(table, column string) {
+	d.statement(diffPhaseTables, "ALTER TABLE %s.%s DROP %s", d.new.Name, table, column)
+	if d.droppedColumns[table] == nil {
+		d.droppedColumns[table] = make(map[string]bool)
+	}
+	d.droppedColumns[table][column] = true
+}
+
+// diffOptions returns the assignments of the options of the table or view
+// parent which changed.
+func (d *schemaDiffer) diffOptions(parent string, from TableMetadataOptions, fromExtensions map[string]interface{},
+	to TableMetadataOptions, toExtensions map[string]interface{}) []string {
+	fromProperties, err := tableProperties(from, fromExtensions)
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+	toProperties, err := tableProperties(to, toExtensions)
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+
+	var options []string
+	for _, key := range schemaNames(fromProperties, toProperties) {
+		fromValue, toValue := fromProperties[key], toProperties[key]
+		if fromValue == toValue {
+			continue
+		}
+		d.difference(SchemaObjectOption, SchemaUpdated, parent, key, fromValue, toValue)
+		if toValue == "" {
+			if toValue = schemaDiffOptionResets[key]; toValue == "" {
+				continue
+			}
+		}
+		options = append(options, key+" = "+toValue)
+	}
+	return options
+}
+
+func (d *schemaDiffer) diffViews() {
+	for _, name := range schemaNames(d.old.Views, d.new.Views) {
+		from, to := d.old.Views[name], d.new.Views[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectView, SchemaDropped, "", name, viewDefinition(from), "")
+			d.dropView(name)
+		case from == nil:
+			d.difference(SchemaObjectView, SchemaCreated, "", name, "", viewDefinition(to))
+			d.createView(to)
+		case viewDefinition(from) != viewDefinition(to):
+			d.difference(SchemaObjectView, SchemaUpdated, "", name, viewDefinition(from), viewDefinition(to))
+			d.dropView(name)
+			d.createView(to)
+		case d.recreatedTables[to.BaseTableName] || len(d.droppedColumns[to.BaseTableName]) > 0:
+			// the view is recreated with its new options
+			d.diffOptions(name, from.Options, from.Extensions, to.Options, to.Extensions)
+			d.dropView(name)
+			d.createView(to)
+		default:
+			if options := d.diffOptions(name, from.Options, from.Extensions, to.Options, to.Extensions); len(options) > 0 {
+				d.statement(diffPhaseViews, "ALTER MATERIALIZED VIEW %s.%s WITH %s", d.new.Name, name, strings.Join(options, " AND "))
+			}
+		}
+	}
+}
+
+func (d *schemaDiffer) dropView(name string) {
+	d.statement(diffPhaseDropViews, "DROP MATERIALIZED VIEW %s.%s", d.old.Name, name)
+}
+
+func (d *schemaDiffer) createView(vm *ViewMetadata) {
+	view := *vm
+	view.KeyspaceName = d.new.Name
+	d.render(diffPhaseViews, func(w io.Writer) error { return d.new.viewToCQL(w, &view) })
+}
+
+func (d *schemaDiffer) diffIndexes() {
+	for _, name := range schemaNames(d.old.Indexes, d.new.Indexes) {
+		from, to := d.old.Indexes[name], d.new.Indexes[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectIndex, SchemaDropped, from.TableName, name, indexDefinition(from), "")
+			d.dropIndex(name)
+		case from == nil:
+			d.difference(SchemaObjectIndex, SchemaCreated, to.TableName, name, "", indexDefinition(to))
+			d.createIndex(to)
+		case from.TableName != to.TableName || from.Kind != to.Kind || !reflect.DeepEqual(from.Options, to.Options):
+			d.difference(SchemaObjectIndex, SchemaUpdated, to.TableName, name, indexDefinition(from), indexDefinition(to))
+			d.dropIndex(name)
+			d.createIndex(to)
+		case d.recreatedTables[to.TableName] || d.indexesDroppedColumn(from):
+			d.dropIndex(name)
+			d.createIndex(to)
+		}
+	}
+}
+
+// indexesDroppedColumn reports whether im indexes a column dropped.
+func (d *schemaDiffer) indexesDroppedColumn(im *IndexMetadata) bool {
+	for column := range d.droppedColumns[im.TableName] {
+		if containsIdentifier(im.Options["target"], column) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *schemaDiffer) dropIndex(name string) {
+	d.statement(diffPhaseDropIndexes, "DROP INDEX %s.%s", d.old.Name, name)
+}
+
+func (d *schemaDiffer) createIndex(im *IndexMetadata) {
+	index := *im
+	index.KeyspaceName = d.new.Name
+	d.render(diffPhaseIndexes, func(w io.Writer) error { return d.new.indexToCQL(w, &index) })
+}
+
+func (d *schemaDiffer) diffFunctions() {
+	for _, name := range schemaNames(d.old.Functions, d.new.Functions) {
+		from, to := d.old.Functions[name], d.new.Functions[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectFunction, SchemaDropped, "", name, functionDefinition(from), "")
+			d.dropFunction(from)
+		case from == nil:
+			d.difference(SchemaObjectFunction, SchemaCreated, "", name, "", functionDefinition(to))
+			d.createFunction(to, false)
+		case functionDefinition(from) != functionDefinition(to):
+			d.difference(SchemaObjectFunction, SchemaUpdated, "", name, functionDefinition(from), functionDefinition(to))
+			// the return type of a function can't be replaced
+			if functionSignature(from.Name, from.ArgumentTypes) == functionSignature(to.Name, to.ArgumentTypes) && from.ReturnType == to.ReturnType {
+				d.createFunction(to, true)
+			} else {
+				d.dropFunction(from)
+				d.createFunction(to, false)
+				d.recreatedFunctions[name] = true
+			}
+		}
+	}
+}
+
+func (d *schemaDiffer) dropFunction(fm *FunctionMetadata) {
+	d.statement(diffPhaseDropFunctions, "DROP FUNCTION %s.%s", d.old.Name, functionSignature(fm.Name, fm.ArgumentTypes))
+}
+
+func (d *schemaDiffer) createFunction(fm *FunctionMetadata, replace bool) {
+	stmt := d.renderCQL(func(w io.Writer) error { return d.new.functionToCQL(w, d.new.Name, fm) })
+	if replace {
+		stmt = strings.Replace(stmt, "CREATE FUNCTION", "CREATE OR REPLACE FUNCTION", 1)
+	}
+	if stmt != "" {
+		d.statement(diffPhaseFunctions, "%s", stmt)
+	}
+}
+
+func (d *schemaDiffer) diffAggregates() {
+	for _, name := range schemaNames(d.old.Aggregates, d.new.Aggregates) {
+		from, to := d.old.Aggregates[name], d.new.Aggregates[name]
+		switch {
+		case to == nil:
+			d.difference(SchemaObjectAggregate, SchemaDropped, "", name, aggregateDefinition(from), "")
+			d.dropAggregate(from)
+		case from == nil:
+			d.difference(SchemaObjectAggregate, SchemaCreated, "", name, "", aggregateDefinition(to))
+			d.createAggregate(to, false)
+		case aggregateDefinition(from) != aggregateDefinition(to):
+			d.difference(SchemaObjectAggregate, SchemaUpdated, "", name, aggregateDefinition(from), aggregateDefinition(to))
+			if functionSignature(from.Name, from.ArgumentTypes) == functionSignature(to.Name, to.ArgumentTypes) && from.ReturnType == to.ReturnType &&
+				!d.recreatedFunctions[from.StateFunc.Name] && !d.recreatedFunctions[from.FinalFunc.Name] {
+				d.createAggregate(to, true)
+			} else {
+				d.dropAggregate(from)
+				d.createAggregate(to, false)
+			}
+		case d.recreatedFunctions[to.StateFunc.Name] || d.recreatedFunctions[to.FinalFunc.Name]:
+			d.dropAggregate(from)
+			d.createAggregate(to, false)
+		}
+	}
+}
+
+func (d *schemaDiffer) dropAggregate(am *AggregateMetadata) {
+	d.statement(diffPhaseDropAggregates, "DROP AGGREGATE %s.%s", d.old.Name, functionSignature(am.Name, am.ArgumentTypes))
+}
+
+func (d *schemaDiffer) createAggregate(am *AggregateMetadata, replace bool) {
+	aggregate := *am
+	aggregate.Keyspace = d.new.Name
+	stmt := d.renderCQL(func(w io.Writer) error { return d.new.aggregateToCQL(w, &aggregate) })
+	if replace {
+		stmt = strings.Replace(stmt, "CREATE AGGREGATE", "CREATE OR REPLACE AGGREGATE", 1)
+	}
+	if stmt != "" {
+		d.statement(diffPhaseAggregates, "%s", stmt)
+	}
+}
+
+// schemaNames returns the sorted union of the keys of the maps a and b,
+// which must have string keys, or be nil.
+func schemaNames(a, b interface{}) []string {
+	set := make(map[string]struct{})
+	for _, m := range []interface{}{a, b} {
+		if m == nil {
+			continue
+		}
+		for _, key := range reflect.ValueOf(m).MapKeys() {
+			set[key.String()] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// typesInDependencyOrder sorts names so that the types come after the types
+// their fields refer to.
+func typesInDependencyOrder(types map[string]*TypeMetadata, names []string) []string {
+	sorted := make([]string, 0, len(names))
+	visited := make(map[string]bool, len(names))
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dep := range names {
+			if dep != name && typeRefersTo(types[name], dep) {
+				visit(dep)
+			}
+		}
+		sorted = append(sorted, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return sorted
+}
+
+func typeRefersTo(tm *TypeMetadata, name string) bool {
+	for _, typ := range tm.FieldTypes {
+		if containsIdentifier(typ, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIdentifier reports whether the CQL type or index target s contains
+// the identifier name.
+func containsIdentifier(s, name string) bool {
+	identifiers := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, identifier := range identifiers {
+		if identifier == name {
+			return true
+		}
+	}
+	return false
+}
+
+func typeFieldsString(tm *TypeMetadata) string {
+	fields := make([]string, len(tm.FieldNames))
+	for i, name := range tm.FieldNames {
+		fields[i] = name + " " + tm.FieldTypes[i]
+	}
+	return "(" + strings.Join(fields, ", ") + ")"
+}
+
+func replicationToCQL(km *KeyspaceMetadata) string {
+	keys := make([]string, 0, len(km.StrategyOptions))
+	for key := range km.StrategyOptions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	options := []string{"'class': " + cqlHelpers.escape(cqlHelpers.fixStrategy(km.StrategyClass))}
+	for _, key := range keys {
+		options = append(options, cqlHelpers.escape(key)+": "+cqlHelpers.escape(km.StrategyOptions[key]))
+	}
+	return "{" + strings.Join(options, ", ") + "}"
+}
+
+// tableKeyString describes the primary key of a table with the types and the
+// clustering order of its columns, which can't be altered.
+func tableKeyString(tm *TableMetadata) string {
+	s := "PRIMARY KEY (" + keyString(tm.PartitionKey, tm.ClusteringColumns, true) + ")"
+	if cqlHelpers.compactStorage(tm.Flags) {
+		s += " WITH COMPACT STORAGE"
+	}
+	return s
+}
+
+func keyString(pks, cks []*ColumnMetadata, types bool) string {
+	column := func(col *ColumnMetadata) string {
+		if types {
+			return col.Name + " " + col.Type
+		}
+		return col.Name
+	}
+
+	parts := make([]string, 0, len(pks))
+	for _, col := range pks {
+		parts = append(parts, column(col))
+	}
+	s := strings.Join(parts, ", ")
+	if len(pks) != 1 {
+		s = "(" + s + ")"
+	}
+	for _, col := range cks {
+		s += ", " + column(col)
+		if types {
+			order := strings.ToUpper(col.ClusteringOrder)
+			if order == "" {
+				order = "ASC"
+			}
+			s += " " + order
+		}
+	}
+	return s
+}
+
+func columnString(cm *ColumnMetadata) string {
+	if cm.Kind == ColumnStatic {
+		return cm.Type + " static"
+	}
+	return cm.Type
+}
+
+// tableProperties returns the options and the extensions of a table or a
+// view by name, with their values in CQL.
+func tableProperties(options TableMetadataOptions, extensions map[string]interface{}) (map[string]string, error) {
+	opts, err := cqlHelpers.tableOptionsToCQL(options)
+	if err != nil {
+		return nil, err
+	}
+	exts, err := cqlHelpers.tableExtensionsToCQL(extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]string, len(opts)+len(exts))
+	for _, property := range append(opts, exts...) {
+		kv := strings.SplitN(property, " = ", 2)
+		if len(kv) == 2 {
+			properties[kv[0]] = kv[1]
+		}
+	}
+	return properties, nil
+}
+
+func viewDefinition(vm *ViewMetadata) string {
+	columns := "*"
+	if !vm.IncludeAllColumns {
+		columns = strings.Join(vm.OrderedColumns, ", ")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s PRIMARY KEY (%s)",
+		columns, vm.BaseTableName, vm.WhereClause, keyString(vm.PartitionKey, vm.ClusteringColumns, false))
+}
+
+func indexDefinition(im *IndexMetadata) string {
+	s := fmt.Sprintf("ON %s (%s)", im.TableName, im.Options["target"])
+	if im.Kind != "" {
+		s = im.Kind + " " + s
+	}
+	return s
+}
+
+func functionSignature(name string, argumentTypes []string) string {
+	args := make([]string, len(argumentTypes))
+	for i, typ := range argumentTypes {
+		args[i] = cqlHelpers.stripFrozen(typ)
+	}
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func functionDefinition(fm *FunctionMetadata) string {
+	args := make([]string, len(fm.ArgumentTypes))
+	for i, typ := range fm.ArgumentTypes {
+		args[i] = cqlHelpers.stripFrozen(typ)
+		if i < len(fm.ArgumentNames) {
+			args[i] = fm.ArgumentNames[i] + " " + args[i]
+		}
+	}
+	onNull := "RETURNS NULL"
+	if fm.CalledOnNullInput {
+		onNull = "CALLED"
+	}
+	return fmt.Sprintf("(%s) %s ON NULL INPUT RETURNS %s LANGUAGE %s AS $$%s$$",
+		strings.Join(args, ", "), onNull, fm.ReturnType, fm.Language, fm.Body)
+}
+
+func aggregateDefinition(am *AggregateMetadata) string {
+	s := fmt.Sprintf("%s SFUNC %s STYPE %s", functionSignature(am.Name, am.ArgumentTypes), am.StateFunc.Name, am.StateType)
+	if am.FinalFunc.Name != "" {
+		s += " FINALFUNC " + am.FinalFunc.Name
+	}
+	if am.InitCond != "" {
+		s += " INITCOND " + am.InitCond
+	}
+	return s
+}
@@ -0,0 +1,275 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"strings"
+	"testing"
+)
+
+func diffTestTable(name string, pk, ck []string, columns ...string) *TableMetadata {
+	tm := &TableMetadata{
+		Keyspace: "ks",
+		Name:     name,
+		Columns:  make(map[string]*ColumnMetadata),
+		Options:  TableMetadataOptions{GcGraceSeconds: 864000},
+		Flags:    []string{TableFlagCompound},
+	}
+	add := func(kind ColumnKind, def string) *ColumnMetadata {
+		parts := strings.Fields(def)
+		col := &ColumnMetadata{Keyspace: "ks", Table: name, Name: parts[0], Type: parts[1], Kind: kind}
+		if len(parts) > 2 && parts[2] == "static" {
+			col.Kind = ColumnStatic
+		}
+		tm.Columns[col.Name] = col
+		tm.OrderedColumns = append(tm.OrderedColumns, col.Name)
+		return col
+	}
+	for _, def := range pk {
+		tm.PartitionKey = append(tm.PartitionKey, add(ColumnPartitionKey, def))
+	}
+	for _, def := range ck {
+		col := add(ColumnClusteringKey, def)
+		col.ClusteringOrder = "asc"
+		tm.ClusteringColumns = append(tm.ClusteringColumns, col)
+	}
+	for _, def := range columns {
+		add(ColumnRegular, def)
+	}
+	return tm
+}
+
+func diffTestKeyspace() *KeyspaceMetadata {
+	users := diffTestTable("users", []string{"id uuid"}, nil, "name text", "age int", "city text")
+	events := diffTestTable("events", []string{"id uuid"}, []string{"at timestamp"}, "payload blob")
+	legacy := diffTestTable("legacy", []string{"id int"}, nil)
+	return &KeyspaceMetadata{
+		Name:            "ks",
+		DurableWrites:   true,
+		StrategyClass:   "org.apache.cassandra.locator.SimpleStrategy",
+		StrategyOptions: map[string]interface{}{"replication_factor": "1"},
+		Tables:          map[string]*TableMetadata{"users": users, "events": events, "legacy": legacy},
+		Types: map[string]*TypeMetadata{
+			"address": {Keyspace: "ks", Name: "address", FieldNames: []string{"street"}, FieldTypes: []string{"text"}},
+		},
+		Indexes: map[string]*IndexMetadata{
+			"events_payload_idx": {Name: "events_payload_idx", KeyspaceName: "ks", TableName: "events", Kind: "COMPOSITES", Options: map[string]string{"target": "payload"}},
+		},
+		Views: map[string]*ViewMetadata{
+			"users_by_name": {
+				KeyspaceName: "ks", ViewName: "users_by_name", BaseTableName: "users", IncludeAllColumns: true,
+				WhereClause: "name IS NOT NULL", PartitionKey: []*ColumnMetadata{{Name: "name"}}, ClusteringColumns: []*ColumnMetadata{{Name: "id", ClusteringOrder: "asc"}},
+				Options: TableMetadataOptions{GcGraceSeconds: 864000},
+			},
+		},
+		Functions: map[string]*FunctionMetadata{
+			"twice": {Keyspace: "ks", Name: "twice", ArgumentNames: []string{"v"}, ArgumentTypes: []string{"int"}, ReturnType: "int", Language: "lua", Body: "return v * 2"},
+		},
+	}
+}
+
+func TestDiffKeyspacesSame(t *testing.T) {
+	t.Parallel()
+
+	if diff := DiffKeyspaces(diffTestKeyspace(), diffTestKeyspace()); !diff.Empty() || len(diff.Statements) != 0 || diff.Err != nil {
+		t.Fatalf("expected no differences got %s\n%s", diff, diff.CQL())
+	}
+	if diff := DiffKeyspaces(nil, nil); !diff.Empty() {
+		t.Fatalf("expected no differences got %s", diff)
+	}
+}
+
+func TestDiffKeyspaces(t *testing.T) {
+	t.Parallel()
+
+	old, new := diffTestKeyspace(), diffTestKeyspace()
+	new.StrategyOptions["replication_factor"] = "3"
+
+	// columns and options are altered in place
+	users := new.Tables["users"]
+	delete(users.Columns, "city")
+	users.Columns["age"].Type = "bigint"
+	users.Columns["email"] = &ColumnMetadata{Name: "email", Type: "text", Kind: ColumnRegular}
+	users.Options.GcGraceSeconds = 3600
+
+	// the primary key can't be altered, the table and its index are recreated
+	events := new.Tables["events"]
+	events.ClusteringColumns[0].ClusteringOrder = "desc"
+
+	delete(new.Tables, "legacy")
+	new.Tables["orders"] = diffTestTable("orders", []string{"id uuid"}, nil, "addr frozen<address>")
+
+	new.Types["address"] = &TypeMetadata{Keyspace: "ks", Name: "address", FieldNames: []string{"street", "city"}, FieldTypes: []string{"text", "text"}}
+	new.Views["users_by_name"].Options.GcGraceSeconds = 0
+	new.Functions["twice"] = &FunctionMetadata{Keyspace: "ks", Name: "twice", ArgumentNames: []string{"v"}, ArgumentTypes: []string{"int"}, ReturnType: "int", Language: "lua", Body: "return v + v"}
+
+	diff := DiffKeyspaces(old, new)
+	if diff.Err != nil {
+		t.Fatal(diff.Err)
+	}
+
+	expectedDifferences := []string{
+		"~ option ks.replication: {'class': 'SimpleStrategy', 'replication_factor': '1'} -> {'class': 'SimpleStrategy', 'replication_factor': '3'}",
+		"+ field ks.address.city text",
+		"~ table ks.events: PRIMARY KEY (id uuid, at timestamp ASC) -> PRIMARY KEY (id uuid, at timestamp DESC)",
+		"- table ks.legacy",
+		"+ table ks.orders",
+		"~ column ks.users.age: int -> bigint",
+		"- column ks.users.city text",
+		"+ column ks.users.email text",
+		"~ option ks.users.gc_grace_seconds: 864000 -> 3600",
+		"~ option ks.users_by_name.gc_grace_seconds: 864000 -> 0",
+		"~ function ks.twice: (v int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$return v * 2$$ -> (v int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE lua AS $$return v + v$$",
+	}
+	if got := strings.Split(diff.String(), "\n"); strings.Join(got, "\n") != strings.Join(expectedDifferences, "\n") {
+		t.Errorf("expected differences:\n%s\ngot:\n%s", strings.Join(expectedDifferences, "\n"), diff)
+	}
+
+	// the type of a column can't be altered, the column is recreated, and the
+	// views of its table as columns can't be dropped while views depend on them
+	expectedStatements := []string{
+		"ALTER KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': '3'}",
+		"DROP MATERIALIZED VIEW ks.users_by_name",
+		"DROP INDEX ks.events_payload_idx",
+		"DROP TABLE ks.events",
+		"DROP TABLE ks.legacy",
+		"ALTER TYPE ks.address ADD city text",
+		"CREATE TABLE ks.events",
+		"CREATE TABLE ks.orders",
+		"ALTER TABLE ks.users DROP age",
+		"ALTER TABLE ks.users ADD age bigint",
+		"ALTER TABLE ks.users DROP city",
+		"ALTER TABLE ks.users ADD email text",
+		"ALTER TABLE ks.users WITH gc_grace_seconds = 3600",
+		"CREATE OR REPLACE FUNCTION ks.twice",
+		"CREATE INDEX events_payload_idx ON ks.events (payload)",
+		"CREATE MATERIALIZED VIEW ks.users_by_name",
+	}
+	if len(diff.Statements) != len(expectedStatements) {
+		t.Fatalf("expected %d statements got:\n%s", len(expectedStatements), diff.CQL())
+	}
+	for i, stmt := range diff.Statements {
+		if !strings.HasPrefix(stmt, expectedStatements[i]) {
+			t.Errorf("statement %d: expected %q got %q", i, expectedStatements[i], stmt)
+		}
+	}
+	if !strings.Contains(diff.Statements[6], "CLUSTERING ORDER BY (at desc)") {
+		t.Errorf("expected the table to be recreated with the new key got %q", diff.Statements[6])
+	}
+	if view := diff.Statements[len(diff.Statements)-1]; !strings.Contains(view, "gc_grace_seconds = 0") {
+		t.Errorf("expected the view to be recreated with its new options got %q", view)
+	}
+}
+
+func TestDiffKeyspacesTypes(t *testing.T) {
+	t.Parallel()
+
+	typ := func(name string, fields ...string) *TypeMetadata {
+		tm := &TypeMetadata{Keyspace: "ks", Name: name}
+		for _, field := range fields {
+			parts := strings.Fields(field)
+			tm.FieldNames = append(tm.FieldNames, parts[0])
+			tm.FieldTypes = append(tm.FieldTypes, parts[1])
+		}
+		return tm
+	}
+
+	old := &KeyspaceMetadata{Name: "ks", Types: map[string]*TypeMetadata{
+		"a":      typ("a", "x int", "y int"),
+		"b":      typ("b", "x int"),
+		"person": typ("person", "home frozen<b>"),
+	}}
+	new := &KeyspaceMetadata{Name: "ks", Types: map[string]*TypeMetadata{
+		// fields renamed in place
+		"a": typ("a", "first int", "y int"),
+		// a field type changed, the type is recreated with the types
+		// referring to it
+		"b":      typ("b", "x bigint"),
+		"person": typ("person", "home frozen<b>", "work frozen<b>"),
+		"z":      typ("z", "v int"),
+		// created after the type it refers to
+		"c": typ("c", "z frozen<z>"),
+	}}
+
+	diff := DiffKeyspaces(old, new)
+	if diff.Err != nil {
+		t.Fatal(diff.Err)
+	}
+	expected := []string{
+		"DROP TYPE ks.person",
+		"DROP TYPE ks.b",
+		"CREATE TYPE ks.b",
+		"CREATE TYPE ks.z",
+		"CREATE TYPE ks.c",
+		"CREATE TYPE ks.person",
+		"ALTER TYPE ks.a RENAME x TO first",
+	}
+	if len(diff.Statements) != len(expected) {
+		t.Fatalf("expected %d statements got:\n%s", len(expected), diff.CQL())
+	}
+	for i, stmt := range diff.Statements {
+		if !strings.HasPrefix(stmt, expected[i]) {
+			t.Errorf("statement %d: expected %q got %q", i, expected[i], stmt)
+		}
+	}
+	if !strings.Contains(diff.Statements[5], "work frozen<b>") {
+		t.Errorf("expected the type to be recreated with its new fields got %q", diff.Statements[5])
+	}
+
+	// the tables referring to a type can't be recreated without their data
+	old.Tables = map[string]*TableMetadata{"people": diffTestTable("people", []string{"id int"}, nil, "p frozen<person>")}
+	new.Tables = map[string]*TableMetadata{"people": diffTestTable("people", []string{"id int"}, nil, "p frozen<person>")}
+	diff = DiffKeyspaces(old, new)
+	if diff.Err == nil || !strings.Contains(diff.Err.Error(), "type ks.b can't be altered and is used by table people") {
+		t.Fatalf("expected an error got %v", diff.Err)
+	}
+	for _, stmt := range diff.Statements {
+		if strings.HasPrefix(stmt, "DROP TYPE") {
+			t.Errorf("expected no type to be dropped got %q", stmt)
+		}
+	}
+}
+
+func TestDiffKeyspacesColumnIndex(t *testing.T) {
+	t.Parallel()
+
+	old, new := diffTestKeyspace(), diffTestKeyspace()
+	new.Tables["events"].Columns["payload"].Type = "text"
+	diff := DiffKeyspaces(old, new)
+	if diff.Err != nil {
+		t.Fatal(diff.Err)
+	}
+	expected := []string{
+		"DROP INDEX ks.events_payload_idx",
+		"ALTER TABLE ks.events DROP payload",
+		"ALTER TABLE ks.events ADD payload text",
+		"CREATE INDEX events_payload_idx ON ks.events (payload)",
+	}
+	if diff.CQL() != strings.Join(expected, ";\n")+";\n" {
+		t.Errorf("expected statements:\n%s\ngot:\n%s", strings.Join(expected, "\n"), diff.CQL())
+	}
+}
+
+func TestDiffKeyspacesCreateDrop(t *testing.T) {
+	t.Parallel()
+
+	diff := DiffKeyspaces(nil, diffTestKeyspace())
+	if diff.Err != nil {
+		t.Fatal(diff.Err)
+	}
+	if diff.Differences[0].Object != SchemaObjectKeyspace || diff.Differences[0].Change != SchemaCreated {
+		t.Errorf("expected the keyspace to be created got %s", diff.Differences[0])
+	}
+	if !strings.HasPrefix(diff.Statements[0], "CREATE KEYSPACE ks WITH replication") {
+		t.Errorf("expected the keyspace to be created first got %q", diff.Statements[0])
+	}
+	if !strings.HasPrefix(diff.Statements[len(diff.Statements)-1], "CREATE MATERIALIZED VIEW ks.users_by_name") {
+		t.Errorf("expected the view to be created last got %q", diff.Statements[len(diff.Statements)-1])
+	}
+
+	diff = DiffKeyspaces(diffTestKeyspace(), nil)
+	if diff.String() != "- keyspace ks" || diff.CQL() != "DROP KEYSPACE ks;\n" {
+		t.Errorf("expected the keyspace to be dropped got %s\n%s", diff, diff.CQL())
+	}
+}
@@ -0,0 +1,204 @@
+package gocql
+
+import (
+	"sync"
+)
+
+// SchemaChangeTarget is the kind of schema element changed by a SchemaChangeEvent.
+type SchemaChangeTarget int
+
+const (
+	SchemaKeyspace SchemaChangeTarget = iota
+	SchemaTable
+	SchemaType
+	SchemaFunction
+	SchemaAggregate
+)
+
+func (t SchemaChangeTarget) String() string {
+	switch t {
+	case SchemaKeyspace:
+		return "KEYSPACE"
+	case SchemaTable:
+		return "TABLE"
+	case SchemaType:
+		return "TYPE"
+	case SchemaFunction:
+		return "FUNCTION"
+	case SchemaAggregate:
+		return "AGGREGATE"
+	default:
+		return "unknown"
+	}
+}
+
+// SchemaChangeType is the kind of change of a SchemaChangeEvent.
+type SchemaChangeType int
+
+const (
+	SchemaCreated SchemaChangeType = iota
+	SchemaUpdated
+	SchemaDropped
+)
+
+func (t SchemaChangeType) String() string {
+	switch t {
+	case SchemaCreated:
+		return "CREATED"
+	case SchemaUpdated:
+		return "UPDATED"
+	case SchemaDropped:
+		return "DROPPED"
+	default:
+		return "unknown"
+	}
+}
+
+func parseSchemaChangeType(change string) SchemaChangeType {
+	switch change {
+	case "CREATED":
+		return SchemaCreated
+	case "DROPPED":
+		return SchemaDropped
+	default:
+		return SchemaUpdated
+	}
+}
+
+// SchemaChangeEvent is a schema change pushed by the cluster, delivered to
+// the functions subscribed with Session.SubscribeSchemaChanges.
+type SchemaChangeEvent struct {
+	Target   SchemaChangeTarget
+	Change   SchemaChangeType
+	Keyspace string
+	// Name is the name of the changed table, type, function or aggregate.
+	// It is empty for keyspace changes.
+	Name string
+	// Args are the argument types of the changed function or aggregate.
+	Args []string
+
+	// OldKeyspace is the metadata of the keyspace cached by the session
+	// before the change, nil if it was not cached.
+	OldKeyspace *KeyspaceMetadata
+	// NewKeyspace is the metadata of the keyspace after the change, nil if
+	// the keyspace was dropped or its metadata could not be refreshed.
+	NewKeyspace *KeyspaceMetadata
+	// Err is the error refreshing the metadata of the keyspace.
+	Err error
+}
+
+func newSchemaChangeEvent(f frame) (SchemaChangeEvent, bool) {
+	switch f := f.(type) {
+	case *schemaChangeKeyspace:
+		return SchemaChangeEvent{Target: SchemaKeyspace, Change: parseSchemaChangeType(f.change), Keyspace: f.keyspace}, true
+	case *schemaChangeTable:
+		return SchemaChangeEvent{Target: SchemaTable, Change: parseSchemaChangeType(f.change), Keyspace: f.keyspace, Name: f.object}, true
+	case *schemaChangeType:
+		return SchemaChangeEvent{Target: SchemaType, Change: parseSchemaChangeType(f.change), Keyspace: f.keyspace, Name: f.object}, true
+	case *schemaChangeFunction:
+		return SchemaChangeEvent{Target: SchemaFunction, Change: parseSchemaChangeType(f.change), Keyspace: f.keyspace, Name: f.name, Args: f.args}, true
+	case *schemaChangeAggregate:
+		return SchemaChangeEvent{Target: SchemaAggregate, Change: parseSchemaChangeType(f.change), Keyspace: f.keyspace, Name: f.name, Args: f.args}, true
+	}
+	return SchemaChangeEvent{}, false
+}
+
+type schemaChangeSubscribers struct {
+	mu     sync.RWMutex
+	nextID int
+	fns    map[int]func(SchemaChangeEvent)
+}
+
+func (s *schemaChangeSubscribers) add(fn func(SchemaChangeEvent)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fns == nil {
+		s.fns = make(map[int]func(SchemaChangeEvent))
+	}
+	id := s.nextID
+	s.nextID++
+	s.fns[id] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.fns, id)
+			s.mu.Unlock()
+		})
+	}
+}
+
+func (s *schemaChangeSubscribers) empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.fns) == 0
+}
+
+func (s *schemaChangeSubscribers) publish(events []SchemaChangeEvent) {
+	s.mu.RLock()
+	fns := make([]func(SchemaChangeEvent), 0, len(s.fns))
+	for id := 0; id < s.nextID; id++ {
+		if fn, ok := s.fns[id]; ok {
+			fns = append(fns, fn)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, event := range events {
+		for _, fn := range fns {
+			fn(event)
+		}
+	}
+}
+
+// SubscribeSchemaChanges calls fn with the schema changes pushed by the
+// cluster, until the returned function is called. The events are delivered in
+// order once the metadata of their keyspace is refreshed, on the goroutine
+// handling the events of the session, so fn must not block.
+//
+// Schema changes are not pushed if ClusterConfig.Events.DisableSchemaEvents is set.
+func (s *Session) SubscribeSchemaChanges(fn func(SchemaChangeEvent)) (unsubscribe func()) {
+	return s.schemaSubscribers.add(fn)
+}
+
+// publishSchemaChanges refreshes the metadata of the keyspaces changed by
+// events and publishes them. old holds the metadata of the keyspaces cached
+// before the changes.
+func (s *Session) publishSchemaChanges(events []SchemaChangeEvent, old map[string]*KeyspaceMetadata) {
+	if s.control != nil {
+		s.control.awaitSchemaAgreement()
+	}
+
+	type refreshed struct {
+		metadata *KeyspaceMetadata
+		err      error
+	}
+	keyspaces := make(map[string]refreshed)
+	for i := range events {
+		event := &events[i]
+		r, ok := keyspaces[event.Keyspace]
+		if !ok {
+			if !keyspaceDropped(events, event.Keyspace) {
+				r.metadata, r.err = s.metadataDescriber.getSchema(event.Keyspace)
+			}
+			keyspaces[event.Keyspace] = r
+		}
+		event.OldKeyspace = old[event.Keyspace]
+		event.NewKeyspace = r.metadata
+		event.Err = r.err
+	}
+
+	s.schemaSubscribers.publish(events)
+}
+
+// keyspaceDropped reports whether the last change of keyspace in events drops it.
+func keyspaceDropped(events []SchemaChangeEvent, keyspace string) bool {
+	dropped := false
+	for _, event := range events {
+		if event.Target == SchemaKeyspace && event.Keyspace == keyspace {
+			dropped = event.Change == SchemaDropped
+		}
+	}
+	return dropped
+}
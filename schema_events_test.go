@@ -0,0 +1,86 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSubscribeSchemaChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	var events []SchemaChangeEvent
+	unsubscribe := db.SubscribeSchemaChanges(func(event SchemaChangeEvent) {
+		events = append(events, event)
+	})
+
+	old := &KeyspaceMetadata{Name: "ks"}
+	db.metadataDescriber.metadata.keyspaceMetadata.set("ks", old)
+
+	db.handleSchemaEvent([]frame{
+		&schemaChangeTable{change: "UPDATED", keyspace: "ks", object: "t"},
+		&schemaChangeFunction{change: "CREATED", keyspace: "ks", name: "f", args: []string{"int"}},
+		&schemaChangeType{change: "DROPPED", keyspace: "other", object: "u"},
+	})
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events got %+v", events)
+	}
+	expected := []SchemaChangeEvent{
+		{Target: SchemaTable, Change: SchemaUpdated, Keyspace: "ks", Name: "t"},
+		{Target: SchemaFunction, Change: SchemaCreated, Keyspace: "ks", Name: "f", Args: []string{"int"}},
+		{Target: SchemaType, Change: SchemaDropped, Keyspace: "other", Name: "u"},
+	}
+	for i, event := range events {
+		want := expected[i]
+		if event.Target != want.Target || event.Change != want.Change || event.Keyspace != want.Keyspace ||
+			event.Name != want.Name || len(event.Args) != len(want.Args) {
+			t.Errorf("event %d: expected %+v got %+v", i, want, event)
+		}
+		// the test server doesn't serve the schema tables, so the refresh fails
+		if event.Err == nil || event.NewKeyspace != nil {
+			t.Errorf("event %d: expected refresh error got %+v", i, event)
+		}
+	}
+	if events[0].OldKeyspace != old || events[1].OldKeyspace != old {
+		t.Error("expected old metadata of the cached keyspace")
+	}
+	if events[2].OldKeyspace != nil {
+		t.Error("expected no old metadata of a keyspace which was not cached")
+	}
+
+	unsubscribe()
+	unsubscribe()
+	db.handleSchemaEvent([]frame{&schemaChangeTable{change: "CREATED", keyspace: "ks", object: "t2"}})
+	if len(events) != 3 {
+		t.Errorf("expected no events after unsubscribe got %+v", events[3:])
+	}
+}
+
+func TestKeyspaceDropped(t *testing.T) {
+	t.Parallel()
+
+	events := []SchemaChangeEvent{
+		{Target: SchemaKeyspace, Change: SchemaDropped, Keyspace: "a"},
+		{Target: SchemaKeyspace, Change: SchemaCreated, Keyspace: "a"},
+		{Target: SchemaTable, Change: SchemaDropped, Keyspace: "b", Name: "t"},
+		{Target: SchemaKeyspace, Change: SchemaDropped, Keyspace: "c"},
+	}
+	for keyspace, want := range map[string]bool{"a": false, "b": false, "c": true} {
+		if got := keyspaceDropped(events, keyspace); got != want {
+			t.Errorf("%s: expected %v got %v", keyspace, want, got)
+		}
+	}
+}
@@ -96,7 +96,7 @@ var _ cqlProtocolExtension = &rateLimitExt{}
 
 // Factory function to deserialize and create an `rateLimitExt` instance
 // from SUPPORTED message payload.
-func newRateLimitExt(supported map[string][]string, logger StdLogger) *rateLimitExt {
+func newRateLimitExt(supported map[string][]string, logger *driverLogger) *rateLimitExt {
 	const rateLimitErrorCode = "ERROR_CODE"
 
 	if v, found := supported[rateLimitError]; found {
@@ -108,8 +108,8 @@ func newRateLimitExt(supported map[string][]string, logger StdLogger) *rateLimit
 					errorCode int
 				)
 				if errorCode, err = strconv.Atoi(splitVal[1]); err != nil {
+					logger.debug("failed to parse supported option", logField("option", rateLimitErrorCode), logField("value", splitVal[1]), logError(err))
 					if gocqlDebug {
-						logger.Printf("scylla: failed to parse %s value %v: %s", rateLimitErrorCode, splitVal[1], err)
 						return nil
 					}
 				}
@@ -150,7 +150,7 @@ var _ cqlProtocolExtension = &lwtAddMetadataMarkExt{}
 
 // Factory function to deserialize and create an `lwtAddMetadataMarkExt` instance
 // from SUPPORTED message payload.
-func newLwtAddMetaMarkExt(supported map[string][]string, logger StdLogger) *lwtAddMetadataMarkExt {
+func newLwtAddMetaMarkExt(supported map[string][]string, logger *driverLogger) *lwtAddMetadataMarkExt {
 	const lwtOptMetaBitMaskKey = "LWT_OPTIMIZATION_META_BIT_MASK"
 
 	if v, found := supported[lwtAddMetadataMarkKey]; found {
@@ -162,8 +162,8 @@ func newLwtAddMetaMarkExt(supported map[string][]string, logger StdLogger) *lwtA
 					bitMask int
 				)
 				if bitMask, err = strconv.Atoi(splitVal[1]); err != nil {
+					logger.debug("failed to parse supported option", logField("option", lwtOptMetaBitMaskKey), logField("value", splitVal[1]), logError(err))
 					if gocqlDebug {
-						logger.Printf("scylla: failed to parse %s value %v: %s", lwtOptMetaBitMaskKey, splitVal[1], err)
 						return nil
 					}
 				}
@@ -186,7 +186,7 @@ func (ext *lwtAddMetadataMarkExt) name() string {
 	return lwtAddMetadataMarkKey
 }
 
-func parseSupported(supported map[string][]string, logger StdLogger) scyllaSupported {
+func parseSupported(supported map[string][]string, logger *driverLogger) scyllaSupported {
 	const (
 		scyllaShard             = "SCYLLA_SHARD"
 		scyllaNrShards          = "SCYLLA_NR_SHARDS"
@@ -204,23 +204,17 @@ func parseSupported(supported map[string][]string, logger StdLogger) scyllaSuppo
 
 	if s, ok := supported[scyllaShard]; ok {
 		if si.shard, err = strconv.Atoi(s[0]); err != nil {
-			if gocqlDebug {
-				logger.Printf("scylla: failed to parse %s value %v: %s", scyllaShard, s, err)
-			}
+			logger.debug("failed to parse supported option", logField("option", scyllaShard), logField("value", s), logError(err))
 		}
 	}
 	if s, ok := supported[scyllaNrShards]; ok {
 		if si.nrShards, err = strconv.Atoi(s[0]); err != nil {
-			if gocqlDebug {
-				logger.Printf("scylla: failed to parse %s value %v: %s", scyllaNrShards, s, err)
-			}
+			logger.debug("failed to parse supported option", logField("option", scyllaNrShards), logField("value", s), logError(err))
 		}
 	}
 	if s, ok := supported[scyllaShardingIgnoreMSB]; ok {
 		if si.msbIgnore, err = strconv.ParseUint(s[0], 10, 64); err != nil {
-			if gocqlDebug {
-				logger.Printf("scylla: failed to parse %s value %v: %s", scyllaShardingIgnoreMSB, s, err)
-			}
+			logger.debug("failed to parse supported option", logField("option", scyllaShardingIgnoreMSB), logField("value", s), logError(err))
 		}
 	}
 
@@ -232,35 +226,29 @@ func parseSupported(supported map[string][]string, logger StdLogger) scyllaSuppo
 	}
 	if s, ok := supported[scyllaShardAwarePort]; ok {
 		if shardAwarePort, err := strconv.ParseUint(s[0], 10, 16); err != nil {
-			if gocqlDebug {
-				logger.Printf("scylla: failed to parse %s value %v: %s", scyllaShardAwarePort, s, err)
-			}
+			logger.debug("failed to parse supported option", logField("option", scyllaShardAwarePort), logField("value", s), logError(err))
 		} else {
 			si.shardAwarePort = uint16(shardAwarePort)
 		}
 	}
 	if s, ok := supported[scyllaShardAwarePortSSL]; ok {
 		if shardAwarePortSSL, err := strconv.ParseUint(s[0], 10, 16); err != nil {
-			if gocqlDebug {
-				logger.Printf("scylla: failed to parse %s value %v: %s", scyllaShardAwarePortSSL, s, err)
-			}
+			logger.debug("failed to parse supported option", logField("option", scyllaShardAwarePortSSL), logField("value", s), logError(err))
 		} else {
 			si.shardAwarePortSSL = uint16(shardAwarePortSSL)
 		}
 	}
 
 	if si.partitioner != "org.apache.cassandra.dht.Murmur3Partitioner" || si.shardingAlgorithm != "biased-token-round-robin" || si.nrShards == 0 || si.msbIgnore == 0 {
-		if gocqlDebug {
-			logger.Printf("scylla: unsupported sharding configuration, partitioner=%s, algorithm=%s, no_shards=%d, msb_ignore=%d",
-				si.partitioner, si.shardingAlgorithm, si.nrShards, si.msbIgnore)
-		}
+		logger.debug("unsupported sharding configuration", logField("partitioner", si.partitioner),
+			logField("algorithm", si.shardingAlgorithm), logField("nr_shards", si.nrShards), logField("msb_ignore", si.msbIgnore))
 		return scyllaSupported{}
 	}
 
 	return si
 }
 
-func parseCQLProtocolExtensions(supported map[string][]string, logger StdLogger) []cqlProtocolExtension {
+func parseCQLProtocolExtensions(supported map[string][]string, logger *driverLogger) []cqlProtocolExtension {
 	exts := []cqlProtocolExtension{}
 
 	lwtExt := newLwtAddMetaMarkExt(supported, logger)
@@ -310,13 +298,13 @@ type scyllaConnPicker struct {
 	pos                    uint64
 	lastAttemptedShard     int
 	shardAwarePortDisabled bool
-	logger                 StdLogger
+	logger                 *driverLogger
 
 	// Used to disable new connections to the shard-aware port temporarily
 	disableShardAwarePortUntil *atomic.Value
 }
 
-func newScyllaConnPicker(conn *Conn, logger StdLogger) *scyllaConnPicker {
+func newScyllaConnPicker(conn *Conn, logger *driverLogger) *scyllaConnPicker {
 	addr := conn.Address()
 	hostId := conn.host.hostId
 
@@ -324,9 +312,7 @@ func newScyllaConnPicker(conn *Conn, logger StdLogger) *scyllaConnPicker {
 		panic(fmt.Sprintf("scylla: %s not a sharded connection", addr))
 	}
 
-	if gocqlDebug {
-		logger.Printf("scylla: %s new conn picker sharding options %+v", addr, conn.scyllaSupported)
-	}
+	logger.debug("new conn picker", logAddr(addr), logHostID(conn.host), logField("sharding", conn.scyllaSupported))
 
 	var shardAwarePort uint16
 	if conn.session.connCfg.tlsConfig != nil {
@@ -478,11 +464,12 @@ func (p *scyllaConnPicker) Put(conn *Conn) {
 			// changes the source port along the way, therefore we can't trust
 			// the shard-aware port to return connection to the shard
 			// that we requested. Fall back to non-shard-aware port for some time.
-			p.logger.Printf(
-				"scylla: %s connection to shard-aware address %s resulted in wrong shard being assigned; please check that you are not behind a NAT or AddressTranslater which changes source ports; falling back to non-shard-aware port for %v",
-				p.address,
-				p.shardAwareAddress,
-				scyllaShardAwarePortFallbackDuration,
+			p.logger.warn(
+				"connection to shard-aware address resulted in wrong shard being assigned; please check that you are not behind a NAT or AddressTranslater which changes source ports; falling back to non-shard-aware port",
+				logAddr(p.address),
+				logField("shard_aware_address", p.shardAwareAddress),
+				logShard(shard),
+				logField("fallback", scyllaShardAwarePortFallbackDuration),
 			)
 			until := time.Now().Add(scyllaShardAwarePortFallbackDuration)
 			p.disableShardAwarePortUntil.Store(until)
@@ -493,16 +480,14 @@ func (p *scyllaConnPicker) Put(conn *Conn) {
 			closeConns(conn)
 		} else {
 			p.excessConns = append(p.excessConns, conn)
-			if gocqlDebug {
-				p.logger.Printf("scylla: %s put shard %d excess connection total: %d missing: %d excess: %d", p.address, shard, p.nrConns, p.nrShards-p.nrConns, len(p.excessConns))
-			}
+			p.logger.debug("put excess connection", logAddr(p.address), logShard(shard),
+				logField("total", p.nrConns), logField("missing", p.nrShards-p.nrConns), logField("excess", len(p.excessConns)))
 		}
 	} else {
 		p.conns[shard] = conn
 		p.nrConns++
-		if gocqlDebug {
-			p.logger.Printf("scylla: %s put shard %d connection total: %d missing: %d", p.address, shard, p.nrConns, p.nrShards-p.nrConns)
-		}
+		p.logger.debug("put connection", logAddr(p.address), logShard(shard),
+			logField("total", p.nrConns), logField("missing", p.nrShards-p.nrConns))
 	}
 
 	if p.shouldCloseExcessConns() {
@@ -525,14 +510,10 @@ func (p *scyllaConnPicker) Remove(conn *Conn) {
 	if conn.scyllaSupported.nrShards == 0 {
 		// It is possible for Remove to be called before the connection is added to the pool.
 		// Ignoring these connections here is safe.
-		if gocqlDebug {
-			p.logger.Printf("scylla: %s has unknown sharding state, ignoring it", p.address)
-		}
+		p.logger.debug("unknown sharding state, ignoring connection", logAddr(p.address))
 		return
 	}
-	if gocqlDebug {
-		p.logger.Printf("scylla: %s remove shard %d connection", p.address, shard)
-	}
+	p.logger.debug("remove connection", logAddr(p.address), logShard(shard))
 
 	if p.conns[shard] != nil {
 		p.conns[shard] = nil
@@ -561,9 +542,7 @@ func (p *scyllaConnPicker) Close() {
 
 func (p *scyllaConnPicker) closeConns() {
 	if len(p.conns) == 0 {
-		if gocqlDebug {
-			p.logger.Printf("scylla: %s no connections to close", p.address)
-		}
+		p.logger.debug("no connections to close", logAddr(p.address))
 		return
 	}
 
@@ -571,26 +550,20 @@ func (p *scyllaConnPicker) closeConns() {
 	p.conns = nil
 	p.nrConns = 0
 
-	if gocqlDebug {
-		p.logger.Printf("scylla: %s closing %d connections", p.address, len(conns))
-	}
+	p.logger.debug("closing connections", logAddr(p.address), logField("count", len(conns)))
 	go closeConns(conns...)
 }
 
 func (p *scyllaConnPicker) closeExcessConns() {
 	if len(p.excessConns) == 0 {
-		if gocqlDebug {
-			p.logger.Printf("scylla: %s no excess connections to close", p.address)
-		}
+		p.logger.debug("no excess connections to close", logAddr(p.address))
 		return
 	}
 
 	conns := p.excessConns
 	p.excessConns = nil
 
-	if gocqlDebug {
-		p.logger.Printf("scylla: %s closing %d excess connections", p.address, len(conns))
-	}
+	p.logger.debug("closing excess connections", logAddr(p.address), logField("count", len(conns)))
 	go closeConns(conns...)
 }
 
@@ -651,7 +624,7 @@ type ShardDialer interface {
 // A dialer which dials a particular shard
 type scyllaDialer struct {
 	dialer    Dialer
-	logger    StdLogger
+	logger    *driverLogger
 	tlsConfig *tls.Config
 	cfg       *ClusterConfig
 }
@@ -702,9 +675,7 @@ func (sd *scyllaDialer) DialShard(ctx context.Context, host *HostInfo, shardID,
 		shardAwareAddress = net.JoinHostPort(tIP.String(), strconv.Itoa(tPort))
 	}
 
-	if gocqlDebug {
-		sd.logger.Printf("scylla: connecting to shard %d", shardID)
-	}
+	sd.logger.debug("connecting to shard", logHost(host), logHostID(host), logShard(shardID))
 
 	conn, err := sd.dialShardAware(ctx, addr, shardAwareAddress, iter)
 	if err != nil {
@@ -737,15 +708,13 @@ func (sd *scyllaDialer) dialShardAware(ctx context.Context, addr, shardAwareAddr
 				// indicate that the shard-aware port is just not reachable,
 				// but we may also be unlucky and the node became reachable
 				// just after we tried the first connection.
-				// We can't avoid false positives here, so I'm putting it
-				// behind a debug flag.
-				if gocqlDebug {
-					sd.logger.Printf(
-						"scylla: %s couldn't connect to shard-aware address while the non-shard-aware address %s is available; this might be an issue with ",
-						addr,
-						shardAwareAddr,
-					)
-				}
+				// We can't avoid false positives here, so I'm logging it
+				// at the debug level.
+				sd.logger.debug(
+					"couldn't connect to shard-aware address while the non-shard-aware address is available",
+					logAddr(addr),
+					logField("shard_aware_address", shardAwareAddr),
+				)
 			}
 			return conn, err
 		}
@@ -0,0 +1,345 @@
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+)
+
+// Protocol v5 wraps envelopes (the v4 style frames) into segments. Each segment
+// carries a header protected by a CRC24 checksum and a payload protected by a
+// CRC32 checksum. A segment is either self-contained, in which case it holds
+// one or more complete envelopes, or it is a part of a single envelope which
+// is too large to fit into one segment.
+//
+// See section 2 of native_protocol_v5.spec for details.
+
+const (
+	maxSegmentPayloadSize = 128*1024 - 1
+
+	compressedSegmentHeaderSize = 8
+	segmentCRC24Size            = 3
+	segmentCRC32Size            = 4
+
+	segmentCRC24Init = 0x875060
+	segmentCRC24Poly = 0x1974F0B
+)
+
+// segmentCRC32Initial is fed into the CRC32 before the payload as mandated
+// by the protocol specification.
+var segmentCRC32Initial = []byte{0xFA, 0x2D, 0x55, 0xCA}
+
+// ErrSegmentCorrupted is returned when a protocol v5 segment fails the header
+// or payload checksum verification. The connection that received the segment
+// is closed as the stream can not be recovered.
+type ErrSegmentCorrupted struct {
+	// Header is true if the header checksum did not match, false if it was the payload.
+	Header   bool
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ErrSegmentCorrupted) Error() string {
+	part := "payload"
+	if e.Header {
+		part = "header"
+	}
+	return fmt.Sprintf("gocql: corrupted segment %s: checksum mismatch, expected 0x%x got 0x%x", part, e.Expected, e.Actual)
+}
+
+func segmentCRC24(data uint64, length int) uint32 {
+	crc := uint32(segmentCRC24Init)
+	for ; length > 0; length-- {
+		crc ^= uint32(data&0xff) << 16
+		data >>= 8
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= segmentCRC24Poly
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+func segmentCRC32(payload []byte) uint32 {
+	crc := crc32.Update(0, crc32.IEEETable, segmentCRC32Initial)
+	return crc32.Update(crc, crc32.IEEETable, payload)
+}
+
+func putUintLE(p []byte, v uint64, n int) {
+	for i := 0; i < n; i++ {
+		p[i] = byte(v >> (8 * i))
+	}
+}
+
+func readUintLE(p []byte, n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v |= uint64(p[i]) << (8 * i)
+	}
+	return v
+}
+
+// segmentCodec encodes envelopes into segments and decodes them back. If the
+// compressor is nil the segments are sent uncompressed.
+type segmentCodec struct {
+	compressor BlockCompressor
+}
+
+// appendSegments wraps the envelope bytes in p into one self-contained segment
+// if it fits or into multiple segments otherwise and appends them to dst.
+func (s *segmentCodec) appendSegments(dst, p []byte) ([]byte, error) {
+	if len(p) <= maxSegmentPayloadSize {
+		return s.appendSegment(dst, p, true)
+	}
+
+	var err error
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxSegmentPayloadSize {
+			n = maxSegmentPayloadSize
+		}
+		if dst, err = s.appendSegment(dst, p[:n], false); err != nil {
+			return nil, err
+		}
+		p = p[n:]
+	}
+	return dst, nil
+}
+
+func (s *segmentCodec) appendSegment(dst, payload []byte, selfContained bool) ([]byte, error) {
+	var header uint64
+	headerLen := 3
+	if s.compressor != nil {
+		headerLen = 5
+		compressed, err := s.compressor.EncodeBlock(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(payload) {
+			header = uint64(len(compressed)) | uint64(len(payload))<<17
+			payload = compressed
+		} else {
+			// uncompressed length of zero signals that the payload was not compressed
+			header = uint64(len(payload))
+		}
+		if selfContained {
+			header |= 1 << 34
+		}
+	} else {
+		header = uint64(len(payload))
+		if selfContained {
+			header |= 1 << 17
+		}
+	}
+
+	var head [compressedSegmentHeaderSize]byte
+	putUintLE(head[:], header, headerLen)
+	putUintLE(head[headerLen:], uint64(segmentCRC24(header, headerLen)), segmentCRC24Size)
+	dst = append(dst, head[:headerLen+segmentCRC24Size]...)
+	dst = append(dst, payload...)
+
+	var crc [segmentCRC32Size]byte
+	putUintLE(crc[:], uint64(segmentCRC32(payload)), segmentCRC32Size)
+	return append(dst, crc[:]...), nil
+}
+
+// readSegment reads a single segment from r and returns its decompressed payload.
+// buf is used to hold the raw segment payload and is grown as needed.
+func (s *segmentCodec) readSegment(r io.Reader, buf *[]byte) (payload []byte, selfContained bool, err error) {
+	var head [compressedSegmentHeaderSize]byte
+	if _, err = io.ReadFull(r, head[:s.headerSize()]); err != nil {
+		return nil, false, err
+	}
+
+	length, uncompressedLength, selfContained, err := s.parseHeader(head[:s.headerSize()])
+	if err != nil {
+		return nil, false, err
+	}
+
+	raw := growSegmentBuffer(buf, length)
+	if _, err = io.ReadFull(r, raw); err != nil {
+		return nil, false, err
+	}
+
+	payload, err = s.decodePayload(raw, uncompressedLength)
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, selfContained, nil
+}
+
+// headerSize returns the size of the header of a segment, including its CRC24.
+func (s *segmentCodec) headerSize() int {
+	if s.compressor != nil {
+		return compressedSegmentHeaderSize
+	}
+	return 3 + segmentCRC24Size
+}
+
+// parseHeader checks the header of a segment and returns the length of its
+// payload, the uncompressed length of the payload if it is compressed and
+// whether the segment is self-contained.
+func (s *segmentCodec) parseHeader(head []byte) (length, uncompressedLength int, selfContained bool, err error) {
+	headerLen := len(head) - segmentCRC24Size
+	header := readUintLE(head, headerLen)
+	expected := uint32(readUintLE(head[headerLen:], segmentCRC24Size))
+	if actual := segmentCRC24(header, headerLen); actual != expected {
+		return 0, 0, false, &ErrSegmentCorrupted{Header: true, Expected: expected, Actual: actual}
+	}
+
+	if s.compressor != nil {
+		length = int(header & 0x1FFFF)
+		uncompressedLength = int((header >> 17) & 0x1FFFF)
+		selfContained = header&(1<<34) != 0
+	} else {
+		length = int(header & 0x1FFFF)
+		selfContained = header&(1<<17) != 0
+	}
+	return length, uncompressedLength, selfContained, nil
+}
+
+// decodePayload checks the raw payload of a segment, followed by its CRC32,
+// and returns it decompressed.
+func (s *segmentCodec) decodePayload(raw []byte, uncompressedLength int) ([]byte, error) {
+	length := len(raw) - segmentCRC32Size
+	payload := raw[:length]
+	expected := uint32(readUintLE(raw[length:], segmentCRC32Size))
+	if actual := segmentCRC32(payload); actual != expected {
+		return nil, &ErrSegmentCorrupted{Expected: expected, Actual: actual}
+	}
+
+	if uncompressedLength > 0 {
+		return s.compressor.DecodeBlock(payload, uncompressedLength)
+	}
+	return payload, nil
+}
+
+// growSegmentBuffer returns the part of buf holding a payload of length bytes
+// and its CRC32, growing buf as needed.
+func growSegmentBuffer(buf *[]byte, length int) []byte {
+	if cap(*buf) < length+segmentCRC32Size {
+		*buf = make([]byte, length+segmentCRC32Size)
+	}
+	return (*buf)[:length+segmentCRC32Size]
+}
+
+// segmentReader presents the envelopes carried in segments read from r as a
+// plain stream of bytes, so that envelopes can be read with readHeader and
+// framer.readFrame just like with protocol v4 and earlier.
+type segmentReader struct {
+	r     io.Reader
+	codec segmentCodec
+
+	// the segment being read: its header is read into head, then its raw
+	// payload into raw. They are kept when a temporary error interrupts the
+	// read, so that the segment is resumed when Conn.Read retries.
+	head               [compressedSegmentHeaderSize]byte
+	headRead           int
+	raw                []byte
+	rawRead            int
+	uncompressedLength int
+
+	buf     []byte
+	payload []byte
+
+	// err is sticky, once a segment could not be read the stream is out of sync.
+	err error
+}
+
+func newSegmentReader(r io.Reader, compressor BlockCompressor) *segmentReader {
+	return &segmentReader{
+		r:     r,
+		codec: segmentCodec{compressor: compressor},
+	}
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	for len(s.payload) == 0 {
+		payload, err := s.readSegment()
+		if err != nil {
+			if nerr, ok := err.(net.Error); !ok || !nerr.Temporary() {
+				s.err = err
+			}
+			return 0, err
+		}
+		s.payload = payload
+	}
+
+	n := copy(p, s.payload)
+	s.payload = s.payload[n:]
+	return n, nil
+}
+
+// readSegment reads the rest of the segment being read and returns its
+// decompressed payload.
+func (s *segmentReader) readSegment() ([]byte, error) {
+	if s.raw == nil {
+		head := s.head[:s.codec.headerSize()]
+		n, err := io.ReadFull(s.r, head[s.headRead:])
+		s.headRead += n
+		if err != nil {
+			return nil, err
+		}
+
+		length, uncompressedLength, _, err := s.codec.parseHeader(head)
+		if err != nil {
+			return nil, err
+		}
+		s.raw = growSegmentBuffer(&s.buf, length)
+		s.uncompressedLength = uncompressedLength
+	}
+
+	n, err := io.ReadFull(s.r, s.raw[s.rawRead:])
+	s.rawRead += n
+	if err != nil {
+		return nil, err
+	}
+
+	raw := s.raw
+	s.headRead, s.raw, s.rawRead = 0, nil, 0
+	return s.codec.decodePayload(raw, s.uncompressedLength)
+}
+
+// segmentWriter wraps every write into segments before passing it to the
+// underlying contextWriter. Each write is expected to be one whole envelope.
+type segmentWriter struct {
+	w     contextWriter
+	codec segmentCodec
+}
+
+func newSegmentWriter(w contextWriter, compressor BlockCompressor) *segmentWriter {
+	return &segmentWriter{
+		w:     w,
+		codec: segmentCodec{compressor: compressor},
+	}
+}
+
+// writeContext implements contextWriter.
+func (s *segmentWriter) writeContext(ctx context.Context, p []byte) (int, error) {
+	buf, err := s.codec.appendSegments(nil, p)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := s.w.writeContext(ctx, buf)
+	switch {
+	case n == 0:
+		return 0, err
+	case n < len(buf):
+		// segment overhead makes it impossible to tell exactly how much of p
+		// was written, but callers only need to know it was not all of it.
+		if n >= len(p) {
+			n = len(p) - 1
+		}
+		return n, err
+	}
+	return len(p), err
+}
@@ -0,0 +1,228 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+)
+
+type testBlockCompressor struct{}
+
+func (testBlockCompressor) EncodeBlock(data []byte) ([]byte, error) {
+	return s2.Encode(nil, data), nil
+}
+
+func (testBlockCompressor) DecodeBlock(data []byte, uncompressedLength int) ([]byte, error) {
+	return s2.Decode(make([]byte, uncompressedLength), data)
+}
+
+type bufferContextWriter struct {
+	bytes.Buffer
+}
+
+func (b *bufferContextWriter) writeContext(_ context.Context, p []byte) (int, error) {
+	return b.Write(p)
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	compressible := bytes.Repeat([]byte("gocql"), 100)
+	random := make([]byte, 3*maxSegmentPayloadSize+17)
+	for i := range random {
+		random[i] = byte(i * 7 % 251)
+	}
+
+	tests := []struct {
+		name       string
+		compressor BlockCompressor
+		envelopes  [][]byte
+	}{
+		{"small", nil, [][]byte{[]byte("hello"), []byte("world")}},
+		{"multi_segment", nil, [][]byte{random, []byte("tail")}},
+		{"exact_max", nil, [][]byte{random[:maxSegmentPayloadSize]}},
+		{"compressed", testBlockCompressor{}, [][]byte{compressible, []byte("x")}},
+		{"compressed_multi_segment", testBlockCompressor{}, [][]byte{random, compressible}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bufferContextWriter
+			w := newSegmentWriter(&out, test.compressor)
+			var expected []byte
+			for _, env := range test.envelopes {
+				n, err := w.writeContext(context.Background(), env)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != len(env) {
+					t.Fatalf("expected to write %d bytes got %d", len(env), n)
+				}
+				expected = append(expected, env...)
+			}
+
+			got, err := io.ReadAll(io.LimitReader(newSegmentReader(&out, test.compressor), int64(len(expected))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, got) {
+				t.Fatalf("read %d bytes which do not match the %d written", len(got), len(expected))
+			}
+		})
+	}
+}
+
+func TestSegmentSelfContained(t *testing.T) {
+	t.Parallel()
+
+	codec := segmentCodec{}
+	buf, err := codec.appendSegments(nil, make([]byte, maxSegmentPayloadSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf)
+	var scratch []byte
+	for i, expected := range []int{maxSegmentPayloadSize, 1} {
+		payload, selfContained, err := codec.readSegment(r, &scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selfContained {
+			t.Errorf("segment %d of a large envelope should not be self-contained", i)
+		}
+		if len(payload) != expected {
+			t.Errorf("segment %d: expected payload of %d bytes got %d", i, expected, len(payload))
+		}
+	}
+
+	buf, err = codec.appendSegments(nil, []byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, selfContained, err := codec.readSegment(bytes.NewReader(buf), &scratch); err != nil {
+		t.Fatal(err)
+	} else if !selfContained {
+		t.Error("small envelope should be sent in a self-contained segment")
+	}
+}
+
+func TestSegmentCorrupted(t *testing.T) {
+	t.Parallel()
+
+	for _, compressor := range []BlockCompressor{nil, testBlockCompressor{}} {
+		codec := segmentCodec{compressor: compressor}
+		headerLen := 6
+		if compressor != nil {
+			headerLen = compressedSegmentHeaderSize
+		}
+
+		tests := []struct {
+			name   string
+			offset int
+			header bool
+		}{
+			{"header", 1, true},
+			{"header_crc", headerLen - 1, true},
+			{"payload", headerLen + 1, false},
+		}
+
+		for _, test := range tests {
+			buf, err := codec.appendSegments(nil, []byte("some envelope"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf[test.offset] ^= 0x40
+
+			_, err = io.ReadAll(newSegmentReader(bytes.NewReader(buf), compressor))
+			var segErr *ErrSegmentCorrupted
+			if !errors.As(err, &segErr) {
+				t.Fatalf("%s: expected ErrSegmentCorrupted got %v", test.name, err)
+			}
+			if segErr.Header != test.header {
+				t.Errorf("%s: expected header=%v got %v", test.name, test.header, segErr.Header)
+			}
+		}
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary error" }
+func (temporaryError) Timeout() bool   { return true }
+func (temporaryError) Temporary() bool { return true }
+
+// interruptedReader returns a temporary error before each of the reads at
+// the offsets in interrupts.
+type interruptedReader struct {
+	r          io.Reader
+	read       int
+	interrupts []int
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if len(r.interrupts) > 0 {
+		if r.interrupts[0] == r.read {
+			r.interrupts = r.interrupts[1:]
+			return 0, temporaryError{}
+		}
+		if max := r.interrupts[0] - r.read; len(p) > max {
+			p = p[:max]
+		}
+	}
+	n, err := r.r.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestSegmentReaderTemporaryError(t *testing.T) {
+	t.Parallel()
+
+	for _, compressor := range []BlockCompressor{nil, testBlockCompressor{}} {
+		codec := segmentCodec{compressor: compressor}
+		expected := bytes.Repeat([]byte("envelope"), 10)
+		buf, err := codec.appendSegments(nil, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := codec.appendSegments(nil, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = append(buf, second...)
+
+		// interrupt the reads in the headers and the payloads of the segments
+		r := newSegmentReader(&interruptedReader{
+			r:          bytes.NewReader(buf),
+			interrupts: []int{2, codec.headerSize() + 5, len(buf) - len(second) + 1, len(buf) - 2},
+		}, compressor)
+
+		var got []byte
+		p := make([]byte, 16)
+		for i := 0; len(got) < 2*len(expected); i++ {
+			if i == 100 {
+				t.Fatalf("the reads didn't resume after the temporary errors, read %q", got)
+			}
+			n, err := r.Read(p)
+			got = append(got, p[:n]...)
+			if err != nil {
+				if _, ok := err.(temporaryError); !ok {
+					t.Fatalf("unexpected error %v", err)
+				}
+			}
+		}
+		if !bytes.Equal(got, append(expected, expected...)) {
+			t.Errorf("expected %q got %q", append(expected, expected...), got)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package gocql
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ServerWarningType is the type of a warning sent by the server with a response.
+type ServerWarningType int
+
+const (
+	// UnknownWarning is a warning which is not parsed by ParseServerWarning.
+	UnknownWarning ServerWarningType = iota
+	// BatchSizeExceededWarning is sent for batches whose size is over batch_size_warn_threshold.
+	BatchSizeExceededWarning
+	// TombstoneThresholdWarning is sent for reads which scanned more tombstones than tombstone_warn_threshold.
+	TombstoneThresholdWarning
+	// AggregationWithoutPartitionKeyWarning is sent for aggregation queries not restricted to a partition.
+	AggregationWithoutPartitionKeyWarning
+	// LargePartitionWarning is sent for writes to partitions over the partition size threshold.
+	LargePartitionWarning
+	// UnloggedBatchAcrossPartitionsWarning is sent for unlogged batches modifying several partitions.
+	UnloggedBatchAcrossPartitionsWarning
+)
+
+func (t ServerWarningType) String() string {
+	switch t {
+	case UnknownWarning:
+		return "unknown"
+	case BatchSizeExceededWarning:
+		return "batch_size_exceeded"
+	case TombstoneThresholdWarning:
+		return "tombstone_threshold"
+	case AggregationWithoutPartitionKeyWarning:
+		return "aggregation_without_partition_key"
+	case LargePartitionWarning:
+		return "large_partition"
+	case UnloggedBatchAcrossPartitionsWarning:
+		return "unlogged_batch_across_partitions"
+	default:
+		return "ServerWarningType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// ServerWarning is a warning sent by the server, parsed by ParseServerWarning.
+// Only the fields known for its type are set.
+type ServerWarning struct {
+	Type ServerWarningType
+
+	// Message is the warning as sent by the server.
+	Message string
+
+	// Statement is the statement of the query the warning was sent for, or
+	// the statements of the batch separated by semicolons.
+	Statement string
+
+	// Tables are the tables the warning is about, qualified with their keyspace.
+	Tables []string
+
+	// Size is the size in bytes of a batch or of a partition, and Threshold
+	// the threshold it exceeds.
+	Size      int64
+	Threshold int64
+
+	// LiveRows and Tombstones are the numbers of live rows and of tombstones
+	// read by a query.
+	LiveRows   int64
+	Tombstones int64
+
+	// Partitions is the number of partitions modified by a batch.
+	Partitions int64
+
+	// PartitionKey is the key of a large partition.
+	PartitionKey string
+}
+
+// Table returns the first table the warning is about, or an empty string.
+func (w ServerWarning) Table() string {
+	if len(w.Tables) == 0 {
+		return ""
+	}
+	return w.Tables[0]
+}
+
+const sizePattern = `(\d+(?:\.\d+)?)\s*(bytes|B|KiB|MiB|GiB)?`
+
+var (
+	// Cassandra: Batch for [ks.t] is of size 5.123KiB, exceeding specified threshold of 5.000KiB by 0.123KiB.
+	cassandraBatchSizeWarning = regexp.MustCompile(`^Batch for \[(.*?)\] is of size ` + sizePattern + `, exceeding specified threshold of ` + sizePattern)
+	// Scylla: Batch modifying 2 partitions in ks.t is of size 6150 bytes, exceeding specified WARN threshold of 5120 by 1030.
+	scyllaBatchSizeWarning = regexp.MustCompile(`^Batch modifying (\d+) partitions? in (.*?) is of size ` + sizePattern + `, exceeding specified \w+ threshold of ` + sizePattern)
+	// Read 0 live rows and 1001 tombstone cells for query SELECT * FROM ks.t LIMIT 100 (see tombstone_warn_threshold)
+	tombstoneWarning = regexp.MustCompile(`^Read (\d+) live rows? and (\d+) tombstone cells? for query (.*?)(?:; token -?\d+)?\s*\(see tombstone_warn_threshold\)`)
+	// Guardrail partition_size violated: Partition ks.t:key has size 2.5MiB, this exceeds the warning threshold of 1MiB.
+	guardrailPartitionWarning = regexp.MustCompile(`^Guardrail partition_size violated: Partition ([^\s:]+):(.*) has size ` + sizePattern + `, this exceeds the \w+ threshold of ` + sizePattern)
+	// Writing large partition ks/t:key (123.456MiB)
+	largePartitionWarning = regexp.MustCompile(`^Writing large partition ([^\s/]+)/([^\s:]+):(.*) \(` + sizePattern + `\)`)
+	// Unlogged batch covering 12 partitions detected against table [ks.t]. You should use a logged batch ...
+	unloggedBatchWarning = regexp.MustCompile(`^Unlogged batch covering (\d+) partitions? detected against tables? \[(.*?)\]`)
+	// SELECT ... FROM ks.t ...
+	fromTable = regexp.MustCompile(`(?i)\bFROM\s+("?[\w]+"?(?:\."?[\w]+"?)?)`)
+)
+
+// ParseServerWarning parses a warning sent by the server. Warnings of unknown
+// format are returned with the UnknownWarning type.
+func ParseServerWarning(msg string) ServerWarning {
+	w := ServerWarning{Type: UnknownWarning, Message: msg}
+
+	if m := cassandraBatchSizeWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = BatchSizeExceededWarning
+		w.Tables = splitTables(m[1])
+		w.Size = parseSize(m[2], m[3])
+		w.Threshold = parseSize(m[4], m[5])
+	} else if m := scyllaBatchSizeWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = BatchSizeExceededWarning
+		w.Partitions, _ = strconv.ParseInt(m[1], 10, 64)
+		w.Tables = splitTables(m[2])
+		w.Size = parseSize(m[3], m[4])
+		w.Threshold = parseSize(m[5], m[6])
+	} else if m := tombstoneWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = TombstoneThresholdWarning
+		w.LiveRows, _ = strconv.ParseInt(m[1], 10, 64)
+		w.Tombstones, _ = strconv.ParseInt(m[2], 10, 64)
+		if t := fromTable.FindStringSubmatch(m[3]); t != nil {
+			w.Tables = []string{strings.Replace(t[1], `"`, "", -1)}
+		}
+	} else if strings.HasPrefix(msg, "Aggregation query used without partition key") {
+		w.Type = AggregationWithoutPartitionKeyWarning
+	} else if m := guardrailPartitionWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = LargePartitionWarning
+		w.Tables = []string{m[1]}
+		w.PartitionKey = m[2]
+		w.Size = parseSize(m[3], m[4])
+		w.Threshold = parseSize(m[5], m[6])
+	} else if m := largePartitionWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = LargePartitionWarning
+		w.Tables = []string{m[1] + "." + m[2]}
+		w.PartitionKey = m[3]
+		w.Size = parseSize(m[4], m[5])
+	} else if m := unloggedBatchWarning.FindStringSubmatch(msg); m != nil {
+		w.Type = UnloggedBatchAcrossPartitionsWarning
+		w.Partitions, _ = strconv.ParseInt(m[1], 10, 64)
+		w.Tables = splitTables(m[2])
+	}
+
+	return w
+}
+
+// ParseServerWarnings parses the warnings sent by the server for qry, the
+// statement of qry is set on the returned warnings and the tables not
+// qualified with their keyspace are qualified with the keyspace of qry.
+func ParseServerWarnings(qry ExecutableQuery, warnings []string) []ServerWarning {
+	stmt := executableStatement(qry)
+	parsed := make([]ServerWarning, len(warnings))
+	for i, msg := range warnings {
+		parsed[i] = ParseServerWarning(msg)
+		parsed[i].Statement = stmt
+		for j, table := range parsed[i].Tables {
+			if !strings.Contains(table, ".") && qry != nil {
+				if keyspace := qry.Keyspace(); keyspace != "" {
+					parsed[i].Tables[j] = keyspace + "." + table
+				}
+			}
+		}
+	}
+	return parsed
+}
+
+func executableStatement(qry ExecutableQuery) string {
+	switch q := qry.(type) {
+	case *Query:
+		return q.stmt
+	case *Batch:
+		stmts := make([]string, len(q.Entries))
+		for i, entry := range q.Entries {
+			stmts[i] = entry.Stmt
+		}
+		return strings.Join(stmts, "; ")
+	}
+	return ""
+}
+
+func splitTables(s string) []string {
+	var tables []string
+	for _, table := range strings.Split(s, ",") {
+		if table = strings.TrimSpace(table); table != "" {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// parseSize returns the number of bytes of a size printed by the server.
+func parseSize(value, unit string) int64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "KiB":
+		f *= 1 << 10
+	case "MiB":
+		f *= 1 << 20
+	case "GiB":
+		f *= 1 << 30
+	}
+	return int64(f)
+}
@@ -0,0 +1,183 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseServerWarning(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		msg      string
+		expected ServerWarning
+	}{
+		{
+			msg: "Batch for [ks.t] is of size 6.006KiB, exceeding specified threshold of 5.000KiB by 1.006KiB.",
+			expected: ServerWarning{
+				Type:      BatchSizeExceededWarning,
+				Tables:    []string{"ks.t"},
+				Size:      6150,
+				Threshold: 5120,
+			},
+		},
+		{
+			msg: "Batch for [ks.t1, ks.t2] is of size 6150, exceeding specified threshold of 5120 by 1030.",
+			expected: ServerWarning{
+				Type:      BatchSizeExceededWarning,
+				Tables:    []string{"ks.t1", "ks.t2"},
+				Size:      6150,
+				Threshold: 5120,
+			},
+		},
+		{
+			msg: "Batch modifying 2 partitions in ks.t is of size 6150 bytes, exceeding specified WARN threshold of 5120 by 1030.",
+			expected: ServerWarning{
+				Type:       BatchSizeExceededWarning,
+				Tables:     []string{"ks.t"},
+				Size:       6150,
+				Threshold:  5120,
+				Partitions: 2,
+			},
+		},
+		{
+			msg: "Read 2 live rows and 1001 tombstone cells for query SELECT * FROM ks.events WHERE id = 1 LIMIT 100 (see tombstone_warn_threshold)",
+			expected: ServerWarning{
+				Type:       TombstoneThresholdWarning,
+				Tables:     []string{"ks.events"},
+				LiveRows:   2,
+				Tombstones: 1001,
+			},
+		},
+		{
+			msg: `Read 0 live rows and 5000 tombstone cells for query SELECT v FROM "Ks"."T" LIMIT 5000; token 42 (see tombstone_warn_threshold)`,
+			expected: ServerWarning{
+				Type:       TombstoneThresholdWarning,
+				Tables:     []string{"Ks.T"},
+				Tombstones: 5000,
+			},
+		},
+		{
+			msg:      "Aggregation query used without partition key",
+			expected: ServerWarning{Type: AggregationWithoutPartitionKeyWarning},
+		},
+		{
+			msg: "Guardrail partition_size violated: Partition ks.t:42 has size 2MiB, this exceeds the warning threshold of 1MiB.",
+			expected: ServerWarning{
+				Type:         LargePartitionWarning,
+				Tables:       []string{"ks.t"},
+				PartitionKey: "42",
+				Size:         2 << 20,
+				Threshold:    1 << 20,
+			},
+		},
+		{
+			msg: "Writing large partition ks/t:key (1.500MiB)",
+			expected: ServerWarning{
+				Type:         LargePartitionWarning,
+				Tables:       []string{"ks.t"},
+				PartitionKey: "key",
+				Size:         3 << 19,
+			},
+		},
+		{
+			msg: "Unlogged batch covering 12 partitions detected against table [ks.t]. You should use a logged batch for atomicity, or asynchronous writes for performance.",
+			expected: ServerWarning{
+				Type:       UnloggedBatchAcrossPartitionsWarning,
+				Tables:     []string{"ks.t"},
+				Partitions: 12,
+			},
+		},
+		{
+			msg:      "Something else happened",
+			expected: ServerWarning{Type: UnknownWarning},
+		},
+	}
+
+	for _, test := range tests {
+		test.expected.Message = test.msg
+		if got := ParseServerWarning(test.msg); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q:\nexpected %+v\ngot      %+v", test.msg, test.expected, got)
+		}
+	}
+}
+
+func TestParseServerWarningsStatement(t *testing.T) {
+	t.Parallel()
+
+	batch := &Batch{Entries: []BatchEntry{{Stmt: "INSERT a"}, {Stmt: "INSERT b"}}}
+	warnings := ParseServerWarnings(batch, []string{"Aggregation query used without partition key"})
+	if len(warnings) != 1 || warnings[0].Statement != "INSERT a; INSERT b" {
+		t.Errorf("unexpected warnings %+v", warnings)
+	}
+
+	warnings = ParseServerWarnings(&Query{stmt: "SELECT count(*) FROM ks.t"}, []string{"Aggregation query used without partition key"})
+	if len(warnings) != 1 || warnings[0].Statement != "SELECT count(*) FROM ks.t" {
+		t.Errorf("unexpected warnings %+v", warnings)
+	}
+	// unqualified tables are in the keyspace of the query
+	warnings = ParseServerWarnings(&Query{stmt: "SELECT * FROM t", keyspace: "ks", routingInfo: &queryRoutingInfo{}}, []string{
+		"Read 0 live rows and 1001 tombstone cells for query SELECT * FROM t (see tombstone_warn_threshold)",
+		"Read 0 live rows and 1001 tombstone cells for query SELECT * FROM other.t (see tombstone_warn_threshold)",
+	})
+	if len(warnings) != 2 || warnings[0].Table() != "ks.t" || warnings[1].Table() != "other.t" {
+		t.Errorf("unexpected warnings %+v", warnings)
+	}
+}
+
+type recordingWarningHandler struct {
+	warnings []string
+}
+
+func (h *recordingWarningHandler) HandleWarnings(qry ExecutableQuery, host *HostInfo, warnings []string) {
+	h.warnings = append(h.warnings, warnings...)
+}
+
+func TestAggregatingWarningHandler(t *testing.T) {
+	t.Parallel()
+
+	// the sessions built share the counts but pass the warnings on to their
+	// own handlers
+	next, otherNext := &recordingWarningHandler{}, &recordingWarningHandler{}
+	h := NewAggregatingWarningHandler()
+	handler := h.Builder(func(*Session) WarningHandler { return next })(nil)
+	other := h.Builder(func(*Session) WarningHandler { return otherNext })(nil)
+	if handler := h.Builder(nil)(nil); handler != h {
+		t.Fatal("expected builder to return the aggregating handler without next handler")
+	}
+
+	qry := &Query{stmt: "SELECT * FROM t", keyspace: "ks", routingInfo: &queryRoutingInfo{}}
+	handler.HandleWarnings(qry, nil, []string{
+		"Read 0 live rows and 1001 tombstone cells for query SELECT * FROM t (see tombstone_warn_threshold)",
+		"Read 0 live rows and 3000 tombstone cells for query SELECT * FROM ks.t (see tombstone_warn_threshold)",
+	})
+	other.HandleWarnings(qry, nil, []string{
+		"Read 0 live rows and 2000 tombstone cells for query SELECT * FROM ks.u (see tombstone_warn_threshold)",
+		"Aggregation query used without partition key",
+	})
+
+	counts := h.Counts()
+	if len(counts) != 3 {
+		t.Fatalf("expected 3 counts got %+v", counts)
+	}
+	if c := counts[0]; c.Type != TombstoneThresholdWarning || c.Table != "ks.t" || c.Count != 2 || c.Max != 3000 {
+		t.Errorf("unexpected count %+v", c)
+	}
+	if c := counts[1]; c.Type != TombstoneThresholdWarning || c.Table != "ks.u" || c.Count != 1 || c.Last.Statement != qry.stmt {
+		t.Errorf("unexpected count %+v", c)
+	}
+	if c := counts[2]; c.Type != AggregationWithoutPartitionKeyWarning || c.Table != "" || c.Count != 1 {
+		t.Errorf("unexpected count %+v", c)
+	}
+	if len(next.warnings) != 2 || len(otherNext.warnings) != 2 {
+		t.Errorf("expected warnings to be passed on to the handler of their session, got %v and %v", next.warnings, otherNext.warnings)
+	}
+
+	h.Reset()
+	if counts := h.Counts(); len(counts) != 0 {
+		t.Errorf("expected no counts after reset got %+v", counts)
+	}
+}
@@ -73,6 +73,7 @@ type Session struct {
 	executor *queryExecutor
 	pool     *policyConnPool
 	policy   HostSelectionPolicy
+	metrics  *sessionMetrics
 
 	mu sync.RWMutex
 
@@ -103,12 +104,15 @@ type Session struct {
 	initErr       error
 	readyCh       chan struct{}
 
-	logger StdLogger
+	logger *driverLogger
 
 	tabletsRoutingV1 bool
 
 	usingTimeoutClause string
 	warningHandler     WarningHandler
+
+	schemaSubscribers   schemaChangeSubscribers
+	hostStateDispatcher *hostStateDispatcher
 }
 
 var queryPool = &sync.Pool{
@@ -184,12 +188,19 @@ func newSessionCommon(cfg ClusterConfig) (*Session, error) {
 	}
 	s.pool = cfg.PoolConfig.buildPool(s)
 
-	s.policy = cfg.PoolConfig.HostSelectionPolicy
+	s.policy = newProfilesHostPolicy(cfg.PoolConfig.HostSelectionPolicy, cfg.ExecutionProfiles)
 	s.policy.Init(s)
 
+	s.metrics = newSessionMetrics()
 	s.executor = &queryExecutor{
-		pool:   s.pool,
-		policy: cfg.PoolConfig.HostSelectionPolicy,
+		pool:      s.pool,
+		policy:    s.policy,
+		throttler: cfg.RequestThrottler,
+		metrics:   s.metrics,
+	}
+	if conviction, ok := cfg.ConvictionPolicy.(requestConvictionPolicy); ok {
+		conviction.init(s)
+		s.executor.conviction = conviction
 	}
 
 	s.queryObserver = cfg.QueryObserver
@@ -197,6 +208,7 @@ func newSessionCommon(cfg ClusterConfig) (*Session, error) {
 	s.connectObserver = cfg.ConnectObserver
 	s.frameObserver = cfg.FrameHeaderObserver
 	s.streamObserver = cfg.StreamObserver
+	s.hostStateDispatcher = newHostStateDispatcher(cfg.HostStateListener)
 
 	//Check the TLS Config before trying to connect to anything external
 	connCfg, err := connConfig(&s.cfg)
@@ -372,6 +384,7 @@ func (s *Session) init() error {
 		if s.cfg.filterHost(host) {
 			continue
 		}
+		s.hostStateDispatcher.dispatch(HostStateAdded, host)
 
 		atomic.AddInt64(&left, 1)
 		go func() {
@@ -401,9 +414,6 @@ func (s *Session) init() error {
 
 	// before waiting for them to connect, add them all to the policy so we can
 	// utilize efficiencies by calling AddHosts if the policy supports it
-	type bulkAddHosts interface {
-		AddHosts([]*HostInfo)
-	}
 	if v, ok := s.policy.(bulkAddHosts); ok {
 		v.AddHosts(hosts)
 	} else {
@@ -602,6 +612,8 @@ func (s *Session) Close() {
 		s.ringRefresher.Stop()
 	}
 
+	s.hostStateDispatcher.stop()
+
 	if s.cancel != nil {
 		s.cancel()
 	}
@@ -610,6 +622,10 @@ func (s *Session) Close() {
 		s.policy.Reset()
 	}
 
+	if s.executor != nil && s.executor.conviction != nil {
+		s.executor.conviction.release()
+	}
+
 	s.sessionStateMu.Lock()
 	s.isClosed = true
 	s.sessionStateMu.Unlock()
@@ -644,14 +660,37 @@ func (s *Session) WaitUntilReady() error {
 	return s.initErr
 }
 
-func (s *Session) executeQuery(qry *Query) (it *Iter) {
+// startQuery checks that qry can be executed and prepares its execution.
+// The returned function has to be called once the execution completes.
+func (s *Session) startQuery(qry *Query) (func(), error) {
 	// fail fast
 	if s.Closed() {
-		return &Iter{err: ErrSessionClosed}
+		return nil, ErrSessionClosed
 	}
 	if err := s.Ready(); err != nil {
+		return nil, err
+	}
+	if qry.profileErr != nil {
+		return nil, qry.profileErr
+	}
+
+	if qry.trace == nil {
+		if trigger, ok := qry.observer.(queryTraceTrigger); ok {
+			if trace := trigger.triggeredTracer(qry.stmt); trace != nil {
+				qry.trace = trace
+				return func() { qry.trace = nil }, nil
+			}
+		}
+	}
+	return func() {}, nil
+}
+
+func (s *Session) executeQuery(qry *Query) (it *Iter) {
+	end, err := s.startQuery(qry)
+	if err != nil {
 		return &Iter{err: err}
 	}
+	defer end()
 
 	iter, err := s.executor.executeQuery(qry)
 	if err != nil {
@@ -664,8 +703,24 @@ func (s *Session) executeQuery(qry *Query) (it *Iter) {
 	return iter
 }
 
+// executeQueryAsync executes qry like executeQuery but calls done with the
+// iterator instead of returning it.
+func (s *Session) executeQueryAsync(qry *Query, done func(*Iter)) {
+	end, err := s.startQuery(qry)
+	if err != nil {
+		done(&Iter{err: err})
+		return
+	}
+
+	s.executor.executeQueryAsync(qry, func(iter *Iter) {
+		end()
+		done(iter)
+	})
+}
+
 func (s *Session) removeHost(h *HostInfo) {
 	s.policy.RemoveHost(h)
+	s.metrics.removeHost(h)
 	hostID := h.HostID()
 	s.pool.removeHost(hostID)
 	s.hostSource.removeHost(hostID)
@@ -721,11 +776,14 @@ func (s *Session) findTabletReplicasForToken(keyspace, table string, token int64
 	return s.metadataDescriber.metadata.tabletsMetadata.FindReplicasForToken(keyspace, table, token)
 }
 
-// returns routing key indexes and type info
-func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyInfo, error) {
+// returns routing key indexes and type info, keyspace is the per-query keyspace
+// the statement is prepared in, if empty the session keyspace is used.
+func (s *Session) routingKeyInfo(ctx context.Context, stmt, keyspace string) (*routingKeyInfo, error) {
+	cacheKey := routingKeyInfoCacheKey(keyspace, stmt)
+
 	s.routingKeyInfoCache.mu.Lock()
 
-	entry, cached := s.routingKeyInfoCache.lru.Get(stmt)
+	entry, cached := s.routingKeyInfoCache.lru.Get(cacheKey)
 	if cached {
 		// done accessing the cache
 		s.routingKeyInfoCache.mu.Unlock()
@@ -749,7 +807,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 	inflight := new(inflightCachedEntry)
 	inflight.wg.Add(1)
 	defer inflight.wg.Done()
-	s.routingKeyInfoCache.lru.Add(stmt, inflight)
+	s.routingKeyInfoCache.lru.Add(cacheKey, inflight)
 	s.routingKeyInfoCache.mu.Unlock()
 
 	var (
@@ -764,11 +822,18 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 		return nil, inflight.err
 	}
 
+	keyspace, inflight.err = conn.statementKeyspace(keyspace)
+	if inflight.err != nil {
+		// don't cache this error
+		s.routingKeyInfoCache.Remove(cacheKey)
+		return nil, inflight.err
+	}
+
 	// get the query info for the statement
-	info, inflight.err = conn.prepareStatement(ctx, stmt, nil)
+	info, inflight.err = conn.prepareStatementInKeyspace(ctx, stmt, keyspace, nil)
 	if inflight.err != nil {
 		// don't cache this error
-		s.routingKeyInfoCache.Remove(stmt)
+		s.routingKeyInfoCache.Remove(cacheKey)
 		return nil, inflight.err
 	}
 
@@ -781,12 +846,12 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 	}
 
 	table := info.request.table
-	keyspace := info.request.keyspace
+	keyspace = info.request.keyspace
 
 	partitioner, err := scyllaGetTablePartitioner(s, keyspace, table)
 	if err != nil {
 		// don't cache this error
-		s.routingKeyInfoCache.Remove(stmt)
+		s.routingKeyInfoCache.Remove(cacheKey)
 		return nil, inflight.err
 	}
 
@@ -816,7 +881,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 	keyspaceMetadata, inflight.err = s.KeyspaceMetadata(info.request.columns[0].Keyspace)
 	if inflight.err != nil {
 		// don't cache this error
-		s.routingKeyInfoCache.Remove(stmt)
+		s.routingKeyInfoCache.Remove(cacheKey)
 		return nil, inflight.err
 	}
 
@@ -827,7 +892,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 		// in the metadata code, or that the table was just dropped.
 		inflight.err = ErrNoMetadata
 		// don't cache this error
-		s.routingKeyInfoCache.Remove(stmt)
+		s.routingKeyInfoCache.Remove(cacheKey)
 		return nil, inflight.err
 	}
 
@@ -874,6 +939,10 @@ func (b *Batch) execute(ctx context.Context, conn *Conn) *Iter {
 	return conn.executeBatch(ctx, b)
 }
 
+func (b *Batch) executeAsync(ctx context.Context, conn *Conn, done func(*Iter)) bool {
+	return conn.executeBatchAsync(ctx, b, done)
+}
+
 // Exec executes a batch operation and returns nil if successful
 // otherwise an error is returned describing the failure.
 func (b *Batch) Exec() error {
@@ -881,13 +950,18 @@ func (b *Batch) Exec() error {
 	return iter.Close()
 }
 
-func (s *Session) executeBatch(batch *Batch) *Iter {
+// startBatch checks that batch can be executed and prepares its execution.
+func (s *Session) startBatch(batch *Batch) error {
 	// fail fast
 	if s.Closed() {
-		return &Iter{err: ErrSessionClosed}
+		return ErrSessionClosed
 	}
 	if err := s.Ready(); err != nil {
-		return &Iter{err: err}
+		return err
+	}
+
+	if batch.profileErr != nil {
+		return batch.profileErr
 	}
 
 	// Drop metrics from prior query executions
@@ -897,7 +971,14 @@ func (s *Session) executeBatch(batch *Batch) *Iter {
 	// Currently batches have a limit of 65536 queries.
 	// https://datastax-oss.atlassian.net/browse/JAVA-229
 	if batch.Size() > BatchSizeMaximum {
-		return &Iter{err: ErrTooManyStmts}
+		return ErrTooManyStmts
+	}
+	return nil
+}
+
+func (s *Session) executeBatch(batch *Batch) *Iter {
+	if err := s.startBatch(batch); err != nil {
+		return &Iter{err: err}
 	}
 
 	iter, err := s.executor.executeQuery(batch)
@@ -908,6 +989,17 @@ func (s *Session) executeBatch(batch *Batch) *Iter {
 	return iter
 }
 
+// executeBatchAsync executes batch like executeBatch but calls done with the
+// iterator instead of returning it.
+func (s *Session) executeBatchAsync(batch *Batch, done func(*Iter)) {
+	if err := s.startBatch(batch); err != nil {
+		done(&Iter{err: err})
+		return
+	}
+
+	s.executor.executeQueryAsync(batch, done)
+}
+
 // ExecuteBatch executes a batch operation and returns nil if successful
 // otherwise an error is returned describing the failure.
 func (s *Session) ExecuteBatch(batch *Batch) error {
@@ -1098,6 +1190,23 @@ type Query struct {
 	metrics               *queryMetrics
 	refCount              uint32
 
+	// v5+
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int
+
+	// timeout bounds the whole execution including retries and speculative
+	// executions, attemptTimeout bounds every single attempt.
+	timeout        time.Duration
+	attemptTimeout time.Duration
+
+	// profile is the execution profile selected with Profile, profileErr is
+	// returned when the query is executed if it is not registered.
+	profile    *ExecutionProfile
+	profileErr error
+	// explicit are the settings made on the query, which the profile doesn't override.
+	explicit executionSettings
+
 	disableAutoPage bool
 
 	// getKeyspace is field so that it can be overriden in tests
@@ -1148,18 +1257,12 @@ func (q *Query) defaultsFromSession() {
 	s := q.session
 
 	s.mu.RLock()
-	q.cons = s.cons
-	q.pageSize = s.pageSize
 	q.trace = s.trace
 	q.observer = s.queryObserver
 	q.prefetch = s.prefetch
-	q.rt = s.cfg.RetryPolicy
-	q.serialCons = s.cfg.SerialConsistency
 	q.defaultTimestamp = s.cfg.DefaultTimestamp
-	q.idempotent = s.cfg.DefaultIdempotence
 	q.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
-
-	q.spec = &NonSpeculativeExecution{}
+	q.profile.applyToQuery(q)
 	s.mu.RUnlock()
 }
 
@@ -1202,6 +1305,7 @@ func (q *Query) AddLatency(l int64, host *HostInfo) {
 // is used.
 func (q *Query) Consistency(c Consistency) *Query {
 	q.cons = c
+	q.explicit |= settingConsistency
 	return q
 }
 
@@ -1214,6 +1318,7 @@ func (q *Query) GetConsistency() Consistency {
 // Same as Consistency but without a return value
 func (q *Query) SetConsistency(c Consistency) {
 	q.cons = c
+	q.explicit |= settingConsistency
 }
 
 // CustomPayload sets the custom payload level for this query.
@@ -1222,6 +1327,11 @@ func (q *Query) CustomPayload(customPayload map[string][]byte) *Query {
 	return q
 }
 
+// GetCustomPayload returns the custom payload of the query.
+func (q *Query) GetCustomPayload() map[string][]byte {
+	return q.customPayload
+}
+
 func (q *Query) Context() context.Context {
 	if q.context == nil {
 		return context.Background()
@@ -1249,6 +1359,7 @@ func (q *Query) Observer(observer QueryObserver) *Query {
 // available in Cassandra 2 and onwards.
 func (q *Query) PageSize(n int) *Query {
 	q.pageSize = n
+	q.explicit |= settingPageSize
 	return q
 }
 
@@ -1275,6 +1386,27 @@ func (q *Query) WithTimestamp(timestamp int64) *Query {
 	return q
 }
 
+// SetKeyspace sets the keyspace the query is prepared and executed in,
+// overriding the keyspace of the session. Unqualified table names in the
+// statement are resolved against it.
+//
+// Only available on protocol >= 5
+func (q *Query) SetKeyspace(keyspace string) *Query {
+	q.keyspace = keyspace
+	return q
+}
+
+// WithNowInSeconds sets the current time, in seconds since the epoch, used
+// by the server to evaluate TTLs of the query. This is meant for testing
+// TTL logic deterministically.
+//
+// Only available on protocol >= 5
+func (q *Query) WithNowInSeconds(now int) *Query {
+	q.nowInSeconds = true
+	q.nowInSecondsValue = now
+	return q
+}
+
 // RoutingKey sets the routing key to use when a token aware connection
 // pool is used to optimize the routing of this query.
 func (q *Query) RoutingKey(routingKey []byte) *Query {
@@ -1308,22 +1440,29 @@ func (q *Query) execute(ctx context.Context, conn *Conn) *Iter {
 	return conn.executeQuery(ctx, q)
 }
 
-func (q *Query) attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo) {
+func (q *Query) executeAsync(ctx context.Context, conn *Conn, done func(*Iter)) bool {
+	return conn.executeQueryAsync(ctx, q, done)
+}
+
+func (q *Query) attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo, speculative, won bool) {
 	latency := end.Sub(start)
 	attempt, metricsForHost := q.metrics.attempt(1, latency, host, q.observer != nil)
 
 	if q.observer != nil {
 		q.observer.ObserveQuery(q.Context(), ObservedQuery{
-			Keyspace:  keyspace,
-			Statement: q.stmt,
-			Values:    q.values,
-			Start:     start,
-			End:       end,
-			Rows:      iter.numRows,
-			Host:      host,
-			Metrics:   metricsForHost,
-			Err:       iter.err,
-			Attempt:   attempt,
+			Keyspace:    keyspace,
+			Statement:   q.stmt,
+			Values:      q.values,
+			Consistency: q.cons,
+			Start:       start,
+			End:         end,
+			Rows:        iter.numRows,
+			Host:        host,
+			Metrics:     metricsForHost,
+			Err:         iter.err,
+			Attempt:     attempt,
+			Speculative: speculative,
+			Won:         won,
 		})
 	}
 }
@@ -1340,6 +1479,9 @@ func (q *Query) Keyspace() string {
 	if q.routingInfo.keyspace != "" {
 		return q.routingInfo.keyspace
 	}
+	if q.keyspace != "" {
+		return q.keyspace
+	}
 
 	if q.session == nil {
 		return ""
@@ -1375,7 +1517,7 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 	}
 
 	// try to determine the routing key
-	routingKeyInfo, err := q.session.routingKeyInfo(q.Context(), q.stmt)
+	routingKeyInfo, err := q.session.routingKeyInfo(q.Context(), q.stmt, q.keyspace)
 	if err != nil {
 		return nil, err
 	}
@@ -1424,12 +1566,14 @@ func (q *Query) Prefetch(p float64) *Query {
 // RetryPolicy sets the policy to use when retrying the query.
 func (q *Query) RetryPolicy(r RetryPolicy) *Query {
 	q.rt = r
+	q.explicit |= settingRetryPolicy
 	return q
 }
 
 // SetSpeculativeExecutionPolicy sets the execution policy
 func (q *Query) SetSpeculativeExecutionPolicy(sp SpeculativeExecutionPolicy) *Query {
 	q.spec = sp
+	q.explicit |= settingSpeculativeExecutionPolicy
 	return q
 }
 
@@ -1438,6 +1582,32 @@ func (q *Query) speculativeExecutionPolicy() SpeculativeExecutionPolicy {
 	return q.spec
 }
 
+// Timeout sets the maximum amount of time the query execution can take,
+// including all retries and speculative executions. Once it elapses the
+// execution is canceled and context.DeadlineExceeded is returned.
+// When paging, the timeout applies to fetching each page separately.
+// Zero, the default, means no timeout other than the one of the query context.
+func (q *Query) Timeout(timeout time.Duration) *Query {
+	q.timeout = timeout
+	q.explicit |= settingTimeout
+	return q
+}
+
+// AttemptTimeout sets the maximum amount of time a single attempt of the query
+// can take. An attempt that times out fails with ErrTimeoutNoResponse and, as
+// with any other error, the retry policy decides whether the query is retried,
+// usually on the next host.
+// Zero, the default, means attempts are only bounded by the connection timeout.
+func (q *Query) AttemptTimeout(timeout time.Duration) *Query {
+	q.attemptTimeout = timeout
+	q.explicit |= settingAttemptTimeout
+	return q
+}
+
+func (q *Query) timeouts() (total, attempt time.Duration) {
+	return q.timeout, q.attemptTimeout
+}
+
 // IsIdempotent returns whether the query is marked as idempotent.
 // Non-idempotent query won't be retried.
 // See "Retries and speculative execution" in package docs for more details.
@@ -1459,9 +1629,28 @@ func (q *Query) GetCustomPartitioner() Partitioner {
 // See "Retries and speculative execution" in package docs for more details.
 func (q *Query) Idempotent(value bool) *Query {
 	q.idempotent = value
+	q.explicit |= settingIdempotent
+	return q
+}
+
+// Profile selects the execution profile registered under name in
+// ClusterConfig.ExecutionProfiles. The settings of the profile override the
+// session defaults, not the settings made on the query, whether they are made
+// before or after selecting the profile.
+// If no profile is registered under name, executing the query fails with
+// ErrExecutionProfileNotFound.
+func (q *Query) Profile(name string) *Query {
+	q.profile, q.profileErr = q.session.executionProfile(name)
+	q.session.mu.RLock()
+	q.profile.applyToQuery(q)
+	q.session.mu.RUnlock()
 	return q
 }
 
+func (q *Query) executionProfile() *ExecutionProfile {
+	return q.profile
+}
+
 // Bind sets query arguments of query. This can also be used to rebind new query arguments
 // to an existing query instance.
 func (q *Query) Bind(v ...interface{}) *Query {
@@ -1480,6 +1669,7 @@ func (q *Query) SerialConsistency(cons Consistency) *Query {
 		panic("Serial consistency can only be SERIAL or LOCAL_SERIAL got " + cons.String())
 	}
 	q.serialCons = cons
+	q.explicit |= settingSerialConsistency
 	return q
 }
 
@@ -1691,6 +1881,9 @@ type Iter struct {
 
 	framer framerInterface
 	closed int32
+
+	// structPlan is the plan last used by StructScan.
+	structPlan *structPlan
 }
 
 // Host returns the host which the query was sent to.
@@ -2003,6 +2196,22 @@ type Batch struct {
 	keyspace              string
 	metrics               *queryMetrics
 
+	// v5+
+	nowInSeconds      bool
+	nowInSecondsValue int
+
+	timeout        time.Duration
+	attemptTimeout time.Duration
+
+	profile    *ExecutionProfile
+	profileErr error
+	idempotent bool
+	// explicit are the settings made on the batch, which the profile doesn't
+	// override. appliedCons is the consistency set by applyToBatch, a
+	// different Cons was assigned.
+	explicit    executionSettings
+	appliedCons Consistency
+
 	// routingInfo is a pointer because Query can be copied and copyable struct can't hold a mutex.
 	routingInfo *queryRoutingInfo
 
@@ -2020,24 +2229,44 @@ func (s *Session) NewBatch(typ BatchType) *Batch {
 
 // Batch creates a new batch operation using defaults defined in the cluster
 func (s *Session) Batch(typ BatchType) *Batch {
-	s.mu.RLock()
 	batch := &Batch{
-		Type:             typ,
-		rt:               s.cfg.RetryPolicy,
-		serialCons:       s.cfg.SerialConsistency,
-		trace:            s.trace,
-		observer:         s.batchObserver,
-		session:          s,
-		Cons:             s.cons,
-		defaultTimestamp: s.cfg.DefaultTimestamp,
-		keyspace:         s.cfg.Keyspace,
-		metrics:          &queryMetrics{m: make(map[string]*hostMetrics)},
-		spec:             &NonSpeculativeExecution{},
-		routingInfo:      &queryRoutingInfo{},
+		Type:        typ,
+		session:     s,
+		routingInfo: &queryRoutingInfo{},
 	}
+	batch.defaultsFromSession()
+	return batch
+}
+
+func (b *Batch) defaultsFromSession() {
+	s := b.session
 
+	s.mu.RLock()
+	b.trace = s.trace
+	b.observer = s.batchObserver
+	b.defaultTimestamp = s.cfg.DefaultTimestamp
+	b.keyspace = s.cfg.Keyspace
+	b.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+	b.profile.applyToBatch(b)
 	s.mu.RUnlock()
-	return batch
+}
+
+// Profile selects the execution profile registered under name in
+// ClusterConfig.ExecutionProfiles. The settings of the profile override the
+// session defaults, not the settings made on the batch, whether they are made
+// before or after selecting the profile.
+// If no profile is registered under name, executing the batch fails with
+// ErrExecutionProfileNotFound.
+func (b *Batch) Profile(name string) *Batch {
+	b.profile, b.profileErr = b.session.executionProfile(name)
+	b.session.mu.RLock()
+	b.profile.applyToBatch(b)
+	b.session.mu.RUnlock()
+	return b
+}
+
+func (b *Batch) executionProfile() *ExecutionProfile {
+	return b.profile
 }
 
 // Trace enables tracing of this batch. Look at the documentation of the
@@ -2054,10 +2283,42 @@ func (b *Batch) Observer(observer BatchObserver) *Batch {
 	return b
 }
 
+// Keyspace returns the keyspace the batch is routed with.
 func (b *Batch) Keyspace() string {
+	if b.routingInfo.keyspace != "" {
+		return b.routingInfo.keyspace
+	}
 	return b.keyspace
 }
 
+// SetKeyspace sets the keyspace the batch statements are prepared and
+// executed in, overriding the keyspace of the session.
+//
+// Only available on protocol >= 5
+func (b *Batch) SetKeyspace(keyspace string) *Batch {
+	b.keyspace = keyspace
+	return b
+}
+
+// perQueryKeyspace returns the keyspace set with SetKeyspace, or an empty
+// string if the batch uses the keyspace of the session.
+func (b *Batch) perQueryKeyspace() string {
+	if b.session != nil && b.keyspace == b.session.cfg.Keyspace {
+		return ""
+	}
+	return b.keyspace
+}
+
+// WithNowInSeconds sets the current time, in seconds since the epoch, used
+// by the server to evaluate TTLs of the batch statements.
+//
+// Only available on protocol >= 5
+func (b *Batch) WithNowInSeconds(now int) *Batch {
+	b.nowInSeconds = true
+	b.nowInSecondsValue = now
+	return b
+}
+
 // Batch has no reasonable eqivalent of Query.Table().
 func (b *Batch) Table() string {
 	return b.routingInfo.table
@@ -2095,6 +2356,7 @@ func (b *Batch) GetConsistency() Consistency {
 // operation.
 func (b *Batch) SetConsistency(c Consistency) {
 	b.Cons = c
+	b.explicit |= settingConsistency
 }
 
 func (b *Batch) Context() context.Context {
@@ -2105,6 +2367,9 @@ func (b *Batch) Context() context.Context {
 }
 
 func (b *Batch) IsIdempotent() bool {
+	if b.idempotent {
+		return true
+	}
 	for _, entry := range b.Entries {
 		if !entry.Idempotent {
 			return false
@@ -2127,9 +2392,30 @@ func (b *Batch) speculativeExecutionPolicy() SpeculativeExecutionPolicy {
 
 func (b *Batch) SpeculativeExecutionPolicy(sp SpeculativeExecutionPolicy) *Batch {
 	b.spec = sp
+	b.explicit |= settingSpeculativeExecutionPolicy
 	return b
 }
 
+// Timeout sets the maximum amount of time the batch execution can take,
+// including all retries and speculative executions. See Query.Timeout.
+func (b *Batch) Timeout(timeout time.Duration) *Batch {
+	b.timeout = timeout
+	b.explicit |= settingTimeout
+	return b
+}
+
+// AttemptTimeout sets the maximum amount of time a single attempt of the batch
+// can take. See Query.AttemptTimeout.
+func (b *Batch) AttemptTimeout(timeout time.Duration) *Batch {
+	b.attemptTimeout = timeout
+	b.explicit |= settingAttemptTimeout
+	return b
+}
+
+func (b *Batch) timeouts() (total, attempt time.Duration) {
+	return b.timeout, b.attemptTimeout
+}
+
 // Query adds the query to the batch operation
 func (b *Batch) Query(stmt string, args ...interface{}) *Batch {
 	b.Entries = append(b.Entries, BatchEntry{Stmt: stmt, Args: args})
@@ -2150,6 +2436,7 @@ func (b *Batch) retryPolicy() RetryPolicy {
 // RetryPolicy sets the retry policy to use when executing the batch operation
 func (b *Batch) RetryPolicy(r RetryPolicy) *Batch {
 	b.rt = r
+	b.explicit |= settingRetryPolicy
 	return b
 }
 
@@ -2191,6 +2478,7 @@ func (b *Batch) SerialConsistency(cons Consistency) *Batch {
 		panic("Serial consistency can only be SERIAL or LOCAL_SERIAL got " + cons.String())
 	}
 	b.serialCons = cons
+	b.explicit |= settingSerialConsistency
 	return b
 }
 
@@ -2217,7 +2505,7 @@ func (b *Batch) WithTimestamp(timestamp int64) *Batch {
 	return b
 }
 
-func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo) {
+func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo, speculative, won bool) {
 	latency := end.Sub(start)
 	attempt, metricsForHost := b.metrics.attempt(1, latency, host, b.observer != nil)
 
@@ -2234,16 +2522,19 @@ func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host
 	}
 
 	b.observer.ObserveBatch(b.Context(), ObservedBatch{
-		Keyspace:   keyspace,
-		Statements: statements,
-		Values:     values,
-		Start:      start,
-		End:        end,
+		Keyspace:    keyspace,
+		Statements:  statements,
+		Values:      values,
+		Consistency: b.Cons,
+		Start:       start,
+		End:         end,
 		// Rows not used in batch observations // TODO - might be able to support it when using BatchCAS
-		Host:    host,
-		Metrics: metricsForHost,
-		Err:     iter.err,
-		Attempt: attempt,
+		Host:        host,
+		Metrics:     metricsForHost,
+		Err:         iter.err,
+		Attempt:     attempt,
+		Speculative: speculative,
+		Won:         won,
 	})
 }
 
@@ -2262,7 +2553,7 @@ func (b *Batch) GetRoutingKey() ([]byte, error) {
 		return nil, nil
 	}
 	// try to determine the routing key
-	routingKeyInfo, err := b.session.routingKeyInfo(b.Context(), entry.Stmt)
+	routingKeyInfo, err := b.session.routingKeyInfo(b.Context(), entry.Stmt, b.perQueryKeyspace())
 	if err != nil {
 		return nil, err
 	}
@@ -2382,6 +2673,12 @@ func (r *routingKeyInfo) String() string {
 	return fmt.Sprintf("routing key index=%v types=%v", r.indexes, r.types)
 }
 
+// routingKeyInfoCacheKey returns the key of the routing key info of stmt
+// prepared in keyspace.
+func routingKeyInfoCacheKey(keyspace, stmt string) string {
+	return keyspace + "\x00" + stmt
+}
+
 func (r *routingKeyInfoLRU) Remove(key string) {
 	r.mu.Lock()
 	r.lru.Remove(key)
@@ -2418,6 +2715,9 @@ type ObservedQuery struct {
 	// Do not modify the values here, they are shared with multiple goroutines.
 	Values []interface{}
 
+	// Consistency is the consistency level the query was sent with.
+	Consistency Consistency
+
 	Start time.Time // time immediately before the query was called
 	End   time.Time // time immediately after the query returned
 
@@ -2439,6 +2739,15 @@ type ObservedQuery struct {
 	// Attempt is the index of attempt at executing this query.
 	// The first attempt is number zero and any retries have non-zero attempt number.
 	Attempt int
+
+	// Speculative is true if the attempt was made by a speculative execution
+	// rather than by the initial execution of the query.
+	Speculative bool
+
+	// Won is true if the attempt was the first successful attempt of a query
+	// with speculative executions, whose result was returned. It is false if
+	// no speculative execution was started before the first successful attempt.
+	Won bool
 }
 
 // QueryObserver is the interface implemented by query observers / stat collectors.
@@ -2458,6 +2767,9 @@ type ObservedBatch struct {
 	// Do not modify the values here, they are shared with multiple goroutines.
 	Values [][]interface{}
 
+	// Consistency is the consistency level the batch was sent with.
+	Consistency Consistency
+
 	Start time.Time // time immediately before the batch query was called
 	End   time.Time // time immediately after the batch query returned
 
@@ -2474,6 +2786,15 @@ type ObservedBatch struct {
 	// Attempt is the index of attempt at executing this query.
 	// The first attempt is number zero and any retries have non-zero attempt number.
 	Attempt int
+
+	// Speculative is true if the attempt was made by a speculative execution
+	// rather than by the initial execution of the query.
+	Speculative bool
+
+	// Won is true if the attempt was the first successful attempt of a query
+	// with speculative executions, whose result was returned. It is false if
+	// no speculative execution was started before the first successful attempt.
+	Won bool
 }
 
 // BatchObserver is the interface implemented by batch observers / stat collectors.
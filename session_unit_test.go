@@ -60,3 +60,11 @@ func TestAsyncSessionInit(t *testing.T) {
 		t.Fatalf("unexpected error from void")
 	}
 }
+
+func TestRoutingKeyInfoCacheKey(t *testing.T) {
+	t.Parallel()
+
+	if routingKeyInfoCacheKey("a", "bSELECT * FROM t") == routingKeyInfoCacheKey("ab", "SELECT * FROM t") {
+		t.Fatal("expected statements of different keyspaces to have different cache keys")
+	}
+}
@@ -0,0 +1,285 @@
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSlowQueryThreshold    = 500 * time.Millisecond
+	defaultSlowQueryRateInterval = time.Minute
+
+	// maxSlowQueryStatements is the number of statements whose rate limits
+	// and pending traces are tracked at once.
+	maxSlowQueryStatements = 1024
+)
+
+// ValueRedactor returns the bound values of stmt as they are logged, for
+// example with sensitive values masked. It must not modify values, they are
+// shared with the query.
+type ValueRedactor func(stmt string, values []interface{}) []interface{}
+
+// LogValues is a ValueRedactor logging the bound values as they are.
+func LogValues(_ string, values []interface{}) []interface{} {
+	return values
+}
+
+// RedactValues is a ValueRedactor logging only the types of the bound values.
+func RedactValues(_ string, values []interface{}) []interface{} {
+	redacted := make([]interface{}, len(values))
+	for i, v := range values {
+		redacted[i] = fmt.Sprintf("<%T>", v)
+	}
+	return redacted
+}
+
+// SlowQueryConfig configures an observer created with NewSlowQueryObserver.
+type SlowQueryConfig struct {
+	// Threshold is the duration of an attempt above which it is slow.
+	// Default: 500 milliseconds
+	Threshold time.Duration
+
+	// Logger receives the slow attempts at the warn level and the sampled
+	// attempts at the info level.
+	// Default: the standard logger
+	Logger StructuredLogger
+
+	// Redactor returns the bound values as they are logged.
+	// Default: the values are not logged
+	Redactor ValueRedactor
+
+	// MaxPerStatement is the number of slow attempts of a statement logged
+	// per RateInterval, the number of attempts left out is logged with the
+	// next logged attempt of the statement.
+	// Default: 0 (no limit)
+	MaxPerStatement int
+
+	// RateInterval is the interval of MaxPerStatement.
+	// Default: 1 minute
+	RateInterval time.Duration
+
+	// SampleRate is the fraction, between 0 and 1, of the attempts which are
+	// not slow that are logged.
+	// Default: 0
+	SampleRate float64
+
+	// TraceNext is the number of the next executions of a statement traced
+	// with Tracer once an attempt of the statement is slow, as with Query.Trace.
+	// Queries already traced and batches are left as they are. Statements
+	// are only traced when the SlowQueryObserver itself is the query observer
+	// of the session or the query, not when it is wrapped by another observer.
+	// Default: 0 (no tracing)
+	TraceNext int
+
+	// Tracer receives the traces of the statements, it is required when
+	// TraceNext is set, usually a TraceWriter.
+	Tracer Tracer
+}
+
+func (cfg *SlowQueryConfig) setDefaults() {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultSlowQueryThreshold
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = stdStructuredLogger{logger: &defaultLogger{}}
+	}
+	if cfg.RateInterval <= 0 {
+		cfg.RateInterval = defaultSlowQueryRateInterval
+	}
+}
+
+// SlowQueryObserver logs the slow attempts of queries and batches with the
+// host, attempt, consistency, rows and error, and a sample of the other
+// attempts. It implements QueryObserver and BatchObserver:
+//
+//	observer := gocql.NewSlowQueryObserver(gocql.SlowQueryConfig{
+//		Threshold:       100 * time.Millisecond,
+//		MaxPerStatement: 10,
+//	})
+//	cluster.QueryObserver = observer
+//	cluster.BatchObserver = observer
+type SlowQueryObserver struct {
+	cfg SlowQueryConfig
+
+	mu         sync.Mutex
+	statements map[string]*slowStatement
+}
+
+type slowStatement struct {
+	windowStart time.Time
+	logged      int
+	suppressed  int
+	traces      int
+}
+
+// NewSlowQueryObserver returns an observer configured with cfg.
+func NewSlowQueryObserver(cfg SlowQueryConfig) *SlowQueryObserver {
+	cfg.setDefaults()
+	return &SlowQueryObserver{
+		cfg:        cfg,
+		statements: make(map[string]*slowStatement),
+	}
+}
+
+// ObserveQuery logs q if it is slow or sampled.
+func (o *SlowQueryObserver) ObserveQuery(_ context.Context, q ObservedQuery) {
+	latency := q.End.Sub(q.Start)
+	slow := latency > o.cfg.Threshold
+	if !slow && !o.sampled() {
+		return
+	}
+
+	fields := []LogField{
+		logField("statement", q.Statement),
+		logField("keyspace", q.Keyspace),
+	}
+	fields = append(fields, o.commonFields(latency, q.Host, q.Consistency, q.Attempt, q.Speculative)...)
+	fields = append(fields, logField("rows", q.Rows))
+	if o.cfg.Redactor != nil && len(q.Values) > 0 {
+		fields = append(fields, logField("values", o.cfg.Redactor(q.Statement, q.Values)))
+	}
+	o.log(slow, q.Statement, true, q.End, q.Err, fields)
+}
+
+// ObserveBatch logs b if it is slow or sampled.
+func (o *SlowQueryObserver) ObserveBatch(_ context.Context, b ObservedBatch) {
+	latency := b.End.Sub(b.Start)
+	slow := latency > o.cfg.Threshold
+	if !slow && !o.sampled() {
+		return
+	}
+
+	stmt := strings.Join(b.Statements, "; ")
+	fields := []LogField{
+		logField("statement", stmt),
+		logField("keyspace", b.Keyspace),
+		logField("batch_size", len(b.Statements)),
+	}
+	fields = append(fields, o.commonFields(latency, b.Host, b.Consistency, b.Attempt, b.Speculative)...)
+	if o.cfg.Redactor != nil && len(b.Values) > 0 {
+		values := make([][]interface{}, len(b.Values))
+		for i := range b.Values {
+			if i < len(b.Statements) {
+				values[i] = o.cfg.Redactor(b.Statements[i], b.Values[i])
+			}
+		}
+		fields = append(fields, logField("values", values))
+	}
+	o.log(slow, "BATCH "+stmt, false, b.End, b.Err, fields)
+}
+
+func (o *SlowQueryObserver) commonFields(latency time.Duration, host *HostInfo, cons Consistency, attempt int, speculative bool) []LogField {
+	fields := []LogField{logField("latency", latency)}
+	if host != nil {
+		fields = append(fields, logHost(host), logHostID(host))
+	}
+	return append(fields,
+		logField("attempt", attempt),
+		logField("speculative", speculative),
+		logField("consistency", cons),
+	)
+}
+
+func (o *SlowQueryObserver) sampled() bool {
+	return o.cfg.SampleRate > 0 && rand.Float64() < o.cfg.SampleRate
+}
+
+// log logs a slow or sampled attempt of stmt ended at now. Slow attempts are
+// rate limited per statement and trigger the tracing of stmt if traceable.
+func (o *SlowQueryObserver) log(slow bool, stmt string, traceable bool, now time.Time, err error, fields []LogField) {
+	if err != nil {
+		fields = append(fields, logError(err))
+	}
+	if !slow {
+		o.cfg.Logger.Log(LogLevelInfo, "query", fields...)
+		return
+	}
+
+	trace := traceable && o.cfg.TraceNext > 0 && o.cfg.Tracer != nil
+	if o.cfg.MaxPerStatement > 0 || trace {
+		o.mu.Lock()
+		st := o.statement(stmt, now)
+		if trace && st.traces < o.cfg.TraceNext {
+			st.traces = o.cfg.TraceNext
+		}
+		if o.cfg.MaxPerStatement > 0 {
+			if st.logged >= o.cfg.MaxPerStatement {
+				st.suppressed++
+				o.mu.Unlock()
+				return
+			}
+			st.logged++
+			if st.suppressed > 0 {
+				fields = append(fields, logField("suppressed", st.suppressed))
+				st.suppressed = 0
+			}
+		}
+		o.mu.Unlock()
+	}
+
+	o.cfg.Logger.Log(LogLevelWarn, "slow query", fields...)
+}
+
+// statement returns the state of stmt, whose rate limit window is reset if
+// it is over at now. o.mu must be held.
+func (o *SlowQueryObserver) statement(stmt string, now time.Time) *slowStatement {
+	st, ok := o.statements[stmt]
+	if !ok {
+		if len(o.statements) >= maxSlowQueryStatements {
+			o.prune(now)
+		}
+		st = &slowStatement{windowStart: now}
+		o.statements[stmt] = st
+	}
+	if now.Sub(st.windowStart) >= o.cfg.RateInterval {
+		st.windowStart = now
+		st.logged = 0
+	}
+	return st
+}
+
+// prune drops the statements whose rate limit window is over and which have
+// no pending traces. If none of them can be dropped, all the statements are.
+// o.mu must be held.
+func (o *SlowQueryObserver) prune(now time.Time) {
+	for stmt, st := range o.statements {
+		if st.traces == 0 && now.Sub(st.windowStart) >= o.cfg.RateInterval {
+			delete(o.statements, stmt)
+		}
+	}
+	if len(o.statements) >= maxSlowQueryStatements {
+		o.statements = make(map[string]*slowStatement)
+	}
+}
+
+// triggeredTracer returns the tracer of the next execution of stmt, or nil
+// if it is not traced.
+func (o *SlowQueryObserver) triggeredTracer(stmt string) Tracer {
+	if o.cfg.TraceNext <= 0 || o.cfg.Tracer == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	st, ok := o.statements[stmt]
+	if !ok || st.traces == 0 {
+		return nil
+	}
+	st.traces--
+	return o.cfg.Tracer
+}
+
+// queryTraceTrigger is implemented by query observers which trace the next
+// executions of some statements.
+type queryTraceTrigger interface {
+	triggeredTracer(stmt string) Tracer
+}
+
+var (
+	_ QueryObserver     = (*SlowQueryObserver)(nil)
+	_ BatchObserver     = (*SlowQueryObserver)(nil)
+	_ queryTraceTrigger = (*SlowQueryObserver)(nil)
+)
@@ -0,0 +1,211 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type countingTracer struct {
+	traces int
+}
+
+func (t *countingTracer) Trace(traceId []byte) {
+	t.traces++
+}
+
+func observedQuery(stmt string, start time.Time, latency time.Duration) ObservedQuery {
+	return ObservedQuery{
+		Keyspace:    "ks",
+		Statement:   stmt,
+		Values:      []interface{}{1, "secret"},
+		Consistency: LocalQuorum,
+		Start:       start,
+		End:         start.Add(latency),
+		Rows:        3,
+		Attempt:     1,
+	}
+}
+
+func logFieldValue(fields []LogField, key string) (interface{}, bool) {
+	for _, field := range fields {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+func TestSlowQueryObserverThreshold(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{level: LogLevelDebug}
+	o := NewSlowQueryObserver(SlowQueryConfig{
+		Threshold: 100 * time.Millisecond,
+		Logger:    logger,
+		Redactor:  RedactValues,
+	})
+	now := time.Now()
+
+	o.ObserveQuery(context.Background(), observedQuery("fast", now, 10*time.Millisecond))
+	if len(logger.entries) != 0 {
+		t.Fatalf("expected fast query not to be logged, got %v", logger.entries)
+	}
+
+	q := observedQuery("slow", now, 200*time.Millisecond)
+	q.Err = errors.New("timeout")
+	o.ObserveQuery(context.Background(), q)
+	if len(logger.entries) != 1 {
+		t.Fatalf("expected slow query to be logged, got %v", logger.entries)
+	}
+	entry := logger.entries[0]
+	if entry.level != LogLevelWarn {
+		t.Errorf("expected warn level got %v", entry.level)
+	}
+	expected := map[string]interface{}{
+		"statement":   "slow",
+		"latency":     200 * time.Millisecond,
+		"attempt":     1,
+		"consistency": LocalQuorum,
+		"rows":        3,
+		LogFieldError: q.Err,
+	}
+	for key, want := range expected {
+		if got, _ := logFieldValue(entry.fields, key); got != want {
+			t.Errorf("%s: expected %v got %v", key, want, got)
+		}
+	}
+	values, _ := logFieldValue(entry.fields, "values")
+	if redacted, ok := values.([]interface{}); !ok || len(redacted) != 2 || redacted[1] != "<string>" {
+		t.Errorf("expected redacted values got %v", values)
+	}
+}
+
+func TestSlowQueryObserverRateLimit(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{level: LogLevelDebug}
+	o := NewSlowQueryObserver(SlowQueryConfig{
+		Threshold:       time.Millisecond,
+		Logger:          logger,
+		MaxPerStatement: 2,
+		RateInterval:    time.Minute,
+	})
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		o.ObserveQuery(context.Background(), observedQuery("a", now, time.Second))
+	}
+	o.ObserveQuery(context.Background(), observedQuery("b", now, time.Second))
+	if len(logger.entries) != 3 {
+		t.Fatalf("expected 3 entries got %d", len(logger.entries))
+	}
+
+	o.ObserveQuery(context.Background(), observedQuery("a", now.Add(time.Minute), time.Second))
+	if len(logger.entries) != 4 {
+		t.Fatalf("expected 4 entries got %d", len(logger.entries))
+	}
+	if suppressed, _ := logFieldValue(logger.entries[3].fields, "suppressed"); suppressed != 3 {
+		t.Errorf("expected 3 suppressed got %v", suppressed)
+	}
+}
+
+func TestSlowQueryObserverSampling(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{level: LogLevelDebug}
+	o := NewSlowQueryObserver(SlowQueryConfig{
+		Threshold:  time.Second,
+		Logger:     logger,
+		SampleRate: 1,
+	})
+	now := time.Now()
+
+	o.ObserveQuery(context.Background(), observedQuery("fast", now, time.Millisecond))
+	o.ObserveBatch(context.Background(), ObservedBatch{Statements: []string{"a", "b"}, Start: now, End: now})
+	if len(logger.entries) != 2 {
+		t.Fatalf("expected 2 entries got %v", logger.entries)
+	}
+	for _, entry := range logger.entries {
+		if entry.level != LogLevelInfo {
+			t.Errorf("expected info level got %v", entry.level)
+		}
+	}
+	if values, ok := logFieldValue(logger.entries[0].fields, "values"); ok {
+		t.Errorf("expected values not to be logged got %v", values)
+	}
+	if size, _ := logFieldValue(logger.entries[1].fields, "batch_size"); size != 2 {
+		t.Errorf("expected batch size 2 got %v", size)
+	}
+}
+
+func TestSlowQueryObserverTrace(t *testing.T) {
+	t.Parallel()
+
+	tracer := &countingTracer{}
+	o := NewSlowQueryObserver(SlowQueryConfig{
+		Threshold: time.Millisecond,
+		Logger:    &recordingLogger{level: LogLevelDebug},
+		TraceNext: 2,
+		Tracer:    tracer,
+	})
+	now := time.Now()
+
+	if trace := o.triggeredTracer("a"); trace != nil {
+		t.Fatal("expected statement not to be traced before it is slow")
+	}
+	o.ObserveQuery(context.Background(), observedQuery("a", now, time.Second))
+	o.ObserveBatch(context.Background(), ObservedBatch{Statements: []string{"b"}, Start: now, End: now.Add(time.Second)})
+
+	for i := 0; i < 2; i++ {
+		if trace := o.triggeredTracer("a"); trace != tracer {
+			t.Fatalf("expected execution %d to be traced", i)
+		}
+	}
+	if trace := o.triggeredTracer("a"); trace != nil {
+		t.Error("expected only 2 executions to be traced")
+	}
+	if trace := o.triggeredTracer("b"); trace != nil {
+		t.Error("expected batch statements not to be traced")
+	}
+}
+
+func TestSlowQueryObserverSessionTrace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	o := NewSlowQueryObserver(SlowQueryConfig{
+		Threshold: time.Nanosecond,
+		Logger:    &recordingLogger{level: LogLevelError},
+		TraceNext: 1,
+		Tracer:    &countingTracer{},
+	})
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.QueryObserver = o
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		q := db.Query("void")
+		if err := q.Exec(); err != nil {
+			t.Fatal(err)
+		}
+		if q.trace != nil {
+			t.Fatal("expected triggered tracer to be reset after execution")
+		}
+	}
+	// the first execution was slow and the second one traced
+	if trace := o.triggeredTracer("void"); trace == nil {
+		t.Error("expected the slow traced execution to trigger tracing again")
+	}
+}
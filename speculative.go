@@ -0,0 +1,348 @@
+package gocql
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSpeculativePercentile = 95
+	defaultSpeculativeMinDelay   = time.Millisecond
+	defaultSpeculativeMinSamples = 100
+	defaultSpeculativeWindow     = time.Minute
+	defaultSpeculativeRate       = 100
+
+	// maxSpeculativeStatements bounds the number of statements whose latency is tracked.
+	maxSpeculativeStatements = 1000
+
+	latencyHistogramMin     = 100 * time.Microsecond
+	latencyHistogramGrowth  = 1.1
+	latencyHistogramBuckets = 150
+)
+
+// adaptiveSpeculativeExecutionPolicy is implemented by speculative
+// execution policies which adapt the delay of speculative executions to the
+// observed latency of queries.
+type adaptiveSpeculativeExecutionPolicy interface {
+	SpeculativeExecutionPolicy
+
+	// delayFor returns the delay before speculative executions of qry,
+	// or zero if qry should not be speculatively executed.
+	delayFor(qry ExecutableQuery) time.Duration
+
+	// allowSpeculation is called before every speculative execution and
+	// reports whether it may be started.
+	allowSpeculation() bool
+
+	// trackLatency is called with the latency and the result of every
+	// attempt of a query using the policy.
+	trackLatency(qry ExecutableQuery, latency time.Duration, err error)
+}
+
+// execution describes the execution of a query an attempt belongs to.
+type execution struct {
+	// speculative is true for executions started by the SpeculativeExecutionPolicy.
+	speculative bool
+	// won is shared by all executions of a query and set by the first successful attempt.
+	won *int32
+	// speculated is shared by all executions of a query and set once a
+	// speculative execution is started.
+	speculated *int32
+}
+
+type executionKey struct{}
+
+func withExecution(ctx context.Context, exec execution) context.Context {
+	return context.WithValue(ctx, executionKey{}, exec)
+}
+
+func executionFromContext(ctx context.Context) execution {
+	exec, _ := ctx.Value(executionKey{}).(execution)
+	return exec
+}
+
+// claimWin reports whether the attempt which ended with err won the race
+// between the executions of its query. There is no race if no speculative
+// execution was started before the first successful attempt.
+func (e execution) claimWin(err error) bool {
+	return err == nil && e.won != nil && atomic.CompareAndSwapInt32(e.won, 0, 1) &&
+		atomic.LoadInt32(e.speculated) != 0
+}
+
+// PercentileSpeculativeExecutionConfig configures a policy created with
+// NewPercentileSpeculativeExecution.
+type PercentileSpeculativeExecutionConfig struct {
+	// NumAttempts is the maximum number of speculative executions of a query. Required.
+	NumAttempts int
+
+	// Percentile of the observed latency of a statement after which its
+	// speculative executions are started, between 0 and 100.
+	// Default: 95
+	Percentile float64
+
+	// MinDelay is the lower bound of the delay of speculative executions.
+	// Default: 1 millisecond
+	MinDelay time.Duration
+
+	// MaxDelay is the upper bound of the delay of speculative executions.
+	// Default: no upper bound
+	MaxDelay time.Duration
+
+	// DefaultDelay is the delay of speculative executions of statements
+	// whose latency has not been observed at least MinSamples times.
+	// Default: such statements are not speculatively executed
+	DefaultDelay time.Duration
+
+	// MinSamples is the number of observed latencies of a statement required
+	// to compute the percentile.
+	// Default: 100
+	MinSamples int
+
+	// Window is the period over which latencies are observed. Latencies are
+	// kept for at least one and at most two windows.
+	// Default: 1 minute
+	Window time.Duration
+
+	// MaxSpeculativeRate is the maximum number of speculative executions
+	// started per second across all queries using the policy, so that
+	// speculative executions do not amplify an overload of the cluster.
+	// Default: 100
+	MaxSpeculativeRate float64
+}
+
+// PercentileSpeculativeExecution is a SpeculativeExecutionPolicy starting
+// speculative executions of a query once it takes longer than a percentile
+// of the latency observed for its statement, instead of after a fixed delay.
+//
+// The latency of every statement is tracked separately, so a single policy
+// is meant to be shared by the queries of many statements. As with any
+// speculative execution policy, only idempotent queries are speculatively
+// executed.
+type PercentileSpeculativeExecution struct {
+	cfg PercentileSpeculativeExecutionConfig
+
+	mu         sync.Mutex
+	statements map[string]*latencyHistogram
+	tokens     float64
+	refilled   time.Time
+}
+
+// NewPercentileSpeculativeExecution returns a speculative execution policy
+// adapting the delay of speculative executions to the observed latency of
+// statements.
+func NewPercentileSpeculativeExecution(cfg PercentileSpeculativeExecutionConfig) *PercentileSpeculativeExecution {
+	if cfg.NumAttempts <= 0 {
+		panic("gocql: NumAttempts must be positive")
+	}
+	if cfg.Percentile <= 0 || cfg.Percentile >= 100 {
+		cfg.Percentile = defaultSpeculativePercentile
+	}
+	if cfg.MinDelay <= 0 {
+		cfg.MinDelay = defaultSpeculativeMinDelay
+	}
+	if cfg.MaxDelay > 0 && cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = cfg.MinDelay
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = defaultSpeculativeMinSamples
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultSpeculativeWindow
+	}
+	if cfg.MaxSpeculativeRate <= 0 {
+		cfg.MaxSpeculativeRate = defaultSpeculativeRate
+	}
+	return &PercentileSpeculativeExecution{
+		cfg:        cfg,
+		statements: make(map[string]*latencyHistogram),
+		tokens:     math.Max(1, cfg.MaxSpeculativeRate),
+		refilled:   time.Now(),
+	}
+}
+
+func (sp *PercentileSpeculativeExecution) Attempts() int { return sp.cfg.NumAttempts }
+
+// Delay returns the delay of speculative executions of statements whose
+// latency is not known yet. The delay of other statements is computed from
+// their latency.
+func (sp *PercentileSpeculativeExecution) Delay() time.Duration {
+	if sp.cfg.DefaultDelay <= 0 {
+		// must be positive to be used in a ticker
+		return 1
+	}
+	return sp.cfg.DefaultDelay
+}
+
+func (sp *PercentileSpeculativeExecution) delayFor(qry ExecutableQuery) time.Duration {
+	now := time.Now()
+
+	sp.mu.Lock()
+	var delay time.Duration
+	if h, ok := sp.statements[speculativeStatementKey(qry)]; ok {
+		delay = h.percentile(now, sp.cfg.Window, sp.cfg.Percentile, sp.cfg.MinSamples)
+	}
+	sp.mu.Unlock()
+
+	if delay == 0 {
+		return sp.cfg.DefaultDelay
+	}
+	if delay < sp.cfg.MinDelay {
+		delay = sp.cfg.MinDelay
+	}
+	if sp.cfg.MaxDelay > 0 && delay > sp.cfg.MaxDelay {
+		delay = sp.cfg.MaxDelay
+	}
+	return delay
+}
+
+func (sp *PercentileSpeculativeExecution) allowSpeculation() bool {
+	now := time.Now()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.tokens += now.Sub(sp.refilled).Seconds() * sp.cfg.MaxSpeculativeRate
+	if burst := math.Max(1, sp.cfg.MaxSpeculativeRate); sp.tokens > burst {
+		sp.tokens = burst
+	}
+	sp.refilled = now
+	if sp.tokens < 1 {
+		return false
+	}
+	sp.tokens--
+	return true
+}
+
+func (sp *PercentileSpeculativeExecution) trackLatency(qry ExecutableQuery, latency time.Duration, err error) {
+	if !measuresLatency(err) {
+		return
+	}
+	key := speculativeStatementKey(qry)
+	now := time.Now()
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	h, ok := sp.statements[key]
+	if !ok {
+		if len(sp.statements) >= maxSpeculativeStatements {
+			sp.prune(now)
+		}
+		h = &latencyHistogram{rotated: now}
+		sp.statements[key] = h
+	}
+	h.record(now, sp.cfg.Window, latency)
+}
+
+// prune drops the statements whose latency was not recorded for two windows,
+// as none of their latencies are kept. If none of them can be dropped, the
+// statement whose latency was recorded least recently is. sp.mu must be held.
+func (sp *PercentileSpeculativeExecution) prune(now time.Time) {
+	var oldestKey string
+	var oldest *latencyHistogram
+	for key, h := range sp.statements {
+		if now.Sub(h.recorded) >= 2*sp.cfg.Window {
+			delete(sp.statements, key)
+			continue
+		}
+		if oldest == nil || h.recorded.Before(oldest.recorded) {
+			oldestKey, oldest = key, h
+		}
+	}
+	if len(sp.statements) >= maxSpeculativeStatements {
+		delete(sp.statements, oldestKey)
+	}
+}
+
+func speculativeStatementKey(qry ExecutableQuery) string {
+	switch qry := qry.(type) {
+	case *Query:
+		return qry.Keyspace() + "\x00" + qry.stmt
+	case *Batch:
+		var b strings.Builder
+		b.WriteString(qry.Keyspace())
+		for _, entry := range qry.Entries {
+			b.WriteByte(0)
+			b.WriteString(entry.Stmt)
+		}
+		return b.String()
+	default:
+		return ""
+	}
+}
+
+// latencyHistogram is a rolling histogram of latencies with exponentially
+// growing buckets. Latencies are recorded in the current window and the
+// percentiles are computed from the current and the previous window.
+type latencyHistogram struct {
+	rotated  time.Time
+	recorded time.Time
+	current  [latencyHistogramBuckets]uint32
+	previous [latencyHistogramBuckets]uint32
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= latencyHistogramMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(latencyHistogramMin)) / math.Log(latencyHistogramGrowth)))
+	if i >= latencyHistogramBuckets {
+		return latencyHistogramBuckets - 1
+	}
+	return i
+}
+
+// latencyBucketBound returns the upper bound of the bucket.
+func latencyBucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyHistogramMin) * math.Pow(latencyHistogramGrowth, float64(i)))
+}
+
+func (h *latencyHistogram) rotate(now time.Time, window time.Duration) {
+	elapsed := now.Sub(h.rotated)
+	if elapsed < window {
+		return
+	}
+	if elapsed < 2*window {
+		h.previous = h.current
+	} else {
+		h.previous = [latencyHistogramBuckets]uint32{}
+	}
+	h.current = [latencyHistogramBuckets]uint32{}
+	h.rotated = now
+}
+
+func (h *latencyHistogram) record(now time.Time, window, d time.Duration) {
+	h.rotate(now, window)
+	h.recorded = now
+	if i := latencyBucket(d); h.current[i] < math.MaxUint32 {
+		h.current[i]++
+	}
+}
+
+// percentile returns the upper bound of the bucket of the percentile p,
+// or zero if fewer than minSamples latencies were recorded.
+func (h *latencyHistogram) percentile(now time.Time, window time.Duration, p float64, minSamples int) time.Duration {
+	h.rotate(now, window)
+
+	var total uint64
+	for i := range h.current {
+		total += uint64(h.current[i]) + uint64(h.previous[i])
+	}
+	if total == 0 || total < uint64(minSamples) {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(total)))
+	var count uint64
+	for i := range h.current {
+		count += uint64(h.current[i]) + uint64(h.previous[i])
+		if count >= rank {
+			return latencyBucketBound(i)
+		}
+	}
+	return latencyBucketBound(latencyHistogramBuckets - 1)
+}
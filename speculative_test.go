@@ -0,0 +1,233 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type queryObserverFunc func(context.Context, ObservedQuery)
+
+func (f queryObserverFunc) ObserveQuery(ctx context.Context, o ObservedQuery) {
+	f(ctx, o)
+}
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	t.Parallel()
+
+	window := time.Minute
+	now := time.Now()
+	h := &latencyHistogram{rotated: now}
+
+	if d := h.percentile(now, window, 95, 1); d != 0 {
+		t.Fatalf("expected no percentile without samples got %v", d)
+	}
+
+	for i := 0; i < 95; i++ {
+		h.record(now, window, time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		h.record(now, window, 100*time.Millisecond)
+	}
+
+	if d := h.percentile(now, window, 95, 101); d != 0 {
+		t.Fatalf("expected no percentile with fewer than min samples got %v", d)
+	}
+	// buckets grow by 10%, so the percentile is within 10% of the latency
+	if d := h.percentile(now, window, 95, 100); d < time.Millisecond || d > 1100*time.Microsecond {
+		t.Fatalf("expected p95 of about 1ms got %v", d)
+	}
+	if d := h.percentile(now, window, 99, 100); d < 100*time.Millisecond || d > 110*time.Millisecond {
+		t.Fatalf("expected p99 of about 100ms got %v", d)
+	}
+
+	// latencies of the previous window are still used
+	now = now.Add(window)
+	if d := h.percentile(now, window, 95, 100); d < time.Millisecond || d > 1100*time.Microsecond {
+		t.Fatalf("expected p95 of about 1ms got %v", d)
+	}
+	now = now.Add(window)
+	if d := h.percentile(now, window, 95, 1); d != 0 {
+		t.Fatalf("expected latencies older than two windows to be forgotten got %v", d)
+	}
+}
+
+func TestPercentileSpeculativeExecutionDelay(t *testing.T) {
+	t.Parallel()
+
+	sp := NewPercentileSpeculativeExecution(PercentileSpeculativeExecutionConfig{
+		NumAttempts:  1,
+		MinSamples:   10,
+		DefaultDelay: 50 * time.Millisecond,
+		MaxDelay:     20 * time.Millisecond,
+	})
+	fast := &Query{stmt: "fast", routingInfo: &queryRoutingInfo{}}
+	slow := &Query{stmt: "slow", routingInfo: &queryRoutingInfo{}}
+
+	if d := sp.delayFor(fast); d != 50*time.Millisecond {
+		t.Fatalf("expected the default delay got %v", d)
+	}
+
+	for i := 0; i < 10; i++ {
+		sp.trackLatency(fast, 10*time.Microsecond, nil)
+		sp.trackLatency(slow, time.Second, nil)
+		// attempts which did not measure the latency are ignored
+		sp.trackLatency(fast, time.Second, context.Canceled)
+	}
+	if d := sp.delayFor(fast); d != time.Millisecond {
+		t.Fatalf("expected the delay to be raised to MinDelay got %v", d)
+	}
+	if d := sp.delayFor(slow); d != 20*time.Millisecond {
+		t.Fatalf("expected the delay to be capped at MaxDelay got %v", d)
+	}
+}
+
+func TestPercentileSpeculativeExecutionStatements(t *testing.T) {
+	t.Parallel()
+
+	sp := NewPercentileSpeculativeExecution(PercentileSpeculativeExecutionConfig{
+		NumAttempts: 1,
+		MinSamples:  1,
+		Window:      time.Minute,
+	})
+	now := time.Now()
+	for i := 0; i < maxSpeculativeStatements; i++ {
+		recorded := now
+		if i%2 == 0 {
+			// the latencies of the statement are forgotten
+			recorded = now.Add(-2 * time.Minute)
+		}
+		sp.statements[fmt.Sprint(i)] = &latencyHistogram{rotated: recorded, recorded: recorded}
+	}
+
+	// the statements whose latencies are forgotten make room for new ones
+	qry := &Query{stmt: "new", routingInfo: &queryRoutingInfo{}}
+	sp.trackLatency(qry, 10*time.Millisecond, nil)
+	if len(sp.statements) != maxSpeculativeStatements/2+1 {
+		t.Fatalf("expected the statements without latencies to be dropped got %d statements", len(sp.statements))
+	}
+	if d := sp.delayFor(qry); d == 0 {
+		t.Fatal("expected the delay of the new statement to be computed")
+	}
+
+	// the least recently recorded statement makes room once all are recent
+	sp.statements["1"].recorded = now.Add(-time.Minute)
+	for i := 0; len(sp.statements) < maxSpeculativeStatements; i++ {
+		sp.statements[fmt.Sprint("recent", i)] = &latencyHistogram{rotated: now, recorded: now}
+	}
+	sp.trackLatency(&Query{stmt: "newer", routingInfo: &queryRoutingInfo{}}, 10*time.Millisecond, nil)
+	if _, ok := sp.statements["1"]; ok || len(sp.statements) != maxSpeculativeStatements {
+		t.Fatalf("expected the least recently recorded statement to be dropped got %d statements", len(sp.statements))
+	}
+}
+
+func TestPercentileSpeculativeExecutionRate(t *testing.T) {
+	t.Parallel()
+
+	sp := NewPercentileSpeculativeExecution(PercentileSpeculativeExecutionConfig{
+		NumAttempts:        1,
+		MaxSpeculativeRate: 2,
+	})
+	for i := 0; i < 2; i++ {
+		if !sp.allowSpeculation() {
+			t.Fatalf("expected speculative execution %d to be allowed", i)
+		}
+	}
+	if sp.allowSpeculation() {
+		t.Fatal("expected speculative executions to be limited")
+	}
+	time.Sleep(600 * time.Millisecond)
+	if !sp.allowSpeculation() {
+		t.Fatal("expected speculative executions to be allowed again")
+	}
+}
+
+func TestPercentileSpeculativeExecution(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var nodes []*TestServer
+	var addresses []string
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		srv := NewTestServerWithAddress(ip+":0", t, defaultProto, ctx)
+		defer srv.Stop()
+		nodes = append(nodes, srv)
+		addresses = append(addresses, srv.Address)
+	}
+
+	var (
+		mu       sync.Mutex
+		observed []ObservedQuery
+	)
+	cluster := testCluster(defaultProto, addresses...)
+	cluster.QueryObserver = queryObserverFunc(func(_ context.Context, o ObservedQuery) {
+		mu.Lock()
+		observed = append(observed, o)
+		mu.Unlock()
+	})
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sp := NewPercentileSpeculativeExecution(PercentileSpeculativeExecutionConfig{
+		NumAttempts:        1,
+		MinSamples:         1,
+		MaxSpeculativeRate: 1,
+	})
+
+	// no latency is known yet, so the query is not speculatively executed
+	if err := db.Query("slow").Idempotent(true).SetSpeculativeExecutionPolicy(sp).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(observed) != 1 || observed[0].Speculative || observed[0].Won {
+		t.Fatalf("expected a single attempt which didn't race got %+v", observed)
+	}
+	observed = nil
+	mu.Unlock()
+
+	// the latency of slow queries is about 50ms, make it look faster
+	for i := 0; i < 100; i++ {
+		sp.trackLatency(db.Query("slow"), 5*time.Millisecond, nil)
+	}
+	if err := db.Query("slow").Idempotent(true).SetSpeculativeExecutionPolicy(sp).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the losing attempt to be observed
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(observed)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var speculative, won int
+	for _, o := range observed {
+		if o.Speculative {
+			speculative++
+		}
+		if o.Won {
+			won++
+			if o.Speculative {
+				t.Fatal("expected the initial execution to win")
+			}
+		}
+	}
+	if speculative != 1 || won != 1 {
+		t.Fatalf("expected one speculative attempt and one winner got %+v", observed)
+	}
+}
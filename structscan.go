@@ -0,0 +1,351 @@
+package gocql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// structFields caches the field index of every column name of struct types,
+// keyed by reflect.Type.
+var structFields sync.Map
+
+func cachedStructFields(t reflect.Type) map[string][]int {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields, _ := structFields.LoadOrStore(t, typeStructFields(t))
+	return fields.(map[string][]int)
+}
+
+func typeStructFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	// embedded structs are visited breadth first, so that fields of the
+	// outer struct take precedence over the fields they embed.
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	next := []embedded{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, e := range current {
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get("cql")
+				if tag == "-" {
+					continue
+				}
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: sf.Type, index: index})
+					continue
+				}
+				if sf.PkgPath != "" {
+					// unexported
+					continue
+				}
+
+				name := tag
+				if name == "" {
+					name = toSnakeCase(sf.Name)
+				}
+				if _, ok := fields[name]; !ok {
+					fields[name] = index
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// toSnakeCase converts a Go identifier to snake_case, keeping acronyms together,
+// for example UserID becomes user_id and HTTPStatus becomes http_status.
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	b.Grow(len(name) + 4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+					(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// structPlan maps columns, in order, to the fields of a struct type.
+type structPlan struct {
+	typ     reflect.Type
+	columns string
+	fields  [][]int
+}
+
+type structPlanKey struct {
+	typ     reflect.Type
+	columns string
+}
+
+// structPlans caches plans per struct type and column set. Queries selecting
+// many different column sets would grow it without limit, so at most
+// maxStructPlans plans are cached, the others are built on every use.
+var (
+	structPlans     sync.Map
+	structPlanCount int64
+)
+
+const maxStructPlans = 4096
+
+func columnNamesKey(columns []ColumnInfo) string {
+	var b strings.Builder
+	for i, col := range columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(col.Name)
+	}
+	return b.String()
+}
+
+// structPlanFor returns the plan mapping columns to the fields of the struct t.
+func structPlanFor(t reflect.Type, columns []ColumnInfo) (*structPlan, error) {
+	key := structPlanKey{typ: t, columns: columnNamesKey(columns)}
+	if plan, ok := structPlans.Load(key); ok {
+		return plan.(*structPlan), nil
+	}
+
+	fields := cachedStructFields(t)
+	plan := &structPlan{
+		typ:     t,
+		columns: key.columns,
+		fields:  make([][]int, len(columns)),
+	}
+	for i, col := range columns {
+		index, ok := fields[col.Name]
+		if !ok {
+			return nil, fmt.Errorf("gocql: no field in %v for column %q", t, col.Name)
+		}
+		plan.fields[i] = index
+	}
+
+	if atomic.LoadInt64(&structPlanCount) >= maxStructPlans {
+		return plan, nil
+	}
+	actual, loaded := structPlans.LoadOrStore(key, plan)
+	if !loaded {
+		atomic.AddInt64(&structPlanCount, 1)
+	}
+	return actual.(*structPlan), nil
+}
+
+// structValue returns the struct pointed at by ptr.
+func structValue(ptr interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}, fmt.Errorf("gocql: expected a non-nil pointer to a struct, got %T", ptr)
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("gocql: expected a non-nil pointer to a struct, got %T", ptr)
+	}
+	return v, nil
+}
+
+// StructScan consumes the next row of the iterator and copies its columns
+// into the fields of the struct pointed at by dst. Columns are matched to
+// fields by name, see "Scanning into structs" in the package docs. Every
+// column must have a matching field.
+//
+// StructScan returns true if the row was successfully unmarshaled or false if
+// the end of the result set was reached or if an error occurred. Close should
+// be called afterwards to retrieve any potential errors.
+func (iter *Iter) StructScan(dst interface{}) bool {
+	if iter.err != nil {
+		return false
+	}
+
+	if iter.pos >= iter.numRows {
+		if iter.next != nil {
+			*iter = *iter.next.fetch()
+			return iter.StructScan(dst)
+		}
+		return false
+	}
+
+	if iter.next != nil && iter.pos >= iter.next.pos {
+		iter.next.fetchAsync()
+	}
+
+	v, err := structValue(dst)
+	if err != nil {
+		iter.err = err
+		return false
+	}
+
+	plan := iter.structPlan
+	if plan == nil || plan.typ != v.Type() {
+		if plan, err = structPlanFor(v.Type(), iter.meta.columns); err != nil {
+			iter.err = err
+			return false
+		}
+		// the metadata of an iterator does not change, a new page is a new iterator
+		iter.structPlan = plan
+	}
+
+	for i, col := range iter.meta.columns {
+		colBytes, err := iter.readColumn()
+		if err != nil {
+			iter.err = err
+			return false
+		}
+
+		field := v.FieldByIndex(plan.fields[i]).Addr().Interface()
+		if err := Unmarshal(col.TypeInfo, colBytes, field); err != nil {
+			iter.err = fmt.Errorf("gocql: can not scan column %q: %w", col.Name, err)
+			return false
+		}
+	}
+
+	iter.pos++
+	return true
+}
+
+// ScanStruct executes the query, copies the columns of the first selected
+// row into the fields of the struct pointed at by dst and discards the rest.
+// If no rows were selected, ErrNotFound is returned.
+func (q *Query) ScanStruct(dst interface{}) error {
+	iter := q.Iter()
+	if err := iter.checkErrAndNotFound(); err != nil {
+		return err
+	}
+	iter.StructScan(dst)
+	return iter.Close()
+}
+
+// BindStruct binds the fields of the struct src, or the struct it points to,
+// as the query arguments. Bind variables are matched to fields by name when
+// the query is executed, using the metadata of the prepared statement, so
+// named markers (:name) and positional markers (?) are both supported, the
+// latter by the name of the column they are bound to.
+//
+// Like Session.Bind it only works with statements which are prepared. As the
+// values are only known at execution time the routing key is not computed
+// from them, set it with RoutingKey to enable token aware routing.
+func (q *Query) BindStruct(src interface{}) *Query {
+	q.values = nil
+	q.pageState = nil
+	q.binding = structBinding(src)
+	return q
+}
+
+func structBinding(src interface{}) func(*QueryInfo) ([]interface{}, error) {
+	return func(info *QueryInfo) ([]interface{}, error) {
+		v := reflect.ValueOf(src)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, fmt.Errorf("gocql: can not bind nil %T", src)
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("gocql: expected a struct or a pointer to a struct, got %T", src)
+		}
+
+		plan, err := structPlanFor(v.Type(), info.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, len(plan.fields))
+		for i, index := range plan.fields {
+			values[i] = v.FieldByIndex(index).Interface()
+		}
+		return values, nil
+	}
+}
+
+// rowDecoder decodes whole rows into values of a Go type. It is compiled
+// once from the columns of a result and reused for every row of all pages.
+type rowDecoder struct {
+	// fields maps columns to struct fields. It is nil if the result has a
+	// single column which is unmarshaled into the value itself.
+	fields [][]int
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// newRowDecoder compiles a decoder of columns into t. Structs are decoded
+// by column names like in StructScan, or by position if the names do not
+// match but the number of fields does, so that a struct can be used as a
+// tuple of the selected columns. Any other type can only be decoded from a
+// single column.
+func newRowDecoder(t reflect.Type, columns []ColumnInfo) (*rowDecoder, error) {
+	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(unmarshalerType) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("gocql: can not decode %d columns into %v", len(columns), t)
+		}
+		return &rowDecoder{}, nil
+	}
+
+	plan, err := structPlanFor(t, columns)
+	if err == nil {
+		return &rowDecoder{fields: plan.fields}, nil
+	}
+
+	// a single user defined type or tuple column is decoded into the struct itself
+	if len(columns) == 1 {
+		switch columns[0].TypeInfo.Type() {
+		case TypeUDT, TypeTuple:
+			return &rowDecoder{}, nil
+		}
+	}
+
+	var fields [][]int
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Tag.Get("cql") == "-" {
+			continue
+		}
+		fields = append(fields, []int{i})
+	}
+	switch {
+	case len(fields) == len(columns):
+		return &rowDecoder{fields: fields}, nil
+	case len(columns) == 1:
+		// structs like time.Time which are unmarshaled as a whole
+		return &rowDecoder{}, nil
+	}
+	// report the mismatching names, as it is the more likely intent
+	return nil, err
+}
+
+// decode unmarshals the raw columns of a row into the value pointed at by v.
+func (d *rowDecoder) decode(columns []ColumnInfo, row [][]byte, v reflect.Value) error {
+	if d.fields == nil {
+		return Unmarshal(columns[0].TypeInfo, row[0], v.Interface())
+	}
+
+	v = v.Elem()
+	for i, col := range columns {
+		field := v.FieldByIndex(d.fields[i]).Addr().Interface()
+		if err := Unmarshal(col.TypeInfo, row[i], field); err != nil {
+			return fmt.Errorf("gocql: can not decode column %q: %w", col.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql/internal/tests/mock"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"Name":       "name",
+		"UserID":     "user_id",
+		"HTTPStatus": "http_status",
+		"Address2":   "address2",
+		"lastSeenAt": "last_seen_at",
+		"ID":         "id",
+	}
+	for name, expected := range tests {
+		if actual := toSnakeCase(name); actual != expected {
+			t.Errorf("toSnakeCase(%q) = %q, expected %q", name, actual, expected)
+		}
+	}
+}
+
+type structScanBase struct {
+	ID      int `cql:"id"`
+	Created int64
+}
+
+type structScanRow struct {
+	structScanBase
+	UserName string
+	Email    string `cql:"mail"`
+	Ignored  string `cql:"-"`
+	Created  int64  `cql:"created_at"`
+	ignored  string
+	Address  structScanAddress
+	Point    structScanPoint
+}
+
+type structScanAddress struct {
+	Street string `cql:"street"`
+	Zip    int    `cql:"zip"`
+}
+
+type structScanPoint struct {
+	X int
+	Y string
+}
+
+func TestStructFields(t *testing.T) {
+	t.Parallel()
+
+	fields := typeStructFields(reflect.TypeOf(structScanRow{}))
+	expected := map[string][]int{
+		"id":         {0, 0},
+		"created":    {0, 1},
+		"user_name":  {1},
+		"mail":       {2},
+		"created_at": {4},
+		"address":    {6},
+		"point":      {7},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected fields %v got %v", expected, fields)
+	}
+}
+
+type udtPerson struct {
+	Name string
+}
+
+func TestUDTStructFields(t *testing.T) {
+	t.Parallel()
+
+	// unlike the columns of StructScan, the fields of UDTs only match cql
+	// tags or exact field names
+	info := UDTTypeInfo{
+		NativeType: NativeType{proto: 4, typ: TypeUDT},
+		Name:       "person",
+		Elements: []UDTField{
+			{Name: "name", Type: NativeType{proto: 4, typ: TypeVarchar}},
+			{Name: "Name", Type: NativeType{proto: 4, typ: TypeVarchar}},
+		},
+	}
+	data, err := Marshal(info, udtPerson{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unmarshaled struct {
+		Lower string `cql:"name"`
+		Name  string
+	}
+	if err := Unmarshal(info, data, &unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	if unmarshaled.Lower != "" || unmarshaled.Name != "alice" {
+		t.Fatalf("expected only the field Name to be marshaled got %+v", unmarshaled)
+	}
+}
+
+var structScanMetadata = resultMetadata{
+	colCount:       5,
+	actualColCount: 6,
+	columns: []ColumnInfo{
+		{Name: "id", TypeInfo: NativeType{proto: 4, typ: TypeInt}},
+		{Name: "user_name", TypeInfo: NativeType{proto: 4, typ: TypeVarchar}},
+		{Name: "mail", TypeInfo: NativeType{proto: 4, typ: TypeVarchar}},
+		{Name: "address", TypeInfo: UDTTypeInfo{
+			NativeType: NativeType{proto: 4, typ: TypeUDT},
+			Name:       "address",
+			Elements: []UDTField{
+				{Name: "street", Type: NativeType{proto: 4, typ: TypeVarchar}},
+				{Name: "zip", Type: NativeType{proto: 4, typ: TypeInt}},
+			},
+		}},
+		{Name: "point", TypeInfo: TupleTypeInfo{
+			NativeType: NativeType{proto: 4, typ: TypeTuple},
+			Elems: []TypeInfo{
+				NativeType{proto: 4, typ: TypeInt},
+				NativeType{proto: 4, typ: TypeVarchar},
+			},
+		}},
+	},
+}
+
+func TestIterStructScan(t *testing.T) {
+	t.Parallel()
+
+	rows := []structScanRow{
+		{
+			structScanBase: structScanBase{ID: 1},
+			UserName:       "alice",
+			Email:          "alice@example.com",
+			Address:        structScanAddress{Street: "Main St", Zip: 1234},
+			Point:          structScanPoint{X: 1, Y: "a"},
+		},
+		{
+			structScanBase: structScanBase{ID: 2},
+			UserName:       "bob",
+			Email:          "bob@example.com",
+			Address:        structScanAddress{Street: "Side St", Zip: 4321},
+			Point:          structScanPoint{X: 2, Y: "b"},
+		},
+	}
+
+	var data [][]byte
+	for _, row := range rows {
+		data = append(data, marshalMetadataMust(structScanMetadata, []interface{}{
+			row.ID, row.UserName, row.Email, row.Address, row.Point,
+		})...)
+	}
+	iter := &Iter{
+		meta:    structScanMetadata,
+		framer:  &mock.MockFramer{Data: data},
+		numRows: len(rows),
+	}
+
+	var scanned []structScanRow
+	var row structScanRow
+	for iter.StructScan(&row) {
+		scanned = append(scanned, row)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scanned, rows) {
+		t.Fatalf("expected %+v got %+v", rows, scanned)
+	}
+}
+
+func TestIterStructScanMissingField(t *testing.T) {
+	t.Parallel()
+
+	iter := &Iter{
+		meta: structScanMetadata,
+		framer: &mock.MockFramer{Data: marshalMetadataMust(structScanMetadata, []interface{}{
+			1, "alice", "alice@example.com", structScanAddress{}, structScanPoint{},
+		})},
+		numRows: 1,
+	}
+
+	var row struct {
+		ID       int
+		UserName string
+	}
+	if iter.StructScan(&row) {
+		t.Fatal("expected scan to fail")
+	}
+	if err := iter.Close(); err == nil || !strings.Contains(err.Error(), `column "mail"`) {
+		t.Fatalf("expected missing field error got %v", err)
+	}
+
+	iter = &Iter{meta: structScanMetadata, numRows: 1}
+	if iter.StructScan(row) {
+		t.Fatal("expected scan into non-pointer to fail")
+	}
+}
+
+func TestStructBinding(t *testing.T) {
+	t.Parallel()
+
+	info := &QueryInfo{
+		Args: []ColumnInfo{
+			{Name: "mail", TypeInfo: NativeType{proto: 4, typ: TypeVarchar}},
+			{Name: "id", TypeInfo: NativeType{proto: 4, typ: TypeInt}},
+			{Name: "point", TypeInfo: structScanMetadata.columns[4].TypeInfo},
+		},
+	}
+	row := structScanRow{
+		structScanBase: structScanBase{ID: 7},
+		Email:          "carol@example.com",
+		Point:          structScanPoint{X: 3, Y: "c"},
+	}
+
+	for _, src := range []interface{}{row, &row} {
+		values, err := structBinding(src)(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []interface{}{row.Email, row.ID, row.Point}
+		if !reflect.DeepEqual(values, expected) {
+			t.Fatalf("expected values %v got %v", expected, values)
+		}
+	}
+
+	if _, err := structBinding((*structScanRow)(nil))(info); err == nil {
+		t.Fatal("expected error binding nil struct")
+	}
+	if _, err := structBinding(1)(info); err == nil {
+		t.Fatal("expected error binding non struct")
+	}
+
+	info.Args = append(info.Args, ColumnInfo{Name: "unknown"})
+	if _, err := structBinding(row)(info); err == nil {
+		t.Fatal("expected error for bind variable without field")
+	}
+}
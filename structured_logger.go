@@ -0,0 +1,172 @@
+package gocql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel is the level of a message logged to a StructuredLogger. The levels
+// have the values of the matching slog levels.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = -4
+	LogLevelInfo  LogLevel = 0
+	LogLevelWarn  LogLevel = 4
+	LogLevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// Keys of the fields attached to messages logged by the driver.
+const (
+	LogFieldHost   = "host"
+	LogFieldHostID = "host_id"
+	LogFieldShard  = "shard"
+	LogFieldError  = "error"
+)
+
+// LogField is a key/value pair attached to a logged message.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger logs messages with a level and key/value fields, so that
+// they can be filtered by level and parsed. NewSlogLogger adapts a slog.Handler.
+type StructuredLogger interface {
+	// Enabled reports whether messages of level are logged.
+	Enabled(level LogLevel) bool
+	// Log logs msg with fields at level.
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// stdStructuredLogger logs structured messages to a StdLogger, it drops
+// debug messages unless the driver is built with the gocql_debug tag.
+type stdStructuredLogger struct {
+	logger StdLogger
+}
+
+func (l stdStructuredLogger) Enabled(level LogLevel) bool {
+	return level > LogLevelDebug || gocqlDebug
+}
+
+func (l stdStructuredLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("gocql: ")
+	b.WriteString(msg)
+	for _, field := range fields {
+		fmt.Fprintf(&b, " %s=%v", field.Key, field.Value)
+	}
+	l.logger.Println(b.String())
+}
+
+// driverLogger is the logger used by the driver. It logs structured messages
+// and implements StdLogger for messages without a level, which are logged at
+// the info level.
+type driverLogger struct {
+	StructuredLogger
+
+	// std is set if the messages are logged to a StdLogger
+	std StdLogger
+}
+
+func newDriverLogger(std StdLogger, structured StructuredLogger) *driverLogger {
+	if structured != nil {
+		return &driverLogger{StructuredLogger: structured}
+	}
+	if l, ok := std.(*driverLogger); ok {
+		return l
+	}
+	if std == nil {
+		std = &defaultLogger{}
+	}
+	return &driverLogger{StructuredLogger: stdStructuredLogger{logger: std}, std: std}
+}
+
+func (l *driverLogger) Print(v ...interface{}) {
+	if l.std != nil {
+		l.std.Print(v...)
+		return
+	}
+	l.info(strings.TrimSuffix(fmt.Sprint(v...), "\n"))
+}
+
+func (l *driverLogger) Printf(format string, v ...interface{}) {
+	if l.std != nil {
+		l.std.Printf(format, v...)
+		return
+	}
+	l.info(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (l *driverLogger) Println(v ...interface{}) {
+	if l.std != nil {
+		l.std.Println(v...)
+		return
+	}
+	l.info(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+// log logs msg if level is enabled, a nil driverLogger drops all messages.
+func (l *driverLogger) log(level LogLevel, msg string, fields []LogField) {
+	if l != nil && l.Enabled(level) {
+		l.Log(level, msg, fields...)
+	}
+}
+
+func (l *driverLogger) debug(msg string, fields ...LogField) {
+	l.log(LogLevelDebug, msg, fields)
+}
+
+func (l *driverLogger) info(msg string, fields ...LogField) {
+	l.log(LogLevelInfo, msg, fields)
+}
+
+func (l *driverLogger) warn(msg string, fields ...LogField) {
+	l.log(LogLevelWarn, msg, fields)
+}
+
+func (l *driverLogger) error(msg string, fields ...LogField) {
+	l.log(LogLevelError, msg, fields)
+}
+
+func logHost(host *HostInfo) LogField {
+	return LogField{Key: LogFieldHost, Value: host.ConnectAddressAndPort()}
+}
+
+func logHostID(host *HostInfo) LogField {
+	return LogField{Key: LogFieldHostID, Value: host.HostID()}
+}
+
+func logAddr(addr string) LogField {
+	return LogField{Key: LogFieldHost, Value: addr}
+}
+
+func logShard(shard int) LogField {
+	return LogField{Key: LogFieldShard, Value: shard}
+}
+
+func logError(err error) LogField {
+	return LogField{Key: LogFieldError, Value: err}
+}
+
+func logField(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
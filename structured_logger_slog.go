@@ -0,0 +1,33 @@
+//go:build go1.21
+// +build go1.21
+
+package gocql
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// NewSlogLogger returns a StructuredLogger logging to handler:
+//
+//	cluster.StructuredLogger = gocql.NewSlogLogger(slog.NewJSONHandler(os.Stderr, nil))
+func NewSlogLogger(handler slog.Handler) StructuredLogger {
+	return slogLogger{handler: handler}
+}
+
+type slogLogger struct {
+	handler slog.Handler
+}
+
+func (l slogLogger) Enabled(level LogLevel) bool {
+	return l.handler.Enabled(context.Background(), slog.Level(level))
+}
+
+func (l slogLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	record := slog.NewRecord(time.Now(), slog.Level(level), msg, 0)
+	for _, field := range fields {
+		record.AddAttrs(slog.Any(field.Key, field.Value))
+	}
+	_ = l.handler.Handle(context.Background(), record)
+}
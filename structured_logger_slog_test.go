@@ -0,0 +1,34 @@
+//go:build unit && go1.21
+// +build unit,go1.21
+
+package gocql
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	if logger.Enabled(LogLevelDebug) {
+		t.Error("expected debug level to be disabled")
+	}
+	if !logger.Enabled(LogLevelWarn) {
+		t.Error("expected warn level to be enabled")
+	}
+
+	logger.Log(LogLevelWarn, "unable to dial", logAddr("10.0.0.1:9042"), logShard(2), logError(errors.New("refused")))
+	got := buf.String()
+	for _, want := range []string{"level=WARN", `msg="unable to dial"`, "host=10.0.0.1:9042", "shard=2", "error=refused"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+}
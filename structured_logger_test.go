@@ -0,0 +1,116 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"errors"
+	"testing"
+)
+
+type logEntry struct {
+	level  LogLevel
+	msg    string
+	fields []LogField
+}
+
+type recordingLogger struct {
+	level   LogLevel
+	entries []logEntry
+}
+
+func (l *recordingLogger) Enabled(level LogLevel) bool {
+	return level >= l.level
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func TestStdStructuredLogger(t *testing.T) {
+	t.Parallel()
+
+	std := &testLogger{}
+	logger := newDriverLogger(std, nil)
+
+	logger.warn("unable to dial", logAddr("10.0.0.1:9042"), logShard(3), logError(errors.New("refused")))
+	if got, want := std.String(), "gocql: unable to dial host=10.0.0.1:9042 shard=3 error=refused\n"; got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	std.capture.Reset()
+	logger.debug("reconnecting")
+	if got := std.String(); gocqlDebug != (got != "") {
+		t.Errorf("debug message logged with gocqlDebug=%v: %q", gocqlDebug, got)
+	}
+
+	std.capture.Reset()
+	logger.Printf("gocql: %s\n", "unleveled")
+	if got, want := std.String(), "gocql: unleveled\n"; got != want {
+		t.Errorf("expected %q got %q", want, got)
+	}
+
+	if l := newDriverLogger(logger, nil); l != logger {
+		t.Error("expected driver logger not to be wrapped again")
+	}
+}
+
+func TestStructuredLoggerLevels(t *testing.T) {
+	t.Parallel()
+
+	structured := &recordingLogger{level: LogLevelWarn}
+	cfg := NewCluster("127.0.0.1")
+	cfg.StructuredLogger = structured
+	logger := cfg.logger()
+
+	logger.debug("reconnecting", logShard(1))
+	logger.info("connected")
+	logger.warn("unable to refresh ring", logError(errors.New("timeout")))
+	logger.error("unable to reconnect control connection")
+	logger.Println("unleveled")
+
+	if len(structured.entries) != 2 {
+		t.Fatalf("expected 2 entries got %v", structured.entries)
+	}
+	warn := structured.entries[0]
+	if warn.level != LogLevelWarn || warn.msg != "unable to refresh ring" {
+		t.Errorf("unexpected entry %v", warn)
+	}
+	if len(warn.fields) != 1 || warn.fields[0].Key != LogFieldError {
+		t.Errorf("unexpected fields %v", warn.fields)
+	}
+	if structured.entries[1].level != LogLevelError {
+		t.Errorf("unexpected entry %v", structured.entries[1])
+	}
+
+	// messages logged by the connections go to the structured logger as well
+	structured.level = LogLevelInfo
+	connLogger := (&ConnConfig{Logger: logger}).logger()
+	connLogger.Printf("unleveled %d\n", 1)
+	if last := structured.entries[len(structured.entries)-1]; last.level != LogLevelInfo || last.msg != "unleveled 1" {
+		t.Errorf("unexpected entry %v", last)
+	}
+}
+
+func TestDriverLoggerNil(t *testing.T) {
+	t.Parallel()
+
+	var logger *driverLogger
+	logger.warn("dropped", logField("key", "value"))
+}
+
+func TestLogLevelString(t *testing.T) {
+	t.Parallel()
+
+	for level, want := range map[LogLevel]string{
+		LogLevelDebug: "DEBUG",
+		LogLevelInfo:  "INFO",
+		LogLevelWarn:  "WARN",
+		LogLevelError: "ERROR",
+		LogLevel(2):   "LogLevel(2)",
+	} {
+		if got := level.String(); got != want {
+			t.Errorf("expected %q got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package gocql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrThrottlerQueueFull is returned when a request can not be queued by
+	// the RequestThrottler because its queue is full.
+	ErrThrottlerQueueFull = errors.New("gocql: request throttler queue is full")
+	// ErrThrottlerTimeout is returned when a request has been queued by the
+	// RequestThrottler for longer than allowed.
+	ErrThrottlerTimeout = errors.New("gocql: timed out waiting in request throttler queue")
+)
+
+const (
+	defaultThrottlerMaxQueueSize        = 1024
+	defaultThrottlerMaxQueueWait        = time.Second
+	defaultThrottlerRateLimitBackoff    = 10 * time.Millisecond
+	defaultThrottlerMaxRateLimitBackoff = time.Second
+
+	// maxPartitionBackoffs bounds the number of partitions slowed down at once.
+	maxPartitionBackoffs = 10000
+)
+
+// ThrottledRequest describes a request attempt passed to a RequestThrottler.
+type ThrottledRequest struct {
+	// Host the attempt is going to be sent to.
+	Host *HostInfo
+
+	Keyspace string
+	Table    string
+
+	// RoutingKey of the partition the request is targeting, nil if not known.
+	RoutingKey []byte
+}
+
+// RequestThrottler controls the rate at which requests are sent to hosts.
+// Every attempt of a query or batch, including retries and speculative
+// executions, has to be admitted by the throttler before it is sent.
+//
+// Implementations must be safe for concurrent use.
+type RequestThrottler interface {
+	// Acquire blocks until the request may be sent or ctx is done. If the
+	// request is admitted, release has to be called with the result of the
+	// attempt once it completes. Otherwise an error is returned, which fails
+	// the attempt and is passed to the retry policy.
+	Acquire(ctx context.Context, req ThrottledRequest) (release func(err error), err error)
+
+	// QueueDepth returns the number of requests currently waiting to be admitted.
+	QueueDepth() int
+}
+
+// partitionBackoff slows down requests to partitions for which the server
+// reported RequestErrRateLimitReached. The delay doubles with every
+// rejection and is cleared by the first successful request.
+type partitionBackoff struct {
+	initial time.Duration
+	max     time.Duration
+
+	mu         sync.Mutex
+	partitions map[string]*partitionBackoffState
+}
+
+type partitionBackoffState struct {
+	delay time.Duration
+	until time.Time
+}
+
+func newPartitionBackoff(initial, max time.Duration) *partitionBackoff {
+	if initial <= 0 {
+		initial = defaultThrottlerRateLimitBackoff
+	}
+	if max <= 0 {
+		max = defaultThrottlerMaxRateLimitBackoff
+	}
+	if max < initial {
+		max = initial
+	}
+	return &partitionBackoff{
+		initial:    initial,
+		max:        max,
+		partitions: make(map[string]*partitionBackoffState),
+	}
+}
+
+func partitionBackoffKey(req ThrottledRequest) string {
+	if len(req.RoutingKey) == 0 {
+		return ""
+	}
+	return req.Keyspace + "." + req.Table + "\x00" + string(req.RoutingKey)
+}
+
+// wait blocks until the partition of the request is no longer slowed down.
+func (b *partitionBackoff) wait(ctx context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+	b.mu.Lock()
+	state, ok := b.partitions[key]
+	var until time.Time
+	if ok {
+		until = state.until
+	}
+	b.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observe updates the backoff of the partition with the result of a request.
+func (b *partitionBackoff) observe(key string, err error) {
+	if key == "" {
+		return
+	}
+	var rateLimitErr *RequestErrRateLimitReached
+	limited := errors.As(err, &rateLimitErr)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.partitions[key]
+	if !limited {
+		if ok && err == nil {
+			delete(b.partitions, key)
+		}
+		return
+	}
+
+	now := time.Now()
+	if !ok {
+		if len(b.partitions) >= maxPartitionBackoffs {
+			b.prune(now)
+		}
+		state = &partitionBackoffState{delay: b.initial}
+		b.partitions[key] = state
+	} else if state.delay *= 2; state.delay > b.max {
+		state.delay = b.max
+	}
+	state.until = now.Add(state.delay)
+}
+
+// prune removes expired backoffs, or all of them if none expired.
+func (b *partitionBackoff) prune(now time.Time) {
+	for key, state := range b.partitions {
+		if state.until.Before(now) {
+			delete(b.partitions, key)
+		}
+	}
+	if len(b.partitions) >= maxPartitionBackoffs {
+		b.partitions = make(map[string]*partitionBackoffState)
+	}
+}
+
+// ConcurrencyThrottlerConfig configures a throttler created with NewConcurrencyThrottler.
+type ConcurrencyThrottlerConfig struct {
+	// MaxInFlightPerHost is the maximum number of requests in flight to a
+	// single host. Keeping it below the number of streams of the host's
+	// connections makes requests wait for a stream instead of failing with
+	// ErrNoStreams. Required.
+	MaxInFlightPerHost int
+
+	// MaxQueueSize is the maximum number of requests waiting for a single
+	// host. Requests exceeding it fail with ErrThrottlerQueueFull.
+	// Default: 1024
+	MaxQueueSize int
+
+	// MaxQueueWait is the maximum time a request waits to be admitted before
+	// failing with ErrThrottlerTimeout.
+	// Default: 1 second
+	MaxQueueWait time.Duration
+
+	// RateLimitBackoff is the initial delay of requests to a partition after
+	// the server rejected a request to it with RequestErrRateLimitReached.
+	// The delay doubles with every rejection up to MaxRateLimitBackoff.
+	// Default: 10 milliseconds
+	RateLimitBackoff time.Duration
+
+	// MaxRateLimitBackoff is the maximum delay of requests to a rate limited partition.
+	// Default: 1 second
+	MaxRateLimitBackoff time.Duration
+}
+
+// ConcurrencyThrottler limits the number of requests in flight to every host
+// and queues the requests exceeding the limit.
+type ConcurrencyThrottler struct {
+	cfg     ConcurrencyThrottlerConfig
+	backoff *partitionBackoff
+
+	mu     sync.Mutex
+	hosts  map[string]*concurrencyThrottlerHost
+	queued int
+}
+
+type concurrencyThrottlerHost struct {
+	inFlight int
+	// waiters are closed in order when a request is admitted
+	waiters []chan struct{}
+}
+
+// NewConcurrencyThrottler returns a RequestThrottler limiting the number of
+// requests in flight to every host.
+func NewConcurrencyThrottler(cfg ConcurrencyThrottlerConfig) *ConcurrencyThrottler {
+	if cfg.MaxInFlightPerHost <= 0 {
+		panic("gocql: MaxInFlightPerHost must be positive")
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = defaultThrottlerMaxQueueSize
+	}
+	if cfg.MaxQueueWait <= 0 {
+		cfg.MaxQueueWait = defaultThrottlerMaxQueueWait
+	}
+	return &ConcurrencyThrottler{
+		cfg:     cfg,
+		backoff: newPartitionBackoff(cfg.RateLimitBackoff, cfg.MaxRateLimitBackoff),
+		hosts:   make(map[string]*concurrencyThrottlerHost),
+	}
+}
+
+func (t *ConcurrencyThrottler) Acquire(ctx context.Context, req ThrottledRequest) (func(error), error) {
+	key := partitionBackoffKey(req)
+	if err := t.backoff.wait(ctx, key); err != nil {
+		return nil, err
+	}
+
+	hostID := hostKey(req.Host)
+	t.mu.Lock()
+	host, ok := t.hosts[hostID]
+	if !ok {
+		host = &concurrencyThrottlerHost{}
+		t.hosts[hostID] = host
+	}
+	if host.inFlight < t.cfg.MaxInFlightPerHost && len(host.waiters) == 0 {
+		host.inFlight++
+		t.mu.Unlock()
+		return t.releaseFunc(host, key), nil
+	}
+	if len(host.waiters) >= t.cfg.MaxQueueSize {
+		t.mu.Unlock()
+		return nil, ErrThrottlerQueueFull
+	}
+	admitted := make(chan struct{})
+	host.waiters = append(host.waiters, admitted)
+	t.queued++
+	t.mu.Unlock()
+
+	timer := time.NewTimer(t.cfg.MaxQueueWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-admitted:
+		return t.releaseFunc(host, key), nil
+	case <-timer.C:
+		err = ErrThrottlerTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	t.mu.Lock()
+	for i, waiter := range host.waiters {
+		if waiter == admitted {
+			host.waiters = append(host.waiters[:i], host.waiters[i+1:]...)
+			t.queued--
+			t.mu.Unlock()
+			return nil, err
+		}
+	}
+	t.mu.Unlock()
+
+	// the request has been admitted in the meantime, pass its slot on
+	t.release(host)
+	return nil, err
+}
+
+func (t *ConcurrencyThrottler) releaseFunc(host *concurrencyThrottlerHost, key string) func(error) {
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			t.backoff.observe(key, err)
+			t.release(host)
+		})
+	}
+}
+
+func (t *ConcurrencyThrottler) release(host *concurrencyThrottlerHost) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(host.waiters) > 0 {
+		// the slot is handed over to the first waiting request
+		close(host.waiters[0])
+		host.waiters = host.waiters[1:]
+		t.queued--
+		return
+	}
+	host.inFlight--
+}
+
+func (t *ConcurrencyThrottler) QueueDepth() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.queued
+}
+
+// RateThrottlerConfig configures a throttler created with NewRateThrottler.
+type RateThrottlerConfig struct {
+	// RequestsPerSecond is the maximum sustained rate of requests to a single host. Required.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests which can be sent to a host at once
+	// after a period of inactivity.
+	// Default: 1
+	Burst int
+
+	// MaxQueueSize is the maximum number of requests waiting for a single
+	// host. Requests exceeding it fail with ErrThrottlerQueueFull.
+	// Default: 1024
+	MaxQueueSize int
+
+	// MaxQueueWait is the maximum time a request waits to be admitted.
+	// Requests which would have to wait longer fail immediately with
+	// ErrThrottlerTimeout.
+	// Default: 1 second
+	MaxQueueWait time.Duration
+
+	// RateLimitBackoff is the initial delay of requests to a partition after
+	// the server rejected a request to it with RequestErrRateLimitReached.
+	// The delay doubles with every rejection up to MaxRateLimitBackoff.
+	// Default: 10 milliseconds
+	RateLimitBackoff time.Duration
+
+	// MaxRateLimitBackoff is the maximum delay of requests to a rate limited partition.
+	// Default: 1 second
+	MaxRateLimitBackoff time.Duration
+}
+
+// RateThrottler limits the rate of requests to every host with a token
+// bucket and queues the requests exceeding the rate.
+type RateThrottler struct {
+	cfg     RateThrottlerConfig
+	backoff *partitionBackoff
+
+	mu     sync.Mutex
+	hosts  map[string]*rateThrottlerHost
+	queued int
+}
+
+type rateThrottlerHost struct {
+	// tokens is negative when requests are waiting for future tokens
+	tokens float64
+	last   time.Time
+	queued int
+}
+
+// NewRateThrottler returns a RequestThrottler limiting the rate of requests
+// to every host.
+func NewRateThrottler(cfg RateThrottlerConfig) *RateThrottler {
+	if cfg.RequestsPerSecond <= 0 {
+		panic("gocql: RequestsPerSecond must be positive")
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = defaultThrottlerMaxQueueSize
+	}
+	if cfg.MaxQueueWait <= 0 {
+		cfg.MaxQueueWait = defaultThrottlerMaxQueueWait
+	}
+	return &RateThrottler{
+		cfg:     cfg,
+		backoff: newPartitionBackoff(cfg.RateLimitBackoff, cfg.MaxRateLimitBackoff),
+		hosts:   make(map[string]*rateThrottlerHost),
+	}
+}
+
+func (t *RateThrottler) Acquire(ctx context.Context, req ThrottledRequest) (func(error), error) {
+	key := partitionBackoffKey(req)
+	if err := t.backoff.wait(ctx, key); err != nil {
+		return nil, err
+	}
+	release := func(err error) {
+		t.backoff.observe(key, err)
+	}
+
+	hostID := hostKey(req.Host)
+	now := time.Now()
+
+	t.mu.Lock()
+	host, ok := t.hosts[hostID]
+	if !ok {
+		host = &rateThrottlerHost{tokens: float64(t.cfg.Burst), last: now}
+		t.hosts[hostID] = host
+	}
+	host.tokens += now.Sub(host.last).Seconds() * t.cfg.RequestsPerSecond
+	if burst := float64(t.cfg.Burst); host.tokens > burst {
+		host.tokens = burst
+	}
+	host.last = now
+
+	if host.tokens >= 1 {
+		host.tokens--
+		t.mu.Unlock()
+		return release, nil
+	}
+	if host.queued >= t.cfg.MaxQueueSize {
+		t.mu.Unlock()
+		return nil, ErrThrottlerQueueFull
+	}
+	// reserve a future token and wait until it is available
+	wait := time.Duration((1 - host.tokens) / t.cfg.RequestsPerSecond * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); wait > t.cfg.MaxQueueWait || ok && now.Add(wait).After(deadline) {
+		t.mu.Unlock()
+		return nil, ErrThrottlerTimeout
+	}
+	host.tokens--
+	host.queued++
+	t.queued++
+	t.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	t.mu.Lock()
+	host.queued--
+	t.queued--
+	if err != nil {
+		// give the reserved token back
+		host.tokens++
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+func (t *RateThrottler) QueueDepth() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.queued
+}
@@ -0,0 +1,285 @@
+//go:build unit
+// +build unit
+
+package gocql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyThrottler(t *testing.T) {
+	t.Parallel()
+
+	throttler := NewConcurrencyThrottler(ConcurrencyThrottlerConfig{
+		MaxInFlightPerHost: 1,
+		MaxQueueSize:       1,
+		MaxQueueWait:       time.Second,
+	})
+	ctx := context.Background()
+	req := ThrottledRequest{Host: &HostInfo{hostId: "a"}}
+
+	release, err := throttler.Acquire(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// other hosts are not affected
+	if releaseOther, err := throttler.Acquire(ctx, ThrottledRequest{Host: &HostInfo{hostId: "b"}}); err != nil {
+		t.Fatal(err)
+	} else {
+		releaseOther(nil)
+	}
+
+	admitted := make(chan error)
+	go func() {
+		release, err := throttler.Acquire(ctx, req)
+		if err == nil {
+			release(nil)
+		}
+		admitted <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for throttler.QueueDepth() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the request to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := throttler.Acquire(ctx, req); err != ErrThrottlerQueueFull {
+		t.Fatalf("expected %v got %v", ErrThrottlerQueueFull, err)
+	}
+
+	release(nil)
+	// releasing twice has no effect
+	release(nil)
+	if err := <-admitted; err != nil {
+		t.Fatal(err)
+	}
+	if depth := throttler.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue got %d", depth)
+	}
+}
+
+func TestConcurrencyThrottlerTimeout(t *testing.T) {
+	t.Parallel()
+
+	throttler := NewConcurrencyThrottler(ConcurrencyThrottlerConfig{
+		MaxInFlightPerHost: 1,
+		MaxQueueWait:       10 * time.Millisecond,
+	})
+	ctx := context.Background()
+	req := ThrottledRequest{Host: &HostInfo{hostId: "a"}}
+
+	release, err := throttler.Acquire(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := throttler.Acquire(ctx, req); err != ErrThrottlerTimeout {
+		t.Fatalf("expected %v got %v", ErrThrottlerTimeout, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := throttler.Acquire(canceled, req); err != context.Canceled {
+		t.Fatalf("expected %v got %v", context.Canceled, err)
+	}
+	if depth := throttler.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue got %d", depth)
+	}
+
+	// the slot is still available after the queued requests gave up
+	release(nil)
+	release, err = throttler.Acquire(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(nil)
+}
+
+func TestConcurrencyThrottlerLimit(t *testing.T) {
+	t.Parallel()
+
+	const limit = 3
+	throttler := NewConcurrencyThrottler(ConcurrencyThrottlerConfig{MaxInFlightPerHost: limit})
+	req := ThrottledRequest{Host: &HostInfo{hostId: "a"}}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		inFlight int
+		max      int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := throttler.Acquire(context.Background(), req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			inFlight++
+			if inFlight > max {
+				max = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			release(nil)
+		}()
+	}
+	wg.Wait()
+
+	if max > limit {
+		t.Fatalf("expected at most %d requests in flight got %d", limit, max)
+	}
+}
+
+func TestRateThrottler(t *testing.T) {
+	t.Parallel()
+
+	throttler := NewRateThrottler(RateThrottlerConfig{
+		RequestsPerSecond: 100,
+		Burst:             2,
+		MaxQueueWait:      25 * time.Millisecond,
+	})
+	ctx := context.Background()
+	req := ThrottledRequest{Host: &HostInfo{hostId: "a"}}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := throttler.Acquire(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst is admitted immediately, the third request waits for a token
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("expected the request to wait for a token, took only %v", elapsed)
+	}
+
+	// reserve the tokens of the next 20ms, so that the next request would
+	// have to wait longer than MaxQueueWait
+	for i := 0; i < 2; i++ {
+		if _, err := throttler.Acquire(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := throttler.Acquire(ctx, req)
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	timedOut := 0
+	for _, err := range errs {
+		if err == ErrThrottlerTimeout {
+			timedOut++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if timedOut == 0 {
+		t.Fatal("expected requests exceeding MaxQueueWait to time out")
+	}
+	if depth := throttler.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue got %d", depth)
+	}
+}
+
+func TestPartitionBackoff(t *testing.T) {
+	t.Parallel()
+
+	b := newPartitionBackoff(10*time.Millisecond, 25*time.Millisecond)
+	key := partitionBackoffKey(ThrottledRequest{Keyspace: "ks", Table: "t", RoutingKey: []byte{1}})
+	rateLimited := &RequestErrRateLimitReached{}
+
+	delay := func() time.Duration {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if state, ok := b.partitions[key]; ok {
+			return state.delay
+		}
+		return 0
+	}
+
+	for _, expected := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond} {
+		b.observe(key, &QueryError{err: rateLimited})
+		if d := delay(); d != expected {
+			t.Fatalf("expected delay %v got %v", expected, d)
+		}
+	}
+
+	start := time.Now()
+	if err := b.wait(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("expected the request to be delayed, took only %v", elapsed)
+	}
+
+	// other errors keep the backoff, a success clears it
+	b.observe(key, ErrTimeoutNoResponse)
+	if d := delay(); d == 0 {
+		t.Fatal("expected the backoff to be kept")
+	}
+	b.observe(key, nil)
+	if d := delay(); d != 0 {
+		t.Fatalf("expected the backoff to be cleared got %v", d)
+	}
+
+	// requests without a routing key are never delayed
+	b.observe("", rateLimited)
+	if len(b.partitions) != 0 {
+		t.Fatalf("unexpected backoffs %v", b.partitions)
+	}
+}
+
+func TestSessionRequestThrottler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	throttler := NewConcurrencyThrottler(ConcurrencyThrottlerConfig{MaxInFlightPerHost: 1})
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.RequestThrottler = throttler
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var queries []ExecutableQuery
+	for i := 0; i < 3; i++ {
+		queries = append(queries, db.Query("slow"))
+	}
+	start := time.Now()
+	if errs := db.ExecuteConcurrently(ctx, 0, queries, nil); errs != nil {
+		t.Fatalf("expected no errors got %v", errs)
+	}
+	// every slow query takes 50ms and only one of them is sent at a time
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected queries to be throttled, took only %v", elapsed)
+	}
+	if depth := throttler.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue got %d", depth)
+	}
+}
@@ -171,19 +171,28 @@ type tokenRing struct {
 	hosts []*HostInfo
 }
 
+// newPartitioner returns the partitioner with the given class name.
+func newPartitioner(name string) (Partitioner, error) {
+	switch {
+	case strings.HasSuffix(name, "Murmur3Partitioner"):
+		return murmur3Partitioner{}, nil
+	case strings.HasSuffix(name, "OrderedPartitioner"):
+		return orderedPartitioner{}, nil
+	case strings.HasSuffix(name, "RandomPartitioner"):
+		return randomPartitioner{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported partitioner '%s'", name)
+	}
+}
+
 func newTokenRing(partitioner string, hosts []*HostInfo) (*tokenRing, error) {
 	tokenRing := &tokenRing{
 		hosts: hosts,
 	}
 
-	if strings.HasSuffix(partitioner, "Murmur3Partitioner") {
-		tokenRing.partitioner = murmur3Partitioner{}
-	} else if strings.HasSuffix(partitioner, "OrderedPartitioner") {
-		tokenRing.partitioner = orderedPartitioner{}
-	} else if strings.HasSuffix(partitioner, "RandomPartitioner") {
-		tokenRing.partitioner = randomPartitioner{}
-	} else {
-		return nil, fmt.Errorf("unsupported partitioner '%s'", partitioner)
+	var err error
+	if tokenRing.partitioner, err = newPartitioner(partitioner); err != nil {
+		return nil, err
 	}
 
 	for _, host := range hosts {
@@ -1,7 +1,12 @@
 package gocql
 
+import (
+	"sort"
+	"sync"
+)
+
 type DefaultWarningHandler struct {
-	logger StdLogger
+	logger *driverLogger
 }
 
 func DefaultWarningHandlerBuilder(session *Session) WarningHandler {
@@ -14,10 +19,12 @@ func (d DefaultWarningHandler) HandleWarnings(qry ExecutableQuery, host *HostInf
 	if d.logger == nil {
 		return
 	}
-	if host != nil && len(host.hostId) > 0 {
-		d.logger.Printf("[%s] warnings: %v", host.hostId, warnings)
-	} else {
-		d.logger.Printf("Cluster warnings: %v", warnings)
+	for _, w := range ParseServerWarnings(qry, warnings) {
+		fields := []LogField{logField("warning_type", w.Type), logField("statement", w.Statement)}
+		if host != nil {
+			fields = append(fields, logHost(host), logHostID(host))
+		}
+		d.logger.warn("server warning: "+w.Message, fields...)
 	}
 }
 
@@ -26,3 +33,128 @@ var _ WarningHandler = DefaultWarningHandler{}
 func NoopWarningHandlerBuilder(session *Session) WarningHandler {
 	return nil
 }
+
+// WarningCount is the number of server warnings of a type received for a
+// table, returned by AggregatingWarningHandler.Counts.
+type WarningCount struct {
+	Type ServerWarningType
+	// Table is the table the warnings are about, qualified with its keyspace,
+	// or empty if they are not about a known table.
+	Table string
+	Count uint64
+
+	// Max is the largest size of the batch size and large partition warnings,
+	// the largest number of tombstones of the tombstone warnings, or the
+	// largest number of partitions of the unlogged batch warnings.
+	Max int64
+
+	// Last is the latest warning.
+	Last ServerWarning
+}
+
+type warningCountKey struct {
+	typ   ServerWarningType
+	table string
+}
+
+// AggregatingWarningHandler counts the server warnings by type and table,
+// so that alerts can be raised on them, and passes them on to another
+// handler:
+//
+//	warnings := gocql.NewAggregatingWarningHandler()
+//	cluster.WarningsHandlerBuilder = warnings.Builder(gocql.DefaultWarningHandlerBuilder)
+type AggregatingWarningHandler struct {
+	mu     sync.Mutex
+	counts map[warningCountKey]*WarningCount
+}
+
+// NewAggregatingWarningHandler returns a handler which doesn't pass the
+// warnings on, use Builder to set the handler they are passed to.
+func NewAggregatingWarningHandler() *AggregatingWarningHandler {
+	return &AggregatingWarningHandler{counts: make(map[warningCountKey]*WarningCount)}
+}
+
+// Builder returns a builder of warning handlers counting the warnings of
+// sessions in h, which pass the warnings on to the handler built by next for
+// the session if it is not nil.
+func (h *AggregatingWarningHandler) Builder(next WarningHandlerBuilder) WarningHandlerBuilder {
+	return func(session *Session) WarningHandler {
+		if next == nil {
+			return h
+		}
+		return &aggregatingSessionWarningHandler{counts: h, next: next(session)}
+	}
+}
+
+func (h *AggregatingWarningHandler) HandleWarnings(qry ExecutableQuery, host *HostInfo, warnings []string) {
+	parsed := ParseServerWarnings(qry, warnings)
+
+	h.mu.Lock()
+	for _, w := range parsed {
+		key := warningCountKey{typ: w.Type, table: w.Table()}
+		count, ok := h.counts[key]
+		if !ok {
+			count = &WarningCount{Type: key.typ, Table: key.table}
+			h.counts[key] = count
+		}
+		count.Count++
+		if v := warningMagnitude(w); v > count.Max {
+			count.Max = v
+		}
+		count.Last = w
+	}
+	h.mu.Unlock()
+}
+
+// Counts returns the warning counts sorted by type and table.
+func (h *AggregatingWarningHandler) Counts() []WarningCount {
+	h.mu.Lock()
+	counts := make([]WarningCount, 0, len(h.counts))
+	for _, count := range h.counts {
+		counts = append(counts, *count)
+	}
+	h.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Type != counts[j].Type {
+			return counts[i].Type < counts[j].Type
+		}
+		return counts[i].Table < counts[j].Table
+	})
+	return counts
+}
+
+// Reset drops the warning counts.
+func (h *AggregatingWarningHandler) Reset() {
+	h.mu.Lock()
+	h.counts = make(map[warningCountKey]*WarningCount)
+	h.mu.Unlock()
+}
+
+func warningMagnitude(w ServerWarning) int64 {
+	switch w.Type {
+	case BatchSizeExceededWarning, LargePartitionWarning:
+		return w.Size
+	case TombstoneThresholdWarning:
+		return w.Tombstones
+	case UnloggedBatchAcrossPartitionsWarning:
+		return w.Partitions
+	}
+	return 0
+}
+
+var _ WarningHandler = (*AggregatingWarningHandler)(nil)
+
+// aggregatingSessionWarningHandler is the warning handler of a session built
+// by AggregatingWarningHandler.Builder.
+type aggregatingSessionWarningHandler struct {
+	counts *AggregatingWarningHandler
+	next   WarningHandler
+}
+
+func (h *aggregatingSessionWarningHandler) HandleWarnings(qry ExecutableQuery, host *HostInfo, warnings []string) {
+	h.counts.HandleWarnings(qry, host, warnings)
+	if h.next != nil {
+		h.next.HandleWarnings(qry, host, warnings)
+	}
+}